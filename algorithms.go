@@ -0,0 +1,370 @@
+package imghash
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// Algorithm versions recorded in envelopes. A version must be bumped
+// whenever a change makes the same options produce different hashes.
+const (
+	averageVersion        = 1
+	differenceVersion     = 1
+	medianVersion         = 1
+	phashVersion          = 1
+	blockMeanVersion      = 1
+	marrHildrethVersion   = 1
+	radialVarianceVersion = 1
+	colorMomentVersion    = 1
+	cldVersion            = 1
+	ehdVersion            = 1
+	whashVersion          = 1
+	lbpVersion            = 1
+	hogHashVersion        = 1
+	bovwVersion           = 1
+	pdqVersion            = 2
+	rashVersion           = 1
+	zernikeVersion        = 1
+	gistVersion           = 1
+	ensembleVersion       = 1
+	cropResistantVersion  = 1
+)
+
+func init() {
+	for _, a := range builtinAlgorithms() {
+		if err := Register(a); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func builtinAlgorithms() []Algorithm {
+	return []Algorithm{
+		builtin("average", averageVersion, hashtype.KindBinary, NewAverage,
+			func(a Average) map[string]any { return a.baseConfig.params() },
+			sizeParam(8, 8), interpolationParam(Bilinear), distanceParam),
+		builtin("difference", differenceVersion, hashtype.KindBinary, NewDifference,
+			func(d Difference) map[string]any { return d.baseConfig.params() },
+			sizeParam(8, 8), interpolationParam(Bilinear), distanceParam),
+		builtin("median", medianVersion, hashtype.KindBinary, NewMedian,
+			func(m Median) map[string]any { return m.baseConfig.params() },
+			sizeParam(8, 8), interpolationParam(Bilinear), distanceParam),
+		builtin("phash", phashVersion, hashtype.KindBinary, NewPHash,
+			func(p PHash) map[string]any { return p.baseConfig.params() },
+			sizeParam(32, 32), interpolationParam(BilinearExact), weightsParam, distanceParam),
+		builtin("blockmean", blockMeanVersion, hashtype.KindBinary, NewBlockMean,
+			func(b BlockMean) map[string]any {
+				p := b.baseConfig.params()
+				p["block_size"] = formatDims(b.bWidth, b.bHeight)
+				p["block_mean_method"] = b.method.String()
+				return p
+			},
+			sizeParam(256, 256), interpolationParam(BilinearExact),
+			Param{Name: "block_size", Type: ParamDims, Default: "16x16", Doc: "block dimensions (WithBlockSize)"},
+			Param{Name: "block_mean_method", Type: ParamEnum, Default: Direct.String(), Values: blockMeanMethodNames[:], Doc: "block construction method (WithBlockMeanMethod)"},
+			distanceParam),
+		builtin("marrhildreth", marrHildrethVersion, hashtype.KindBinary, NewMarrHildreth,
+			func(m MarrHildreth) map[string]any {
+				p := m.baseConfig.params()
+				p["scale"] = m.scale
+				p["alpha"] = m.alpha
+				p["kernel_size"] = m.kernel
+				p["sigma"] = m.sigma
+				return p
+			},
+			sizeParam(512, 512), interpolationParam(Bicubic),
+			Param{Name: "scale", Type: ParamFloat, Default: 1.0, Doc: "Marr-Hildreth scale (WithScale)"},
+			Param{Name: "alpha", Type: ParamFloat, Default: 2.0, Doc: "Marr-Hildreth alpha (WithAlpha)"},
+			kernelSizeParam(7), sigmaParam(0), distanceParam),
+		builtin("radialvariance", radialVarianceVersion, hashtype.KindUInt8, NewRadialVariance,
+			func(r RadialVariance) map[string]any {
+				return r.border.params(r.alphaPolicy.params(map[string]any{"sigma": r.sigma, "angles": r.angles}))
+			},
+			sigmaParam(1),
+			Param{Name: "angles", Type: ParamInt, Default: 180, Doc: "number of projection angles (WithAngles)"},
+			distanceParam),
+		builtin("colormoment", colorMomentVersion, hashtype.KindFloat64, NewColorMoment,
+			func(c ColorMoment) map[string]any {
+				p := c.baseConfig.params()
+				p["kernel_size"] = c.kernel
+				p["sigma"] = c.sigma
+				return p
+			},
+			sizeParam(512, 512), interpolationParam(Bicubic), kernelSizeParam(3), sigmaParam(0), distanceParam),
+		builtin("cld", cldVersion, hashtype.KindUInt8, NewCLD,
+			func(c CLD) map[string]any { return c.baseConfig.params() },
+			sizeParam(64, 64), interpolationParam(Bilinear), distanceParam),
+		builtin("ehd", ehdVersion, hashtype.KindUInt8, NewEHD,
+			func(e EHD) map[string]any { return e.baseConfig.params() },
+			sizeParam(256, 256), interpolationParam(Bilinear), distanceParam),
+		builtin("whash", whashVersion, hashtype.KindBinary, NewWHash,
+			func(w WHash) map[string]any {
+				p := w.baseConfig.params()
+				p["level"] = w.level
+				return p
+			},
+			sizeParam(8, 8), interpolationParam(Bilinear),
+			Param{Name: "level", Type: ParamInt, Default: 3, Doc: "Haar wavelet decomposition levels (WithLevel)"},
+			distanceParam),
+		builtin("lbp", lbpVersion, hashtype.KindUInt8, NewLBP,
+			func(l LBP) map[string]any {
+				p := l.baseConfig.params()
+				p["grid_size"] = formatDims(l.gridX, l.gridY)
+				return p
+			},
+			sizeParam(256, 256), interpolationParam(Bilinear), gridSizeParam(1, 1), distanceParam),
+		builtin("hoghash", hogHashVersion, hashtype.KindUInt8, NewHOGHash,
+			func(h HOGHash) map[string]any {
+				p := h.baseConfig.params()
+				p["cell_size"] = uint(h.cellSize)
+				p["num_bins"] = uint(h.numBins)
+				return p
+			},
+			sizeParam(256, 256), interpolationParam(Bilinear),
+			Param{Name: "cell_size", Type: ParamUint, Default: uint(8), Doc: "HOG cell size in pixels (WithCellSize)"},
+			Param{Name: "num_bins", Type: ParamUint, Default: uint(9), Doc: "number of orientation bins (WithNumBins)"},
+			distanceParam),
+		bovwAlgorithm(),
+		builtin("pdq", pdqVersion, hashtype.KindBinary, NewPDQ,
+			func(p PDQ) map[string]any {
+				return p.border.params(p.alphaPolicy.params(map[string]any{"interpolation": p.interp.String()}))
+			},
+			interpolationParam(Bilinear), distanceParam),
+		builtin("rash", rashVersion, hashtype.KindBinary, NewRASH,
+			func(r RASH) map[string]any {
+				p := r.baseConfig.params()
+				p["sigma"] = r.sigma
+				p["rings"] = r.rings
+				return p
+			},
+			sizeParam(256, 256), interpolationParam(Bilinear), sigmaParam(1),
+			Param{Name: "rings", Type: ParamInt, Default: 180, Doc: "number of concentric rings (WithRings)"},
+			distanceParam),
+		builtin("zernike", zernikeVersion, hashtype.KindFloat64, NewZernike,
+			func(z Zernike) map[string]any {
+				p := z.baseConfig.params()
+				p["degree"] = z.degree
+				return p
+			},
+			sizeParam(64, 64), interpolationParam(Bilinear),
+			Param{Name: "degree", Type: ParamInt, Default: 8, Doc: "maximum Zernike degree (WithDegree)"},
+			distanceParam),
+		builtin("gist", gistVersion, hashtype.KindFloat64, NewGIST,
+			func(g GIST) map[string]any {
+				p := g.baseConfig.params()
+				p["grid_size"] = formatDims(g.gridX, g.gridY)
+				return p
+			},
+			sizeParam(64, 64), interpolationParam(Bilinear), gridSizeParam(4, 4), distanceParam),
+		ensembleAlgorithm(),
+		cropResistantAlgorithm(),
+	}
+}
+
+func bovwAlgorithm() Algorithm {
+	a := builtin("bovw", bovwVersion, hashtype.KindFloat64, NewBoVW,
+		func(b BoVW) map[string]any {
+			p := b.baseConfig.params()
+			p["bovw_feature"] = b.featureType.String()
+			p["bovw_storage"] = b.storageType.String()
+			p["vocabulary_size"] = uint(b.vocabularySize)
+			p["max_keypoints"] = uint(b.maxKeypoints)
+			switch b.storageType {
+			case BoVWMinHash:
+				p["min_hash_size"] = uint(b.minHashSize)
+			case BoVWSimHash:
+				p["sim_hash_bits"] = uint(b.simHashBits)
+			}
+			return p
+		},
+		sizeParam(256, 256), interpolationParam(Bilinear),
+		Param{Name: "bovw_feature", Type: ParamEnum, Default: BoVWORB.String(), Values: bovwFeatureNames, Doc: "local feature extractor (WithBoVWFeature)"},
+		Param{Name: "bovw_storage", Type: ParamEnum, Default: BoVWHistogram.String(), Values: bovwStorageNames, Doc: "output storage representation (WithBoVWStorage)"},
+		Param{Name: "vocabulary_size", Type: ParamUint, Default: uint(256), Doc: "visual vocabulary size (WithVocabularySize)"},
+		Param{Name: "max_keypoints", Type: ParamUint, Default: uint(500), Doc: "maximum number of keypoints (WithMaxKeypoints)"},
+		Param{Name: "min_hash_size", Type: ParamUint, Default: uint(64), Doc: "MinHash signature length (WithMinHashSize)"},
+		Param{Name: "sim_hash_bits", Type: ParamUint, Default: uint(128), Doc: "SimHash bit length (WithSimHashBits)"},
+		distanceParam)
+	a.HashKind = func(params map[string]any) hashtype.Kind {
+		if params["bovw_storage"] == BoVWSimHash.String() {
+			return hashtype.KindBinary
+		}
+		return hashtype.KindFloat64
+	}
+	return a
+}
+
+// builtin adapts a constructor from this package to an Algorithm. New maps
+// each canonical parameter to its With* option and passes the options to
+// ctor, so validation stays in the constructor. Every built-in algorithm
+// accepts the alpha policy and border cropping parameters.
+func builtin[O any, H HasherComparer](name string, version uint, kind hashtype.Kind, ctor func(...O) (H, error), describe func(H) map[string]any, params ...Param) Algorithm {
+	return Algorithm{
+		Name:    name,
+		Version: version,
+		Kind:    kind,
+		Params:  append(params, alphaModeParam, backgroundParam, cropToleranceParam),
+		New: func(p map[string]any) (HasherComparer, error) {
+			opts := make([]O, 0, len(p))
+			for _, key := range slices.Sorted(maps.Keys(p)) {
+				o, ok := paramOption(key, p[key]).(O)
+				if !ok {
+					return nil, fmt.Errorf("%w %q for %s", ErrUnknownParam, key, name)
+				}
+				opts = append(opts, o)
+			}
+			return ctor(opts...)
+		},
+		Describe: func(h Hasher) (map[string]any, bool) {
+			v, ok := h.(H)
+			if !ok {
+				return nil, false
+			}
+			return describe(v), true
+		},
+	}
+}
+
+// paramOption returns the With* option for a canonical parameter value.
+func paramOption(name string, v any) any {
+	switch name {
+	case "size":
+		w, h, _ := parseDims(v.(string))
+		return WithSize(w, h)
+	case "interpolation":
+		return WithInterpolation(Interpolation(slices.Index(interpolationNames[:], v.(string))))
+	case "kernel_size":
+		return WithKernelSize(v.(int))
+	case "sigma":
+		return WithSigma(v.(float64))
+	case "block_size":
+		w, h, _ := parseDims(v.(string))
+		return WithBlockSize(w, h)
+	case "block_mean_method":
+		return WithBlockMeanMethod(BlockMeanMethod(slices.Index(blockMeanMethodNames[:], v.(string))))
+	case "scale":
+		return WithScale(v.(float64))
+	case "alpha":
+		return WithAlpha(v.(float64))
+	case "angles":
+		return WithAngles(v.(int))
+	case "level":
+		return WithLevel(v.(int))
+	case "grid_size":
+		x, y, _ := parseDims(v.(string))
+		return WithGridSize(x, y)
+	case "cell_size":
+		return WithCellSize(v.(uint))
+	case "num_bins":
+		return WithNumBins(v.(uint))
+	case "rings":
+		return WithRings(v.(int))
+	case "degree":
+		return WithDegree(v.(int))
+	case "weights":
+		return WithWeights(v.([]float64))
+	case "bovw_feature":
+		return WithBoVWFeature(BoVWFeatureType(slices.Index(bovwFeatureNames, v.(string)) + 1))
+	case "bovw_storage":
+		return WithBoVWStorage(BoVWStorageType(slices.Index(bovwStorageNames, v.(string)) + 1))
+	case "vocabulary_size":
+		return WithVocabularySize(v.(uint))
+	case "max_keypoints":
+		return WithMaxKeypoints(v.(uint))
+	case "min_hash_size":
+		return WithMinHashSize(v.(uint))
+	case "sim_hash_bits":
+		return WithSimHashBits(v.(uint))
+	case "segment_limit":
+		return WithSegmentLimit(v.(uint))
+	case "min_segment_size":
+		return WithMinSegmentSize(v.(uint))
+	case "alpha_mode":
+		mode := AlphaMode(slices.Index(alphaModeNames[:], v.(string)))
+		return alphaPolicyOption{cfg: alphaConfig{mode: mode}, setMode: true}
+	case "background":
+		c, _ := parseColor(v.(string))
+		return alphaPolicyOption{cfg: alphaConfig{bg: c}, setBackground: true}
+	case "crop_tolerance":
+		return WithBorderCrop(v.(uint))
+	case "distance":
+		return WithDistance(distanceFuncs[v.(string)])
+	}
+	return nil
+}
+
+var (
+	bovwFeatureNames = []string{BoVWORB.String(), BoVWAKAZE.String()}
+	bovwStorageNames = []string{BoVWHistogram.String(), BoVWMinHash.String(), BoVWSimHash.String()}
+)
+
+// distanceFuncs names the similarity functions accepted by the distance parameter.
+var distanceFuncs = map[string]DistanceFunc{
+	"hamming":   similarity.Hamming,
+	"l1":        similarity.L1,
+	"l2":        similarity.L2,
+	"cosine":    similarity.Cosine,
+	"chisquare": similarity.ChiSquare,
+	"pcc":       similarity.PCC,
+	"jaccard":   similarity.Jaccard,
+}
+
+var distanceParam = Param{
+	Name:        "distance",
+	Type:        ParamEnum,
+	Values:      slices.Sorted(maps.Keys(distanceFuncs)),
+	CompareOnly: true,
+	Doc:         "distance function used by Compare (WithDistance)",
+}
+
+var (
+	alphaModeParam = Param{
+		Name:    "alpha_mode",
+		Type:    ParamEnum,
+		Default: AlphaPremultiply.String(),
+		Values:  alphaModeNames[:],
+		Doc:     "alpha channel handling (WithAlphaPolicy)",
+	}
+	backgroundParam = Param{
+		Name:    "background",
+		Type:    ParamColor,
+		Default: formatColor(white),
+		Doc:     "background colour for the Composite alpha mode (WithAlphaPolicy)",
+	}
+	cropToleranceParam = Param{
+		Name: "crop_tolerance",
+		Type: ParamUint,
+		Doc:  "crops uniform borders with this per-channel tolerance; off when omitted (WithBorderCrop)",
+	}
+)
+
+var weightsParam = Param{
+	Name:        "weights",
+	Type:        ParamFloats,
+	CompareOnly: true,
+	Doc:         "per-byte weights for weighted Hamming distance (WithWeights)",
+}
+
+func sizeParam(w, h uint) Param {
+	return Param{Name: "size", Type: ParamDims, Default: formatDims(w, h), Doc: "resize dimensions (WithSize)"}
+}
+
+func interpolationParam(def Interpolation) Param {
+	return Param{Name: "interpolation", Type: ParamEnum, Default: def.String(), Values: interpolationNames[:], Doc: "resize interpolation method (WithInterpolation)"}
+}
+
+func kernelSizeParam(def int) Param {
+	return Param{Name: "kernel_size", Type: ParamInt, Default: def, Doc: "Gaussian kernel size (WithKernelSize)"}
+}
+
+func sigmaParam(def float64) Param {
+	return Param{Name: "sigma", Type: ParamFloat, Default: def, Doc: "Gaussian standard deviation (WithSigma)"}
+}
+
+func gridSizeParam(x, y uint) Param {
+	return Param{Name: "grid_size", Type: ParamDims, Default: formatDims(x, y), Doc: "grid cells (WithGridSize)"}
+}
@@ -0,0 +1,144 @@
+package imghash
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/ajdnik/imghash/v2/internal/imgproc"
+)
+
+// AlphaMode selects how transparent pixels are treated before an image is
+// hashed.
+type AlphaMode int
+
+// Supported alpha modes.
+const (
+	// AlphaPremultiply hashes colours premultiplied by alpha, the way
+	// image.Image reports them, so transparent pixels count as black. It is
+	// the default and keeps hashes unchanged from earlier versions.
+	AlphaPremultiply AlphaMode = iota
+	// AlphaComposite blends the image over an opaque background colour, as
+	// it is displayed on a page of that colour.
+	AlphaComposite
+	// AlphaIgnore drops the alpha channel and hashes the colours as if every
+	// pixel were opaque.
+	AlphaIgnore
+)
+
+var alphaModeNames = [...]string{
+	AlphaPremultiply: "Premultiply",
+	AlphaComposite:   "Composite",
+	AlphaIgnore:      "Ignore",
+}
+
+func (m AlphaMode) valid() bool {
+	return int(m) >= 0 && int(m) < len(alphaModeNames)
+}
+
+// String returns the name of the alpha mode.
+func (m AlphaMode) String() string {
+	if m.valid() {
+		return alphaModeNames[m]
+	}
+	return "Unknown"
+}
+
+// AlphaPolicy describes how an algorithm handles the alpha channel before
+// converting an image to grayscale or another colour space. Opaque images
+// hash the same under every policy.
+type AlphaPolicy struct {
+	// Mode selects the handling.
+	Mode AlphaMode
+	// Background is the colour AlphaComposite blends onto. Its alpha is
+	// ignored; nil means white.
+	Background color.Color
+}
+
+// alphaConfig is the canonical, comparable form of an AlphaPolicy.
+type alphaConfig struct {
+	mode AlphaMode
+	bg   color.RGBA
+}
+
+var white = color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+// defaultAlphaPolicy is the alpha handling every constructor starts from.
+var defaultAlphaPolicy = alphaConfig{mode: AlphaPremultiply, bg: white}
+
+func newAlphaConfig(p AlphaPolicy) alphaConfig {
+	a := alphaConfig{mode: p.Mode, bg: white}
+	if p.Background != nil {
+		c := color.NRGBAModel.Convert(p.Background).(color.NRGBA)
+		a.bg = color.RGBA{c.R, c.G, c.B, 0xff}
+	}
+	return a
+}
+
+func (a alphaConfig) validate() error {
+	if !a.mode.valid() {
+		return ErrInvalidAlphaMode
+	}
+	return nil
+}
+
+// params records the non-default alpha handling in a parameter map.
+func (a alphaConfig) params(p map[string]any) map[string]any {
+	if a.mode != AlphaPremultiply {
+		p["alpha_mode"] = a.mode.String()
+	}
+	if a.mode == AlphaComposite {
+		p["background"] = formatColor(a.bg)
+	}
+	return p
+}
+
+// flatten applies the policy to img. It reports false, and leaves the
+// image alone, under AlphaPremultiply and for images that are opaque.
+func (a alphaConfig) flatten(img image.Image) (image.Image, bool) {
+	if a.mode == AlphaPremultiply || img == nil {
+		return img, false
+	}
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img, false
+	}
+	if a.mode == AlphaComposite {
+		return imgproc.Composite(img, a.bg), true
+	}
+	return imgproc.DropAlpha(img), true
+}
+
+func formatColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// toColor accepts "#RRGGBB" strings, with or without the hash, and
+// color.Color values.
+func toColor(v any) (string, error) {
+	if c, ok := v.(color.Color); ok {
+		return formatColor(newAlphaConfig(AlphaPolicy{Background: c}).bg), nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%T is not a colour", v)
+	}
+	c, err := parseColor(s)
+	if err != nil {
+		return "", err
+	}
+	return formatColor(c), nil
+}
+
+func parseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("%q is not #RRGGBB", s)
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("%q is not #RRGGBB", s)
+	}
+	return color.RGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 0xff}, nil
+}
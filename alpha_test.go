@@ -0,0 +1,166 @@
+package imghash_test
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+)
+
+// logo draws a transparent 96x96 sticker: a dark ring and a red square on
+// canvas that is transparent but stores the colour hidden.
+func logo(hidden color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 96, 96))
+	for y := range 96 {
+		for x := range 96 {
+			dx, dy := x-48, y-48
+			d := dx*dx + dy*dy
+			switch {
+			case d > 30*30 && d < 40*40:
+				img.SetNRGBA(x, y, color.NRGBA{20, 30, 40, 255})
+			case x > 30 && x < 56 && y > 36 && y < 60:
+				img.SetNRGBA(x, y, color.NRGBA{220, 30, 30, 200})
+			default:
+				img.SetNRGBA(x, y, hidden)
+			}
+		}
+	}
+	return img
+}
+
+func TestWithAlphaPolicy(t *testing.T) {
+	a := logo(color.NRGBA{0, 0, 0, 0})
+	b := logo(color.NRGBA{255, 0, 255, 0})
+	onWhite := image.NewRGBA(a.Bounds())
+	draw.Draw(onWhite, onWhite.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(onWhite, onWhite.Bounds(), a, image.Point{}, draw.Over)
+
+	for _, name := range imghash.Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			h, err := imghash.New(name, map[string]any{"alpha_mode": "Composite"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ha, err := h.Calculate(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hb, err := h.Calculate(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ha, hb) {
+				t.Errorf("hidden colour under transparent pixels changed the hash")
+			}
+			hw, err := h.Calculate(onWhite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ha, hw) {
+				t.Errorf("got %v, want the hash of the logo drawn on white %v", ha, hw)
+			}
+		})
+	}
+}
+
+func TestWithAlphaPolicy_modes(t *testing.T) {
+	a := logo(color.NRGBA{0, 0, 0, 0})
+	b := logo(color.NRGBA{255, 255, 255, 0})
+	tests := []struct {
+		name   string
+		policy imghash.AlphaPolicy
+		same   bool
+	}{
+		{"premultiply", imghash.AlphaPolicy{}, true},
+		{"composite on black", imghash.AlphaPolicy{Mode: imghash.AlphaComposite, Background: color.Black}, true},
+		{"ignore", imghash.AlphaPolicy{Mode: imghash.AlphaIgnore}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			avg, err := imghash.NewAverage(imghash.WithAlphaPolicy(tt.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ha, err := avg.Calculate(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hb, err := avg.Calculate(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := reflect.DeepEqual(ha, hb); got != tt.same {
+				t.Errorf("hashes equal = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
+
+func TestWithAlphaPolicy_opaque(t *testing.T) {
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []imghash.AlphaMode{imghash.AlphaComposite, imghash.AlphaIgnore} {
+		for _, name := range []string{"phash", "pdq", "colormoment"} {
+			def, err := imghash.New(name, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := imghash.New(name, map[string]any{"alpha_mode": mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := def.Calculate(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := h.Calculate(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s %v: opaque image hash changed", name, mode)
+			}
+		}
+	}
+}
+
+func TestWithAlphaPolicy_invalid(t *testing.T) {
+	policy := imghash.WithAlphaPolicy(imghash.AlphaPolicy{Mode: 7})
+	if _, err := imghash.NewPHash(policy); !errors.Is(err, imghash.ErrInvalidAlphaMode) {
+		t.Errorf("PHash: got %v, want %v", err, imghash.ErrInvalidAlphaMode)
+	}
+	if _, err := imghash.NewPDQ(policy); !errors.Is(err, imghash.ErrInvalidAlphaMode) {
+		t.Errorf("PDQ: got %v, want %v", err, imghash.ErrInvalidAlphaMode)
+	}
+	if _, err := imghash.NewRadialVariance(policy); !errors.Is(err, imghash.ErrInvalidAlphaMode) {
+		t.Errorf("RadialVariance: got %v, want %v", err, imghash.ErrInvalidAlphaMode)
+	}
+	if _, err := imghash.New("average", map[string]any{"background": "white"}); !errors.Is(err, imghash.ErrInvalidParam) {
+		t.Errorf("background: got %v, want %v", err, imghash.ErrInvalidParam)
+	}
+}
+
+func TestPrepared_Flatten(t *testing.T) {
+	prep := imghash.Prepare(logo(color.NRGBA{0, 0, 0, 0}))
+	if prep.Flatten(imghash.AlphaPolicy{}) != prep {
+		t.Error("AlphaPremultiply returned a different Prepared image")
+	}
+	policy := imghash.AlphaPolicy{Mode: imghash.AlphaComposite}
+	flat := prep.Flatten(policy)
+	if flat == prep || prep.Flatten(policy) != flat {
+		t.Error("Flatten is not memoised per policy")
+	}
+	if _, _, _, a := flat.Image().At(0, 0).RGBA(); a != 0xffff {
+		t.Errorf("flattened image has alpha %d, want opaque", a)
+	}
+	opaque := imghash.Prepare(image.NewGray(image.Rect(0, 0, 4, 4)))
+	if opaque.Flatten(policy) != opaque {
+		t.Error("opaque image was flattened")
+	}
+}
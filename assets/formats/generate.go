@@ -0,0 +1,165 @@
+//go:build ignore
+
+// Command generate writes the image format fixtures in assets/formats: a
+// 128x128 thumbnail of assets/peppers.jpg stored losslessly as PNG, BMP,
+// TIFF and WebP, so every format decodes to the same pixels. Run it from
+// the repository root:
+//
+//	go run assets/formats/generate.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/image/bmp"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+)
+
+const dir = "assets/formats"
+
+func main() {
+	f, err := os.Open("assets/peppers.jpg")
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := jpeg.Decode(f)
+	_ = f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+	xdraw.CatmullRom.Scale(img, img.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	encoders := map[string]func(io.Writer, *image.NRGBA) error{
+		"peppers.png": func(w io.Writer, m *image.NRGBA) error { return png.Encode(w, m) },
+		"peppers.bmp": func(w io.Writer, m *image.NRGBA) error { return bmp.Encode(w, m) },
+		"peppers.tiff": func(w io.Writer, m *image.NRGBA) error {
+			return tiff.Encode(w, m, &tiff.Options{Compression: tiff.Deflate})
+		},
+		"peppers.webp": encodeWebP,
+	}
+	for name, enc := range encoders {
+		var buf bytes.Buffer
+		if err := enc(&buf, img); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// bitWriter packs values least significant bit first, as VP8L expects.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	w.acc |= v << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+	}
+	return w.buf
+}
+
+// encodeWebP writes an opaque image as lossless WebP (VP8L) without
+// transforms or backward references: every channel value is coded with a
+// flat 8-bit prefix code. The files are large but need no real encoder.
+func encodeWebP(out io.Writer, m *image.NRGBA) error {
+	b := m.Bounds()
+	w := &bitWriter{}
+	w.write(0x2f, 8)
+	w.write(uint64(b.Dx()-1), 14)
+	w.write(uint64(b.Dy()-1), 14)
+	w.write(0, 1) // alpha is not used
+	w.write(0, 3) // version
+	w.write(0, 1) // no transforms
+	w.write(0, 1) // no color cache
+	w.write(0, 1) // no meta prefix codes
+
+	// Green has 256 literals and 24 length prefixes, which stay unused;
+	// red, blue and alpha have 256 literals.
+	flat := func(alphabet int) {
+		w.write(0, 1) // normal code
+		// Code length code: lengths 0 and 8 get one-bit codes. Its lengths
+		// are stored in the order 17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8.
+		w.write(12-4, 4)
+		for _, sym := range []int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8} {
+			if sym == 0 || sym == 8 {
+				w.write(1, 3)
+			} else {
+				w.write(0, 3)
+			}
+		}
+		w.write(0, 1) // every symbol has a length
+		for s := range alphabet {
+			if s < 256 {
+				w.write(1, 1) // length 8
+			} else {
+				w.write(0, 1) // length 0
+			}
+		}
+	}
+	flat(256 + 24)
+	flat(256)
+	flat(256)
+	flat(256)
+	// Distance: simple code with the single symbol 0.
+	w.write(1, 1)
+	w.write(0, 1)
+	w.write(0, 1)
+	w.write(0, 1)
+
+	// Prefix codes are read most significant bit first.
+	literal := func(v uint8) {
+		for i := 7; i >= 0; i-- {
+			w.write(uint64(v>>uint(i)&1), 1)
+		}
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := m.NRGBAAt(x, y)
+			literal(c.G)
+			literal(c.R)
+			literal(c.B)
+			literal(255)
+		}
+	}
+
+	data := w.bytes()
+	chunk := len(data)
+	if chunk%2 == 1 {
+		data = append(data, 0)
+	}
+	var hdr bytes.Buffer
+	hdr.WriteString("RIFF")
+	_ = binary.Write(&hdr, binary.LittleEndian, uint32(4+8+len(data)))
+	hdr.WriteString("WEBPVP8L")
+	_ = binary.Write(&hdr, binary.LittleEndian, uint32(chunk))
+	if _, err := out.Write(hdr.Bytes()); err != nil {
+		return err
+	}
+	_, err := out.Write(data)
+	return err
+}
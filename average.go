@@ -23,7 +23,7 @@ type Average struct {
 // Without options, sensible defaults are used.
 func NewAverage(opts ...AverageOption) (Average, error) {
 	a := Average{
-		baseConfig: baseConfig{width: 8, height: 8, interp: Bilinear},
+		baseConfig: baseConfig{width: 8, height: 8, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 	}
 	for _, o := range opts {
 		o.applyAverage(&a)
@@ -36,8 +36,26 @@ func NewAverage(opts ...AverageOption) (Average, error) {
 
 // Calculate returns a perceptual image hash.
 func (ah Average) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(ah.width, ah.height, img, ah.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return ah.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Binary hash with enough capacity. See IntoHasher.
+func (ah Average) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return ah.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (ah Average) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return ah.calculate(nil, prep)
+}
+
+func (ah Average) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(ah.alphaPolicy).cropBorders(ah.border)
+	g, err := prep.ResizedGray(ah.width, ah.height, ah.interp)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +63,7 @@ func (ah Average) Calculate(img image.Image) (hashtype.Hash, error) {
 	if err != nil {
 		return nil, err
 	}
-	return thresholdHash(g, uint(math.Round(m)))
+	return thresholdHash(dst, g, uint(math.Round(m)))
 }
 
 // Compare computes the Hamming distance between two Average hashes.
@@ -58,3 +76,9 @@ func (ah Average) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
 	}
 	return similarity.Hamming(h1, h2)
 }
+
+// ComparesHamming reports whether Compare returns the Hamming distance,
+// which it does unless WithDistance was given. See HammingComparer.
+func (ah Average) ComparesHamming() bool {
+	return ah.distFunc == nil
+}
@@ -0,0 +1,235 @@
+package imghash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"iter"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+// Batch errors.
+var (
+	// ErrNoHashers is returned by HashAll when no hashers are given or one
+	// of them is nil.
+	ErrNoHashers = errors.New("imghash: at least one non-nil hasher is required")
+	// ErrInvalidWorkers is returned by HashAll when the worker count is not positive.
+	ErrInvalidWorkers = errors.New("imghash: workers must be greater than zero")
+	// ErrEmptySource is returned in a Result whose Source has no image, reader or path.
+	ErrEmptySource = errors.New("imghash: source has no image, reader or path")
+)
+
+// Source is one image in a batch. Exactly one of Image, Open or Path is
+// used, in that order of preference.
+type Source struct {
+	// Key identifies the source in results, e.g. a file path or database ID.
+	Key string
+	// Image is an already decoded image.
+	Image image.Image
+	// Open returns a reader for an encoded image. The reader is closed
+	// after decoding.
+	Open func() (io.ReadCloser, error)
+	// Path is an image file to open and decode.
+	Path string
+}
+
+// FileSource returns a Source that decodes the file at path, keyed by path.
+func FileSource(path string) Source {
+	return Source{Key: path, Path: path}
+}
+
+// Files returns a sequence of FileSource values for paths.
+func Files(paths ...string) iter.Seq[Source] {
+	return func(yield func(Source) bool) {
+		for _, p := range paths {
+			if !yield(FileSource(p)) {
+				return
+			}
+		}
+	}
+}
+
+// Result is the outcome of hashing one Source.
+type Result struct {
+	// Source is the source the result belongs to.
+	Source Source
+	// Index is the position of Source in the input sequence.
+	Index int
+	// Hashes holds one hash per hasher, in the order the hashers were
+	// given. It is nil if the image could not be decoded, and an entry is
+	// nil if that hasher failed.
+	Hashes []hashtype.Hash
+	// Err is the decode error, or the joined errors of the hashers that
+	// failed. Each hasher error is wrapped in a HasherError.
+	Err error
+}
+
+// HasherError reports the failure of one hasher in a batch.
+type HasherError struct {
+	// Hasher is the position of the hasher in the hashers passed to HashAll.
+	Hasher int
+	Err    error
+}
+
+func (e *HasherError) Error() string {
+	return fmt.Sprintf("hasher %d: %v", e.Hasher, e.Err)
+}
+
+func (e *HasherError) Unwrap() error { return e.Err }
+
+// BatchOption configures HashAll.
+type BatchOption interface{ applyBatch(*batchConfig) }
+
+type batchConfig struct {
+	workers int
+	decode  decodeConfig
+}
+
+type workersOption int
+
+func (o workersOption) applyBatch(c *batchConfig) { c.workers = int(o) }
+
+// WithWorkers sets the number of images decoded and hashed concurrently.
+// It defaults to runtime.GOMAXPROCS(0).
+func WithWorkers(n int) BatchOption { return workersOption(n) }
+
+// HashAll decodes every source once and computes a hash with each of the
+// hashers, using a bounded pool of workers. Hashers that implement
+// PreparedHasher share resize and grayscale work through Prepare. Results
+// are streamed in the order they complete; use Result.Index to restore
+// input order. A failed source is reported in its Result and does not stop
+// the batch. Encoded sources are turned upright according to their EXIF
+// orientation unless WithOrientation(false) is passed.
+//
+// The returned sequence can be iterated once. Breaking out of the loop or
+// cancelling ctx stops the batch: no new sources are started and the loop
+// ends after the images already being hashed are finished. Check
+// ctx.Err() after the loop to tell a cancelled batch from a complete one.
+//
+//	results, err := imghash.HashAll(ctx, []imghash.Hasher{phash, pdq, cld}, imghash.Files(paths...))
+//	if err != nil {
+//		return err
+//	}
+//	for r := range results {
+//		if r.Err != nil {
+//			log.Printf("%s: %v", r.Source.Key, r.Err)
+//			continue
+//		}
+//		store(r.Source.Key, r.Hashes)
+//	}
+//
+// Hashers are called concurrently from several goroutines; all hashers
+// in this package are safe for concurrent use.
+func HashAll(ctx context.Context, hashers []Hasher, sources iter.Seq[Source], opts ...BatchOption) (iter.Seq[Result], error) {
+	if len(hashers) == 0 || slices.ContainsFunc(hashers, func(h Hasher) bool { return h == nil }) {
+		return nil, ErrNoHashers
+	}
+	cfg := batchConfig{workers: runtime.GOMAXPROCS(0), decode: decodeConfig{orient: true}}
+	for _, o := range opts {
+		o.applyBatch(&cfg)
+	}
+	if cfg.workers < 1 {
+		return nil, ErrInvalidWorkers
+	}
+	hashers = slices.Clone(hashers)
+
+	return func(yield func(Result) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type job struct {
+			index  int
+			source Source
+		}
+		jobs := make(chan job)
+		results := make(chan Result)
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			defer close(jobs)
+			i := 0
+			for src := range sources {
+				select {
+				case jobs <- job{i, src}:
+				case <-ctx.Done():
+					return
+				}
+				i++
+			}
+		})
+		for range cfg.workers {
+			wg.Go(func() {
+				for j := range jobs {
+					if ctx.Err() != nil {
+						continue
+					}
+					r := hashSource(hashers, j.source, cfg.decode)
+					r.Index = j.index
+					select {
+					case results <- r:
+					case <-ctx.Done():
+					}
+				}
+			})
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		for r := range results {
+			if !yield(r) {
+				break
+			}
+		}
+		cancel()
+		for range results {
+		}
+	}, nil
+}
+
+// hashSource decodes src and runs every hasher on the decoded image,
+// sharing resize and grayscale work through a Prepared image.
+func hashSource(hashers []Hasher, src Source, cfg decodeConfig) Result {
+	r := Result{Source: src}
+	img, err := src.decode(cfg)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	prep := Prepare(img)
+	r.Hashes = make([]hashtype.Hash, len(hashers))
+	var errs []error
+	for i, h := range hashers {
+		hash, err := CalculatePrepared(h, prep)
+		if err != nil {
+			errs = append(errs, &HasherError{Hasher: i, Err: err})
+			continue
+		}
+		r.Hashes[i] = hash
+	}
+	r.Err = errors.Join(errs...)
+	return r
+}
+
+func (s Source) decode(cfg decodeConfig) (image.Image, error) {
+	switch {
+	case s.Image != nil:
+		return s.Image, nil
+	case s.Open != nil:
+		rc, err := s.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rc.Close() }()
+		return decodeImage(rc, cfg)
+	case s.Path != "":
+		return openImage(s.Path, cfg)
+	}
+	return nil, ErrEmptySource
+}
@@ -0,0 +1,243 @@
+package imghash_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"iter"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+var batchFiles = []string{
+	"assets/baboon.jpg",
+	"assets/cat.jpg",
+	"assets/lena.jpg",
+	"assets/monarch.jpg",
+	"assets/peppers.jpg",
+	"assets/tulips.jpg",
+}
+
+func batchHashers(t *testing.T) []imghash.Hasher {
+	t.Helper()
+	phash, err := imghash.NewPHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cld, err := imghash.NewCLD()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []imghash.Hasher{phash, pdq, cld}
+}
+
+func TestHashAll(t *testing.T) {
+	hashers := batchHashers(t)
+	for _, workers := range []int{1, 3, 16} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			results, err := imghash.HashAll(context.Background(), hashers, imghash.Files(batchFiles...), imghash.WithWorkers(workers))
+			if err != nil {
+				t.Fatalf("HashAll: %v", err)
+			}
+			seen := make([]bool, len(batchFiles))
+			for r := range results {
+				if r.Err != nil {
+					t.Fatalf("%s: %v", r.Source.Key, r.Err)
+				}
+				if r.Source.Key != batchFiles[r.Index] || seen[r.Index] {
+					t.Fatalf("unexpected result %d for %s", r.Index, r.Source.Key)
+				}
+				seen[r.Index] = true
+				for i, h := range hashers {
+					want, err := imghash.HashFile(h, r.Source.Key)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(r.Hashes[i], want) {
+						t.Errorf("%s hasher %d: got %v, want %v", r.Source.Key, i, r.Hashes[i], want)
+					}
+				}
+			}
+			for i, ok := range seen {
+				if !ok {
+					t.Errorf("no result for %s", batchFiles[i])
+				}
+			}
+		})
+	}
+}
+
+type failingHasher struct{}
+
+func (failingHasher) Calculate(image.Image) (hashtype.Hash, error) {
+	return nil, errors.New("boom")
+}
+
+func TestHashAll_itemErrors(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := imghash.OpenImage("assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := []imghash.Source{
+		{Key: "missing", Path: "assets/missing.jpg"},
+		{Key: "garbage", Open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("not an image")), nil }},
+		{Key: "open error", Open: func() (io.ReadCloser, error) { return nil, os.ErrPermission }},
+		{Key: "empty"},
+		{Key: "decoded", Image: img},
+	}
+	results, err := imghash.HashAll(context.Background(), []imghash.Hasher{avg, failingHasher{}}, func(yield func(imghash.Source) bool) {
+		for _, s := range sources {
+			if !yield(s) {
+				return
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]imghash.Result)
+	for r := range results {
+		got[r.Source.Key] = r
+	}
+	if len(got) != len(sources) {
+		t.Fatalf("got %d results, want %d", len(got), len(sources))
+	}
+	if r := got["missing"]; !errors.Is(r.Err, os.ErrNotExist) || r.Hashes != nil {
+		t.Errorf("missing: got %v, %v", r.Hashes, r.Err)
+	}
+	if r := got["garbage"]; !errors.Is(r.Err, image.ErrFormat) {
+		t.Errorf("garbage: got %v", r.Err)
+	}
+	if r := got["open error"]; !errors.Is(r.Err, os.ErrPermission) {
+		t.Errorf("open error: got %v", r.Err)
+	}
+	if r := got["empty"]; !errors.Is(r.Err, imghash.ErrEmptySource) {
+		t.Errorf("empty: got %v", r.Err)
+	}
+	r := got["decoded"]
+	var herr *imghash.HasherError
+	if !errors.As(r.Err, &herr) || herr.Hasher != 1 {
+		t.Errorf("decoded: got error %v, want hasher 1 failure", r.Err)
+	}
+	if r.Hashes[0] == nil || r.Hashes[1] != nil {
+		t.Errorf("decoded: got hashes %v", r.Hashes)
+	}
+}
+
+// endless yields the same decoded image until the consumer stops.
+func endless(img image.Image) iter.Seq[imghash.Source] {
+	return func(yield func(imghash.Source) bool) {
+		for i := 0; ; i++ {
+			if !yield(imghash.Source{Key: fmt.Sprint(i), Image: img}) {
+				return
+			}
+		}
+	}
+}
+
+func TestHashAll_stop(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		results, err := imghash.HashAll(ctx, []imghash.Hasher{avg}, endless(img), imghash.WithWorkers(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for range results {
+			if n++; n == 10 {
+				cancel()
+			}
+		}
+		if ctx.Err() == nil || n < 10 {
+			t.Errorf("got %d results, ctx err %v", n, ctx.Err())
+		}
+	})
+
+	t.Run("break", func(t *testing.T) {
+		results, err := imghash.HashAll(context.Background(), []imghash.Hasher{avg}, endless(img), imghash.WithWorkers(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for range results {
+			if n++; n == 10 {
+				break
+			}
+		}
+		if n != 10 {
+			t.Errorf("got %d results, want 10", n)
+		}
+	})
+}
+
+func TestHashAll_errors(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		hashers []imghash.Hasher
+		opts    []imghash.BatchOption
+		err     error
+	}{
+		{"no hashers", nil, nil, imghash.ErrNoHashers},
+		{"nil hasher", []imghash.Hasher{avg, nil}, nil, imghash.ErrNoHashers},
+		{"zero workers", []imghash.Hasher{avg}, []imghash.BatchOption{imghash.WithWorkers(0)}, imghash.ErrInvalidWorkers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := imghash.HashAll(context.Background(), tt.hashers, imghash.Files(), tt.opts...); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func ExampleHashAll() {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		panic(err)
+	}
+	diff, err := imghash.NewDifference()
+	if err != nil {
+		panic(err)
+	}
+	results, err := imghash.HashAll(context.Background(), []imghash.Hasher{avg, diff},
+		imghash.Files("assets/cat.jpg", "assets/missing.jpg"), imghash.WithWorkers(1))
+	if err != nil {
+		panic(err)
+	}
+	for r := range results {
+		if r.Err != nil {
+			fmt.Println(r.Source.Key, "failed")
+			continue
+		}
+		fmt.Println(r.Source.Key, r.Hashes[0], r.Hashes[1])
+	}
+	// Output:
+	// assets/cat.jpg [255 255 15 7 1 0 0 0] [6 2 194 64 92 60 16 16]
+	// assets/missing.jpg failed
+}
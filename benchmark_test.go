@@ -0,0 +1,54 @@
+package imghash_test
+
+import (
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+)
+
+// BenchmarkCalculate hashes a decoded JPEG, an *image.YCbCr, with every
+// algorithm at its defaults.
+func BenchmarkCalculate(b *testing.B) {
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, name := range imghash.Algorithms() {
+		h, err := imghash.New(name, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := h.Calculate(img); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCalculateInto is like BenchmarkCalculate but reuses the hash
+// of the previous iteration.
+func BenchmarkCalculateInto(b *testing.B) {
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, name := range imghash.Algorithms() {
+		h, err := imghash.New(name, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			var dst imghash.Hash
+			for b.Loop() {
+				if dst, err = imghash.CalculateInto(h, dst, img); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -40,6 +40,21 @@ const (
 	RotationOverlap
 )
 
+var blockMeanMethodNames = [...]string{
+	Direct:          "Direct",
+	Overlap:         "Overlap",
+	Rotation:        "Rotation",
+	RotationOverlap: "RotationOverlap",
+}
+
+// String returns the name of the block construction method.
+func (m BlockMeanMethod) String() string {
+	if m >= 0 && int(m) < len(blockMeanMethodNames) {
+		return blockMeanMethodNames[m]
+	}
+	return "Unknown"
+}
+
 const (
 	blockMeanRotationStepDegrees = 15
 	blockMeanRotationCount       = 360 / blockMeanRotationStepDegrees
@@ -49,7 +64,7 @@ const (
 // Without options, sensible defaults are used.
 func NewBlockMean(opts ...BlockMeanOption) (BlockMean, error) {
 	b := BlockMean{
-		baseConfig: baseConfig{width: 256, height: 256, interp: BilinearExact},
+		baseConfig: baseConfig{width: 256, height: 256, interp: BilinearExact, alphaPolicy: defaultAlphaPolicy},
 		bWidth:     16,
 		bHeight:    16,
 		method:     Direct,
@@ -68,26 +83,44 @@ func NewBlockMean(opts ...BlockMeanOption) (BlockMean, error) {
 
 // Calculate returns a perceptual image hash.
 func (bh BlockMean) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(bh.width, bh.height, img, bh.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return bh.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Binary hash with enough capacity. See IntoHasher.
+func (bh BlockMean) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return bh.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (bh BlockMean) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return bh.calculate(nil, prep)
+}
+
+func (bh BlockMean) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(bh.alphaPolicy).cropBorders(bh.border)
+	g, err := prep.ResizedGray(bh.width, bh.height, bh.interp)
 	if err != nil {
 		return nil, err
 	}
 	if bh.method == Rotation || bh.method == RotationOverlap {
-		return bh.computeRotatedHash(g)
+		return bh.computeRotatedHash(dst, g)
 	}
 	mm := bh.computeMean(g)
 	med, err := imgproc.Mean(g)
 	if err != nil {
 		return nil, err
 	}
-	return bh.computeHash(mm, med), nil
+	return bh.computeHash(dst, mm, med), nil
 }
 
-func (bh BlockMean) computeRotatedHash(img *image.Gray) (hashtype.Binary, error) {
+func (bh BlockMean) computeRotatedHash(dst hashtype.Hash, img *image.Gray) (hashtype.Binary, error) {
 	meansPerRotation := len(bh.computeMean(img))
 	totalBits := meansPerRotation * blockMeanRotationCount
-	hash := hashtype.NewBinary(uint(totalBits))
+	hash := binaryInto(dst, uint(totalBits))
 	bitOffset := 0
 	for d := 0; d < 360; d += blockMeanRotationStepDegrees {
 		var rotated *image.Gray
@@ -168,10 +201,10 @@ func (bh BlockMean) computeMean(img *image.Gray) []float64 {
 }
 
 // Computes binary hash value based on block means.
-func (bh BlockMean) computeHash(means []float64, median float64) hashtype.Binary {
+func (bh BlockMean) computeHash(dst hashtype.Hash, means []float64, median float64) hashtype.Binary {
 	mSize := len(means)
 	hSize := (mSize + 7) / 8
-	hash := make(hashtype.Binary, hSize)
+	hash := hashInto[hashtype.Binary](dst, hSize)
 	for i := 0; i < mSize; i++ {
 		if means[i] >= median {
 			_ = hash.Set(uint(i))
@@ -190,3 +223,9 @@ func (bh BlockMean) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
 	}
 	return similarity.Hamming(h1, h2)
 }
+
+// ComparesHamming reports whether Compare returns the Hamming distance,
+// which it does unless WithDistance was given. See HammingComparer.
+func (bh BlockMean) ComparesHamming() bool {
+	return bh.distFunc == nil
+}
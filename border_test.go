@@ -0,0 +1,106 @@
+package imghash_test
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+)
+
+// letterbox returns img as RGBA and a copy of it framed by black bars
+// above and below and white bars on the sides.
+func letterbox(t *testing.T, img image.Image) (*image.RGBA, *image.RGBA) {
+	t.Helper()
+	b := img.Bounds()
+	content := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(content, content.Bounds(), img, b.Min, draw.Src)
+
+	framed := image.NewRGBA(image.Rect(0, 0, b.Dx()+60, b.Dy()+80))
+	draw.Draw(framed, framed.Bounds(), image.White, image.Point{}, draw.Src)
+	black := image.NewUniform(color.Black)
+	draw.Draw(framed, image.Rect(0, 0, framed.Rect.Dx(), 40), black, image.Point{}, draw.Src)
+	draw.Draw(framed, image.Rect(0, framed.Rect.Dy()-40, framed.Rect.Dx(), framed.Rect.Dy()), black, image.Point{}, draw.Src)
+	draw.Draw(framed, content.Bounds().Add(image.Pt(30, 40)), content, image.Point{}, draw.Src)
+	return content, framed
+}
+
+func TestContentBounds(t *testing.T) {
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, framed := letterbox(t, img)
+	want := content.Bounds().Add(image.Pt(30, 40))
+	if got := imghash.ContentBounds(framed, 16); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := imghash.ContentBounds(content, 16); got != content.Bounds() {
+		t.Errorf("image without borders: got %v, want %v", got, content.Bounds())
+	}
+	if got := imghash.ContentBounds(nil, 16); got != (image.Rectangle{}) {
+		t.Errorf("nil image: got %v, want empty rectangle", got)
+	}
+}
+
+func TestWithBorderCrop(t *testing.T) {
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, framed := letterbox(t, img)
+	for _, name := range imghash.Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			h, err := imghash.New(name, map[string]any{"crop_tolerance": 16})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := h.Calculate(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := h.Calculate(framed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("letterboxed image hashed differently from its content")
+			}
+		})
+	}
+}
+
+func TestWithBorderCrop_invalid(t *testing.T) {
+	if _, err := imghash.NewAverage(imghash.WithBorderCrop(256)); !errors.Is(err, imghash.ErrInvalidTolerance) {
+		t.Errorf("Average: got %v, want %v", err, imghash.ErrInvalidTolerance)
+	}
+	if _, err := imghash.NewPDQ(imghash.WithBorderCrop(300)); !errors.Is(err, imghash.ErrInvalidTolerance) {
+		t.Errorf("PDQ: got %v, want %v", err, imghash.ErrInvalidTolerance)
+	}
+	if _, err := imghash.NewRadialVariance(imghash.WithBorderCrop(1000)); !errors.Is(err, imghash.ErrInvalidTolerance) {
+		t.Errorf("RadialVariance: got %v, want %v", err, imghash.ErrInvalidTolerance)
+	}
+}
+
+func TestPrepared_CropBorders(t *testing.T) {
+	img, err := imghash.OpenImage("assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, framed := letterbox(t, img)
+	prep := imghash.Prepare(framed)
+	cropped := prep.CropBorders(16)
+	if cropped.Image().Bounds() != content.Bounds() {
+		t.Errorf("got bounds %v, want %v", cropped.Image().Bounds(), content.Bounds())
+	}
+	if prep.CropBorders(16) != cropped {
+		t.Error("CropBorders is not memoised per tolerance")
+	}
+	plain := imghash.Prepare(content)
+	if plain.CropBorders(16) != plain {
+		t.Error("image without borders was cropped")
+	}
+}
@@ -24,6 +24,18 @@ func (f BoVWFeatureType) valid() bool {
 	return f == BoVWORB || f == BoVWAKAZE
 }
 
+// String returns the name of the feature extractor.
+func (f BoVWFeatureType) String() string {
+	switch f {
+	case BoVWORB:
+		return "ORB"
+	case BoVWAKAZE:
+		return "AKAZE"
+	default:
+		return "Unknown"
+	}
+}
+
 // BoVWStorageType selects the global BoVW representation format.
 type BoVWStorageType uint8
 
@@ -40,6 +52,20 @@ func (s BoVWStorageType) valid() bool {
 	return s == BoVWHistogram || s == BoVWMinHash || s == BoVWSimHash
 }
 
+// String returns the name of the storage representation.
+func (s BoVWStorageType) String() string {
+	switch s {
+	case BoVWHistogram:
+		return "Histogram"
+	case BoVWMinHash:
+		return "MinHash"
+	case BoVWSimHash:
+		return "SimHash"
+	default:
+		return "Unknown"
+	}
+}
+
 type bovwKeypoint struct {
 	x, y     int
 	response float64
@@ -74,7 +100,7 @@ type BoVW struct {
 // Without options, sensible defaults are used.
 func NewBoVW(opts ...BoVWOption) (BoVW, error) {
 	b := BoVW{
-		baseConfig:     baseConfig{width: 256, height: 256, interp: Bilinear},
+		baseConfig:     baseConfig{width: 256, height: 256, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 		featureType:    BoVWORB,
 		storageType:    BoVWHistogram,
 		vocabularySize: 256,
@@ -111,50 +137,43 @@ func NewBoVW(opts ...BoVWOption) (BoVW, error) {
 
 // Calculate returns a BoVW representation hash.
 func (b BoVW) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(b.width, b.height, img, b.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return b.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a hash of the configured storage type with enough capacity. See IntoHasher.
+func (b BoVW) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return b.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (b BoVW) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return b.calculate(nil, prep)
+}
+
+func (b BoVW) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(b.alphaPolicy).cropBorders(b.border)
+	g, err := prep.ResizedGray(b.width, b.height, b.interp)
 	if err != nil {
 		return nil, err
 	}
-	gray, w, h := bovwGrayToFlat(g)
-
-	var keypoints []bovwKeypoint
-	switch b.featureType {
-	case BoVWORB:
-		keypoints = bovwDetectORB(gray, w, h, int(b.maxKeypoints))
-	case BoVWAKAZE:
-		keypoints = bovwDetectAKAZE(g, w, h, int(b.maxKeypoints))
-	default:
-		return nil, ErrInvalidBoVWFeatureType
-	}
-
-	descriptors := make([][]byte, 0, len(keypoints))
-	switch b.featureType {
-	case BoVWORB:
-		for i := range keypoints {
-			descriptors = append(descriptors, bovwDescriptorORB(gray, w, h, keypoints[i]))
-		}
-	case BoVWAKAZE:
-		blurred := imgproc.GaussianBlur(g, 0, 1.2)
-		blurredGray, berr := imgproc.Grayscale(blurred)
-		if berr != nil {
-			return nil, berr
-		}
-		bg, _, _ := bovwGrayToFlat(blurredGray)
-		for i := range keypoints {
-			descriptors = append(descriptors, bovwDescriptorAKAZE(bg, w, h, keypoints[i]))
-		}
+	_, descriptors, err := b.extract(g, int(b.maxKeypoints))
+	if err != nil {
+		return nil, err
 	}
 
 	wordHist := b.bovwHistogram(descriptors)
 
 	switch b.storageType {
 	case BoVWHistogram:
-		return hashtype.Float64(bovwNormalizeL2(wordHist)), nil
+		return bovwNormalizeL2(dst, wordHist), nil
 	case BoVWMinHash:
-		return hashtype.Float64(b.bovwMinHash(wordHist)), nil
+		return b.bovwMinHash(dst, wordHist), nil
 	case BoVWSimHash:
-		return b.bovwSimHash(wordHist), nil
+		return b.bovwSimHash(dst, wordHist), nil
 	default:
 		return nil, ErrInvalidBoVWStorageType
 	}
@@ -193,6 +212,42 @@ func (b BoVW) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
 	}
 }
 
+// extract detects up to maxKeypoints keypoints in g with the configured
+// feature extractor and computes their binary descriptors.
+func (b BoVW) extract(g *image.Gray, maxKeypoints int) ([]bovwKeypoint, [][]byte, error) {
+	gray, w, h := bovwGrayToFlat(g)
+
+	var keypoints []bovwKeypoint
+	switch b.featureType {
+	case BoVWORB:
+		keypoints = bovwDetectORB(gray, w, h, maxKeypoints)
+	case BoVWAKAZE:
+		keypoints = bovwDetectAKAZE(g, w, h, maxKeypoints)
+	default:
+		return nil, nil, ErrInvalidBoVWFeatureType
+	}
+
+	descriptors := make([][]byte, 0, len(keypoints))
+	switch b.featureType {
+	case BoVWORB:
+		for i := range keypoints {
+			descriptors = append(descriptors, bovwDescriptorORB(gray, w, h, keypoints[i]))
+		}
+	case BoVWAKAZE:
+		blurred := imgproc.GaussianBlur(g, 0, 1.2)
+		blurredGray, berr := imgproc.Grayscale(blurred)
+		if berr != nil {
+			return nil, nil, berr
+		}
+		bg, _, _ := bovwGrayToFlat(blurredGray)
+		for i := range keypoints {
+			descriptors = append(descriptors, bovwDescriptorAKAZE(bg, w, h, keypoints[i]))
+		}
+	}
+
+	return keypoints, descriptors, nil
+}
+
 func bovwDetectORB(gray []uint8, w, h, maxKeypoints int) []bovwKeypoint {
 	if w < 7 || h < 7 || maxKeypoints <= 0 {
 		return nil
@@ -414,14 +469,14 @@ func (b BoVW) bovwHistogram(descriptors [][]byte) []float64 {
 	return hist
 }
 
-func (b BoVW) bovwMinHash(hist []float64) []float64 {
+func (b BoVW) bovwMinHash(dst hashtype.Hash, hist []float64) hashtype.Float64 {
 	words := make([]uint32, 0, len(hist))
 	for i := range hist {
 		if hist[i] > 0 {
 			words = append(words, uint32(i))
 		}
 	}
-	signature := make([]float64, b.minHashSize)
+	signature := hashInto[hashtype.Float64](dst, int(b.minHashSize))
 	if len(words) == 0 {
 		return signature
 	}
@@ -444,8 +499,8 @@ func (b BoVW) bovwMinHash(hist []float64) []float64 {
 	return signature
 }
 
-func (b BoVW) bovwSimHash(hist []float64) hashtype.Binary {
-	out := hashtype.NewBinary(b.simHashBits)
+func (b BoVW) bovwSimHash(dst hashtype.Hash, hist []float64) hashtype.Binary {
+	out := binaryInto(dst, b.simHashBits)
 	acc := make([]float64, b.simHashBits)
 	for i := range hist {
 		weight := hist[i]
@@ -470,8 +525,8 @@ func (b BoVW) bovwSimHash(hist []float64) hashtype.Binary {
 	return out
 }
 
-func bovwNormalizeL2(v []float64) []float64 {
-	out := make([]float64, len(v))
+func bovwNormalizeL2(dst hashtype.Hash, v []float64) hashtype.Float64 {
+	out := hashInto[hashtype.Float64](dst, len(v))
 	copy(out, v)
 	var norm float64
 	for i := range out {
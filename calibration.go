@@ -0,0 +1,632 @@
+package imghash
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// Calibration errors.
+var (
+	// ErrTooFewPairs is returned when a calibration is fitted without both
+	// matching and non-matching pairs.
+	ErrTooFewPairs = errors.New("imghash: calibration needs matching and non-matching pairs")
+	// ErrInvalidCalibration is returned for a calibration model that is
+	// malformed or uses an unknown method.
+	ErrInvalidCalibration = errors.New("imghash: invalid calibration")
+	// ErrInvalidPrior is returned when the match prior is not in (0, 1).
+	ErrInvalidPrior = errors.New("imghash: match prior must be in (0, 1)")
+	// ErrCalibrationMismatch is returned when a calibration is applied to a
+	// hasher configured differently from the one it was fitted for.
+	ErrCalibrationMismatch = errors.New("imghash: calibration was fitted for a different hasher configuration")
+)
+
+// CalibrationMethod selects how distances are mapped to probabilities.
+type CalibrationMethod uint8
+
+const (
+	// Logistic fits a sigmoid of the distance (Platt scaling). It is smooth
+	// and needs few pairs, but assumes the match probability falls off
+	// like a logistic curve.
+	Logistic CalibrationMethod = iota + 1
+	// Isotonic fits a monotone piecewise-linear function of the distance.
+	// It follows any monotone shape but needs more pairs.
+	Isotonic
+)
+
+// String returns the name of the calibration method.
+func (m CalibrationMethod) String() string {
+	switch m {
+	case Logistic:
+		return "Logistic"
+	case Isotonic:
+		return "Isotonic"
+	default:
+		return "Unknown"
+	}
+}
+
+// MarshalText encodes the method by its lowercase name.
+func (m CalibrationMethod) MarshalText() ([]byte, error) {
+	if m != Logistic && m != Isotonic {
+		return nil, fmt.Errorf("%w: method %d", ErrInvalidCalibration, m)
+	}
+	return []byte(strings.ToLower(m.String())), nil
+}
+
+// UnmarshalText decodes a method encoded by MarshalText.
+func (m *CalibrationMethod) UnmarshalText(text []byte) error {
+	for _, c := range []CalibrationMethod{Logistic, Isotonic} {
+		if strings.EqualFold(string(text), c.String()) {
+			*m = c
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unknown method %q", ErrInvalidCalibration, text)
+}
+
+// Calibration maps the distances of one hasher configuration to the
+// probability that two hashes come from the same image. It is fitted with
+// Calibrate or FitCalibration and encodes to JSON, so a model fitted once
+// can be shipped with an application and loaded with NewCalibrated.
+type Calibration struct {
+	Method CalibrationMethod `json:"method"`
+	// Algorithm, Version and Params record the hasher configuration the
+	// calibration was fitted for, as in an Envelope. They are empty when
+	// the comparer was not a registered hasher.
+	Algorithm string            `json:"algorithm,omitempty"`
+	Version   uint              `json:"version,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	// Intercept and Slope define the Logistic model
+	// 1 / (1 + exp(-(Intercept + Slope*distance))).
+	Intercept float64 `json:"intercept,omitempty"`
+	Slope     float64 `json:"slope,omitempty"`
+	// Distances and Probabilities are the knots of the Isotonic model, by
+	// increasing distance. Probabilities are interpolated linearly between
+	// knots and held constant beyond the first and last.
+	Distances     []float64 `json:"distances,omitempty"`
+	Probabilities []float64 `json:"probabilities,omitempty"`
+}
+
+// Probability returns the probability that two hashes at distance d come
+// from the same image. It is monotone in d: it falls with the distance for
+// metrics such as Hamming or L2, and rises with the score for similarity
+// measures such as PCC.
+func (c *Calibration) Probability(d similarity.Distance) float64 {
+	x := float64(d)
+	if c.Method == Logistic {
+		return sigmoid(c.Intercept + c.Slope*x)
+	}
+	ds, ps := c.Distances, c.Probabilities
+	if len(ds) == 0 {
+		return 0
+	}
+	i := sort.SearchFloat64s(ds, x)
+	switch {
+	case i == len(ds):
+		return ps[len(ps)-1]
+	case ds[i] == x || i == 0:
+		return ps[i]
+	}
+	t := (x - ds[i-1]) / (ds[i] - ds[i-1])
+	return ps[i-1] + t*(ps[i]-ps[i-1])
+}
+
+// Threshold returns the distance at which Probability reaches p, and false
+// when no distance does. Pairs at most that far apart match with
+// probability p or more; for similarity measures, whose probability rises
+// with the score, it is pairs scoring at least the threshold. The
+// threshold is infinite when every distance reaches p.
+//
+// Since every pair within the threshold matches with probability p or
+// more, at least a fraction p of them are true matches on data like the
+// calibration pairs: the threshold for 99.9% precision is Threshold(0.999).
+func (c *Calibration) Threshold(p float64) (similarity.Distance, bool) {
+	inc := c.increasing()
+	all := math.Inf(1)
+	if inc {
+		all = math.Inf(-1)
+	}
+	if c.Method == Logistic {
+		switch {
+		case p >= 1:
+			return 0, false
+		case p <= 0:
+			return similarity.Distance(all), true
+		case c.Slope == 0:
+			if sigmoid(c.Intercept) >= p {
+				return similarity.Distance(all), true
+			}
+			return 0, false
+		}
+		return similarity.Distance((logit(p) - c.Intercept) / c.Slope), true
+	}
+	ds, ps := c.Distances, c.Probabilities
+	n := len(ps)
+	// at returns the index of the k-th knot counted from the most probable
+	// end of the model.
+	at := func(k int) int {
+		if inc {
+			return n - 1 - k
+		}
+		return k
+	}
+	switch {
+	case n == 0 || ps[at(0)] < p:
+		return 0, false
+	case ps[at(n-1)] >= p:
+		return similarity.Distance(all), true
+	}
+	k := sort.Search(n, func(k int) bool { return ps[at(k)] < p }) - 1
+	i, j := at(k), at(k+1)
+	t := (ps[i] - p) / (ps[i] - ps[j])
+	return similarity.Distance(ds[i] + t*(ds[j]-ds[i])), true
+}
+
+// increasing reports whether the probability rises with the distance, as
+// for similarity measures.
+func (c *Calibration) increasing() bool {
+	if c.Method == Logistic {
+		return c.Slope > 0
+	}
+	ps := c.Probabilities
+	return len(ps) > 0 && ps[len(ps)-1] > ps[0]
+}
+
+func (c *Calibration) validate() error {
+	finite := func(v float64) bool { return !math.IsNaN(v) && !math.IsInf(v, 0) }
+	switch c.Method {
+	case Logistic:
+		if !finite(c.Intercept) || !finite(c.Slope) {
+			return fmt.Errorf("%w: logistic coefficients must be finite", ErrInvalidCalibration)
+		}
+	case Isotonic:
+		ds, ps := c.Distances, c.Probabilities
+		if len(ds) == 0 || len(ds) != len(ps) {
+			return fmt.Errorf("%w: isotonic model needs one probability per distance", ErrInvalidCalibration)
+		}
+		for i := range ds {
+			if !finite(ds[i]) || !(ps[i] >= 0 && ps[i] <= 1) {
+				return fmt.Errorf("%w: isotonic knot %d is out of range", ErrInvalidCalibration, i)
+			}
+			if i > 0 && ds[i] <= ds[i-1] {
+				return fmt.Errorf("%w: isotonic distances must increase", ErrInvalidCalibration)
+			}
+		}
+		if !slices.IsSorted(ps) && !slices.IsSortedFunc(ps, func(a, b float64) int { return cmp.Compare(b, a) }) {
+			return fmt.Errorf("%w: isotonic probabilities must be monotone", ErrInvalidCalibration)
+		}
+	default:
+		return fmt.Errorf("%w: method %d", ErrInvalidCalibration, c.Method)
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes and validates a calibration encoded with
+// encoding/json.
+func (c *Calibration) UnmarshalJSON(data []byte) error {
+	type plain Calibration
+	var v plain
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	cal := Calibration(v)
+	if err := cal.validate(); err != nil {
+		return err
+	}
+	*c = cal
+	return nil
+}
+
+// CalibrationOption configures Calibrate and FitCalibration.
+type CalibrationOption interface{ applyCalibration(*calibrationConfig) }
+
+type calibrationConfig struct {
+	method CalibrationMethod
+	prior  float64
+}
+
+type calibrationMethodOption CalibrationMethod
+
+func (o calibrationMethodOption) applyCalibration(c *calibrationConfig) {
+	c.method = CalibrationMethod(o)
+}
+
+// WithCalibrationMethod sets the calibration method. It defaults to
+// Logistic.
+func WithCalibrationMethod(m CalibrationMethod) CalibrationOption {
+	return calibrationMethodOption(m)
+}
+
+type priorOption float64
+
+func (o priorOption) applyCalibration(c *calibrationConfig) { c.prior = float64(o) }
+
+// WithMatchPrior sets the fraction of compared pairs expected to match
+// once the calibration is used, in (0, 1). Probabilities depend on it:
+// the same distance is less convincing when matches are rare. By default
+// it is the fraction of matching pairs among the calibration pairs, so
+// set it whenever their mix differs from production traffic.
+func WithMatchPrior(p float64) CalibrationOption { return priorOption(p) }
+
+// LabeledPair is a pair of hashes known to come from the same image
+// (Match) or from different images.
+type LabeledPair struct {
+	A, B  hashtype.Hash
+	Match bool
+}
+
+// Calibrated is a Comparer whose distances are also available as match
+// probabilities through a Calibration.
+type Calibrated struct {
+	Comparer
+	cal *Calibration
+}
+
+// Calibrate compares every labelled pair with c and fits a calibration of
+// its distances. When c is a registered hasher, the calibration records
+// its configuration. Options that only affect Compare, such as
+// WithDistance, are not recorded, so a calibration must only be used with
+// the metric it was fitted with.
+func Calibrate(c Comparer, pairs []LabeledPair, opts ...CalibrationOption) (*Calibrated, error) {
+	var genuine, impostor []similarity.Distance
+	for _, p := range pairs {
+		d, err := c.Compare(p.A, p.B)
+		if err != nil {
+			return nil, err
+		}
+		if p.Match {
+			genuine = append(genuine, d)
+		} else {
+			impostor = append(impostor, d)
+		}
+	}
+	return FitCalibration(c, genuine, impostor, opts...)
+}
+
+// FitCalibration is like Calibrate but takes distances that c has already
+// computed for matching (genuine) and non-matching (impostor) pairs, such
+// as those reported by the eval package.
+func FitCalibration(c Comparer, genuine, impostor []similarity.Distance, opts ...CalibrationOption) (*Calibrated, error) {
+	cfg := calibrationConfig{method: Logistic}
+	for _, o := range opts {
+		o.applyCalibration(&cfg)
+	}
+	if c == nil {
+		return nil, ErrNilHasher
+	}
+	if cfg.method != Logistic && cfg.method != Isotonic {
+		return nil, fmt.Errorf("%w: method %d", ErrInvalidCalibration, cfg.method)
+	}
+	if cfg.prior != 0 && !(cfg.prior > 0 && cfg.prior < 1) {
+		return nil, ErrInvalidPrior
+	}
+	if len(genuine) == 0 || len(impostor) == 0 {
+		return nil, ErrTooFewPairs
+	}
+	samples := make([]calibrationSample, 0, len(genuine)+len(impostor))
+	for _, d := range genuine {
+		samples = append(samples, calibrationSample{float64(d), true})
+	}
+	for _, d := range impostor {
+		samples = append(samples, calibrationSample{float64(d), false})
+	}
+	for _, s := range samples {
+		if math.IsNaN(s.d) || math.IsInf(s.d, 0) {
+			return nil, fmt.Errorf("%w: distance %v is not finite", ErrInvalidCalibration, s.d)
+		}
+	}
+	// shift converts the log-odds of the calibration pairs to those of
+	// the expected match prior.
+	var shift float64
+	if cfg.prior != 0 {
+		shift = logit(cfg.prior) - logit(float64(len(genuine))/float64(len(samples)))
+	}
+
+	cal := &Calibration{Method: cfg.method}
+	if h, ok := c.(Hasher); ok {
+		if spec, err := Describe(h); err == nil {
+			cal.Algorithm, cal.Version, cal.Params = spec.Name, spec.Version, formatParams(spec.Params)
+		}
+	}
+	if cfg.method == Logistic {
+		x := make([][]float64, len(samples))
+		match := make([]bool, len(samples))
+		for i, s := range samples {
+			x[i], match[i] = []float64{s.d}, s.match
+		}
+		var coef []float64
+		cal.Intercept, coef = fitLogistic(x, match)
+		cal.Intercept += shift
+		cal.Slope = coef[0]
+	} else {
+		cal.Distances, cal.Probabilities = fitIsotonic(samples)
+		for i, p := range cal.Probabilities {
+			if p > 0 && p < 1 {
+				cal.Probabilities[i] = sigmoid(logit(p) + shift)
+			}
+		}
+	}
+	return &Calibrated{Comparer: c, cal: cal}, nil
+}
+
+// NewCalibrated applies a calibration, typically one decoded from JSON, to
+// c. It fails with ErrCalibrationMismatch if the calibration records a
+// hasher configuration that differs from that of c.
+func NewCalibrated(c Comparer, cal *Calibration) (*Calibrated, error) {
+	if c == nil {
+		return nil, ErrNilHasher
+	}
+	if cal == nil {
+		return nil, ErrInvalidCalibration
+	}
+	if err := cal.validate(); err != nil {
+		return nil, err
+	}
+	if cal.Algorithm != "" {
+		h, ok := c.(Hasher)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T is not a hasher", ErrCalibrationMismatch, c)
+		}
+		spec, err := Describe(h)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCalibrationMismatch, err)
+		}
+		if spec.Name != cal.Algorithm || spec.Version != cal.Version || !maps.Equal(formatParams(spec.Params), cal.Params) {
+			return nil, fmt.Errorf("%w: fitted for %s version %d", ErrCalibrationMismatch, cal.Algorithm, cal.Version)
+		}
+	}
+	return &Calibrated{Comparer: c, cal: cal}, nil
+}
+
+// Calibration returns the calibration of c, for encoding or inspection.
+// It must not be modified.
+func (c *Calibrated) Calibration() *Calibration { return c.cal }
+
+// Similarity returns the probability that h1 and h2 come from the same
+// image, from 0 to 1.
+func (c *Calibrated) Similarity(h1, h2 hashtype.Hash) (float64, error) {
+	d, err := c.Compare(h1, h2)
+	if err != nil {
+		return 0, err
+	}
+	return c.cal.Probability(d), nil
+}
+
+// formatParams returns params in the string form recorded by envelopes.
+func formatParams(params map[string]any) map[string]string {
+	if len(params) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(params))
+	for k, v := range params {
+		out[k] = formatParam(v)
+	}
+	return out
+}
+
+type calibrationSample struct {
+	d     float64
+	match bool
+}
+
+func sigmoid(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+func logit(p float64) float64 { return math.Log(p / (1 - p)) }
+
+// fitLogistic fits 1 / (1 + exp(-(a + w·x))) to samples x labelled by
+// match by Newton's method with backtracking, as in Lin, Lin and Weng's
+// refinement of Platt scaling. The targets are smoothed towards one half
+// so that perfectly separated samples still give finite coefficients.
+func fitLogistic(x [][]float64, match []bool) (intercept float64, coef []float64) {
+	n, d := len(x), len(x[0])
+	var pos, neg float64
+	mean, scale := make([]float64, d), make([]float64, d)
+	for i, xi := range x {
+		if match[i] {
+			pos++
+		} else {
+			neg++
+		}
+		for j, v := range xi {
+			mean[j] += v
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(n)
+	}
+	for _, xi := range x {
+		for j, v := range xi {
+			scale[j] += (v - mean[j]) * (v - mean[j])
+		}
+	}
+	for j := range scale {
+		if scale[j] = math.Sqrt(scale[j] / float64(n)); scale[j] == 0 {
+			scale[j] = 1
+		}
+	}
+	// z holds the standardised samples after a constant 1 for the intercept.
+	hi, lo := (pos+1)/(pos+2), 1/(neg+2)
+	z := make([][]float64, n)
+	t := make([]float64, n)
+	for i, xi := range x {
+		z[i] = make([]float64, d+1)
+		z[i][0] = 1
+		for j, v := range xi {
+			z[i][j+1] = (v - mean[j]) / scale[j]
+		}
+		t[i] = lo
+		if match[i] {
+			t[i] = hi
+		}
+	}
+	dot := func(a, b []float64) float64 {
+		var s float64
+		for j := range a {
+			s += a[j] * b[j]
+		}
+		return s
+	}
+	// loss is the negative log-likelihood of the coefficients w, computed
+	// without overflow.
+	loss := func(w []float64) float64 {
+		var f float64
+		for i := range z {
+			v := dot(w, z[i])
+			if v >= 0 {
+				f += (1-t[i])*v + math.Log1p(math.Exp(-v))
+			} else {
+				f += -t[i]*v + math.Log1p(math.Exp(v))
+			}
+		}
+		return f
+	}
+	w := make([]float64, d+1)
+	w[0] = logit((pos + 1) / (pos + neg + 2))
+	f := loss(w)
+	const ridge = 1e-12
+	g := make([]float64, d+1)
+	h := make([][]float64, d+1)
+	for k := range h {
+		h[k] = make([]float64, d+1)
+	}
+	next := make([]float64, d+1)
+	for range 100 {
+		clear(g)
+		for k := range h {
+			clear(h[k])
+		}
+		for i, zi := range z {
+			p := sigmoid(dot(w, zi))
+			for j := range zi {
+				g[j] += (p - t[i]) * zi[j]
+				for k := range zi {
+					h[j][k] += p * (1 - p) * zi[j] * zi[k]
+				}
+			}
+		}
+		if slices.IndexFunc(g, func(v float64) bool { return math.Abs(v) >= 1e-9 }) < 0 {
+			break
+		}
+		for k := range h {
+			h[k][k] += ridge
+		}
+		step := solve(h, g)
+		for k := range step {
+			step[k] = -step[k]
+		}
+		size := 1.0
+		for size >= 1e-10 {
+			for k := range w {
+				next[k] = w[k] + size*step[k]
+			}
+			if nf := loss(next); nf < f+1e-4*size*dot(g, step) {
+				copy(w, next)
+				f = nf
+				break
+			}
+			size /= 2
+		}
+		if size < 1e-10 {
+			break
+		}
+	}
+	// Undo the standardisation.
+	intercept, coef = w[0], make([]float64, d)
+	for j := range coef {
+		coef[j] = w[j+1] / scale[j]
+		intercept -= coef[j] * mean[j]
+	}
+	return intercept, coef
+}
+
+// solve returns the solution of a·x = b by Gaussian elimination with
+// partial pivoting. It overwrites a.
+func solve(a [][]float64, b []float64) []float64 {
+	n := len(b)
+	x := slices.Clone(b)
+	for c := range n {
+		p := c
+		for r := c + 1; r < n; r++ {
+			if math.Abs(a[r][c]) > math.Abs(a[p][c]) {
+				p = r
+			}
+		}
+		a[c], a[p] = a[p], a[c]
+		x[c], x[p] = x[p], x[c]
+		for r := c + 1; r < n; r++ {
+			f := a[r][c] / a[c][c]
+			for k := c; k < n; k++ {
+				a[r][k] -= f * a[c][k]
+			}
+			x[r] -= f * x[c]
+		}
+	}
+	for c := n - 1; c >= 0; c-- {
+		for k := c + 1; k < n; k++ {
+			x[c] -= a[c][k] * x[k]
+		}
+		x[c] /= a[c][c]
+	}
+	return x
+}
+
+// fitIsotonic fits a monotone match probability to the samples with the
+// pool adjacent violators algorithm and returns its knots. The probability
+// falls with the distance unless matching samples are further apart on
+// average, as with similarity measures.
+func fitIsotonic(samples []calibrationSample) (distances, probabilities []float64) {
+	samples = slices.Clone(samples)
+	slices.SortFunc(samples, func(a, b calibrationSample) int { return cmp.Compare(a.d, b.d) })
+	var sums, counts [2]float64
+	for _, s := range samples {
+		k := 0
+		if s.match {
+			k = 1
+		}
+		sums[k] += s.d
+		counts[k]++
+	}
+	sign := 1.0
+	if sums[1]/counts[1] > sums[0]/counts[0] {
+		sign = -1
+	}
+	type block struct {
+		lo, hi      float64
+		weight, sum float64
+	}
+	var blocks []block
+	for i := 0; i < len(samples); {
+		b := block{lo: samples[i].d, hi: samples[i].d}
+		for ; i < len(samples) && samples[i].d == b.lo; i++ {
+			b.weight++
+			if samples[i].match {
+				b.sum++
+			}
+		}
+		blocks = append(blocks, b)
+		for n := len(blocks); n > 1 && sign*(blocks[n-2].sum/blocks[n-2].weight) < sign*(blocks[n-1].sum/blocks[n-1].weight); n-- {
+			prev, last := blocks[n-2], blocks[n-1]
+			blocks = append(blocks[:n-2], block{prev.lo, last.hi, prev.weight + last.weight, prev.sum + last.sum})
+		}
+	}
+	for _, b := range blocks {
+		p := b.sum / b.weight
+		distances = append(distances, b.lo)
+		probabilities = append(probabilities, p)
+		if b.hi != b.lo {
+			distances = append(distances, b.hi)
+			probabilities = append(probabilities, p)
+		}
+	}
+	return distances, probabilities
+}
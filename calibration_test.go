@@ -0,0 +1,284 @@
+package imghash_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// calibrationDistances returns overlapping distances of matching pairs,
+// mostly small, and of non-matching pairs, mostly large.
+func calibrationDistances() (genuine, impostor []similarity.Distance) {
+	for i := range 200 {
+		genuine = append(genuine, similarity.Distance(i%40))
+		impostor = append(impostor, similarity.Distance(30+i%60))
+	}
+	return genuine, impostor
+}
+
+func TestFitCalibration(t *testing.T) {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genuine, impostor := calibrationDistances()
+	for _, m := range []imghash.CalibrationMethod{imghash.Logistic, imghash.Isotonic} {
+		t.Run(m.String(), func(t *testing.T) {
+			c, err := imghash.FitCalibration(pdq, genuine, impostor, imghash.WithCalibrationMethod(m))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cal := c.Calibration()
+			if cal.Method != m || cal.Algorithm != "pdq" || cal.Params["interpolation"] == "" {
+				t.Errorf("calibration %+v does not record the configuration", cal)
+			}
+			prev := 2.0
+			for d := similarity.Distance(0); d <= 100; d++ {
+				p := cal.Probability(d)
+				if p > prev || p < 0 || p > 1 {
+					t.Fatalf("probability %v at %v after %v", p, d, prev)
+				}
+				prev = p
+			}
+			if p := cal.Probability(5); p < 0.9 {
+				t.Errorf("probability at 5 is %v, want at least 0.9", p)
+			}
+			if p := cal.Probability(80); p > 0.1 {
+				t.Errorf("probability at 80 is %v, want at most 0.1", p)
+			}
+			// Only genuine pairs are closer than 30; overlap lasts until 40.
+			if th, ok := cal.Threshold(0.9); !ok || th < 25 || th > 40 {
+				t.Errorf("threshold for 0.9 is %v, %v", th, ok)
+			}
+			if _, ok := cal.Threshold(1); ok != (m == imghash.Isotonic) {
+				t.Errorf("probability 1 reachable: %v", ok)
+			}
+		})
+	}
+}
+
+func TestFitCalibration_isotonic(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := imghash.FitCalibration(avg, []similarity.Distance{1, 2, 2, 4}, []similarity.Distance{3, 5, 6},
+		imghash.WithCalibrationMethod(imghash.Isotonic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := c.Calibration()
+	// Pooling 3 (no match) with 4 (match) gives one half.
+	wantD := []float64{1, 2, 3, 4, 5, 6}
+	wantP := []float64{1, 1, 0.5, 0.5, 0, 0}
+	if !equalFloats(cal.Distances, wantD) || !equalFloats(cal.Probabilities, wantP) {
+		t.Fatalf("got knots %v %v, want %v %v", cal.Distances, cal.Probabilities, wantD, wantP)
+	}
+	tests := []struct {
+		d    similarity.Distance
+		want float64
+	}{{0, 1}, {2.5, 0.75}, {3.5, 0.5}, {4.5, 0.25}, {10, 0}}
+	for _, tt := range tests {
+		if got := cal.Probability(tt.d); got != tt.want {
+			t.Errorf("Probability(%v) = %v, want %v", tt.d, got, tt.want)
+		}
+	}
+	if th, ok := cal.Threshold(0.75); !ok || th != 2.5 {
+		t.Errorf("Threshold(0.75) = %v, %v; want 2.5", th, ok)
+	}
+	if th, ok := cal.Threshold(0); !ok || !math.IsInf(float64(th), 1) {
+		t.Errorf("Threshold(0) = %v, %v; want +Inf", th, ok)
+	}
+}
+
+func TestFitCalibration_similarityScores(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Scores such as PCC are higher for matching pairs.
+	genuine := []similarity.Distance{0.9, 0.95, 0.8, 0.99}
+	impostor := []similarity.Distance{0.1, 0.3, 0.5, 0.85}
+	for _, m := range []imghash.CalibrationMethod{imghash.Logistic, imghash.Isotonic} {
+		c, err := imghash.FitCalibration(avg, genuine, impostor, imghash.WithCalibrationMethod(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cal := c.Calibration()
+		if cal.Probability(0.98) <= cal.Probability(0.2) {
+			t.Errorf("%v: probability does not rise with the score", m)
+		}
+		th, ok := cal.Threshold(0.6)
+		if !ok || cal.Probability(th+0.01) < 0.6 || cal.Probability(th-0.01) >= 0.6 {
+			t.Errorf("%v: threshold %v, %v is not a lower bound", m, th, ok)
+		}
+	}
+}
+
+func TestFitCalibration_prior(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genuine, impostor := calibrationDistances()
+	for _, m := range []imghash.CalibrationMethod{imghash.Logistic, imghash.Isotonic} {
+		even, err := imghash.FitCalibration(avg, genuine, impostor, imghash.WithCalibrationMethod(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rare, err := imghash.FitCalibration(avg, genuine, impostor, imghash.WithCalibrationMethod(m), imghash.WithMatchPrior(0.01))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, q := even.Calibration().Probability(35), rare.Calibration().Probability(35)
+		// Lowering the prior from 1/2 to 1/100 divides the odds by 99.
+		if got, want := q/(1-q), p/(1-p)/99; math.Abs(got-want) > 1e-9*want {
+			t.Errorf("%v: odds %v, want %v", m, got, want)
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := hashtype.Binary{0x00, 0x00}
+	pairs := []imghash.LabeledPair{
+		{A: a, B: hashtype.Binary{0x00, 0x00}, Match: true},
+		{A: a, B: hashtype.Binary{0x01, 0x00}, Match: true},
+		{A: a, B: hashtype.Binary{0x03, 0x00}, Match: true},
+		{A: a, B: hashtype.Binary{0xff, 0x0f}, Match: false},
+		{A: a, B: hashtype.Binary{0xff, 0xff}, Match: false},
+		{A: a, B: hashtype.Binary{0x0f, 0x00}, Match: false},
+	}
+	c, err := imghash.Calibrate(avg, pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near, err := c.Similarity(a, hashtype.Binary{0x01, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	far, err := c.Similarity(a, hashtype.Binary{0xff, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(near > 0.5 && far < 0.5) {
+		t.Errorf("got similarities %v and %v", near, far)
+	}
+	if _, err := c.Similarity(a, hashtype.Binary{0x00}); err == nil {
+		t.Error("expected an error for hashes of different lengths")
+	}
+	if d, err := c.Compare(a, hashtype.Binary{0x03, 0x00}); err != nil || d != 2 {
+		t.Errorf("Compare = %v, %v; want 2", d, err)
+	}
+}
+
+func TestCalibration_JSON(t *testing.T) {
+	phash, err := imghash.NewPHash(imghash.WithInterpolation(imghash.Bicubic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	genuine, impostor := calibrationDistances()
+	for _, m := range []imghash.CalibrationMethod{imghash.Logistic, imghash.Isotonic} {
+		c, err := imghash.FitCalibration(phash, genuine, impostor, imghash.WithCalibrationMethod(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(c.Calibration())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cal imghash.Calibration
+		if err := json.Unmarshal(data, &cal); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := imghash.NewCalibrated(phash, &cal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for d := similarity.Distance(0); d < 100; d += 7 {
+			if got, want := loaded.Calibration().Probability(d), c.Calibration().Probability(d); got != want {
+				t.Errorf("%v: Probability(%v) = %v after decoding, want %v", m, d, got, want)
+			}
+		}
+
+		// The model does not apply to other configurations.
+		other, err := imghash.NewPHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := imghash.NewCalibrated(other, &cal); !errors.Is(err, imghash.ErrCalibrationMismatch) {
+			t.Errorf("%v: got %v, want ErrCalibrationMismatch", m, err)
+		}
+		avg, err := imghash.NewAverage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := imghash.NewCalibrated(avg, &cal); !errors.Is(err, imghash.ErrCalibrationMismatch) {
+			t.Errorf("%v: got %v, want ErrCalibrationMismatch", m, err)
+		}
+	}
+}
+
+func TestCalibration_invalid(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{
+		`{"method":"sigmoid"}`,
+		`{"method":"isotonic"}`,
+		`{"method":"isotonic","distances":[1,2],"probabilities":[1]}`,
+		`{"method":"isotonic","distances":[2,1],"probabilities":[1,0]}`,
+		`{"method":"isotonic","distances":[1,2,3],"probabilities":[1,0,0.5]}`,
+		`{"method":"isotonic","distances":[1,2],"probabilities":[1.5,0]}`,
+	} {
+		var cal imghash.Calibration
+		if err := json.Unmarshal([]byte(data), &cal); !errors.Is(err, imghash.ErrInvalidCalibration) {
+			t.Errorf("%s: got %v, want ErrInvalidCalibration", data, err)
+		}
+	}
+	if _, err := imghash.NewCalibrated(avg, &imghash.Calibration{}); !errors.Is(err, imghash.ErrInvalidCalibration) {
+		t.Errorf("got %v, want ErrInvalidCalibration", err)
+	}
+
+	genuine, impostor := calibrationDistances()
+	tests := []struct {
+		name              string
+		genuine, impostor []similarity.Distance
+		opts              []imghash.CalibrationOption
+		want              error
+	}{
+		{"no genuine", nil, impostor, nil, imghash.ErrTooFewPairs},
+		{"no impostor", genuine, nil, nil, imghash.ErrTooFewPairs},
+		{"method", genuine, impostor, []imghash.CalibrationOption{imghash.WithCalibrationMethod(0)}, imghash.ErrInvalidCalibration},
+		{"prior", genuine, impostor, []imghash.CalibrationOption{imghash.WithMatchPrior(1)}, imghash.ErrInvalidPrior},
+		{"nan", []similarity.Distance{similarity.Distance(math.NaN())}, impostor, nil, imghash.ErrInvalidCalibration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := imghash.FitCalibration(avg, tt.genuine, tt.impostor, tt.opts...); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-12 {
+			return false
+		}
+	}
+	return true
+}
@@ -46,7 +46,7 @@ type CLD struct {
 // Without options, sensible defaults are used.
 func NewCLD(opts ...CLDOption) (CLD, error) {
 	c := CLD{
-		baseConfig: baseConfig{width: 64, height: 64, interp: Bilinear},
+		baseConfig: baseConfig{width: 64, height: 64, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 	}
 	for _, o := range opts {
 		o.applyCLD(&c)
@@ -59,14 +59,36 @@ func NewCLD(opts ...CLDOption) (CLD, error) {
 
 // Calculate returns an MPEG-7 CLD style perceptual hash.
 func (c CLD) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(c.width, c.height, img, c.interp.resizeType())
+	return c.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a UInt8 hash with enough capacity. See IntoHasher.
+func (c CLD) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return c.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (c CLD) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return c.calculate(nil, prep)
+}
+
+func (c CLD) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(c.alphaPolicy).cropBorders(c.border)
+	r, err := prep.Resized(c.width, c.height, c.interp)
+	if err != nil {
+		return nil, err
+	}
 	y, cb, cr := c.layoutYCbCr(r)
 
 	yDCT := imgproc.DCT(y)
 	cbDCT := imgproc.DCT(cb)
 	crDCT := imgproc.DCT(cr)
 
-	hash := make(hashtype.UInt8, cldHashLen)
+	hash := hashInto[hashtype.UInt8](dst, cldHashLen)
 	hash[0] = quantizeCLDDC(yDCT[0][0])
 	for i := 1; i < cldYCoeffs; i++ {
 		hash[i] = quantizeCLDAC(zigZagCoeff(yDCT, i))
@@ -91,55 +113,54 @@ func (c CLD) layoutYCbCr(img image.Image) ([][]float32, [][]float32, [][]float32
 	bounds := img.Bounds()
 	w, h := bounds.Dx(), bounds.Dy()
 
-	y := make([][]float32, cldGridSize)
-	cb := make([][]float32, cldGridSize)
-	cr := make([][]float32, cldGridSize)
-	for i := 0; i < cldGridSize; i++ {
-		y[i] = make([]float32, cldGridSize)
-		cb[i] = make([]float32, cldGridSize)
-		cr[i] = make([]float32, cldGridSize)
-	}
+	y := imgproc.NewMatF32(cldGridSize, cldGridSize)
+	cb := imgproc.NewMatF32(cldGridSize, cldGridSize)
+	cr := imgproc.NewMatF32(cldGridSize, cldGridSize)
 
+	row := make([]uint32, 4*w)
+	var sy, scb, scr [cldGridSize]float64
 	for gy := 0; gy < cldGridSize; gy++ {
-		y0 := gy * h / cldGridSize
-		y1 := (gy + 1) * h / cldGridSize
-		if y1 <= y0 {
-			if y0 >= h {
-				y0 = h - 1
-			}
-			y1 = y0 + 1
-		}
-		for gx := 0; gx < cldGridSize; gx++ {
-			x0 := gx * w / cldGridSize
-			x1 := (gx + 1) * w / cldGridSize
-			if x1 <= x0 {
-				if x0 >= w {
-					x0 = w - 1
-				}
-				x1 = x0 + 1
-			}
-
-			var sy, scb, scr float64
-			var n float64
-			for yy := y0; yy < y1; yy++ {
+		y0, y1 := cldCell(gy, h)
+		sy, scb, scr = [cldGridSize]float64{}, [cldGridSize]float64{}, [cldGridSize]float64{}
+		for yy := y0; yy < y1; yy++ {
+			imgproc.RGBA64Row(img, bounds.Min.Y+yy, row)
+			for gx := 0; gx < cldGridSize; gx++ {
+				x0, x1 := cldCell(gx, w)
 				for xx := x0; xx < x1; xx++ {
-					r, g, b, _ := img.At(bounds.Min.X+xx, bounds.Min.Y+yy).RGBA()
-					yyc, cbc, crc := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
-					sy += float64(yyc)
-					scb += float64(cbc)
-					scr += float64(crc)
-					n++
+					px := row[4*xx : 4*xx+3 : 4*xx+3]
+					yyc, cbc, crc := color.RGBToYCbCr(uint8(px[0]>>8), uint8(px[1]>>8), uint8(px[2]>>8))
+					sy[gx] += float64(yyc)
+					scb[gx] += float64(cbc)
+					scr[gx] += float64(crc)
 				}
 			}
-			y[gy][gx] = float32(sy / n)
-			cb[gy][gx] = float32(scb / n)
-			cr[gy][gx] = float32(scr / n)
+		}
+		for gx := 0; gx < cldGridSize; gx++ {
+			x0, x1 := cldCell(gx, w)
+			n := float64((y1 - y0) * (x1 - x0))
+			y[gy][gx] = float32(sy[gx] / n)
+			cb[gy][gx] = float32(scb[gx] / n)
+			cr[gy][gx] = float32(scr[gx] / n)
 		}
 	}
 
 	return y, cb, cr
 }
 
+// cldCell returns the pixel range [lo, hi) of grid cell i along an axis
+// of the given size. Every cell covers at least one pixel.
+func cldCell(i, size int) (int, int) {
+	lo := i * size / cldGridSize
+	hi := (i + 1) * size / cldGridSize
+	if hi <= lo {
+		if lo >= size {
+			lo = size - 1
+		}
+		hi = lo + 1
+	}
+	return lo, hi
+}
+
 func zigZagCoeff(dct [][]float32, idx int) float64 {
 	pos := cldZigZag[idx]
 	return float64(dct[pos/cldGridSize][pos%cldGridSize])
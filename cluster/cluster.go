@@ -0,0 +1,263 @@
+// Package cluster groups images whose hashes are within a distance of each
+// other, answering "which images are the same" instead of listing
+// pairwise distances.
+//
+// Groups links every pair of items whose distance under a Comparer is at
+// most a threshold and returns the resulting groups of near-duplicates:
+//
+//	phash, _ := imghash.NewPHash()
+//	items := make([]cluster.Item[string], len(paths))
+//	for i, path := range paths {
+//		hash, err := imghash.HashFile(phash, path)
+//		if err != nil {
+//			return err
+//		}
+//		items[i] = cluster.Item[string]{ID: path, Hash: hash}
+//	}
+//	groups, err := cluster.Groups(items, phash, 8)
+//
+// By default a group is a connected component: two items share a group
+// when a chain of matches joins them. WithMethod selects complete or
+// average linkage hierarchical clustering, which stop such chains from
+// merging dissimilar images, or DBSCAN, which only grows groups from items
+// with several matches. WithRepresentative chooses which member stands for
+// each group, for instance the one with the largest resolution or the
+// earliest timestamp.
+//
+// When the comparer measures the Hamming distance, as reported by
+// imghash.ComparesHamming, Binary hashes are matched through a multi-index
+// hashing index from the index package, so grouping does not compare every
+// pair of items. Other comparers, such as hashers given WithDistance,
+// compare every pair.
+package cluster
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+var (
+	// ErrNilComparer is returned when the comparer is nil.
+	ErrNilComparer = errors.New("cluster: comparer must not be nil")
+	// ErrInvalidThreshold is returned when the threshold is negative or NaN.
+	ErrInvalidThreshold = errors.New("cluster: threshold must not be negative")
+	// ErrInvalidMethod is returned for an unknown clustering method.
+	ErrInvalidMethod = errors.New("cluster: invalid method")
+	// ErrInvalidMinPoints is returned when the DBSCAN minimum number of
+	// points is less than one.
+	ErrInvalidMinPoints = errors.New("cluster: min points must be greater than zero")
+	// ErrDuplicateID is returned when two items share an ID.
+	ErrDuplicateID = errors.New("cluster: IDs must be unique")
+	// ErrNilHash is returned when an item has no hash.
+	ErrNilHash = errors.New("cluster: hash must not be nil")
+)
+
+// Item is an image to group.
+type Item[ID comparable] struct {
+	ID   ID
+	Hash hashtype.Hash
+	// Info describes the image for the representative selector. It may be
+	// left zero when no selector uses it.
+	Info Info
+}
+
+// Info describes an image for choosing group representatives.
+type Info struct {
+	Width, Height int
+	// Time is when the image was taken or created.
+	Time time.Time
+}
+
+// Group is a set of near-duplicate images.
+type Group[ID comparable] struct {
+	// Representative is the member chosen to stand for the group.
+	Representative ID
+	// Members holds every member, including the representative, in input
+	// order.
+	Members []ID
+}
+
+// Method selects how matching items are grouped.
+type Method uint8
+
+const (
+	// Components groups items joined by a chain of matches, as connected
+	// components of the match graph (single linkage).
+	Components Method = iota + 1
+	// CompleteLinkage merges groups only while every pair of their members
+	// is within the threshold.
+	CompleteLinkage
+	// AverageLinkage merges groups while the mean distance between their
+	// members is within the threshold.
+	AverageLinkage
+	// DBSCAN grows groups from core items with at least the minimum number
+	// of matches set by WithMinPoints, counting the item itself. Items
+	// matching a core item join its group, other items are left out.
+	DBSCAN
+)
+
+var methodNames = []string{"Components", "CompleteLinkage", "AverageLinkage", "DBSCAN"}
+
+// String returns the name of the method.
+func (m Method) String() string {
+	if m >= Components && m <= DBSCAN {
+		return methodNames[m-1]
+	}
+	return "Unknown"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m Method) MarshalText() ([]byte, error) {
+	if m < Components || m > DBSCAN {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidMethod, m)
+	}
+	return []byte(strings.ToLower(m.String())), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Names are matched
+// case-insensitively.
+func (m *Method) UnmarshalText(text []byte) error {
+	for i, name := range methodNames {
+		if strings.EqualFold(string(text), name) {
+			*m = Method(i + 1)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidMethod, text)
+}
+
+// Selector orders candidate representatives. It returns a negative number
+// when a makes a better representative than b, a positive number when b
+// does and zero when they are equally good. Ties go to the member that
+// comes first in the input.
+type Selector func(a, b Info) int
+
+// LargestResolution prefers the image with the most pixels.
+func LargestResolution(a, b Info) int {
+	return cmp.Compare(b.Width*b.Height, a.Width*a.Height)
+}
+
+// Earliest prefers the image with the earliest time.
+func Earliest(a, b Info) int {
+	return a.Time.Compare(b.Time)
+}
+
+// Then returns a selector that orders by s and breaks its ties with next.
+func (s Selector) Then(next Selector) Selector {
+	return func(a, b Info) int {
+		if c := s(a, b); c != 0 {
+			return c
+		}
+		return next(a, b)
+	}
+}
+
+// Option configures Groups.
+type Option interface{ apply(*config) }
+
+type config struct {
+	method    Method
+	minPoints int
+	selector  Selector
+}
+
+type methodOption Method
+
+func (o methodOption) apply(c *config) { c.method = Method(o) }
+
+// WithMethod sets the clustering method. It defaults to Components.
+func WithMethod(m Method) Option { return methodOption(m) }
+
+type minPointsOption int
+
+func (o minPointsOption) apply(c *config) { c.minPoints = int(o) }
+
+// WithMinPoints sets the number of items, counting the item itself, that
+// must be within the threshold of an item for DBSCAN to treat it as a core
+// item. It defaults to 3 and is ignored by other methods.
+func WithMinPoints(n int) Option { return minPointsOption(n) }
+
+type selectorOption Selector
+
+func (o selectorOption) apply(c *config) { c.selector = Selector(o) }
+
+// WithRepresentative sets the selector that chooses each group's
+// representative. By default the first member in input order is chosen.
+func WithRepresentative(s Selector) Option { return selectorOption(s) }
+
+// Groups returns the groups of items whose hashes are within threshold of
+// each other under c. Items without a match are not part of any group.
+// Groups are ordered by their first member in input order.
+func Groups[ID comparable](items []Item[ID], c imghash.Comparer, threshold similarity.Distance, opts ...Option) ([]Group[ID], error) {
+	cfg := config{method: Components, minPoints: 3}
+	for _, o := range opts {
+		o.apply(&cfg)
+	}
+	switch {
+	case c == nil:
+		return nil, ErrNilComparer
+	case threshold < 0 || math.IsNaN(float64(threshold)):
+		return nil, fmt.Errorf("%w: %v", ErrInvalidThreshold, threshold)
+	case cfg.method < Components || cfg.method > DBSCAN:
+		return nil, fmt.Errorf("%w: %d", ErrInvalidMethod, cfg.method)
+	case cfg.minPoints < 1:
+		return nil, fmt.Errorf("%w: %d", ErrInvalidMinPoints, cfg.minPoints)
+	}
+	seen := make(map[ID]struct{}, len(items))
+	hashes := make([]hashtype.Hash, len(items))
+	for i, it := range items {
+		if _, ok := seen[it.ID]; ok {
+			return nil, fmt.Errorf("%w: %v", ErrDuplicateID, it.ID)
+		}
+		if it.Hash == nil {
+			return nil, fmt.Errorf("%w: %v", ErrNilHash, it.ID)
+		}
+		seen[it.ID] = struct{}{}
+		hashes[i] = it.Hash
+	}
+
+	g, err := matches(hashes, c, threshold)
+	if err != nil {
+		return nil, err
+	}
+	var sets [][]int
+	switch cfg.method {
+	case Components:
+		sets = g.components()
+	case CompleteLinkage, AverageLinkage:
+		sets, err = hierarchical(g, hashes, c, threshold, cfg.method)
+	case DBSCAN:
+		sets = dbscan(g, cfg.minPoints)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sets = slices.DeleteFunc(sets, func(s []int) bool { return len(s) < 2 })
+	for _, s := range sets {
+		slices.Sort(s)
+	}
+	slices.SortFunc(sets, func(a, b []int) int { return a[0] - b[0] })
+	groups := make([]Group[ID], len(sets))
+	for i, s := range sets {
+		best := s[0]
+		members := make([]ID, len(s))
+		for j, idx := range s {
+			members[j] = items[idx].ID
+			if cfg.selector != nil && cfg.selector(items[idx].Info, items[best].Info) < 0 {
+				best = idx
+			}
+		}
+		groups[i] = Group[ID]{Representative: items[best].ID, Members: members}
+	}
+	return groups, nil
+}
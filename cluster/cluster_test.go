@@ -0,0 +1,250 @@
+package cluster_test
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/cluster"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/index"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// compareFunc adapts a distance function to imghash.Comparer.
+type compareFunc func(hashtype.Hash, hashtype.Hash) (similarity.Distance, error)
+
+func (f compareFunc) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) { return f(h1, h2) }
+
+// hammingComparer measures the Hamming distance and reports it, so Groups
+// matches its hashes through the index.
+type hammingComparer struct{}
+
+func (hammingComparer) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
+	return similarity.Hamming(h1, h2)
+}
+
+func (hammingComparer) ComparesHamming() bool { return true }
+
+var (
+	hamming = compareFunc(similarity.Hamming)
+	indexed = hammingComparer{}
+	l2      = compareFunc(similarity.L2)
+)
+
+// chain holds a, b, c and d, each one bit from the next, a pair e and f
+// one bit apart, and g, at least three bits from everything else.
+func chain() []cluster.Item[string] {
+	hashes := map[string]byte{
+		"a": 0b00000000, "b": 0b00000001, "c": 0b00000011, "d": 0b00000111,
+		"e": 0b11110000, "f": 0b11110001, "g": 0b01010101,
+	}
+	var items []cluster.Item[string]
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		items = append(items, cluster.Item[string]{ID: id, Hash: hashtype.Binary{hashes[id]}})
+	}
+	return items
+}
+
+func members(groups []cluster.Group[string]) [][]string {
+	out := make([][]string, len(groups))
+	for i, g := range groups {
+		out[i] = g.Members
+	}
+	return out
+}
+
+func TestGroups(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold similarity.Distance
+		opts      []cluster.Option
+		want      [][]string
+	}{
+		{"components", 1, nil, [][]string{{"a", "b", "c", "d"}, {"e", "f"}}},
+		{"components zero threshold", 0, nil, [][]string{}},
+		{"complete linkage", 2, []cluster.Option{cluster.WithMethod(cluster.CompleteLinkage)}, [][]string{{"a", "b"}, {"c", "d"}, {"e", "f"}}},
+		{"average linkage", 2, []cluster.Option{cluster.WithMethod(cluster.AverageLinkage)}, [][]string{{"a", "b", "c", "d"}, {"e", "f"}}},
+		{"average linkage tight", 1.5, []cluster.Option{cluster.WithMethod(cluster.AverageLinkage)}, [][]string{{"a", "b"}, {"c", "d"}, {"e", "f"}}},
+		{"dbscan", 1, []cluster.Option{cluster.WithMethod(cluster.DBSCAN)}, [][]string{{"a", "b", "c", "d"}}},
+		{"dbscan two points", 1, []cluster.Option{cluster.WithMethod(cluster.DBSCAN), cluster.WithMinPoints(2)}, [][]string{{"a", "b", "c", "d"}, {"e", "f"}}},
+		{"dbscan four points", 1, []cluster.Option{cluster.WithMethod(cluster.DBSCAN), cluster.WithMinPoints(4)}, [][]string{}},
+	}
+	for _, tt := range tests {
+		for _, c := range []imghash.Comparer{hamming, indexed} {
+			name := tt.name
+			if c == indexed {
+				name += " indexed"
+			}
+			t.Run(name, func(t *testing.T) {
+				groups, err := cluster.Groups(chain(), c, tt.threshold, tt.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := members(groups); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestGroups_float(t *testing.T) {
+	items := []cluster.Item[int]{
+		{ID: 1, Hash: hashtype.Float64{0, 0}},
+		{ID: 2, Hash: hashtype.Float64{10, 10}},
+		{ID: 3, Hash: hashtype.Float64{0.3, 0.4}},
+		{ID: 4, Hash: hashtype.Float64{10, 10.5}},
+	}
+	groups, err := cluster.Groups(items, l2, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cluster.Group[int]{{Representative: 1, Members: []int{1, 3}}, {Representative: 2, Members: []int{2, 4}}}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("got %v, want %v", groups, want)
+	}
+}
+
+func TestGroups_representative(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	items := []cluster.Item[string]{
+		{ID: "small", Hash: hashtype.Binary{0}, Info: cluster.Info{Width: 100, Height: 100, Time: day}},
+		{ID: "large", Hash: hashtype.Binary{1}, Info: cluster.Info{Width: 400, Height: 300, Time: day.Add(time.Hour)}},
+		{ID: "large copy", Hash: hashtype.Binary{2}, Info: cluster.Info{Width: 300, Height: 400, Time: day.Add(-time.Hour)}},
+	}
+	tests := []struct {
+		name string
+		opts []cluster.Option
+		want string
+	}{
+		{"default", nil, "small"},
+		{"largest resolution", []cluster.Option{cluster.WithRepresentative(cluster.LargestResolution)}, "large"},
+		{"earliest", []cluster.Option{cluster.WithRepresentative(cluster.Earliest)}, "large copy"},
+		{"then", []cluster.Option{cluster.WithRepresentative(cluster.Selector(cluster.LargestResolution).Then(cluster.Earliest))}, "large copy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups, err := cluster.Groups(items, hamming, 2, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(groups) != 1 || groups[0].Representative != tt.want {
+				t.Errorf("got %v, want representative %q", groups, tt.want)
+			}
+		})
+	}
+}
+
+// TestGroups_indexMatchesExhaustive checks that grouping through the index
+// finds the same groups as comparing every pair.
+func TestGroups_indexMatchesExhaustive(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	var items []cluster.Item[int]
+	for len(items) < 600 {
+		base := make(hashtype.Binary, 8)
+		for i := range base {
+			base[i] = byte(r.UintN(256))
+		}
+		for range 1 + r.IntN(4) {
+			h := append(hashtype.Binary(nil), base...)
+			for range r.IntN(8) {
+				bit := r.IntN(64)
+				h[bit/8] ^= 1 << (bit % 8)
+			}
+			items = append(items, cluster.Item[int]{ID: len(items), Hash: h})
+		}
+	}
+	for _, m := range []cluster.Method{cluster.Components, cluster.CompleteLinkage, cluster.AverageLinkage, cluster.DBSCAN} {
+		t.Run(m.String(), func(t *testing.T) {
+			viaIndex, err := cluster.Groups(items, indexed, 6, cluster.WithMethod(m))
+			if err != nil {
+				t.Fatal(err)
+			}
+			exhaustive, err := cluster.Groups(items, hamming, 6, cluster.WithMethod(m))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(viaIndex) == 0 || !reflect.DeepEqual(viaIndex, exhaustive) {
+				t.Errorf("indexed %d groups, exhaustive %d groups, want equal and non-empty", len(viaIndex), len(exhaustive))
+			}
+		})
+	}
+}
+
+// TestGroups_customDistance checks that binary hashes compared with
+// another metric than the Hamming distance find matches the index would
+// miss.
+func TestGroups_customDistance(t *testing.T) {
+	jaccard, err := imghash.NewAverage(imghash.WithDistance(similarity.Jaccard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a and b share three of four set bits, a Jaccard distance of 0.25
+	// but a Hamming distance of 1.
+	items := []cluster.Item[string]{
+		{ID: "a", Hash: hashtype.Binary{0b00001111}},
+		{ID: "b", Hash: hashtype.Binary{0b00001110}},
+		{ID: "c", Hash: hashtype.Binary{0b11110000}},
+	}
+	groups, err := cluster.Groups(items, jaccard, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := members(groups), [][]string{{"a", "b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGroups_errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		items     []cluster.Item[string]
+		comparer  imghash.Comparer
+		threshold similarity.Distance
+		opts      []cluster.Option
+		want      error
+	}{
+		{"nil comparer", chain(), nil, 1, nil, cluster.ErrNilComparer},
+		{"negative threshold", chain(), hamming, -1, nil, cluster.ErrInvalidThreshold},
+		{"NaN threshold", chain(), hamming, similarity.Distance(math.NaN()), nil, cluster.ErrInvalidThreshold},
+		{"invalid method", chain(), hamming, 1, []cluster.Option{cluster.WithMethod(0)}, cluster.ErrInvalidMethod},
+		{"invalid min points", chain(), hamming, 1, []cluster.Option{cluster.WithMethod(cluster.DBSCAN), cluster.WithMinPoints(0)}, cluster.ErrInvalidMinPoints},
+		{"duplicate ID", append(chain(), cluster.Item[string]{ID: "a", Hash: hashtype.Binary{0}}), hamming, 1, nil, cluster.ErrDuplicateID},
+		{"nil hash", append(chain(), cluster.Item[string]{ID: "x"}), hamming, 1, nil, cluster.ErrNilHash},
+		{"length mismatch", append(chain(), cluster.Item[string]{ID: "x", Hash: hashtype.Binary{0, 0}}), indexed, 1, nil, index.ErrHashLengthMismatch},
+		{"compare error", append(chain(), cluster.Item[string]{ID: "x", Hash: hashtype.Float64{0}}), hamming, 1, nil, similarity.ErrNotBinaryHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cluster.Groups(tt.items, tt.comparer, tt.threshold, tt.opts...)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMethod_text(t *testing.T) {
+	for _, m := range []cluster.Method{cluster.Components, cluster.CompleteLinkage, cluster.AverageLinkage, cluster.DBSCAN} {
+		text, err := m.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got cluster.Method
+		if err := got.UnmarshalText(text); err != nil || got != m {
+			t.Errorf("%v: got %v, %v", m, got, err)
+		}
+	}
+	var m cluster.Method
+	if err := m.UnmarshalText([]byte("kmeans")); !errors.Is(err, cluster.ErrInvalidMethod) {
+		t.Errorf("got %v, want ErrInvalidMethod", err)
+	}
+	if _, err := cluster.Method(9).MarshalText(); !errors.Is(err, cluster.ErrInvalidMethod) {
+		t.Errorf("got %v, want ErrInvalidMethod", err)
+	}
+}
@@ -0,0 +1,50 @@
+package cluster
+
+// dbscan clusters g with DBSCAN (Ester, Kriegel, Sander and Xu, "A
+// Density-Based Algorithm for Discovering Clusters in Large Spatial
+// Databases with Noise", KDD 1996), using the threshold of g as the
+// neighbourhood radius.
+//
+// An item with at least minPoints items in its neighbourhood, itself
+// included, is a core item. Clusters are the items reachable through
+// chains of core items; a border item reachable from several clusters
+// joins the first one found in input order. Other items are noise and are
+// returned as singletons.
+func dbscan(g graph, minPoints int) [][]int {
+	label := make([]int, len(g))
+	for i := range label {
+		label[i] = -1
+	}
+	core := func(i int) bool { return len(g[i])+1 >= minPoints }
+
+	var out [][]int
+	for i := range g {
+		if label[i] >= 0 || !core(i) {
+			continue
+		}
+		id := len(out)
+		label[i] = id
+		set := []int{i}
+		for queue := []int{i}; len(queue) > 0; {
+			p := queue[0]
+			queue = queue[1:]
+			for _, e := range g[p] {
+				if label[e.to] >= 0 {
+					continue
+				}
+				label[e.to] = id
+				set = append(set, e.to)
+				if core(e.to) {
+					queue = append(queue, e.to)
+				}
+			}
+		}
+		out = append(out, set)
+	}
+	for i, l := range label {
+		if l < 0 {
+			out = append(out, []int{i})
+		}
+	}
+	return out
+}
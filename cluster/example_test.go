@@ -0,0 +1,76 @@
+package cluster_test
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/cluster"
+	"github.com/ajdnik/imghash/v2/eval"
+)
+
+func ExampleGroups() {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		panic(err)
+	}
+	lena, err := imghash.Open("../assets/lena.jpg")
+	if err != nil {
+		panic(err)
+	}
+	peppers, err := imghash.Open("../assets/peppers.jpg")
+	if err != nil {
+		panic(err)
+	}
+	small, err := eval.Scale(0.5).Apply(lena)
+	if err != nil {
+		panic(err)
+	}
+	images := map[string]image.Image{"lena.jpg": lena, "lena-small.jpg": small, "peppers.jpg": peppers}
+
+	var items []cluster.Item[string]
+	for _, name := range []string{"lena-small.jpg", "peppers.jpg", "lena.jpg"} {
+		hash, err := pdq.Calculate(images[name])
+		if err != nil {
+			panic(err)
+		}
+		b := images[name].Bounds()
+		items = append(items, cluster.Item[string]{ID: name, Hash: hash, Info: cluster.Info{Width: b.Dx(), Height: b.Dy()}})
+	}
+
+	groups, err := cluster.Groups(items, pdq, 31, cluster.WithRepresentative(cluster.LargestResolution))
+	if err != nil {
+		panic(err)
+	}
+	for _, g := range groups {
+		fmt.Printf("keep %s of %v\n", g.Representative, g.Members)
+	}
+	// Output:
+	// keep lena.jpg of [lena-small.jpg lena.jpg]
+}
+
+func ExampleWithMethod() {
+	// Average compares Binary hashes by their Hamming distance.
+	average, err := imghash.NewAverage()
+	if err != nil {
+		panic(err)
+	}
+	var items []cluster.Item[int]
+	for i, b := range []byte{0b0000, 0b0001, 0b0011, 0b0111} {
+		items = append(items, cluster.Item[int]{ID: i, Hash: imghash.Binary{b}})
+	}
+	for _, m := range []cluster.Method{cluster.Components, cluster.CompleteLinkage} {
+		groups, err := cluster.Groups(items, average, 2, cluster.WithMethod(m))
+		if err != nil {
+			panic(err)
+		}
+		fmt.Print(m, ":")
+		for _, g := range groups {
+			fmt.Print(" ", g.Members)
+		}
+		fmt.Println()
+	}
+	// Output:
+	// Components: [0 1 2 3]
+	// CompleteLinkage: [0 1] [2 3]
+}
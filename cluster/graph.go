@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/index"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// graph holds, for every item, the items within the threshold of it,
+// ordered by index.
+type graph [][]edge
+
+type edge struct {
+	to   int
+	dist similarity.Distance
+}
+
+// matches builds the match graph of hashes. Binary hashes are looked up in
+// a multi-index hashing index when c measures the Hamming distance;
+// candidates are always confirmed with c so that the graph holds its
+// distances.
+func matches(hashes []hashtype.Hash, c imghash.Comparer, threshold similarity.Distance) (graph, error) {
+	g := make(graph, len(hashes))
+	link := func(i, j int) error {
+		d, err := c.Compare(hashes[i], hashes[j])
+		if err != nil {
+			return err
+		}
+		if d <= threshold {
+			g[i] = append(g[i], edge{j, d})
+			g[j] = append(g[j], edge{i, d})
+		}
+		return nil
+	}
+
+	if !imghash.ComparesHamming(c) || !allBinary(hashes) {
+		for i := range hashes {
+			for j := i + 1; j < len(hashes); j++ {
+				if err := link(i, j); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return g, nil
+	}
+
+	idx, err := index.NewMIH[int]()
+	if err != nil {
+		return nil, err
+	}
+	for i, hash := range hashes {
+		if err := idx.Insert(i, hash); err != nil {
+			return nil, err
+		}
+	}
+	for i, hash := range hashes {
+		found, err := idx.RadiusSearch(hash, threshold)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range found {
+			if r.ID > i {
+				if err := link(i, r.ID); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, edges := range g {
+		slices.SortFunc(edges, func(a, b edge) int { return cmp.Compare(a.to, b.to) })
+	}
+	return g, nil
+}
+
+func allBinary(hashes []hashtype.Hash) bool {
+	for _, h := range hashes {
+		if _, ok := h.(hashtype.Binary); !ok {
+			return false
+		}
+	}
+	return len(hashes) > 0
+}
+
+// components returns the connected components of g.
+func (g graph) components() [][]int {
+	uf := newUnionFind(len(g))
+	for i, edges := range g {
+		for _, e := range edges {
+			uf.union(i, e.to)
+		}
+	}
+	return uf.sets()
+}
+
+// unionFind groups items connected by a chain of matches.
+type unionFind []int
+
+func newUnionFind(n int) unionFind {
+	uf := make(unionFind, n)
+	for i := range uf {
+		uf[i] = i
+	}
+	return uf
+}
+
+func (uf unionFind) find(i int) int {
+	for uf[i] != i {
+		uf[i] = uf[uf[i]]
+		i = uf[i]
+	}
+	return i
+}
+
+func (uf unionFind) union(a, b int) {
+	ra, rb := uf.find(a), uf.find(b)
+	if ra < rb {
+		uf[rb] = ra
+	} else if rb < ra {
+		uf[ra] = rb
+	}
+}
+
+// sets returns every set, ordered by its smallest element.
+func (uf unionFind) sets() [][]int {
+	byRoot := make(map[int][]int)
+	for i := range uf {
+		r := uf.find(i)
+		byRoot[r] = append(byRoot[r], i)
+	}
+	var out [][]int
+	for i := range uf {
+		if s, ok := byRoot[i]; ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"math"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// hierarchical runs agglomerative clustering with complete or average
+// linkage, merging the closest pair of clusters until no pair is within
+// threshold.
+//
+// Two clusters with no match between them are further apart than
+// threshold under either linkage, so clusters never span connected
+// components of g and each component is clustered on its own. Within a
+// component every pair is compared, which suits the small groups typical
+// of near-duplicates.
+func hierarchical(g graph, hashes []hashtype.Hash, c imghash.Comparer, threshold similarity.Distance, m Method) ([][]int, error) {
+	var out [][]int
+	for _, comp := range g.components() {
+		if len(comp) < 2 {
+			out = append(out, comp)
+			continue
+		}
+		dist, err := distances(g, comp, hashes, c, m == AverageLinkage)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, agglomerate(comp, dist, float64(threshold), m)...)
+	}
+	return out, nil
+}
+
+// distances returns the matrix of distances between the members of comp.
+// Pairs without a match in g are compared with c when exact is set and are
+// infinite otherwise, which complete linkage treats alike.
+func distances(g graph, comp []int, hashes []hashtype.Hash, c imghash.Comparer, exact bool) ([][]float64, error) {
+	pos := make(map[int]int, len(comp))
+	for i, idx := range comp {
+		pos[idx] = i
+	}
+	dist := make([][]float64, len(comp))
+	for i := range dist {
+		dist[i] = make([]float64, len(comp))
+		for j := range dist[i] {
+			if i != j {
+				dist[i][j] = math.Inf(1)
+			}
+		}
+	}
+	for i, idx := range comp {
+		for _, e := range g[idx] {
+			dist[i][pos[e.to]] = float64(e.dist)
+		}
+	}
+	if !exact {
+		return dist, nil
+	}
+	for i := range comp {
+		for j := i + 1; j < len(comp); j++ {
+			if !math.IsInf(dist[i][j], 1) {
+				continue
+			}
+			d, err := c.Compare(hashes[comp[i]], hashes[comp[j]])
+			if err != nil {
+				return nil, err
+			}
+			dist[i][j], dist[j][i] = float64(d), float64(d)
+		}
+	}
+	return dist, nil
+}
+
+// agglomerate merges the clusters of comp, starting from singletons, and
+// updates dist in place with the Lance-Williams formula of the linkage.
+func agglomerate(comp []int, dist [][]float64, threshold float64, m Method) [][]int {
+	members := make([][]int, len(comp))
+	for i, idx := range comp {
+		members[i] = []int{idx}
+	}
+	active := make([]bool, len(comp))
+	for i := range active {
+		active[i] = true
+	}
+	for {
+		a, b, best := -1, -1, math.Inf(1)
+		for i := range dist {
+			if !active[i] {
+				continue
+			}
+			for j := i + 1; j < len(dist); j++ {
+				if active[j] && dist[i][j] < best {
+					a, b, best = i, j, dist[i][j]
+				}
+			}
+		}
+		if a < 0 || best > threshold {
+			break
+		}
+		na, nb := float64(len(members[a])), float64(len(members[b]))
+		for k := range dist {
+			if !active[k] || k == a || k == b {
+				continue
+			}
+			var d float64
+			if m == CompleteLinkage {
+				d = max(dist[a][k], dist[b][k])
+			} else {
+				d = (na*dist[a][k] + nb*dist[b][k]) / (na + nb)
+			}
+			dist[a][k], dist[k][a] = d, d
+		}
+		members[a] = append(members[a], members[b]...)
+		active[b] = false
+	}
+	var out [][]int
+	for i, s := range members {
+		if active[i] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ajdnik/imghash/v2"
+)
+
+// optionFlags returns one flag per parameter name in the schemas of all
+// registered algorithms. Flag names are the kebab-case form of the
+// parameter names, e.g. -kernel-size for kernel_size.
+func optionFlags() []imghash.Param {
+	var params []imghash.Param
+	for _, name := range imghash.Algorithms() {
+		a, _ := imghash.Lookup(name)
+		for _, p := range a.Params {
+			if !slices.ContainsFunc(params, func(q imghash.Param) bool { return q.Name == p.Name }) {
+				params = append(params, p)
+			}
+		}
+	}
+	slices.SortFunc(params, func(a, b imghash.Param) int { return strings.Compare(a.Name, b.Name) })
+	return params
+}
+
+func flagName(param string) string {
+	return strings.ReplaceAll(param, "_", "-")
+}
+
+// flagUsage returns the usage text of a parameter flag. The back-quoted
+// word is the placeholder shown by flag.PrintDefaults.
+func flagUsage(p imghash.Param) string {
+	switch p.Type {
+	case imghash.ParamInt:
+		return p.Doc + ", an `int`"
+	case imghash.ParamUint:
+		return p.Doc + ", a `uint`"
+	case imghash.ParamFloat:
+		return p.Doc + ", a `float`"
+	case imghash.ParamDims:
+		return p.Doc + ", as `WxH`"
+	case imghash.ParamEnum:
+		return p.Doc + ", a `name`: " + strings.Join(p.Values, ", ")
+	case imghash.ParamFloats:
+		return p.Doc + ", comma-separated `floats`"
+	case imghash.ParamColor:
+		return p.Doc + ", as `#RRGGBB`"
+	case imghash.ParamString:
+		return p.Doc + ", a `string`"
+	}
+	return p.Doc
+}
+
+// algorithmFlags holds the algorithm selection flags of a subcommand.
+type algorithmFlags struct {
+	fs   *flag.FlagSet
+	name string
+}
+
+func addAlgorithmFlags(fs *flag.FlagSet) *algorithmFlags {
+	a := &algorithmFlags{fs: fs}
+	fs.StringVar(&a.name, "algo", "pdq", "hash `algorithm`: "+strings.Join(imghash.Algorithms(), ", "))
+	for _, p := range optionFlags() {
+		fs.String(flagName(p.Name), "", flagUsage(p))
+	}
+	return a
+}
+
+// hasher builds the selected algorithm from the flags set on the command
+// line. Values are passed to imghash.New as strings, so parsing and
+// validation stay in the library.
+func (a *algorithmFlags) hasher() (imghash.HasherComparer, error) {
+	return a.build(a.name)
+}
+
+// hashers builds every algorithm of a comma-separated -algo list, such as
+// "pdq,phash". Option flags must apply to all of them.
+func (a *algorithmFlags) hashers() ([]imghash.HasherComparer, []string, error) {
+	var hs []imghash.HasherComparer
+	var names []string
+	for name := range strings.SplitSeq(a.name, ",") {
+		name = strings.TrimSpace(name)
+		h, err := a.build(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		hs = append(hs, h)
+		names = append(names, name)
+	}
+	return hs, names, nil
+}
+
+func (a *algorithmFlags) build(name string) (imghash.HasherComparer, error) {
+	algo, ok := imghash.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown algorithm %q", name)
+	}
+	params := make(map[string]any)
+	for _, p := range optionFlags() {
+		name := flagName(p.Name)
+		if !a.isSet(name) {
+			continue
+		}
+		if !slices.ContainsFunc(algo.Params, func(q imghash.Param) bool { return q.Name == p.Name }) {
+			return nil, fmt.Errorf("flag -%s does not apply to %s", name, algo.Name)
+		}
+		params[p.Name] = a.fs.Lookup(name).Value.String()
+	}
+	return imghash.New(algo.Name, params)
+}
+
+func (a *algorithmFlags) isSet(name string) bool {
+	set := false
+	a.fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
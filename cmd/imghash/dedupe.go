@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/cluster"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// imageExtensions lists the file extensions dedupe hashes.
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".tif", ".tiff"}
+
+func runDedupe(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("imghash dedupe", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: imghash dedupe [flags] DIR...")
+		flags.PrintDefaults()
+	}
+	algo := addAlgorithmFlags(flags)
+	threshold := flags.Float64("threshold", 0, "maximum `distance` at which two images are duplicates")
+	method := cluster.Components
+	flags.TextVar(&method, "method", cluster.Components, "clustering `method`: components, completelinkage, averagelinkage or dbscan")
+	minPoints := flags.Int("min-points", 3, "matches, counting the image itself, that make an image a DBSCAN core `point`")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of images hashed concurrently")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	h, err := algo.hasher()
+	if err != nil {
+		fmt.Fprintf(stderr, "imghash dedupe: %v\n", err)
+		return exitUsage
+	}
+
+	status := exitOK
+	paths, errs := imagePaths(flags.Args())
+	for _, err := range errs {
+		fmt.Fprintf(stderr, "imghash dedupe: %v\n", err)
+		status = exitError
+	}
+
+	results, err := imghash.HashAll(context.Background(), []imghash.Hasher{h}, imghash.Files(paths...), imghash.WithWorkers(max(1, *workers)))
+	if err != nil {
+		fmt.Fprintf(stderr, "imghash dedupe: %v\n", err)
+		return exitError
+	}
+	hashes := make([]hashtype.Hash, len(paths))
+	for r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(stderr, "imghash dedupe: %s: %v\n", r.Source.Key, r.Err)
+			status = exitError
+			continue
+		}
+		hashes[r.Index] = r.Hashes[0]
+	}
+	var items []cluster.Item[string]
+	for i, hash := range hashes {
+		if hash != nil {
+			items = append(items, cluster.Item[string]{ID: paths[i], Hash: hash})
+		}
+	}
+
+	groups, err := cluster.Groups(items, h, similarity.Distance(*threshold), cluster.WithMethod(method), cluster.WithMinPoints(*minPoints))
+	if err != nil {
+		fmt.Fprintf(stderr, "imghash dedupe: %v\n", err)
+		return exitError
+	}
+
+	out := make([][]string, len(groups))
+	for i, g := range groups {
+		out[i] = g.Members
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "imghash dedupe: %v\n", err)
+		return exitError
+	}
+	fmt.Fprintf(stdout, "%s\n", data)
+	return status
+}
+
+// imagePaths walks the given directory trees and returns the files with
+// one of the imageExtensions, each once, along with the errors met while
+// walking. An entry that cannot be read is reported and skipped; the walk
+// goes on with the rest of the tree.
+func imagePaths(roots []string) ([]string, []error) {
+	var paths []string
+	var errs []error
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				errs = append(errs, err)
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if !d.IsDir() && !seen[path] && slices.Contains(imageExtensions, strings.ToLower(filepath.Ext(path))) {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return paths, errs
+}
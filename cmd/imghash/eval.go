@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/eval"
+)
+
+func runEval(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("imghash eval", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: imghash eval [flags] DIR|FILE...")
+		flags.PrintDefaults()
+	}
+	algo := addAlgorithmFlags(flags)
+	attacks := flags.String("attacks", "standard", "comma-separated `attacks`, e.g. jpeg:50,scale:0.5,rotate:5,crop:0.1,gamma:1.5,blur:1,noise:8,watermark:0.5,fliph,flipv or standard")
+	format := flags.String("format", "csv", "output `format`: csv for one row per algorithm and attack, roc for one row per ROC point, or json")
+	impostors := flags.Int("impostors", 100, "number of other images each image is paired with, 0 for all")
+	points := flags.Int("roc-points", 100, "maximum number of points per ROC curve, 0 for all")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of images processed concurrently")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	hs, names, err := algo.hashers()
+	if err != nil {
+		fmt.Fprintf(stderr, "imghash eval: %v\n", err)
+		return exitUsage
+	}
+	hashers := make([]eval.Hasher, len(hs))
+	for i, h := range hs {
+		hashers[i] = eval.Hasher{Name: names[i], HasherComparer: h}
+	}
+	as, err := eval.ParseAttacks(*attacks)
+	if err != nil {
+		fmt.Fprintf(stderr, "imghash eval: %v\n", err)
+		return exitUsage
+	}
+	var write func(*eval.Report) error
+	switch *format {
+	case "csv":
+		write = func(r *eval.Report) error { return r.WriteCSV(stdout) }
+	case "roc":
+		write = func(r *eval.Report) error { return r.WriteROCCSV(stdout) }
+	case "json":
+		write = func(r *eval.Report) error {
+			data, err := json.MarshalIndent(r, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(stdout, "%s\n", data)
+			return err
+		}
+	default:
+		fmt.Fprintf(stderr, "imghash eval: unknown format %q\n", *format)
+		return exitUsage
+	}
+
+	status := exitOK
+	paths, errs := imagePaths(flags.Args())
+	for _, err := range errs {
+		fmt.Fprintf(stderr, "imghash eval: %v\n", err)
+		status = exitError
+	}
+	report, err := eval.Run(context.Background(), imghash.Files(paths...), hashers,
+		eval.WithAttacks(as...), eval.WithImpostors(*impostors), eval.WithROCPoints(*points), eval.WithWorkers(max(1, *workers)))
+	if report != nil {
+		for _, f := range report.Failures {
+			fmt.Fprintf(stderr, "imghash eval: %v\n", f)
+			status = exitError
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "imghash eval: %v\n", err)
+		return exitError
+	}
+	if err := write(report); err != nil {
+		fmt.Fprintf(stderr, "imghash eval: %v\n", err)
+		return exitError
+	}
+	return status
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+func runHash(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("imghash hash", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: imghash hash [flags] FILE...")
+		fs.PrintDefaults()
+	}
+	algo := addAlgorithmFlags(fs)
+	format := fs.String("format", "hex", "output `format`: hex, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	h, err := algo.hasher()
+	if err != nil {
+		fmt.Fprintf(stderr, "imghash hash: %v\n", err)
+		return exitUsage
+	}
+	w, err := newHashWriter(*format, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "imghash hash: %v\n", err)
+		return exitUsage
+	}
+
+	status := exitOK
+	for _, path := range fs.Args() {
+		hash, err := imghash.HashFile(h, path, imghash.WithOrientation(true))
+		if err == nil {
+			err = w.write(path, h, hash)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "imghash hash: %s: %v\n", path, err)
+			status = exitError
+		}
+	}
+	if err := w.flush(); err != nil {
+		fmt.Fprintf(stderr, "imghash hash: %v\n", err)
+		return exitError
+	}
+	return status
+}
+
+// hashWriter prints hashes in one of the supported output formats.
+type hashWriter struct {
+	format string
+	out    io.Writer
+	csv    *csv.Writer
+}
+
+func newHashWriter(format string, out io.Writer) (*hashWriter, error) {
+	w := &hashWriter{format: format, out: out}
+	switch format {
+	case "hex", "json":
+	case "csv":
+		w.csv = csv.NewWriter(out)
+		if err := w.csv.Write([]string{"path", "algorithm", "kind", "hash"}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return w, nil
+}
+
+func (w *hashWriter) write(path string, h imghash.Hasher, hash hashtype.Hash) error {
+	switch w.format {
+	case "hex":
+		_, err := fmt.Fprintf(w.out, "%s  %s\n", payload(h, hash), path)
+		return err
+	case "csv":
+		env, err := imghash.NewEnvelope(h, hash)
+		if err != nil {
+			return err
+		}
+		return w.csv.Write([]string{path, env.Algorithm, env.Kind().String(), payload(h, hash)})
+	default:
+		env, err := imghash.NewEnvelope(h, hash)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(struct {
+			Path     string           `json:"path"`
+			Envelope imghash.Envelope `json:"envelope"`
+		}{path, env})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w.out, "%s\n", data)
+		return err
+	}
+}
+
+func (w *hashWriter) flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// payload returns the text form of a hash without its kind prefix:
+// lowercase hex for Binary and UInt8, comma-separated values for Float64
+// and the text forms of the parts separated by semicolons for Composite.
+// Binary hashes are printed in the bit order of h (see hexOrder).
+func payload(h imghash.Hasher, hash hashtype.Hash) string {
+	if b, ok := hash.(hashtype.Binary); ok {
+		return b.Hex(hexOrder(h))
+	}
+	m, ok := hash.(encoding.TextMarshaler)
+	if !ok {
+		return fmt.Sprint(hash)
+	}
+	text, err := m.MarshalText()
+	if err != nil {
+		return fmt.Sprint(hash)
+	}
+	_, p, _ := strings.Cut(string(text), ":")
+	return p
+}
+
+// hexOrder returns the bit order of the plain hex form of the hashes of h.
+// PDQ hashes use LSB0, the form printed by Meta's tools and exchanged
+// through ThreatExchange; other hashes are printed in storage order.
+func hexOrder(h imghash.Hasher) hashtype.BitOrder {
+	if spec, err := imghash.Describe(h); err == nil && spec.Name == "pdq" {
+		return hashtype.LSB0
+	}
+	return hashtype.MSB0
+}
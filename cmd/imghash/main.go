@@ -0,0 +1,86 @@
+// Command imghash computes, compares and deduplicates perceptual image hashes.
+//
+// Usage:
+//
+//	imghash hash [flags] FILE...
+//	imghash compare [flags] A B
+//	imghash dedupe [flags] DIR...
+//	imghash eval [flags] DIR|FILE...
+//
+// The hash subcommand prints one hash per file as hex, JSON Lines or CSV.
+// The compare subcommand prints the distance between two operands, each of
+// which is either an image file or an encoded hash. The dedupe subcommand
+// walks directory trees and prints groups of near-duplicate images as JSON.
+// The eval subcommand measures how well hashes survive image attacks such
+// as compression, rescaling and rotation across a corpus of images, and
+// prints distance statistics, AUC and equal error rates or ROC curves as
+// CSV or JSON; its -algo flag takes a comma-separated list of algorithms.
+//
+// All subcommands accept -algo to select the algorithm by name and one flag
+// per With* option of the imghash package, such as -size 16x16,
+// -interpolation Bicubic or -level 2. Flags that do not apply to the
+// selected algorithm are rejected, and values are validated by the
+// algorithm's constructor.
+//
+// The exit status is 0 on success, 1 if any file could not be processed and
+// 2 on invalid usage.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Exit statuses.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+var commands = []struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}{
+	{"hash", "compute hashes of image files", runHash},
+	{"compare", "print the distance between two images or hashes", runCompare},
+	{"dedupe", "group near-duplicate images found in directories", runDedupe},
+	{"eval", "measure hash robustness to image attacks", runEval},
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return exitOK
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "imghash: unknown command %q\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: imghash <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "imghash <command> -h" for the flags of a command.`)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+)
+
+const (
+	catJPG  = "../../assets/cat.jpg"
+	lenaJPG = "../../assets/lena.jpg"
+)
+
+func runCmd(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+var runTests = []struct {
+	name   string
+	args   []string
+	code   int
+	stdout string
+	stderr string
+}{
+	{"no command", nil, exitUsage, "", "Usage: imghash"},
+	{"help", []string{"help"}, exitOK, "Commands:", ""},
+	{"unknown command", []string{"frobnicate"}, exitUsage, "", `unknown command "frobnicate"`},
+	{"hash hex", []string{"hash", "-algo", "average", catJPG}, exitOK, "ffff0f0701000000  " + catJPG + "\n", ""},
+	{"hash pdq hex", []string{"hash", catJPG}, exitOK, "b8c13215a7265d236d59e2e3999c12994e55f2e63192752aa93d2be15ad31eab  " + catJPG + "\n", ""},
+	{"hash csv", []string{"hash", "-algo", "average", "-format", "csv", catJPG}, exitOK, "path,algorithm,kind,hash\n" + catJPG + ",average,binary,ffff0f0701000000\n", ""},
+	{"hash no files", []string{"hash"}, exitUsage, "", "Usage: imghash hash"},
+	{"hash unknown algorithm", []string{"hash", "-algo", "nope", catJPG}, exitUsage, "", `unknown algorithm "nope"`},
+	{"hash unknown format", []string{"hash", "-format", "xml", catJPG}, exitUsage, "", `unknown format "xml"`},
+	{"hash inapplicable flag", []string{"hash", "-algo", "average", "-level", "2", catJPG}, exitUsage, "", "flag -level does not apply"},
+	{"hash invalid value", []string{"hash", "-algo", "average", "-size", "8", catJPG}, exitUsage, "", "invalid parameter value for \"size\""},
+	{"hash constructor validation", []string{"hash", "-algo", "average", "-size", "0x8", catJPG}, exitUsage, "", "size dimensions must be greater than zero"},
+	{"hash missing file", []string{"hash", "-algo", "average", "missing.jpg", catJPG}, exitError, "ffff0f0701000000  " + catJPG + "\n", "missing.jpg"},
+	{"compare files", []string{"compare", "-algo", "average", catJPG, catJPG}, exitOK, "0\n", ""},
+	{"compare file and hash", []string{"compare", "-algo", "average", catJPG, "binary:ffff0f0701000003"}, exitOK, "2\n", ""},
+	{"compare plain hex", []string{"compare", "-algo", "average", "ffff0f0701000000", "ffff0f0701000001"}, exitOK, "1\n", ""},
+	{"compare pdq hex", []string{"compare", catJPG, "b8c13215a7265d236d59e2e3999c12994e55f2e63192752aa93d2be15ad31eaa"}, exitOK, "1\n", ""},
+	{"compare distance flag", []string{"compare", "-algo", "average", "-distance", "jaccard", "ff", "0f"}, exitOK, "0.5\n", ""},
+	{"compare bad operand", []string{"compare", "-algo", "average", catJPG, "zz"}, exitError, "", "not a file or an encoded hash"},
+	{"compare one operand", []string{"compare", catJPG}, exitUsage, "", "Usage: imghash compare"},
+	{"eval csv", []string{"eval", "-algo", "average,difference", "-attacks", "jpeg:50", catJPG, lenaJPG}, exitOK, "hasher,attack,genuine_count,", ""},
+	{"eval roc", []string{"eval", "-algo", "average", "-attacks", "blur:1", "-format", "roc", catJPG, lenaJPG}, exitOK, "hasher,attack,threshold,tp,fp,fn,tn,", ""},
+	{"dedupe unknown method", []string{"dedupe", "-method", "kmeans", "."}, exitUsage, "", `invalid value "kmeans" for flag -method`},
+	{"eval no files", []string{"eval"}, exitUsage, "", "Usage: imghash eval"},
+	{"eval unknown attack", []string{"eval", "-attacks", "sharpen:1", catJPG}, exitUsage, "", `unknown attack: "sharpen:1"`},
+	{"eval unknown format", []string{"eval", "-format", "xml", catJPG}, exitUsage, "", `unknown format "xml"`},
+	{"eval flag for one algorithm", []string{"eval", "-algo", "average,whash", "-level", "2", catJPG}, exitUsage, "", "flag -level does not apply to average"},
+	{"eval one image", []string{"eval", "-algo", "average", "-attacks", "fliph", catJPG}, exitError, "", "at least two images"},
+}
+
+func TestRun(t *testing.T) {
+	for _, tt := range runTests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCmd(tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code: got %d, want %d (stderr %q)", code, tt.code, stderr)
+			}
+			if !strings.Contains(stdout, tt.stdout) || (tt.stdout == "" && stdout != "") {
+				t.Errorf("stdout: got %q, want %q", stdout, tt.stdout)
+			}
+			if !strings.Contains(stderr, tt.stderr) || (tt.stderr == "" && stderr != "") {
+				t.Errorf("stderr: got %q, want %q", stderr, tt.stderr)
+			}
+		})
+	}
+}
+
+func TestRun_hashJSON(t *testing.T) {
+	code, stdout, stderr := runCmd("hash", "-algo", "whash", "-level", "2", "-format", "json", catJPG)
+	if code != exitOK {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	var got struct {
+		Path     string `json:"path"`
+		Envelope struct {
+			Kind      string            `json:"kind"`
+			Algorithm string            `json:"algorithm"`
+			Params    map[string]string `json:"params"`
+			Hash      string            `json:"hash"`
+		} `json:"envelope"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if got.Path != catJPG || got.Envelope.Algorithm != "whash" || got.Envelope.Kind != "binary" || got.Envelope.Params["level"] != "2" || got.Envelope.Hash == "" {
+		t.Errorf("unexpected output %+v", got)
+	}
+}
+
+func TestRun_compareEnvelope(t *testing.T) {
+	h, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := imghash.HashFile(h, catJPG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := imghash.NewEnvelope(h, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := env.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{"same settings", []string{"-algo", "average"}, exitOK, ""},
+		{"other algorithm", []string{"-algo", "difference"}, exitError, "does not match"},
+		{"other params", []string{"-algo", "average", "-size", "16x16"}, exitError, "does not match"},
+		{"other kind", []string{"-algo", "gist"}, exitError, "hash kind does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"compare"}, tt.args...)
+			code, stdout, stderr := runCmd(append(args, catJPG, string(text))...)
+			if code != tt.code || !strings.Contains(stderr, tt.stderr) {
+				t.Errorf("got %d %q %q, want %d and %q", code, stdout, stderr, tt.code, tt.stderr)
+			}
+			if tt.code == exitOK && stdout != "0\n" {
+				t.Errorf("got distance %q, want 0", stdout)
+			}
+		})
+	}
+}
+
+func TestRun_dedupe(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, catJPG, filepath.Join(dir, "a", "cat.jpg"))
+	copyFile(t, catJPG, filepath.Join(dir, "b", "cat copy.JPG"))
+	copyFile(t, lenaJPG, filepath.Join(dir, "lena.jpg"))
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{filepath.Join(dir, "a", "cat.jpg"), filepath.Join(dir, "b", "cat copy.JPG")}}
+
+	for _, args := range [][]string{
+		{"dedupe", "-algo", "pdq", "-threshold", "10", dir},
+		{"dedupe", "-algo", "gist", "-threshold", "0.01", dir},
+		{"dedupe", "-algo", "phash", "-distance", "hamming", "-workers", "1", dir},
+		{"dedupe", "-method", "completelinkage", "-threshold", "10", dir},
+		{"dedupe", "-method", "dbscan", "-min-points", "2", "-threshold", "10", dir},
+	} {
+		t.Run(strings.Join(args[1:3], " "), func(t *testing.T) {
+			code, stdout, stderr := runCmd(args...)
+			if code != exitOK {
+				t.Fatalf("exit code %d: %s", code, stderr)
+			}
+			var got [][]string
+			if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+				t.Fatalf("invalid JSON %q: %v", stdout, err)
+			}
+			if len(got) != 1 || len(got[0]) != 2 || got[0][0] != want[0][0] || got[0][1] != want[0][1] {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRun_evalJSON(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, catJPG, filepath.Join(dir, "cat.jpg"))
+	copyFile(t, lenaJPG, filepath.Join(dir, "lena.jpg"))
+	code, stdout, stderr := runCmd("eval", "-algo", "phash,pdq", "-attacks", "jpeg:60,scale:0.5", "-format", "json", "-roc-points", "3", dir)
+	if code != exitOK {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	var got struct {
+		Images  int `json:"images"`
+		Results []struct {
+			Hasher string `json:"hasher"`
+			Attack string `json:"attack"`
+			ROC    struct {
+				Points []struct{} `json:"points"`
+				AUC    float64    `json:"auc"`
+			} `json:"roc"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if got.Images != 2 || len(got.Results) != 4 || got.Results[3].Hasher != "pdq" || got.Results[3].Attack != "scale:0.5" {
+		t.Fatalf("unexpected output %+v", got)
+	}
+	for _, r := range got.Results {
+		if len(r.ROC.Points) == 0 || len(r.ROC.Points) > 3 || r.ROC.AUC != 1 {
+			t.Errorf("%s/%s: %d points, AUC %v", r.Hasher, r.Attack, len(r.ROC.Points), r.ROC.AUC)
+		}
+	}
+}
+
+func TestRun_dedupeEmpty(t *testing.T) {
+	code, stdout, _ := runCmd("dedupe", t.TempDir())
+	if code != exitOK || strings.TrimSpace(stdout) != "[]" {
+		t.Errorf("got %d %q, want 0 []", code, stdout)
+	}
+}
+
+func TestImagePaths_unreadable(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, catJPG, filepath.Join(dir, "a", "cat.jpg"))
+	copyFile(t, catJPG, filepath.Join(dir, "b", "cat.jpg"))
+	copyFile(t, lenaJPG, filepath.Join(dir, "c", "lena.jpg"))
+	locked := filepath.Join(dir, "b")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(locked, 0o755) })
+	if _, err := os.ReadDir(locked); err == nil {
+		t.Skip("directory permissions are not enforced")
+	}
+
+	missing := filepath.Join(dir, "missing")
+	paths, errs := imagePaths([]string{dir, missing})
+	want := []string{filepath.Join(dir, "a", "cat.jpg"), filepath.Join(dir, "c", "lena.jpg")}
+	if !slices.Equal(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+	if len(errs) != 2 {
+		t.Errorf("got %d errors %v, want 2", len(errs), errs)
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
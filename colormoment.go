@@ -25,7 +25,7 @@ type ColorMoment struct {
 // Without options, sensible defaults are used.
 func NewColorMoment(opts ...ColorMomentOption) (ColorMoment, error) {
 	c := ColorMoment{
-		baseConfig: baseConfig{width: 512, height: 512, interp: Bicubic},
+		baseConfig: baseConfig{width: 512, height: 512, interp: Bicubic, alphaPolicy: defaultAlphaPolicy},
 		kernel:     3,
 		sigma:      0,
 	}
@@ -46,23 +46,41 @@ func NewColorMoment(opts ...ColorMomentOption) (ColorMoment, error) {
 
 // Calculate returns a perceptual image hash.
 func (ch ColorMoment) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(ch.width, ch.height, img, ch.interp.resizeType())
-	b := imgproc.GaussianBlur(r, ch.kernel, ch.sigma)
-	yrb, err := imgproc.YCrCb(b)
-	if err != nil {
-		return nil, err
-	}
-	hsv, err := imgproc.HSV(b)
+	return ch.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Float64 hash with enough capacity. See IntoHasher.
+func (ch ColorMoment) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return ch.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (ch ColorMoment) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return ch.calculate(nil, prep)
+}
+
+func (ch ColorMoment) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(ch.alphaPolicy).cropBorders(ch.border)
+	r, err := prep.Resized(ch.width, ch.height, ch.interp)
 	if err != nil {
 		return nil, err
 	}
+	b := prep.blur(r, ch.kernel, ch.sigma)
+	yrb := prep.newRGBA(b.Bounds())
+	imgproc.YCrCbInto(yrb, b)
+	hsv := prep.newRGBA(b.Bounds())
+	imgproc.HSVInto(hsv, b)
 	yrbMom := imgproc.GetMoments(yrb)
 	yrbMom[0], yrbMom[2] = yrbMom[2], yrbMom[0]
 	hsvMom := imgproc.GetMoments(hsv)
 	hsvMom[0], hsvMom[2] = hsvMom[2], hsvMom[0]
 	yHuMom := imgproc.HuMoments(yrbMom)
 	hHuMom := imgproc.HuMoments(hsvMom)
-	hash := make(hashtype.Float64, len(hHuMom)+len(yHuMom))
+	hash := hashInto[hashtype.Float64](dst, len(hHuMom)+len(yHuMom))
 	var i int
 	for i = 0; i < len(hHuMom); i++ {
 		hash[i] = hHuMom[i]
@@ -1,6 +1,7 @@
 package imghash
 
 import (
+	"bytes"
 	"image"
 	_ "image/gif"  // register GIF decoder
 	_ "image/jpeg" // register JPEG decoder
@@ -10,30 +11,115 @@ import (
 
 	"github.com/ajdnik/imghash/v2/hashtype"
 	"github.com/ajdnik/imghash/v2/similarity"
+	_ "golang.org/x/image/bmp"  // register BMP decoder
+	_ "golang.org/x/image/tiff" // register TIFF decoder
+	_ "golang.org/x/image/webp" // register WebP decoder
 )
 
+// DecodeOption configures how images are decoded. Every DecodeOption is
+// also a BatchOption and applies to the images decoded by HashAll.
+type DecodeOption interface {
+	BatchOption
+	applyDecode(*decodeConfig)
+}
+
+type decodeConfig struct {
+	orient bool
+}
+
+func newDecodeConfig(orient bool, opts []DecodeOption) decodeConfig {
+	c := decodeConfig{orient: orient}
+	for _, o := range opts {
+		o.applyDecode(&c)
+	}
+	return c
+}
+
+type orientationOption bool
+
+func (o orientationOption) applyDecode(c *decodeConfig) { c.orient = bool(o) }
+
+func (o orientationOption) applyBatch(c *batchConfig) { c.decode.orient = bool(o) }
+
+// WithOrientation sets whether the EXIF orientation of an image is applied
+// after decoding, so that photos stored sideways are hashed upright.
+// Open, Decode, the frame functions and HashAll apply it by default;
+// OpenImage, DecodeImage, HashFile and HashReader do not, to keep their
+// hashes unchanged.
+func WithOrientation(apply bool) DecodeOption { return orientationOption(apply) }
+
+// Open reads and decodes an image file as it is displayed: the EXIF
+// orientation is applied unless disabled with WithOrientation(false).
+// It supports the same formats as OpenImage.
+func Open(path string, opts ...DecodeOption) (image.Image, error) {
+	return openImage(path, newDecodeConfig(true, opts))
+}
+
+// Decode decodes an image from the given reader as it is displayed: the
+// EXIF orientation is applied unless disabled with WithOrientation(false).
+// It supports the same formats as OpenImage.
+func Decode(r io.Reader, opts ...DecodeOption) (image.Image, error) {
+	return decodeImage(r, newDecodeConfig(true, opts))
+}
+
 // OpenImage reads and decodes an image from the given file path.
-// It supports JPEG, PNG, and GIF formats.
-func OpenImage(path string) (image.Image, error) {
+// It supports JPEG, PNG, GIF, WebP, BMP and TIFF, formats added with
+// RegisterDecoder and any format registered with the image package.
+// Only the first frame of an animated GIF is decoded; use OpenFrames for
+// all of them. The EXIF orientation is ignored unless WithOrientation(true)
+// is passed; Open applies it by default.
+func OpenImage(path string, opts ...DecodeOption) (image.Image, error) {
+	return openImage(path, newDecodeConfig(false, opts))
+}
+
+// DecodeImage decodes an image from the given reader.
+// It supports the same formats as OpenImage. Only the first frame of an
+// animated GIF is decoded; use DecodeFrames for all of them. The EXIF
+// orientation is ignored unless WithOrientation(true) is passed; Decode
+// applies it by default.
+func DecodeImage(r io.Reader, opts ...DecodeOption) (image.Image, error) {
+	return decodeImage(r, newDecodeConfig(false, opts))
+}
+
+func openImage(path string, cfg decodeConfig) (image.Image, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = f.Close() }()
-	img, _, err := image.Decode(f)
-	return img, err
+	return decodeImage(f, cfg)
 }
 
-// DecodeImage decodes an image from the given reader.
-// It supports JPEG, PNG, and GIF formats.
-func DecodeImage(r io.Reader) (image.Image, error) {
-	img, _, err := image.Decode(r)
+func decodeImage(r io.Reader, cfg decodeConfig) (image.Image, error) {
+	if !cfg.orient {
+		return decodeFormat(r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, err := decodeFormat(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ApplyOrientation(img, orientationOf(data)), nil
+}
+
+// decodeFormat decodes an image with the registered decoder matching its
+// format, falling back to the formats registered with the image package.
+func decodeFormat(r io.Reader) (image.Image, error) {
+	br, d, ok := lookupDecoder(r)
+	if ok {
+		return d.Decode(br)
+	}
+	img, _, err := image.Decode(br)
 	return img, err
 }
 
 // HashFile is a convenience that opens an image file and computes its hash.
-func HashFile(hasher Hasher, path string) (hashtype.Hash, error) {
-	img, err := OpenImage(path)
+// Options are as for OpenImage.
+func HashFile(hasher Hasher, path string, opts ...DecodeOption) (hashtype.Hash, error) {
+	img, err := OpenImage(path, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -41,8 +127,9 @@ func HashFile(hasher Hasher, path string) (hashtype.Hash, error) {
 }
 
 // HashReader is a convenience that decodes an image from a reader and computes its hash.
-func HashReader(hasher Hasher, r io.Reader) (hashtype.Hash, error) {
-	img, err := DecodeImage(r)
+// Options are as for DecodeImage.
+func HashReader(hasher Hasher, r io.Reader, opts ...DecodeOption) (hashtype.Hash, error) {
+	img, err := DecodeImage(r, opts...)
 	if err != nil {
 		return nil, err
 	}
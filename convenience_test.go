@@ -138,3 +138,39 @@ func TestCompare_nilOverrideFallsBack(t *testing.T) {
 		t.Fatalf("got %v, want 5", got)
 	}
 }
+
+func TestOpenImage_formats(t *testing.T) {
+	want, err := imghash.OpenImage("assets/formats/peppers.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"bmp", "tiff", "webp"} {
+		t.Run(format, func(t *testing.T) {
+			path := "assets/formats/peppers." + format
+			img, err := imghash.OpenImage(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds() != want.Bounds() {
+				t.Fatalf("got bounds %v, want %v", img.Bounds(), want.Bounds())
+			}
+			for _, name := range []string{"average", "phash", "pdq", "colormoment"} {
+				h, err := imghash.New(name, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := imghash.HashFile(h, path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ref, err := h.Calculate(want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d, err := h.Compare(got, ref); err != nil || d != 0 {
+					t.Errorf("%s: got distance %v (%v) from the PNG hash, want 0", name, d, err)
+				}
+			}
+		})
+	}
+}
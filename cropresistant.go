@@ -0,0 +1,328 @@
+package imghash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/internal/imgproc"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// Crop-resistant hashing errors.
+var (
+	// ErrNilHasher is returned by NewCropResistant when the inner hasher is nil.
+	ErrNilHasher = errors.New("imghash: hasher must not be nil")
+	// ErrInvalidMatchDistance is returned by NewCropResistant when the
+	// segment match distance is negative.
+	ErrInvalidMatchDistance = errors.New("imghash: match distance must not be negative")
+	// ErrCompositeInner is returned by NewCropResistant when the inner
+	// hasher computes Composite hashes, such as an Ensemble, since
+	// composites do not nest.
+	ErrCompositeInner = errors.New("imghash: inner hasher must not compute composite hashes")
+)
+
+// Segmentation parameters, from imagehash's crop_resistant_hash. Images
+// are segmented at segmentationSize x segmentationSize pixels.
+const (
+	segmentationSize   = 300
+	segmentThreshold   = 128
+	segmentBlurSigma   = 2
+	defaultSegmentSize = 500
+	// defaultMatchDistance is the match distance of a CropResistant built
+	// by New, a quarter of the bits of the default inner hash.
+	defaultMatchDistance = 16.0
+)
+
+// CropResistant makes any hash algorithm resistant to cropping, in the
+// spirit of imagehash's crop_resistant_hash. It divides the image into
+// regions of similar brightness, hashes the bounding box of each region
+// with the inner hasher, and compares images by counting the regions that
+// match, so an image still matches after part of it has been cut away.
+// Regions cut by the crop no longer match, but the others do.
+//
+// Its hash is a Composite holding the inner hash of every region, largest
+// region first. It is registered as "cropresistant", with the inner
+// algorithm as a parameter, so its hashes can be stored in envelopes.
+type CropResistant struct {
+	inner   HasherComparer
+	maxDist similarity.Distance
+	limit   uint
+	minSize uint
+	// Alpha channel handling.
+	alphaPolicy alphaConfig
+	// Border cropping.
+	border cropConfig
+}
+
+// CropResistantOption configures CropResistant.
+type CropResistantOption interface{ applyCropResistant(*CropResistant) }
+
+type segmentLimitOption uint
+
+func (o segmentLimitOption) applyCropResistant(c *CropResistant) { c.limit = uint(o) }
+
+// WithSegmentLimit hashes at most the n largest segments of an image.
+// Zero, the default, hashes every segment.
+func WithSegmentLimit(n uint) CropResistantOption { return segmentLimitOption(n) }
+
+type minSegmentSizeOption uint
+
+func (o minSegmentSizeOption) applyCropResistant(c *CropResistant) { c.minSize = uint(o) }
+
+// WithMinSegmentSize ignores segments of fewer pixels than size, measured
+// on the 300x300 image used for segmentation. The default is 500.
+func WithMinSegmentSize(size uint) CropResistantOption { return minSegmentSizeOption(size) }
+
+// NewCropResistant wraps inner in a crop-resistant hasher. Two segments
+// match when inner compares them at a distance of at most maxDist; for a
+// 64-bit binary hash a quarter of the bits, 16, is a good start. The alpha
+// policy and border crop options apply to the image before it is
+// segmented.
+func NewCropResistant(inner HasherComparer, maxDist similarity.Distance, opts ...CropResistantOption) (CropResistant, error) {
+	c := CropResistant{inner: inner, maxDist: maxDist, minSize: defaultSegmentSize, alphaPolicy: defaultAlphaPolicy}
+	for _, o := range opts {
+		o.applyCropResistant(&c)
+	}
+	if c.inner == nil {
+		return CropResistant{}, ErrNilHasher
+	}
+	if isComposite(c.inner) {
+		return CropResistant{}, ErrCompositeInner
+	}
+	if c.maxDist < 0 {
+		return CropResistant{}, ErrInvalidMatchDistance
+	}
+	if err := c.alphaPolicy.validate(); err != nil {
+		return CropResistant{}, err
+	}
+	if err := c.border.validate(); err != nil {
+		return CropResistant{}, err
+	}
+	return c, nil
+}
+
+// isComposite reports whether h computes Composite hashes, which cannot
+// be parts of another Composite.
+func isComposite(h Hasher) bool {
+	switch h.(type) {
+	case Ensemble, CropResistant:
+		return true
+	}
+	return false
+}
+
+// Calculate returns a Composite holding the inner hash of every segment.
+// An image without segments of the minimum size is hashed as a whole.
+func (c CropResistant) Calculate(img image.Image) (hashtype.Hash, error) {
+	return c.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but reuses the memory of dst when it is
+// a Composite, writing the hash of every segment into the corresponding
+// element with CalculateInto. See IntoHasher.
+func (c CropResistant) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return c.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image for segmentation.
+func (c CropResistant) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return c.calculate(nil, prep)
+}
+
+func (c CropResistant) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(c.alphaPolicy).cropBorders(c.border)
+	img := prep.Image()
+	if img == nil || img.Bounds().Empty() {
+		return nil, ErrEmptyImage
+	}
+	// Keep the aspect ratio, so a crop is segmented at the scale of the
+	// original image unless it removes part of its longer side.
+	b := img.Bounds()
+	scale := float64(segmentationSize) / float64(max(b.Dx(), b.Dy()))
+	sw := max(1, uint(math.Round(float64(b.Dx())*scale)))
+	sh := max(1, uint(math.Round(float64(b.Dy())*scale)))
+	g, err := prep.ResizedGray(sw, sh, Bilinear)
+	if err != nil {
+		return nil, err
+	}
+	blurred := imgproc.GaussianBlur(g, 0, segmentBlurSigma).(*image.Gray)
+	segs := imgproc.Segments(blurred, segmentThreshold, int(c.minSize))
+	if c.limit > 0 && uint(len(segs)) > c.limit {
+		segs = segs[:c.limit]
+	}
+	if len(segs) == 0 {
+		segs = []image.Rectangle{blurred.Bounds()}
+	}
+	hashes, _ := dst.(hashtype.Composite)
+	hashes = slices.Grow(hashes[:0], len(segs))[:len(segs)]
+	for i, s := range segs {
+		// Scale the segment to the original image, rounding outwards.
+		r := image.Rect(
+			b.Min.X+s.Min.X*b.Dx()/int(sw),
+			b.Min.Y+s.Min.Y*b.Dy()/int(sh),
+			b.Min.X+(s.Max.X*b.Dx()+int(sw)-1)/int(sw),
+			b.Min.Y+(s.Max.Y*b.Dy()+int(sh)-1)/int(sh),
+		)
+		if hashes[i], err = CalculateInto(c.inner, hashes[i], imgproc.Crop(img, r)); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+// Matches returns how many segments of h1 match a segment of h2.
+func (c CropResistant) Matches(h1, h2 hashtype.Hash) (int, error) {
+	m1, ok := h1.(hashtype.Composite)
+	if !ok {
+		return 0, ErrIncompatibleHash
+	}
+	m2, ok := h2.(hashtype.Composite)
+	if !ok {
+		return 0, ErrIncompatibleHash
+	}
+	return c.matches(m1, m2)
+}
+
+func (c CropResistant) matches(m1, m2 hashtype.Composite) (int, error) {
+	n := 0
+	for _, s1 := range m1 {
+		for _, s2 := range m2 {
+			d, err := c.inner.Compare(s1, s2)
+			if err != nil {
+				return 0, err
+			}
+			if d <= c.maxDist {
+				n++
+				break
+			}
+		}
+	}
+	return n, nil
+}
+
+// Compare returns the fraction of segments that have no match in the
+// other hash, taken from whichever hash has the smaller fraction. It is 0
+// when every segment of one image matches, as for a crop that leaves its
+// segments intact, and 1 when no segment matches.
+func (c CropResistant) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
+	m1, ok := h1.(hashtype.Composite)
+	if !ok {
+		return 0, ErrIncompatibleHash
+	}
+	m2, ok := h2.(hashtype.Composite)
+	if !ok {
+		return 0, ErrIncompatibleHash
+	}
+	if len(m1) == 0 || len(m2) == 0 {
+		return 1, nil
+	}
+	n1, err := c.matches(m1, m2)
+	if err != nil {
+		return 0, err
+	}
+	n2, err := c.matches(m2, m1)
+	if err != nil {
+		return 0, err
+	}
+	matched := max(float64(n1)/float64(len(m1)), float64(n2)/float64(len(m2)))
+	return similarity.Distance(1 - matched), nil
+}
+
+// defaultCropResistantInner is the inner algorithm of a CropResistant
+// built by New without the inner parameter, as in imagehash.
+var defaultCropResistantInner = algorithmRef{Algorithm: "difference", Version: differenceVersion}
+
+// parseAlgorithmRef parses the inner parameter: a JSON object or the name
+// of an algorithm.
+func parseAlgorithmRef(s string) (algorithmRef, error) {
+	var ref algorithmRef
+	if strings.HasPrefix(strings.TrimSpace(s), "{") {
+		if err := json.Unmarshal([]byte(s), &ref); err != nil {
+			return algorithmRef{}, fmt.Errorf("%w for \"inner\": %v", ErrInvalidParam, err)
+		}
+		return ref, nil
+	}
+	return algorithmRef{Algorithm: strings.TrimSpace(s)}, nil
+}
+
+func formatAlgorithmRef(ref algorithmRef) string {
+	data, _ := json.Marshal(ref)
+	return string(data)
+}
+
+func cropResistantAlgorithm() Algorithm {
+	return Algorithm{
+		Name:    "cropresistant",
+		Version: cropResistantVersion,
+		Kind:    hashtype.KindComposite,
+		Params: []Param{
+			{Name: "inner", Type: ParamString, Default: formatAlgorithmRef(defaultCropResistantInner), Doc: "algorithm hashing each segment, as a name or a JSON object {algorithm, version, params} (NewCropResistant)"},
+			{Name: "max_distance", Type: ParamFloat, Default: defaultMatchDistance, CompareOnly: true, Doc: "inner distance at which two segments match (NewCropResistant)"},
+			{Name: "segment_limit", Type: ParamUint, Default: uint(0), Doc: "number of largest segments hashed, 0 for all (WithSegmentLimit)"},
+			{Name: "min_segment_size", Type: ParamUint, Default: uint(defaultSegmentSize), Doc: "smallest segment in pixels of the 300x300 segmentation image (WithMinSegmentSize)"},
+			alphaModeParam, backgroundParam, cropToleranceParam,
+		},
+		New: func(p map[string]any) (HasherComparer, error) {
+			ref := defaultCropResistantInner
+			if s, ok := p["inner"].(string); ok {
+				var err error
+				if ref, err = parseAlgorithmRef(s); err != nil {
+					return nil, err
+				}
+			}
+			inner, err := ref.build(nil)
+			if err != nil {
+				return nil, err
+			}
+			maxDist := defaultMatchDistance
+			if d, ok := p["max_distance"].(float64); ok {
+				maxDist = d
+			}
+			var opts []CropResistantOption
+			for _, key := range slices.Sorted(maps.Keys(p)) {
+				if key == "inner" || key == "max_distance" {
+					continue
+				}
+				if o, ok := paramOption(key, p[key]).(CropResistantOption); ok {
+					opts = append(opts, o)
+				}
+			}
+			return NewCropResistant(inner, similarity.Distance(maxDist), opts...)
+		},
+		Describe: func(h Hasher) (map[string]any, bool) {
+			c, ok := h.(CropResistant)
+			if !ok {
+				return nil, false
+			}
+			ref, err := describeRef(c.inner)
+			if err != nil {
+				return nil, false
+			}
+			p := c.border.params(c.alphaPolicy.params(map[string]any{"inner": formatAlgorithmRef(ref)}))
+			if c.limit != 0 {
+				p["segment_limit"] = c.limit
+			}
+			if c.minSize != defaultSegmentSize {
+				p["min_segment_size"] = c.minSize
+			}
+			return p, true
+		},
+	}
+}
+
+// Compile-time assertions: CropResistant composes like the algorithms it wraps.
+var (
+	_ HasherComparer = CropResistant{}
+	_ PreparedHasher = CropResistant{}
+	_ IntoHasher     = CropResistant{}
+)
@@ -0,0 +1,254 @@
+package imghash_test
+
+import (
+	"errors"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+// cropRight returns img with a fifth of its width cut off the right side.
+func cropRight(t *testing.T, path string) (image.Image, image.Image) {
+	t.Helper()
+	img, err := imghash.OpenImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := img.Bounds()
+	b.Max.X -= b.Dx() / 5
+	return img, img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(b)
+}
+
+func TestCropResistant(t *testing.T) {
+	phash, err := imghash.NewPHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr, err := imghash.NewCropResistant(phash, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	others := make([]imghash.Hash, 0, 3)
+	for _, path := range []string{"assets/cat.jpg", "assets/baboon.jpg", "assets/tulips.jpg"} {
+		h, err := imghash.HashFile(cr, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		others = append(others, h)
+	}
+	for _, path := range []string{"assets/lena.jpg", "assets/peppers.jpg"} {
+		t.Run(path, func(t *testing.T) {
+			img, cropped := cropRight(t, path)
+			h1, err := cr.Calculate(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h2, err := cr.Calculate(cropped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := cr.Compare(h1, h2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, o := range others {
+				od, err := cr.Compare(h2, o)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d >= od {
+					t.Errorf("cropped image at distance %v, unrelated image at %v", d, od)
+				}
+			}
+			if n, err := cr.Matches(h2, h1); err != nil || n == 0 {
+				t.Errorf("got %d matching segments, %v; want some", n, err)
+			}
+			// The plain hash of the crop is far from the original.
+			p1, _ := phash.Calculate(img)
+			p2, _ := phash.Calculate(cropped)
+			if pd, _ := phash.Compare(p1, p2); pd <= 16 {
+				t.Errorf("plain PHash distance %v unexpectedly small", pd)
+			}
+		})
+	}
+}
+
+func TestCropResistant_algorithms(t *testing.T) {
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prep := imghash.Prepare(img)
+	for _, name := range imghash.Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			inner, err := imghash.New(name, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cr, err := imghash.NewCropResistant(inner, 0, imghash.WithSegmentLimit(3))
+			if a, _ := imghash.Lookup(name); a.Kind == hashtype.KindComposite {
+				if !errors.Is(err, imghash.ErrCompositeInner) {
+					t.Errorf("got %v, want %v", err, imghash.ErrCompositeInner)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := imghash.CalculatePrepared(cr, prep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(h.(imghash.Composite)); n == 0 || n > 3 {
+				t.Fatalf("got %d segments, want 1 to 3", n)
+			}
+			if d, err := cr.Compare(h, h); err != nil || d != 0 {
+				t.Errorf("self distance: got %v, %v; want 0", d, err)
+			}
+		})
+	}
+}
+
+func TestCropResistant_segments(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := imghash.OpenImage("assets/tulips.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A uniform image has no segments and is hashed as a whole.
+	uniform := image.NewGray(image.Rect(0, 0, 64, 48))
+	tests := []struct {
+		name string
+		img  image.Image
+		opts []imghash.CropResistantOption
+		want int
+	}{
+		{"limit", img, []imghash.CropResistantOption{imghash.WithSegmentLimit(2)}, 2},
+		{"large minimum size", img, []imghash.CropResistantOption{imghash.WithMinSegmentSize(1 << 20)}, 1},
+		{"uniform image", uniform, nil, 1},
+	}
+	for _, tt := range tests {
+		cr, err := imghash.NewCropResistant(avg, 16, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := cr.Calculate(tt.img)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := len(h.(imghash.Composite)); got != tt.want {
+			t.Errorf("%s: got %d segments, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCropResistant_errors(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imghash.NewCropResistant(nil, 16); !errors.Is(err, imghash.ErrNilHasher) {
+		t.Errorf("nil hasher: got %v, want %v", err, imghash.ErrNilHasher)
+	}
+	if _, err := imghash.NewCropResistant(avg, -1); !errors.Is(err, imghash.ErrInvalidMatchDistance) {
+		t.Errorf("negative distance: got %v, want %v", err, imghash.ErrInvalidMatchDistance)
+	}
+	cr, err := imghash.NewCropResistant(avg, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cr.Calculate(image.NewGray(image.Rect(0, 0, 0, 0))); !errors.Is(err, imghash.ErrEmptyImage) {
+		t.Errorf("empty image: got %v, want %v", err, imghash.ErrEmptyImage)
+	}
+	multi := imghash.Composite{imghash.Binary{1}}
+	if _, err := cr.Compare(multi, imghash.Binary{1}); !errors.Is(err, imghash.ErrIncompatibleHash) {
+		t.Errorf("plain hash: got %v, want %v", err, imghash.ErrIncompatibleHash)
+	}
+	if _, err := cr.Matches(imghash.Binary{1}, multi); !errors.Is(err, imghash.ErrIncompatibleHash) {
+		t.Errorf("plain hash: got %v, want %v", err, imghash.ErrIncompatibleHash)
+	}
+}
+
+func TestCropResistant_registry(t *testing.T) {
+	h, err := imghash.New("cropresistant", map[string]any{
+		"inner":         `{"algorithm": "average", "params": {"size": "16x16"}}`,
+		"max_distance":  64,
+		"segment_limit": 3,
+		"alpha_mode":    "Composite",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := imghash.Describe(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"inner":         `{"algorithm":"average","version":1,"params":{"size":"16x16"}}`,
+		"segment_limit": uint(3),
+		"alpha_mode":    "Composite",
+		"background":    "#FFFFFF",
+	}
+	if spec.Name != "cropresistant" || spec.Kind != hashtype.KindComposite || !reflect.DeepEqual(spec.Params, want) {
+		t.Errorf("got spec %+v, want params %v", spec, want)
+	}
+
+	img, err := imghash.OpenImage("assets/tulips.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := h.Calculate(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := imghash.NewEnvelope(h, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := env.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := hashtype.DecodeEnvelope(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Hash, hash) {
+		t.Errorf("decoded hash: got %v, want %v", decoded.Hash, hash)
+	}
+	rebuilt, err := imghash.FromEnvelope(decoded)
+	if err != nil {
+		t.Fatalf("FromEnvelope: %v", err)
+	}
+	if got, err := rebuilt.Calculate(img); err != nil || !reflect.DeepEqual(got, hash) {
+		t.Errorf("rebuilt hasher: got %v, %v; want %v", got, err, hash)
+	}
+
+	errTests := []struct {
+		name   string
+		params map[string]any
+		want   error
+	}{
+		{"unknown inner", map[string]any{"inner": "nope"}, imghash.ErrUnknownAlgorithm},
+		{"inner version", map[string]any{"inner": `{"algorithm":"average","version":9}`}, imghash.ErrAlgorithmVersion},
+		{"inner param", map[string]any{"inner": `{"algorithm":"pdq","params":{"size":"8x8"}}`}, imghash.ErrUnknownParam},
+		{"composite inner", map[string]any{"inner": "ensemble"}, imghash.ErrCompositeInner},
+		{"bad json", map[string]any{"inner": `{"algorithm":`}, imghash.ErrInvalidParam},
+		{"negative distance", map[string]any{"max_distance": -1}, imghash.ErrInvalidMatchDistance},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := imghash.New("cropresistant", tt.params); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package imghash
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Decoder registry errors.
+var (
+	// ErrInvalidDecoder is returned when registering a decoder without a
+	// name, magic prefix or Decode function.
+	ErrInvalidDecoder = errors.New("imghash: decoder must have a name, magic and Decode")
+	// ErrDecoderExists is returned when registering a name that is already taken.
+	ErrDecoderExists = errors.New("imghash: decoder already registered")
+)
+
+// Decoder decodes one image format for OpenImage, DecodeImage, OpenFrames
+// and DecodeFrames. It lets formats without a standard library decoder,
+// such as AVIF, HEIC or JPEG XL, be plugged in with RegisterDecoder.
+type Decoder struct {
+	// Name identifies the format, e.g. "avif".
+	Name string
+	// Magic is the prefix that identifies the format in the encoded data.
+	// Each '?' matches any byte, as in image.RegisterFormat.
+	Magic string
+	// Decode decodes the image, or the first frame of an animation.
+	Decode func(io.Reader) (image.Image, error)
+	// DecodeFrames decodes every frame of an animation. It is optional;
+	// without it DecodeFrames returns the image from Decode as one frame.
+	// Returning no frames makes DecodeFrames fail with ErrNoFrames.
+	DecodeFrames func(io.Reader) ([]Frame, error)
+}
+
+// builtinDecoders handle the formats whose frames the image package does
+// not decode. They are tried after the registered decoders.
+var builtinDecoders = []Decoder{
+	{Name: "gif", Magic: "GIF8?a", Decode: gif.Decode, DecodeFrames: decodeGIFFrames},
+}
+
+var decoders = struct {
+	sync.RWMutex
+	list []Decoder
+}{}
+
+// RegisterDecoder adds a decoder for an image format. Registered decoders
+// are tried in registration order before the built-in decoders and the
+// formats registered with the image package, so a decoder whose magic
+// matches a built-in format, such as "GIF8?a", replaces its decoder. The
+// names of the built-in decoders are reserved.
+//
+//	imghash.RegisterDecoder(imghash.Decoder{
+//		Name:   "avif",
+//		Magic:  "????ftypavif",
+//		Decode: avif.Decode,
+//	})
+func RegisterDecoder(d Decoder) error {
+	if d.Name == "" || d.Magic == "" || d.Decode == nil {
+		return ErrInvalidDecoder
+	}
+	decoders.Lock()
+	defer decoders.Unlock()
+	for _, r := range slices.Concat(builtinDecoders, decoders.list) {
+		if strings.EqualFold(r.Name, d.Name) {
+			return fmt.Errorf("%w: %s", ErrDecoderExists, d.Name)
+		}
+	}
+	decoders.list = append(decoders.list, d)
+	return nil
+}
+
+// lookupDecoder returns the first registered or built-in decoder whose
+// magic prefix matches the start of r, if any. The returned reader yields
+// all of the data.
+func lookupDecoder(r io.Reader) (*bufio.Reader, Decoder, bool) {
+	decoders.RLock()
+	list := slices.Concat(decoders.list, builtinDecoders)
+	decoders.RUnlock()
+	n := 0
+	for _, d := range list {
+		n = max(n, len(d.Magic))
+	}
+	br, ok := r.(*bufio.Reader)
+	if !ok || br.Size() < n {
+		br = bufio.NewReaderSize(r, max(n, 16))
+	}
+	head, _ := br.Peek(n)
+	for _, d := range list {
+		if matchMagic(d.Magic, head) {
+			return br, d, true
+		}
+	}
+	return br, Decoder{}, false
+}
+
+func matchMagic(magic string, b []byte) bool {
+	if len(magic) > len(b) {
+		return false
+	}
+	for i := range len(magic) {
+		if magic[i] != '?' && magic[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeGIFFrames(r io.Reader) ([]Frame, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return compositeGIF(g), nil
+}
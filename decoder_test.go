@@ -0,0 +1,171 @@
+package imghash_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+)
+
+// decodeTestFormat decodes a toy format: the magic "IMGHASH?" followed by one byte per
+// frame, each decoding to a 1x1 gray frame of that value.
+func decodeTestFormat(r io.Reader) ([]imghash.Frame, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= 8 {
+		return nil, errors.New("test format: no frames")
+	}
+	var frames []imghash.Frame
+	for _, v := range data[8:] {
+		img := image.NewGray(image.Rect(0, 0, 1, 1))
+		img.SetGray(0, 0, color.Gray{Y: v})
+		frames = append(frames, imghash.Frame{Image: img, Delay: 40 * time.Millisecond})
+	}
+	return frames, nil
+}
+
+func init() {
+	err := imghash.RegisterDecoder(imghash.Decoder{
+		Name:  "imghash-test",
+		Magic: "IMGHASH?",
+		Decode: func(r io.Reader) (image.Image, error) {
+			frames, err := decodeTestFormat(r)
+			if err != nil {
+				return nil, err
+			}
+			return frames[0].Image, nil
+		},
+		DecodeFrames: decodeTestFormat,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	data := []byte("IMGHASH1\x10\x20\x30")
+	img, err := imghash.DecodeImage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.(*image.Gray).GrayAt(0, 0).Y; got != 0x10 {
+		t.Errorf("DecodeImage: got %#x, want 0x10", got)
+	}
+	frames, err := imghash.DecodeFrames(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 || frames[2].Image.(*image.Gray).GrayAt(0, 0).Y != 0x30 || frames[2].Delay != 40*time.Millisecond {
+		t.Errorf("DecodeFrames: got %+v, want 3 frames", frames)
+	}
+	if _, err := imghash.DecodeImage(bytes.NewReader([]byte("IMGHASH1"))); err == nil {
+		t.Error("expected the decoder error for a file without frames")
+	}
+}
+
+func TestRegisterDecoder_singleFrame(t *testing.T) {
+	err := imghash.RegisterDecoder(imghash.Decoder{
+		Name:  "imghash-test-still",
+		Magic: "STILL",
+		Decode: func(io.Reader) (image.Image, error) {
+			return image.NewGray(image.Rect(0, 0, 2, 2)), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := imghash.DecodeFrames(bytes.NewReader([]byte("STILL")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0].Image.Bounds().Dx() != 2 {
+		t.Errorf("got %+v, want the decoded image as one frame", frames)
+	}
+}
+
+func TestRegisterDecoder_replacesBuiltin(t *testing.T) {
+	// The magic covers the logical screen size, so only 3x5 GIFs are
+	// decoded by the test decoder.
+	replacement := image.NewGray(image.Rect(0, 0, 7, 7))
+	err := imghash.RegisterDecoder(imghash.Decoder{
+		Name:         "imghash-test-gif",
+		Magic:        "GIF89a\x03\x00\x05\x00",
+		Decode:       func(io.Reader) (image.Image, error) { return replacement, nil },
+		DecodeFrames: func(io.Reader) ([]imghash.Frame, error) { return []imghash.Frame{{Image: replacement}}, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewGray(image.Rect(0, 0, 3, 5)), nil); err != nil {
+		t.Fatal(err)
+	}
+	img, err := imghash.DecodeImage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img != replacement {
+		t.Errorf("DecodeImage used the built-in GIF decoder, got %v", img.Bounds())
+	}
+	frames, err := imghash.DecodeFrames(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0].Image != replacement {
+		t.Errorf("DecodeFrames used the built-in GIF decoder, got %d frames", len(frames))
+	}
+}
+
+func TestRegisterDecoder_noFrames(t *testing.T) {
+	err := imghash.RegisterDecoder(imghash.Decoder{
+		Name:  "imghash-test-empty",
+		Magic: "EMPTY",
+		Decode: func(io.Reader) (image.Image, error) {
+			return image.NewGray(image.Rect(0, 0, 2, 2)), nil
+		},
+		DecodeFrames: func(io.Reader) ([]imghash.Frame, error) { return nil, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imghash.DecodeFrames(bytes.NewReader([]byte("EMPTY"))); !errors.Is(err, imghash.ErrNoFrames) {
+		t.Errorf("DecodeFrames: got %v, want %v", err, imghash.ErrNoFrames)
+	}
+	h, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imghash.HashReaderFrames(h, bytes.NewReader([]byte("EMPTY"))); !errors.Is(err, imghash.ErrNoFrames) {
+		t.Errorf("HashReaderFrames: got %v, want %v", err, imghash.ErrNoFrames)
+	}
+}
+
+func TestRegisterDecoder_errors(t *testing.T) {
+	decode := func(io.Reader) (image.Image, error) { return nil, nil }
+	tests := []struct {
+		name string
+		d    imghash.Decoder
+		err  error
+	}{
+		{"no name", imghash.Decoder{Magic: "X", Decode: decode}, imghash.ErrInvalidDecoder},
+		{"no magic", imghash.Decoder{Name: "x", Decode: decode}, imghash.ErrInvalidDecoder},
+		{"no decode", imghash.Decoder{Name: "x", Magic: "X"}, imghash.ErrInvalidDecoder},
+		{"duplicate", imghash.Decoder{Name: "IMGHASH-TEST", Magic: "X", Decode: decode}, imghash.ErrDecoderExists},
+		{"built-in", imghash.Decoder{Name: "gif", Magic: "X", Decode: decode}, imghash.ErrDecoderExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := imghash.RegisterDecoder(tt.d); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"image"
 
 	"github.com/ajdnik/imghash/v2/hashtype"
-	"github.com/ajdnik/imghash/v2/internal/imgproc"
 	"github.com/ajdnik/imghash/v2/similarity"
 )
 
@@ -20,7 +19,7 @@ type Difference struct {
 // Without options, sensible defaults are used.
 func NewDifference(opts ...DifferenceOption) (Difference, error) {
 	d := Difference{
-		baseConfig: baseConfig{width: 8, height: 8, interp: Bilinear},
+		baseConfig: baseConfig{width: 8, height: 8, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 	}
 	for _, o := range opts {
 		o.applyDifference(&d)
@@ -33,17 +32,35 @@ func NewDifference(opts ...DifferenceOption) (Difference, error) {
 
 // Calculate returns a perceptual image hash.
 func (dh Difference) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(dh.width+1, dh.height, img, dh.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return dh.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Binary hash with enough capacity. See IntoHasher.
+func (dh Difference) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return dh.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (dh Difference) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return dh.calculate(nil, prep)
+}
+
+func (dh Difference) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(dh.alphaPolicy).cropBorders(dh.border)
+	g, err := prep.ResizedGray(dh.width+1, dh.height, dh.interp)
 	if err != nil {
 		return nil, err
 	}
-	return dh.computeHash(g)
+	return dh.computeHash(dst, g)
 }
 
 // Computes the binary hash based on the gradients in the resized image.
-func (dh Difference) computeHash(img *image.Gray) (hashtype.Binary, error) {
-	hash := hashtype.NewBinary(dh.width * dh.height)
+func (dh Difference) computeHash(dst hashtype.Hash, img *image.Gray) (hashtype.Binary, error) {
+	hash := binaryInto(dst, dh.width*dh.height)
 	bnds := img.Bounds()
 	var c uint
 	for i := bnds.Min.Y; i < bnds.Max.Y; i++ {
@@ -71,3 +88,9 @@ func (dh Difference) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error)
 	}
 	return similarity.Hamming(h1, h2)
 }
+
+// ComparesHamming reports whether Compare returns the Hamming distance,
+// which it does unless WithDistance was given. See HammingComparer.
+func (dh Difference) ComparesHamming() bool {
+	return dh.distFunc == nil
+}
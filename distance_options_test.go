@@ -6,6 +6,7 @@ import (
 
 	"github.com/ajdnik/imghash/v2"
 	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
 )
 
 type compareCase struct {
@@ -388,3 +389,51 @@ func TestWithWeights_clonesCallerSlice(t *testing.T) {
 		t.Fatalf("got %v, want 4", got)
 	}
 }
+
+func TestComparesHamming(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func() (imghash.Comparer, error)
+		want  bool
+	}{
+		{"Average", func() (imghash.Comparer, error) { return imghash.NewAverage() }, true},
+		{"Average with distance", func() (imghash.Comparer, error) {
+			return imghash.NewAverage(imghash.WithDistance(similarity.Jaccard))
+		}, false},
+		{"PHash", func() (imghash.Comparer, error) { return imghash.NewPHash() }, true},
+		{"PHash with unit weights", func() (imghash.Comparer, error) {
+			return imghash.NewPHash(imghash.WithWeights([]float64{1, 1, 1, 1, 1, 1, 1, 1}))
+		}, true},
+		{"PHash with weights", func() (imghash.Comparer, error) {
+			return imghash.NewPHash(imghash.WithWeights([]float64{2, 1, 1, 1, 1, 1, 1, 1}))
+		}, false},
+		{"PDQ", func() (imghash.Comparer, error) { return imghash.NewPDQ() }, true},
+		{"RASH", func() (imghash.Comparer, error) { return imghash.NewRASH() }, true},
+		{"BoVW SimHash", func() (imghash.Comparer, error) {
+			return imghash.NewBoVW(imghash.WithBoVWStorage(imghash.BoVWSimHash))
+		}, false},
+		{"ColorMoment", func() (imghash.Comparer, error) { return imghash.NewColorMoment() }, false},
+	}
+	h1, h2 := hashtype.Binary{0x0F, 0x00, 0, 0, 0, 0, 0, 0}, hashtype.Binary{0xF0, 0x01, 0, 0, 0, 0, 0, 0}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := imghash.ComparesHamming(c); got != tt.want {
+				t.Fatalf("ComparesHamming = %v, want %v", got, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			got, err := c.Compare(h1, h2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, _ := similarity.Hamming(h1, h2); !got.Equal(want) {
+				t.Errorf("Compare = %v, want the Hamming distance %v", got, want)
+			}
+		})
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"math"
 
 	"github.com/ajdnik/imghash/v2/hashtype"
-	"github.com/ajdnik/imghash/v2/internal/imgproc"
 	"github.com/ajdnik/imghash/v2/similarity"
 )
 
@@ -39,7 +38,7 @@ type EHD struct {
 // Without options, sensible defaults are used.
 func NewEHD(opts ...EHDOption) (EHD, error) {
 	e := EHD{
-		baseConfig: baseConfig{width: 256, height: 256, interp: Bilinear},
+		baseConfig: baseConfig{width: 256, height: 256, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 	}
 	for _, o := range opts {
 		o.applyEHD(&e)
@@ -52,18 +51,36 @@ func NewEHD(opts ...EHDOption) (EHD, error) {
 
 // Calculate returns an MPEG-7 EHD style perceptual hash.
 func (e EHD) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(e.width, e.height, img, e.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return e.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a UInt8 hash with enough capacity. See IntoHasher.
+func (e EHD) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return e.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (e EHD) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return e.calculate(nil, prep)
+}
+
+func (e EHD) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(e.alphaPolicy).cropBorders(e.border)
+	g, err := prep.ResizedGray(e.width, e.height, e.interp)
 	if err != nil {
 		return nil, err
 	}
-	return e.computeHash(g), nil
+	return e.computeHash(dst, g), nil
 }
 
-func (e EHD) computeHash(img *image.Gray) hashtype.UInt8 {
+func (e EHD) computeHash(dst hashtype.Hash, img *image.Gray) hashtype.UInt8 {
 	b := img.Bounds()
 	w, h := b.Dx(), b.Dy()
-	hash := make(hashtype.UInt8, ehdHashLen)
+	hash := hashInto[hashtype.UInt8](dst, ehdHashLen)
 	ox, oy := b.Min.X, b.Min.Y
 
 	for gy := 0; gy < ehdGridSize; gy++ {
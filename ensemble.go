@@ -0,0 +1,525 @@
+package imghash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// Ensemble errors.
+var (
+	// ErrNoMembers is returned by NewEnsemble without members.
+	ErrNoMembers = errors.New("imghash: ensemble needs at least one member")
+	// ErrInvalidMember is returned by NewEnsemble for a member without a
+	// name, with a duplicate name, or that computes Composite hashes, such
+	// as an Ensemble or a CropResistant.
+	ErrInvalidMember = errors.New("imghash: ensemble members need a unique name and must not compute composite hashes")
+	// ErrInvalidThreshold is returned by NewEnsemble when a member
+	// threshold is not a positive finite distance.
+	ErrInvalidThreshold = errors.New("imghash: member threshold must be greater than zero")
+	// ErrInvalidFusion is returned when an unknown fusion method is supplied.
+	ErrInvalidFusion = errors.New("imghash: invalid fusion method")
+	// ErrInvalidWeights is returned by NewEnsemble when the member weights
+	// do not suit the fusion method.
+	ErrInvalidWeights = errors.New("imghash: invalid ensemble weights")
+)
+
+// Fusion selects how an Ensemble combines the distances of its members.
+// Every method first divides the distance of each member by the member's
+// threshold, so a normalised distance of at most 1 means that member
+// matches, and fuses the normalised distances into one for which the same
+// holds: two images match when the fused distance is at most 1.
+type Fusion uint8
+
+const (
+	// FuseWeightedSum averages the normalised distances, weighted by the
+	// member weights. It is the default.
+	FuseWeightedSum Fusion = iota + 1
+	// FuseAnyMatch takes the smallest normalised distance, so images match
+	// when any member matches.
+	FuseAnyMatch
+	// FuseAllMatch takes the largest normalised distance, so images match
+	// when every member matches.
+	FuseAllMatch
+	// FuseLogistic estimates the probability p that two images match as
+	// 1 / (1 + exp(-(intercept + Σ weight·distance))) over the normalised
+	// distances and returns 2(1-p), which is at most 1 when p is at least
+	// one half. Its weights and intercept are usually learned with
+	// Ensemble.FitLogistic.
+	FuseLogistic
+)
+
+var fusionNames = []string{"WeightedSum", "AnyMatch", "AllMatch", "Logistic"}
+
+// String returns the name of the fusion method.
+func (f Fusion) String() string {
+	if f >= FuseWeightedSum && f <= FuseLogistic {
+		return fusionNames[f-1]
+	}
+	return "Unknown"
+}
+
+// Member is one named hasher of an Ensemble.
+type Member struct {
+	// Name identifies the member in the ensemble. It is the algorithm name
+	// for ensembles built by New.
+	Name string
+	// Hasher computes and compares the member's part of the hash. Its
+	// distances must grow as images become less similar.
+	Hasher HasherComparer
+	// Threshold is the distance at which the member considers two images
+	// a match. Distances are divided by it before they are fused.
+	Threshold similarity.Distance
+}
+
+// Ensemble combines several hash algorithms into one. Its hash is a
+// hashtype.Composite holding the hash of every member in order, and it
+// compares hashes by fusing the distances of the members, so images the
+// algorithms disagree on can be judged by all of them at once.
+//
+// An ensemble is registered as "ensemble" and can be constructed with New
+// and recorded in envelopes like any single algorithm. Its description
+// records each member with its hash-affecting parameters and, unless it
+// is the default for the algorithm, its threshold. The fusion method and
+// weights only affect Compare and are not recorded, but MarshalJSON
+// encodes the complete configuration.
+type Ensemble struct {
+	members   []Member
+	fusion    Fusion
+	weights   []float64
+	intercept float64
+}
+
+// EnsembleOption configures Ensemble.
+type EnsembleOption interface{ applyEnsemble(*Ensemble) }
+
+type fusionOption Fusion
+
+func (o fusionOption) applyEnsemble(e *Ensemble) { e.fusion = Fusion(o) }
+
+// WithFusion sets how member distances are fused. The default is
+// FuseWeightedSum.
+func WithFusion(f Fusion) EnsembleOption { return fusionOption(f) }
+
+type fusionInterceptOption float64
+
+func (o fusionInterceptOption) applyEnsemble(e *Ensemble) { e.intercept = float64(o) }
+
+// WithFusionIntercept sets the intercept of FuseLogistic. It is zero by
+// default and ignored by the other fusion methods.
+func WithFusionIntercept(b float64) EnsembleOption { return fusionInterceptOption(b) }
+
+// NewEnsemble combines members into an ensemble. Member weights, set with
+// WithWeights, default to one each; FuseWeightedSum needs non-negative
+// weights that are not all zero, FuseLogistic needs weights to be given,
+// and FuseAnyMatch and FuseAllMatch ignore them.
+func NewEnsemble(members []Member, opts ...EnsembleOption) (Ensemble, error) {
+	e := Ensemble{members: slices.Clone(members), fusion: FuseWeightedSum}
+	for _, o := range opts {
+		o.applyEnsemble(&e)
+	}
+	if len(e.members) == 0 {
+		return Ensemble{}, ErrNoMembers
+	}
+	for i, m := range e.members {
+		if m.Hasher == nil {
+			return Ensemble{}, ErrNilHasher
+		}
+		if isComposite(m.Hasher) || m.Name == "" {
+			return Ensemble{}, fmt.Errorf("%w: member %d", ErrInvalidMember, i)
+		}
+		if slices.ContainsFunc(e.members[:i], func(o Member) bool { return o.Name == m.Name }) {
+			return Ensemble{}, fmt.Errorf("%w: duplicate name %q", ErrInvalidMember, m.Name)
+		}
+		if !(m.Threshold > 0) || math.IsInf(float64(m.Threshold), 1) {
+			return Ensemble{}, fmt.Errorf("%w: %s has %v", ErrInvalidThreshold, m.Name, m.Threshold)
+		}
+	}
+	if e.fusion < FuseWeightedSum || e.fusion > FuseLogistic {
+		return Ensemble{}, ErrInvalidFusion
+	}
+	if math.IsNaN(e.intercept) || math.IsInf(e.intercept, 0) {
+		return Ensemble{}, fmt.Errorf("%w: intercept must be finite", ErrInvalidWeights)
+	}
+	if e.weights == nil {
+		if e.fusion == FuseLogistic {
+			return Ensemble{}, fmt.Errorf("%w: logistic fusion needs weights", ErrInvalidWeights)
+		}
+		e.weights = slices.Repeat([]float64{1}, len(e.members))
+	}
+	if len(e.weights) != len(e.members) {
+		return Ensemble{}, fmt.Errorf("%w: got %d weights for %d members", ErrInvalidWeights, len(e.weights), len(e.members))
+	}
+	var sum float64
+	for _, w := range e.weights {
+		if math.IsNaN(w) || math.IsInf(w, 0) {
+			return Ensemble{}, fmt.Errorf("%w: weights must be finite", ErrInvalidWeights)
+		}
+		if e.fusion == FuseWeightedSum && w < 0 {
+			return Ensemble{}, fmt.Errorf("%w: weighted sum needs non-negative weights", ErrInvalidWeights)
+		}
+		sum += w
+	}
+	if e.fusion == FuseWeightedSum && sum == 0 {
+		return Ensemble{}, fmt.Errorf("%w: weights must not all be zero", ErrInvalidWeights)
+	}
+	return e, nil
+}
+
+// Members returns the members of the ensemble in hash order.
+func (e Ensemble) Members() []Member { return slices.Clone(e.members) }
+
+// Calculate returns a hashtype.Composite with the hash of every member.
+func (e Ensemble) Calculate(img image.Image) (hashtype.Hash, error) {
+	return e.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but reuses the memory of dst when it is
+// a Composite, writing the hash of every member into the corresponding
+// part. See IntoHasher.
+func (e Ensemble) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return e.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but lets the members share the
+// preprocessing cached in a Prepared image.
+func (e Ensemble) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return e.calculate(nil, prep)
+}
+
+func (e Ensemble) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	parts, _ := dst.(hashtype.Composite)
+	parts = slices.Grow(parts[:0], len(e.members))[:len(e.members)]
+	var err error
+	for i, m := range e.members {
+		if parts[i], err = calculatePreparedInto(m.Hasher, parts[i], prep); err != nil {
+			return nil, fmt.Errorf("%s: %w", m.Name, err)
+		}
+	}
+	return parts, nil
+}
+
+// Distances returns the distance between the parts of h1 and h2 computed
+// by every member, before normalisation.
+func (e Ensemble) Distances(h1, h2 hashtype.Hash) ([]similarity.Distance, error) {
+	c1, ok := h1.(hashtype.Composite)
+	if !ok {
+		return nil, ErrIncompatibleHash
+	}
+	c2, ok := h2.(hashtype.Composite)
+	if !ok {
+		return nil, ErrIncompatibleHash
+	}
+	if len(c1) != len(e.members) || len(c2) != len(e.members) {
+		return nil, ErrHashLengthMismatch
+	}
+	d := make([]similarity.Distance, len(e.members))
+	for i, m := range e.members {
+		var err error
+		if d[i], err = m.Hasher.Compare(c1[i], c2[i]); err != nil {
+			return nil, fmt.Errorf("%s: %w", m.Name, err)
+		}
+	}
+	return d, nil
+}
+
+// Compare returns the fused distance between two composite hashes. Images
+// match when it is at most 1; see Fusion.
+func (e Ensemble) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
+	d, err := e.Distances(h1, h2)
+	if err != nil {
+		return 0, err
+	}
+	n := e.normalise(d)
+	switch e.fusion {
+	case FuseAnyMatch:
+		return similarity.Distance(slices.Min(n)), nil
+	case FuseAllMatch:
+		return similarity.Distance(slices.Max(n)), nil
+	case FuseLogistic:
+		z := e.intercept
+		for i, v := range n {
+			z += e.weights[i] * v
+		}
+		return similarity.Distance(2 * (1 - sigmoid(z))), nil
+	}
+	var sum, total float64
+	for i, v := range n {
+		sum += e.weights[i] * v
+		total += e.weights[i]
+	}
+	return similarity.Distance(sum / total), nil
+}
+
+// normalise divides every member distance by the member threshold.
+func (e Ensemble) normalise(d []similarity.Distance) []float64 {
+	n := make([]float64, len(d))
+	for i, v := range d {
+		n[i] = float64(v / e.members[i].Threshold)
+	}
+	return n
+}
+
+// FitLogistic learns the weights and intercept of FuseLogistic from
+// labelled pairs of composite hashes, like those of images and their
+// edited copies, and returns a copy of e that fuses with them. Of the
+// options only WithMatchPrior applies; by default the match prior is the
+// fraction of matching pairs.
+func (e Ensemble) FitLogistic(pairs []LabeledPair, opts ...CalibrationOption) (Ensemble, error) {
+	var cfg calibrationConfig
+	for _, o := range opts {
+		o.applyCalibration(&cfg)
+	}
+	if cfg.prior != 0 && !(cfg.prior > 0 && cfg.prior < 1) {
+		return Ensemble{}, ErrInvalidPrior
+	}
+	x := make([][]float64, len(pairs))
+	match := make([]bool, len(pairs))
+	var pos int
+	for i, p := range pairs {
+		d, err := e.Distances(p.A, p.B)
+		if err != nil {
+			return Ensemble{}, err
+		}
+		x[i], match[i] = e.normalise(d), p.Match
+		for _, v := range x[i] {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return Ensemble{}, fmt.Errorf("%w: distance %v is not finite", ErrInvalidCalibration, v)
+			}
+		}
+		if p.Match {
+			pos++
+		}
+	}
+	if pos == 0 || pos == len(pairs) {
+		return Ensemble{}, ErrTooFewPairs
+	}
+	intercept, weights := fitLogistic(x, match)
+	if cfg.prior != 0 {
+		intercept += logit(cfg.prior) - logit(float64(pos)/float64(len(pairs)))
+	}
+	return NewEnsemble(e.members, WithFusion(FuseLogistic), WithWeights(weights), WithFusionIntercept(intercept))
+}
+
+// ensembleMember is the encoded form of a Member.
+type ensembleMember struct {
+	Name string `json:"name"`
+	algorithmRef
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+type ensembleJSON struct {
+	Members   []ensembleMember `json:"members"`
+	Fusion    string           `json:"fusion"`
+	Weights   []float64        `json:"weights"`
+	Intercept float64          `json:"intercept,omitempty"`
+}
+
+// MarshalJSON encodes the configuration of the ensemble: every member by
+// its registered algorithm, version, hash-affecting parameters and
+// threshold, and the fusion method with its weights. Like envelopes, it
+// does not record options that only affect the Compare method of a
+// member, such as WithDistance. It fails with ErrUnknownHasher if a member
+// is not a registered algorithm.
+func (e Ensemble) MarshalJSON() ([]byte, error) {
+	members, err := e.encodeMembers(true)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ensembleJSON{
+		Members:   members,
+		Fusion:    e.fusion.String(),
+		Weights:   e.weights,
+		Intercept: e.intercept,
+	})
+}
+
+// UnmarshalJSON constructs the ensemble encoded by MarshalJSON. It fails
+// with ErrAlgorithmVersion if a member was encoded by a different version
+// of its algorithm than the one registered.
+func (e *Ensemble) UnmarshalJSON(data []byte) error {
+	var v ensembleJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	members, err := newMembers(v.Members, nil, nil)
+	if err != nil {
+		return err
+	}
+	f := Fusion(slices.Index(fusionNames, v.Fusion) + 1)
+	dec, err := NewEnsemble(members, WithFusion(f), WithWeights(v.Weights), WithFusionIntercept(v.Intercept))
+	if err != nil {
+		return err
+	}
+	*e = dec
+	return nil
+}
+
+// encodeMembers describes every member by its registered algorithm,
+// omitting parameters that keep their defaults. Thresholds are omitted
+// when they are the default threshold of the algorithm, unless all is set.
+func (e Ensemble) encodeMembers(all bool) ([]ensembleMember, error) {
+	out := make([]ensembleMember, len(e.members))
+	for i, m := range e.members {
+		ref, err := describeRef(m.Hasher)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = ensembleMember{Name: m.Name, algorithmRef: ref}
+		if all || m.Threshold != ensembleThresholds[ref.Algorithm] {
+			out[i].Threshold = float64(m.Threshold)
+		}
+	}
+	return out, nil
+}
+
+// newMembers constructs encoded members with New. Parameters in shared
+// apply to members that do not set them, and thresholds, when given,
+// override the encoded ones. Members without a threshold get the default
+// threshold of their algorithm.
+func newMembers(enc []ensembleMember, shared map[string]any, thresholds []float64) ([]Member, error) {
+	if thresholds != nil && len(thresholds) != len(enc) {
+		return nil, fmt.Errorf("%w: got %d thresholds for %d members", ErrInvalidThreshold, len(thresholds), len(enc))
+	}
+	members := make([]Member, len(enc))
+	for i, m := range enc {
+		h, err := m.build(shared)
+		if err != nil {
+			return nil, err
+		}
+		t := m.Threshold
+		if thresholds != nil {
+			t = thresholds[i]
+		}
+		if t == 0 {
+			d, ok := ensembleThresholds[m.Algorithm]
+			if !ok {
+				return nil, fmt.Errorf("%w: no default threshold for %s", ErrInvalidThreshold, m.Algorithm)
+			}
+			t = float64(d)
+		}
+		name := m.Name
+		if name == "" {
+			name = m.Algorithm
+		}
+		members[i] = Member{Name: name, Hasher: h, Threshold: similarity.Distance(t)}
+	}
+	return members, nil
+}
+
+// ensembleThresholds are the default member thresholds of ensembles built
+// by New. They separate images from mildly edited copies of themselves on
+// the standard attacks of the eval package, with default parameters.
+var ensembleThresholds = map[string]similarity.Distance{
+	"pdq":         31,
+	"colormoment": 0.0002,
+	"rash":        6,
+}
+
+// defaultEnsembleMembers are the members of an ensemble built by New
+// without the members parameter.
+var defaultEnsembleMembers = []ensembleMember{
+	{Name: "pdq", algorithmRef: algorithmRef{Algorithm: "pdq", Version: pdqVersion}},
+	{Name: "colormoment", algorithmRef: algorithmRef{Algorithm: "colormoment", Version: colorMomentVersion}},
+	{Name: "rash", algorithmRef: algorithmRef{Algorithm: "rash", Version: rashVersion}},
+}
+
+// parseEnsembleMembers parses the members parameter: a JSON array of
+// members or a comma-separated list of algorithm names.
+func parseEnsembleMembers(s string) ([]ensembleMember, error) {
+	var members []ensembleMember
+	if strings.HasPrefix(strings.TrimSpace(s), "[") {
+		if err := json.Unmarshal([]byte(s), &members); err != nil {
+			return nil, fmt.Errorf("%w for \"members\": %v", ErrInvalidParam, err)
+		}
+		return members, nil
+	}
+	for name := range strings.SplitSeq(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			members = append(members, ensembleMember{algorithmRef: algorithmRef{Algorithm: name}})
+		}
+	}
+	return members, nil
+}
+
+func formatEnsembleMembers(members []ensembleMember) string {
+	data, _ := json.Marshal(members)
+	return string(data)
+}
+
+func ensembleAlgorithm() Algorithm {
+	shared := []string{alphaModeParam.Name, backgroundParam.Name, cropToleranceParam.Name}
+	return Algorithm{
+		Name:    "ensemble",
+		Version: ensembleVersion,
+		Kind:    hashtype.KindComposite,
+		Params: []Param{
+			{Name: "members", Type: ParamString, Default: formatEnsembleMembers(defaultEnsembleMembers), Doc: "member algorithms, comma-separated or as a JSON array of {name, algorithm, version, params, threshold} (NewEnsemble)"},
+			{Name: "thresholds", Type: ParamFloats, CompareOnly: true, Doc: "per-member match distances, overriding those in members; known defaults for pdq, colormoment and rash (Member.Threshold)"},
+			{Name: "fusion", Type: ParamEnum, Default: FuseWeightedSum.String(), Values: fusionNames, CompareOnly: true, Doc: "how member distances are fused (WithFusion)"},
+			{Name: "weights", Type: ParamFloats, CompareOnly: true, Doc: "per-member fusion weights (WithWeights)"},
+			{Name: "intercept", Type: ParamFloat, Default: 0.0, CompareOnly: true, Doc: "logistic fusion intercept (WithFusionIntercept)"},
+			alphaModeParam, backgroundParam, cropToleranceParam,
+		},
+		New: func(p map[string]any) (HasherComparer, error) {
+			enc := defaultEnsembleMembers
+			if s, ok := p["members"].(string); ok {
+				var err error
+				if enc, err = parseEnsembleMembers(s); err != nil {
+					return nil, err
+				}
+			}
+			forward := make(map[string]any)
+			for _, k := range shared {
+				if v, ok := p[k]; ok {
+					forward[k] = v
+				}
+			}
+			thresholds, _ := p["thresholds"].([]float64)
+			members, err := newMembers(enc, forward, thresholds)
+			if err != nil {
+				return nil, err
+			}
+			var opts []EnsembleOption
+			if f, ok := p["fusion"].(string); ok {
+				opts = append(opts, WithFusion(Fusion(slices.Index(fusionNames, f)+1)))
+			}
+			if w, ok := p["weights"].([]float64); ok {
+				opts = append(opts, WithWeights(w))
+			}
+			if b, ok := p["intercept"].(float64); ok {
+				opts = append(opts, WithFusionIntercept(b))
+			}
+			return NewEnsemble(members, opts...)
+		},
+		Describe: func(h Hasher) (map[string]any, bool) {
+			e, ok := h.(Ensemble)
+			if !ok {
+				return nil, false
+			}
+			members, err := e.encodeMembers(false)
+			if err != nil {
+				return nil, false
+			}
+			return map[string]any{"members": formatEnsembleMembers(members)}, true
+		},
+	}
+}
+
+// Compile-time assertions: Ensemble plugs in wherever a single algorithm does.
+var (
+	_ HasherComparer   = Ensemble{}
+	_ PreparedHasher   = Ensemble{}
+	_ IntoHasher       = Ensemble{}
+	_ json.Marshaler   = Ensemble{}
+	_ json.Unmarshaler = (*Ensemble)(nil)
+)
@@ -0,0 +1,324 @@
+package imghash_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/jpeg"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// averageMembers returns two Average members with thresholds of 8 and 1 bits.
+func averageMembers(t *testing.T) []imghash.Member {
+	t.Helper()
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []imghash.Member{
+		{Name: "a", Hasher: avg, Threshold: 8},
+		{Name: "b", Hasher: avg, Threshold: 1},
+	}
+}
+
+func TestEnsemble_Compare(t *testing.T) {
+	members := averageMembers(t)
+	// The members are at distances 4 and 1, or 0.5 and 1 normalised.
+	h1 := hashtype.Composite{hashtype.Binary{0x00}, hashtype.Binary{0x00}}
+	h2 := hashtype.Composite{hashtype.Binary{0x0f}, hashtype.Binary{0x01}}
+	tests := []struct {
+		name string
+		opts []imghash.EnsembleOption
+		want similarity.Distance
+	}{
+		{"weighted sum", nil, 0.75},
+		{"weights", []imghash.EnsembleOption{imghash.WithWeights([]float64{3, 1})}, 0.625},
+		{"any match", []imghash.EnsembleOption{imghash.WithFusion(imghash.FuseAnyMatch)}, 0.5},
+		{"all match", []imghash.EnsembleOption{imghash.WithFusion(imghash.FuseAllMatch)}, 1},
+		{"logistic", []imghash.EnsembleOption{
+			imghash.WithFusion(imghash.FuseLogistic),
+			imghash.WithWeights([]float64{-2, -2}),
+			imghash.WithFusionIntercept(3),
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := imghash.NewEnsemble(members, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := e.Compare(h1, h2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(float64(got-tt.want)) > 1e-12 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	e, err := imghash.NewEnsemble(members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := e.Distances(h1, h2)
+	if err != nil || len(d) != 2 || d[0] != 4 || d[1] != 1 {
+		t.Errorf("Distances: got %v, %v; want [4 1]", d, err)
+	}
+	if _, err := e.Compare(h1, hashtype.Binary{0}); !errors.Is(err, imghash.ErrIncompatibleHash) {
+		t.Errorf("plain hash: got %v, want %v", err, imghash.ErrIncompatibleHash)
+	}
+	if _, err := e.Compare(h1, h1[:1]); !errors.Is(err, imghash.ErrHashLengthMismatch) {
+		t.Errorf("missing part: got %v, want %v", err, imghash.ErrHashLengthMismatch)
+	}
+}
+
+func TestNewEnsemble_errors(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := imghash.New("ensemble", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := imghash.Member{Name: "a", Hasher: avg, Threshold: 8}
+	tests := []struct {
+		name    string
+		members []imghash.Member
+		opts    []imghash.EnsembleOption
+		want    error
+	}{
+		{"no members", nil, nil, imghash.ErrNoMembers},
+		{"nil hasher", []imghash.Member{{Name: "a", Threshold: 1}}, nil, imghash.ErrNilHasher},
+		{"no name", []imghash.Member{{Hasher: avg, Threshold: 1}}, nil, imghash.ErrInvalidMember},
+		{"duplicate name", []imghash.Member{ok, ok}, nil, imghash.ErrInvalidMember},
+		{"nested", []imghash.Member{{Name: "e", Hasher: nested, Threshold: 1}}, nil, imghash.ErrInvalidMember},
+		{"zero threshold", []imghash.Member{{Name: "a", Hasher: avg}}, nil, imghash.ErrInvalidThreshold},
+		{"infinite threshold", []imghash.Member{{Name: "a", Hasher: avg, Threshold: similarity.Distance(math.Inf(1))}}, nil, imghash.ErrInvalidThreshold},
+		{"unknown fusion", []imghash.Member{ok}, []imghash.EnsembleOption{imghash.WithFusion(9)}, imghash.ErrInvalidFusion},
+		{"weight count", []imghash.Member{ok}, []imghash.EnsembleOption{imghash.WithWeights([]float64{1, 1})}, imghash.ErrInvalidWeights},
+		{"negative weight", []imghash.Member{ok}, []imghash.EnsembleOption{imghash.WithWeights([]float64{-1})}, imghash.ErrInvalidWeights},
+		{"zero weights", []imghash.Member{ok}, []imghash.EnsembleOption{imghash.WithWeights([]float64{0})}, imghash.ErrInvalidWeights},
+		{"logistic without weights", []imghash.Member{ok}, []imghash.EnsembleOption{imghash.WithFusion(imghash.FuseLogistic)}, imghash.ErrInvalidWeights},
+		{"infinite intercept", []imghash.Member{ok}, []imghash.EnsembleOption{imghash.WithFusionIntercept(math.Inf(1))}, imghash.ErrInvalidWeights},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := imghash.NewEnsemble(tt.members, tt.opts...); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsemble_Calculate(t *testing.T) {
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := imghash.OpenImage("assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+	recompressed, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := imghash.New("ensemble", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := e.Calculate(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, ok := h.(hashtype.Composite)
+	if !ok || len(parts) != 3 {
+		t.Fatalf("got %T with %d parts, want a Composite with 3", h, len(parts))
+	}
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, err := pdq.Calculate(img); err != nil || !reflect.DeepEqual(parts[0], want) {
+		t.Errorf("pdq part: got %v, want %v", parts[0], want)
+	}
+
+	hr, err := e.Calculate(recompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ho, err := e.Calculate(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := e.Compare(h, hr); err != nil || d > 1 {
+		t.Errorf("recompressed copy: got distance %v, %v; want at most 1", d, err)
+	}
+	if d, err := e.Compare(h, ho); err != nil || d <= 1 {
+		t.Errorf("different image: got distance %v, %v; want more than 1", d, err)
+	}
+}
+
+func TestEnsemble_registry(t *testing.T) {
+	h, err := imghash.New("ensemble", map[string]any{
+		"members":        "pdq, average",
+		"thresholds":     "20,10",
+		"fusion":         "anymatch",
+		"alpha_mode":     "Composite",
+		"crop_tolerance": 8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := imghash.Describe(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"pdq","algorithm":"pdq","version":2,"params":{"alpha_mode":"Composite","crop_tolerance":"8"},"threshold":20},` +
+		`{"name":"average","algorithm":"average","version":1,"params":{"alpha_mode":"Composite","crop_tolerance":"8"},"threshold":10}]`
+	if spec.Name != "ensemble" || spec.Kind != hashtype.KindComposite || spec.Params["members"] != want {
+		t.Errorf("got spec %+v, want members %s", spec, want)
+	}
+
+	img, err := imghash.OpenImage("assets/tulips.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := h.Calculate(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := imghash.NewEnvelope(h, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := imghash.FromEnvelope(env)
+	if err != nil {
+		t.Fatalf("FromEnvelope: %v", err)
+	}
+	if got, err := rebuilt.Calculate(img); err != nil || !reflect.DeepEqual(got, hash) {
+		t.Errorf("rebuilt hasher: got %v, %v; want %v", got, err, hash)
+	}
+
+	errTests := []struct {
+		name   string
+		params map[string]any
+		want   error
+	}{
+		{"no default threshold", map[string]any{"members": "average"}, imghash.ErrInvalidThreshold},
+		{"threshold count", map[string]any{"members": "pdq", "thresholds": "1,2"}, imghash.ErrInvalidThreshold},
+		{"unknown member", map[string]any{"members": "nope"}, imghash.ErrUnknownAlgorithm},
+		{"member version", map[string]any{"members": `[{"algorithm":"pdq","version":1}]`}, imghash.ErrAlgorithmVersion},
+		{"member param", map[string]any{"members": `[{"algorithm":"pdq","params":{"size":"8x8"}}]`}, imghash.ErrUnknownParam},
+		{"bad json", map[string]any{"members": `[{"algorithm":`}, imghash.ErrInvalidParam},
+		{"composite member", map[string]any{"members": `[{"algorithm":"cropresistant","threshold":0.5}]`}, imghash.ErrInvalidMember},
+		{"no members", map[string]any{"members": ""}, imghash.ErrNoMembers},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := imghash.New("ensemble", tt.params); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsemble_json(t *testing.T) {
+	e, err := imghash.New("ensemble", map[string]any{
+		"members":   `[{"name":"fine","algorithm":"pdq"},{"name":"coarse","algorithm":"phash","params":{"size":"16x16"},"threshold":12}]`,
+		"fusion":    "Logistic",
+		"weights":   "-3,-1.5",
+		"intercept": 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"members":[{"name":"fine","algorithm":"pdq","version":2,"threshold":31},` +
+		`{"name":"coarse","algorithm":"phash","version":1,"params":{"size":"16x16"},"threshold":12}],` +
+		`"fusion":"Logistic","weights":[-3,-1.5],"intercept":4}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	var got imghash.Ensemble
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	again, err := json.Marshal(got)
+	if err != nil || string(again) != want {
+		t.Errorf("round trip: got %s, %v", again, err)
+	}
+	if err := json.Unmarshal([]byte(`{"members":[],"fusion":"WeightedSum"}`), &got); !errors.Is(err, imghash.ErrNoMembers) {
+		t.Errorf("no members: got %v, want %v", err, imghash.ErrNoMembers)
+	}
+	if err := json.Unmarshal([]byte(`{"members":[{"algorithm":"pdq"}],"fusion":"Median"}`), &got); !errors.Is(err, imghash.ErrInvalidFusion) {
+		t.Errorf("unknown fusion: got %v, want %v", err, imghash.ErrInvalidFusion)
+	}
+}
+
+func TestEnsemble_FitLogistic(t *testing.T) {
+	e, err := imghash.NewEnsemble(averageMembers(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Matching pairs differ in few bits of the first part, non-matching
+	// pairs in many; the second part differs in one bit either way.
+	var pairs []imghash.LabeledPair
+	zero := hashtype.Composite{hashtype.Binary{0, 0}, hashtype.Binary{0}}
+	for i := range 40 {
+		near := hashtype.Composite{hashtype.Binary{byte(1<<(i%6) - 1), 0}, hashtype.Binary{byte(i % 2)}}
+		far := hashtype.Composite{hashtype.Binary{0xff, byte(1<<(i%8) - 1)}, hashtype.Binary{byte(i % 2)}}
+		pairs = append(pairs, imghash.LabeledPair{A: zero, B: near, Match: true})
+		pairs = append(pairs, imghash.LabeledPair{A: zero, B: far})
+	}
+	fitted, err := e.FitLogistic(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pairs {
+		d, err := fitted.Compare(p.A, p.B)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (d <= 1) != p.Match {
+			t.Errorf("pair %v: got distance %v, match %v", p.B, d, p.Match)
+		}
+	}
+	data, err := json.Marshal(fitted)
+	if err == nil {
+		var v struct {
+			Fusion  string
+			Weights []float64
+		}
+		err = json.Unmarshal(data, &v)
+		if v.Fusion != "Logistic" || len(v.Weights) != 2 || v.Weights[0] >= 0 || math.Abs(v.Weights[0]) < 5*math.Abs(v.Weights[1]) {
+			t.Errorf("got fusion %s with weights %v, want the first member to dominate", v.Fusion, v.Weights)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.FitLogistic(pairs[:1]); !errors.Is(err, imghash.ErrTooFewPairs) {
+		t.Errorf("one class: got %v, want %v", err, imghash.ErrTooFewPairs)
+	}
+	if _, err := e.FitLogistic(pairs, imghash.WithMatchPrior(1)); !errors.Is(err, imghash.ErrInvalidPrior) {
+		t.Errorf("prior: got %v, want %v", err, imghash.ErrInvalidPrior)
+	}
+}
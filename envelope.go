@@ -0,0 +1,63 @@
+package imghash
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+// Envelope wraps a hash together with the algorithm name, version and
+// options that produced it. Its binary, text and JSON encodings are
+// stable across releases; use hashtype.Decode or hashtype.DecodeEnvelope
+// to read them back.
+type Envelope = hashtype.Envelope
+
+// ErrUnknownHasher is returned when algorithm metadata is requested for a
+// Hasher implementation that is not registered (see Register).
+var ErrUnknownHasher = errors.New("imghash: unknown hasher")
+
+// ErrHashKindMismatch is returned when a hash does not have the kind
+// produced by the hasher it is being wrapped with.
+var ErrHashKindMismatch = errors.New("imghash: hash kind does not match hasher")
+
+// NewEnvelope wraps hash in an Envelope that records the algorithm,
+// algorithm version and hash-affecting options of hasher, as reported by
+// Describe. Options that only influence Compare, such as WithDistance and
+// WithWeights, are not recorded.
+func NewEnvelope(hasher Hasher, hash Hash) (Envelope, error) {
+	spec, err := Describe(hasher)
+	if err != nil {
+		return Envelope{}, err
+	}
+	if got := hashtype.KindOf(hash); got != spec.Kind {
+		return Envelope{}, fmt.Errorf("%w: %s produces %v hashes, got %v", ErrHashKindMismatch, spec.Name, spec.Kind, got)
+	}
+	params := make(map[string]string, len(spec.Params))
+	for k, v := range spec.Params {
+		params[k] = formatParam(v)
+	}
+	return Envelope{
+		Algorithm: spec.Name,
+		Version:   spec.Version,
+		Params:    params,
+		Hash:      hash,
+	}, nil
+}
+
+// params returns the shared resize options as canonical parameters.
+func (b baseConfig) params() map[string]any {
+	return b.border.params(b.alphaPolicy.params(map[string]any{
+		"size":          formatDims(b.width, b.height),
+		"interpolation": b.interp.String(),
+	}))
+}
+
+func formatDims(w, h uint) string {
+	return strconv.FormatUint(uint64(w), 10) + "x" + strconv.FormatUint(uint64(h), 10)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,146 @@
+package imghash_test
+
+import (
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+var envelopeTests = []struct {
+	name    string
+	build   func() (imghash.Hasher, error)
+	algo    string
+	kind    hashtype.Kind
+	params  map[string]string
+	missing []string
+}{
+	{
+		name:   "Average defaults",
+		build:  func() (imghash.Hasher, error) { return imghash.NewAverage() },
+		algo:   "average",
+		kind:   hashtype.KindBinary,
+		params: map[string]string{"size": "8x8", "interpolation": "Bilinear"},
+	},
+	{
+		name: "PHash ignores weights",
+		build: func() (imghash.Hasher, error) {
+			return imghash.NewPHash(imghash.WithSize(16, 16), imghash.WithWeights([]float64{1, 2, 3, 4, 5, 6, 7, 8}))
+		},
+		algo:    "phash",
+		kind:    hashtype.KindBinary,
+		params:  map[string]string{"size": "16x16", "interpolation": "BilinearExact"},
+		missing: []string{"weights"},
+	},
+	{
+		name: "BlockMean",
+		build: func() (imghash.Hasher, error) {
+			return imghash.NewBlockMean(imghash.WithBlockMeanMethod(imghash.RotationOverlap))
+		},
+		algo:   "blockmean",
+		kind:   hashtype.KindBinary,
+		params: map[string]string{"block_size": "16x16", "block_mean_method": "RotationOverlap"},
+	},
+	{
+		name:   "RadialVariance",
+		build:  func() (imghash.Hasher, error) { return imghash.NewRadialVariance(imghash.WithSigma(1.5)) },
+		algo:   "radialvariance",
+		kind:   hashtype.KindUInt8,
+		params: map[string]string{"sigma": "1.5", "angles": "180"},
+	},
+	{
+		name:   "WHash",
+		build:  func() (imghash.Hasher, error) { return imghash.NewWHash(imghash.WithLevel(2)) },
+		algo:   "whash",
+		kind:   hashtype.KindBinary,
+		params: map[string]string{"level": "2"},
+	},
+	{
+		name:    "BoVW SimHash",
+		build:   func() (imghash.Hasher, error) { return imghash.NewBoVW(imghash.WithBoVWStorage(imghash.BoVWSimHash)) },
+		algo:    "bovw",
+		kind:    hashtype.KindBinary,
+		params:  map[string]string{"bovw_feature": "ORB", "bovw_storage": "SimHash", "sim_hash_bits": "128"},
+		missing: []string{"min_hash_size"},
+	},
+	{
+		name:    "PDQ",
+		build:   func() (imghash.Hasher, error) { return imghash.NewPDQ() },
+		algo:    "pdq",
+		kind:    hashtype.KindBinary,
+		params:  map[string]string{"interpolation": "Bilinear"},
+		missing: []string{"size"},
+	},
+	{
+		name:   "GIST",
+		build:  func() (imghash.Hasher, error) { return imghash.NewGIST(imghash.WithGridSize(2, 3)) },
+		algo:   "gist",
+		kind:   hashtype.KindFloat64,
+		params: map[string]string{"grid_size": "2x3"},
+	},
+}
+
+func TestNewEnvelope(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for _, tt := range envelopeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := tt.build()
+			if err != nil {
+				t.Fatalf("failed to create hasher: %v", err)
+			}
+			hash, err := h.Calculate(img)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			env, err := imghash.NewEnvelope(h, hash)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if env.Algorithm != tt.algo || env.Version == 0 || env.Kind() != tt.kind {
+				t.Errorf("got %s v%d %v, want %s %v", env.Algorithm, env.Version, env.Kind(), tt.algo, tt.kind)
+			}
+			for k, v := range tt.params {
+				if env.Params[k] != v {
+					t.Errorf("param %s: got %q, want %q", k, env.Params[k], v)
+				}
+			}
+			for _, k := range tt.missing {
+				if _, ok := env.Params[k]; ok {
+					t.Errorf("param %s should not be recorded", k)
+				}
+			}
+
+			data, err := env.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+			dec, err := hashtype.DecodeEnvelope(data)
+			if err != nil {
+				t.Fatalf("DecodeEnvelope: %v", err)
+			}
+			dist, err := imghash.Compare(hash, dec.Hash)
+			if err != nil || dist != 0 {
+				t.Errorf("decoded hash differs: dist %v, err %v", dist, err)
+			}
+		})
+	}
+}
+
+type customHasher struct{}
+
+func (customHasher) Calculate(image.Image) (hashtype.Hash, error) { return hashtype.Binary{0}, nil }
+
+func TestNewEnvelope_errors(t *testing.T) {
+	if _, err := imghash.NewEnvelope(customHasher{}, hashtype.Binary{0}); !errors.Is(err, imghash.ErrUnknownHasher) {
+		t.Errorf("got %v, want %v", err, imghash.ErrUnknownHasher)
+	}
+	cld, err := imghash.NewCLD()
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+	if _, err := imghash.NewEnvelope(cld, hashtype.Binary{0}); !errors.Is(err, imghash.ErrHashKindMismatch) {
+		t.Errorf("got %v, want %v", err, imghash.ErrHashKindMismatch)
+	}
+}
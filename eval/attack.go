@@ -0,0 +1,364 @@
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/ajdnik/imghash/v2/internal/imgproc"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Attack is a named image transform that a perceptual hash should be
+// robust to.
+type Attack struct {
+	// Name identifies the attack in reports. The attacks of this package
+	// are named like their ParseAttacks spec, e.g. "jpeg:50".
+	Name string
+	// Apply returns the transformed image. It must be deterministic, safe
+	// for concurrent use and must not modify its argument.
+	Apply func(image.Image) (image.Image, error)
+	// err is set by the constructors of this package for invalid
+	// parameters.
+	err error
+}
+
+func invalidAttack(name string) Attack {
+	err := fmt.Errorf("%w: %s", ErrInvalidAttack, name)
+	return Attack{Name: name, Apply: func(image.Image) (image.Image, error) { return nil, err }, err: err}
+}
+
+// formatParam formats an attack parameter in its shortest form.
+func formatParam(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// JPEG re-encodes the image as a JPEG of the given quality, 1 to 100.
+func JPEG(quality int) Attack {
+	name := "jpeg:" + strconv.Itoa(quality)
+	if quality < 1 || quality > 100 {
+		return invalidAttack(name)
+	}
+	return Attack{Name: name, Apply: func(img image.Image) (image.Image, error) {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		return jpeg.Decode(&buf)
+	}}
+}
+
+// Scale resizes the image by factor, which must be positive, with
+// bilinear interpolation.
+func Scale(factor float64) Attack {
+	name := "scale:" + formatParam(factor)
+	if !(factor > 0) || math.IsInf(factor, 1) {
+		return invalidAttack(name)
+	}
+	return Attack{Name: name, Apply: func(img image.Image) (image.Image, error) {
+		b := img.Bounds()
+		w := max(1, uint(math.Round(float64(b.Dx())*factor)))
+		h := max(1, uint(math.Round(float64(b.Dy())*factor)))
+		return imgproc.Resize(w, h, img, imgproc.Bilinear), nil
+	}}
+}
+
+// Rotate rotates the image counterclockwise by degrees about its centre,
+// keeping its size. Corners rotated in from outside the image are black.
+func Rotate(degrees float64) Attack {
+	name := "rotate:" + formatParam(degrees)
+	if math.IsNaN(degrees) || math.IsInf(degrees, 0) {
+		return invalidAttack(name)
+	}
+	return Attack{Name: name, Apply: func(img image.Image) (image.Image, error) {
+		src := toRGBA(img)
+		w, h := src.Rect.Dx(), src.Rect.Dy()
+		dst := image.NewRGBA(src.Rect)
+		sin, cos := math.Sincos(degrees * math.Pi / 180)
+		cx, cy := float64(w-1)/2, float64(h-1)/2
+		for y := range h {
+			for x := range w {
+				// Map the destination pixel back onto the source.
+				dx, dy := float64(x)-cx, float64(y)-cy
+				sx := cos*dx - sin*dy + cx
+				sy := sin*dx + cos*dy + cy
+				dst.SetRGBA(x, y, bilinearAt(src, sx, sy))
+			}
+		}
+		return dst, nil
+	}}
+}
+
+// bilinearAt samples img at (x, y), treating pixels outside it as
+// transparent black.
+func bilinearAt(img *image.RGBA, x, y float64) color.RGBA {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	var acc [4]float64
+	for _, t := range [4]struct {
+		dx, dy int
+		w      float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		px, py := int(x0)+t.dx, int(y0)+t.dy
+		if t.w == 0 || !image.Pt(px, py).In(img.Rect) {
+			continue
+		}
+		c := img.RGBAAt(px, py)
+		acc[0] += t.w * float64(c.R)
+		acc[1] += t.w * float64(c.G)
+		acc[2] += t.w * float64(c.B)
+		acc[3] += t.w * float64(c.A)
+	}
+	return color.RGBA{
+		R: uint8(math.Round(acc[0])),
+		G: uint8(math.Round(acc[1])),
+		B: uint8(math.Round(acc[2])),
+		A: uint8(math.Round(acc[3])),
+	}
+}
+
+// Crop removes fraction of the width and of the height, in [0, 1), keeping
+// the centre of the image.
+func Crop(fraction float64) Attack {
+	name := "crop:" + formatParam(fraction)
+	if !(fraction >= 0 && fraction < 1) {
+		return invalidAttack(name)
+	}
+	return Attack{Name: name, Apply: func(img image.Image) (image.Image, error) {
+		b := img.Bounds()
+		w := min(max(int(math.Round(float64(b.Dx())*(1-fraction))), 1), b.Dx())
+		h := min(max(int(math.Round(float64(b.Dy())*(1-fraction))), 1), b.Dy())
+		x, y := b.Min.X+(b.Dx()-w)/2, b.Min.Y+(b.Dy()-h)/2
+		r := image.Rect(x, y, x+w, y+h)
+		return imgproc.Crop(toRGBA(img), r.Sub(b.Min)), nil
+	}}
+}
+
+// Gamma raises every normalised colour channel to the power gamma, which
+// must be positive. Values below one brighten the image.
+func Gamma(gamma float64) Attack {
+	name := "gamma:" + formatParam(gamma)
+	if !(gamma > 0) || math.IsInf(gamma, 1) {
+		return invalidAttack(name)
+	}
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = uint8(math.Round(255 * math.Pow(float64(i)/255, gamma)))
+	}
+	return Attack{Name: name, Apply: func(img image.Image) (image.Image, error) {
+		dst := toRGBA(img)
+		for i := range dst.Pix {
+			if i%4 != 3 {
+				dst.Pix[i] = lut[dst.Pix[i]]
+			}
+		}
+		return dst, nil
+	}}
+}
+
+// Blur applies a Gaussian blur with standard deviation sigma, which must
+// be positive, in pixels.
+func Blur(sigma float64) Attack {
+	name := "blur:" + formatParam(sigma)
+	if !(sigma > 0) || math.IsInf(sigma, 1) {
+		return invalidAttack(name)
+	}
+	return Attack{Name: name, Apply: func(img image.Image) (image.Image, error) {
+		return imgproc.GaussianBlur(toRGBA(img), 0, sigma), nil
+	}}
+}
+
+// noiseSeed seeds the noise of Noise, so attacked images are reproducible.
+const noiseSeed = 0x5EED
+
+// Noise adds Gaussian noise with standard deviation stddev, which must not
+// be negative, in 8-bit levels to every colour channel. The noise depends
+// only on the image size, so results are reproducible.
+func Noise(stddev float64) Attack {
+	name := "noise:" + formatParam(stddev)
+	if !(stddev >= 0) || math.IsInf(stddev, 1) {
+		return invalidAttack(name)
+	}
+	return Attack{Name: name, Apply: func(img image.Image) (image.Image, error) {
+		dst := toRGBA(img)
+		rng := rand.New(rand.NewPCG(noiseSeed, uint64(len(dst.Pix))))
+		for i := range dst.Pix {
+			if i%4 != 3 {
+				v := float64(dst.Pix[i]) + rng.NormFloat64()*stddev
+				dst.Pix[i] = uint8(math.Round(min(max(v, 0), 255)))
+			}
+		}
+		return dst, nil
+	}}
+}
+
+// watermarkText is the text Watermark overlays.
+const watermarkText = "imghash"
+
+// Watermark overlays white text across the lower part of the image with
+// the given opacity, in [0, 1]. The text spans half the image width.
+func Watermark(opacity float64) Attack {
+	name := "watermark:" + formatParam(opacity)
+	if !(opacity >= 0 && opacity <= 1) {
+		return invalidAttack(name)
+	}
+	return Attack{Name: name, Apply: func(img image.Image) (image.Image, error) {
+		dst := toRGBA(img)
+		w, h := dst.Rect.Dx(), dst.Rect.Dy()
+		face := basicfont.Face7x13
+		tw := font.MeasureString(face, watermarkText).Ceil()
+		th := face.Metrics().Height.Ceil()
+		text := image.NewAlpha(image.Rect(0, 0, tw, th))
+		d := font.Drawer{Dst: text, Src: image.Opaque, Face: face, Dot: fixed.P(0, face.Metrics().Ascent.Ceil())}
+		d.DrawString(watermarkText)
+
+		sw := max(1, w/2)
+		sh := max(1, sw*th/tw)
+		x0, y0 := (w-sw)/2, h-sh-h/10
+		mask := image.NewAlpha(image.Rect(x0, y0, x0+sw, y0+sh))
+		xdraw.NearestNeighbor.Scale(mask, mask.Rect, text, text.Rect, draw.Src, nil)
+		a := uint8(math.Round(opacity * 255))
+		for i, v := range mask.Pix {
+			mask.Pix[i] = uint8(uint(v) * uint(a) / 255)
+		}
+		draw.DrawMask(dst, mask.Rect, image.White, image.Point{}, mask, mask.Rect.Min, draw.Over)
+		return dst, nil
+	}}
+}
+
+// FlipHorizontal mirrors the image left to right.
+func FlipHorizontal() Attack {
+	return Attack{Name: "fliph", Apply: func(img image.Image) (image.Image, error) {
+		src := toRGBA(img)
+		dst := image.NewRGBA(src.Rect)
+		w := src.Rect.Dx()
+		for y := range src.Rect.Dy() {
+			for x := range w {
+				dst.SetRGBA(w-1-x, y, src.RGBAAt(x, y))
+			}
+		}
+		return dst, nil
+	}}
+}
+
+// FlipVertical mirrors the image top to bottom.
+func FlipVertical() Attack {
+	return Attack{Name: "flipv", Apply: func(img image.Image) (image.Image, error) {
+		src := toRGBA(img)
+		dst := image.NewRGBA(src.Rect)
+		h := src.Rect.Dy()
+		for y := range h {
+			copy(dst.Pix[dst.PixOffset(0, h-1-y):], src.Pix[src.PixOffset(0, y):src.PixOffset(0, y+1)])
+		}
+		return dst, nil
+	}}
+}
+
+// toRGBA returns a copy of img as an RGBA image with its origin at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, img, b.Min, draw.Src)
+	return dst
+}
+
+// Standard returns the default set of attacks: JPEG recompression,
+// rescaling, small rotations, cropping, gamma changes, blur, noise, a
+// watermark and mirroring.
+func Standard() []Attack {
+	return []Attack{
+		JPEG(75), JPEG(30),
+		Scale(0.5), Scale(1.5),
+		Rotate(3), Rotate(10),
+		Crop(0.1), Crop(0.25),
+		Gamma(0.6), Gamma(1.6),
+		Blur(1.5),
+		Noise(8),
+		Watermark(0.6),
+		FlipHorizontal(),
+	}
+}
+
+// attackParsers maps the attack names of ParseAttacks to constructors.
+var attackParsers = map[string]func(param string) (Attack, error){
+	"jpeg": func(p string) (Attack, error) {
+		q, err := strconv.Atoi(p)
+		if err != nil {
+			return Attack{}, err
+		}
+		return JPEG(q), nil
+	},
+	"scale":     floatAttack(Scale),
+	"rotate":    floatAttack(Rotate),
+	"crop":      floatAttack(Crop),
+	"gamma":     floatAttack(Gamma),
+	"blur":      floatAttack(Blur),
+	"noise":     floatAttack(Noise),
+	"watermark": floatAttack(Watermark),
+	"fliph":     noParamAttack(FlipHorizontal),
+	"flipv":     noParamAttack(FlipVertical),
+}
+
+func floatAttack(fn func(float64) Attack) func(string) (Attack, error) {
+	return func(p string) (Attack, error) {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return Attack{}, err
+		}
+		return fn(v), nil
+	}
+}
+
+func noParamAttack(fn func() Attack) func(string) (Attack, error) {
+	return func(p string) (Attack, error) {
+		if p != "" {
+			return Attack{}, fmt.Errorf("takes no parameter")
+		}
+		return fn(), nil
+	}
+}
+
+// ParseAttacks parses a comma-separated list of attacks, each written as
+// name:param or name, like "jpeg:50,scale:0.5,rotate:5,fliph". The names
+// are jpeg, scale, rotate, crop, gamma, blur, noise and watermark, whose
+// parameter is that of the function of the same name, and fliph and
+// flipv, which take none. "standard" expands to Standard().
+func ParseAttacks(spec string) ([]Attack, error) {
+	var attacks []Attack
+	for item := range strings.SplitSeq(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "standard" {
+			attacks = append(attacks, Standard()...)
+			continue
+		}
+		name, param, _ := strings.Cut(item, ":")
+		parse, ok := attackParsers[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownAttack, item)
+		}
+		a, err := parse(param)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidAttack, item, err)
+		}
+		if a.err != nil {
+			return nil, a.err
+		}
+		attacks = append(attacks, a)
+	}
+	return attacks, nil
+}
@@ -0,0 +1,130 @@
+package eval_test
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2/eval"
+)
+
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{uint8(255 * x / w), uint8(255 * y / h), uint8((x + y) % 256), 255})
+		}
+	}
+	return img
+}
+
+func TestAttacks(t *testing.T) {
+	src := gradient(80, 60)
+	orig := image.NewRGBA(src.Rect)
+	copy(orig.Pix, src.Pix)
+	tests := []struct {
+		attack eval.Attack
+		name   string
+		size   image.Point
+	}{
+		{eval.JPEG(50), "jpeg:50", image.Pt(80, 60)},
+		{eval.Scale(0.5), "scale:0.5", image.Pt(40, 30)},
+		{eval.Scale(1.5), "scale:1.5", image.Pt(120, 90)},
+		{eval.Rotate(5), "rotate:5", image.Pt(80, 60)},
+		{eval.Crop(0.25), "crop:0.25", image.Pt(60, 45)},
+		{eval.Gamma(2), "gamma:2", image.Pt(80, 60)},
+		{eval.Blur(1.5), "blur:1.5", image.Pt(80, 60)},
+		{eval.Noise(10), "noise:10", image.Pt(80, 60)},
+		{eval.Watermark(0.5), "watermark:0.5", image.Pt(80, 60)},
+		{eval.FlipHorizontal(), "fliph", image.Pt(80, 60)},
+		{eval.FlipVertical(), "flipv", image.Pt(80, 60)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.attack.Name != tt.name {
+				t.Errorf("name %q, want %q", tt.attack.Name, tt.name)
+			}
+			a, err := tt.attack.Apply(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.Bounds().Size(); got != tt.size {
+				t.Errorf("size %v, want %v", got, tt.size)
+			}
+			b, err := tt.attack.Apply(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(a, b) {
+				t.Error("attack is not deterministic")
+			}
+			if reflect.DeepEqual(a, image.Image(orig)) {
+				t.Error("attack did not change the image")
+			}
+			if !reflect.DeepEqual(src, orig) {
+				t.Error("attack modified its input")
+			}
+		})
+	}
+}
+
+func TestFlipHorizontal(t *testing.T) {
+	src := gradient(4, 2)
+	img, err := eval.FlipHorizontal().Apply(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img.At(0, 1), src.At(3, 1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAttacks_invalid(t *testing.T) {
+	for _, a := range []eval.Attack{
+		eval.JPEG(0), eval.JPEG(101), eval.Scale(0), eval.Crop(1), eval.Crop(-0.1),
+		eval.Gamma(0), eval.Blur(-1), eval.Noise(-1), eval.Watermark(1.5),
+	} {
+		if _, err := a.Apply(gradient(8, 8)); !errors.Is(err, eval.ErrInvalidAttack) {
+			t.Errorf("%s: got %v, want ErrInvalidAttack", a.Name, err)
+		}
+	}
+}
+
+func TestParseAttacks(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr error
+	}{
+		{"jpeg:50", []string{"jpeg:50"}, nil},
+		{"scale:0.50, rotate:5,fliph", []string{"scale:0.5", "rotate:5", "fliph"}, nil},
+		{"standard", names(eval.Standard()), nil},
+		{"sharpen:1", nil, eval.ErrUnknownAttack},
+		{"", nil, eval.ErrUnknownAttack},
+		{"jpeg:high", nil, eval.ErrInvalidAttack},
+		{"jpeg:0", nil, eval.ErrInvalidAttack},
+		{"fliph:1", nil, eval.ErrInvalidAttack},
+		{"crop", nil, eval.ErrInvalidAttack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := eval.ParseAttacks(tt.spec)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(names(got), tt.want) {
+				t.Errorf("got %v, want %v", names(got), tt.want)
+			}
+		})
+	}
+}
+
+func names(attacks []eval.Attack) []string {
+	var s []string
+	for _, a := range attacks {
+		s = append(s, a.Name)
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package eval
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+var summaryHeader = []string{
+	"hasher", "attack",
+	"genuine_count", "genuine_mean", "genuine_median", "genuine_p95",
+	"impostor_count", "impostor_mean", "impostor_median", "impostor_p05",
+	"auc", "eer", "eer_threshold",
+}
+
+func summaryRow(r Result) [][]string {
+	return [][]string{{
+		r.Hasher, r.Attack,
+		strconv.Itoa(r.Genuine.Count), formatFloat(r.Genuine.Mean), formatFloat(r.Genuine.Median), formatFloat(r.Genuine.P95),
+		strconv.Itoa(r.Impostor.Count), formatFloat(r.Impostor.Mean), formatFloat(r.Impostor.Median), formatFloat(r.Impostor.P05),
+		formatFloat(r.ROC.AUC), formatFloat(r.ROC.EER), formatFloat(r.ROC.EERThreshold),
+	}}
+}
+
+var rocHeader = []string{
+	"hasher", "attack", "threshold", "tp", "fp", "fn", "tn", "tpr", "fpr", "precision", "recall",
+}
+
+func rocRows(r Result) [][]string {
+	rows := make([][]string, len(r.ROC.Points))
+	for i, p := range r.ROC.Points {
+		rows[i] = []string{
+			r.Hasher, r.Attack, formatFloat(p.Threshold),
+			strconv.Itoa(p.TP), strconv.Itoa(p.FP), strconv.Itoa(p.FN), strconv.Itoa(p.TN),
+			formatFloat(p.TPR), formatFloat(p.FPR), formatFloat(p.Precision), formatFloat(p.Recall),
+		}
+	}
+	return rows
+}
+
+func writeCSV(w io.Writer, header []string, results []Result, rows func(Result) [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err := cw.WriteAll(rows(r)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatFloat(f float64) string { return strconv.FormatFloat(f, 'g', 6, 64) }
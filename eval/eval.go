@@ -0,0 +1,429 @@
+// Package eval measures how well perceptual hashes survive common image
+// transformations.
+//
+// Run applies a set of deterministic attacks (JPEG recompression,
+// rescaling, rotation, cropping, gamma changes, blur, noise, watermarks
+// and flips) to every image of a corpus and hashes the originals and the
+// attacked copies with each hasher under test. For every hasher and
+// attack it compares
+//
+//   - genuine pairs, an image and its own attacked copy, which a robust
+//     hash keeps close, and
+//   - impostor pairs, an image and the attacked copy of a different
+//     image, which a discriminative hash keeps apart,
+//
+// and reports the distance distributions of both, the ROC curve of a
+// distance threshold with precision and recall at each threshold, the
+// area under the curve and the equal error rate:
+//
+//	phash, _ := imghash.NewPHash()
+//	pdq, _ := imghash.NewPDQ()
+//	report, err := eval.Run(ctx, imghash.Files(paths...), []eval.Hasher{
+//		{Name: "phash", HasherComparer: phash},
+//		{Name: "pdq", HasherComparer: pdq},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	for _, r := range report.Results {
+//		fmt.Printf("%s %s: AUC %.3f, EER %.3f at %v\n", r.Hasher, r.Attack, r.ROC.AUC, r.ROC.EER, r.ROC.EERThreshold)
+//	}
+//
+// Report.WriteCSV and encoding/json write reports for further analysis.
+// The imghash command exposes Run as its eval subcommand.
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"iter"
+	"runtime"
+	"sync"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+var (
+	// ErrNoHashers is returned when no hashers are given or one of them is
+	// nil.
+	ErrNoHashers = errors.New("eval: at least one non-nil hasher is required")
+	// ErrNoAttacks is returned when the set of attacks is empty.
+	ErrNoAttacks = errors.New("eval: at least one attack is required")
+	// ErrDuplicateName is returned when two hashers or two attacks share a
+	// name.
+	ErrDuplicateName = errors.New("eval: names must be unique")
+	// ErrInvalidAttack is returned for an attack with an invalid parameter.
+	ErrInvalidAttack = errors.New("eval: invalid attack")
+	// ErrUnknownAttack is returned by ParseAttacks for an unknown name.
+	ErrUnknownAttack = errors.New("eval: unknown attack")
+	// ErrInvalidWorkers is returned when the worker count is not positive.
+	ErrInvalidWorkers = errors.New("eval: workers must be greater than zero")
+	// ErrInvalidImpostors is returned when the impostor count is negative.
+	ErrInvalidImpostors = errors.New("eval: impostors must not be negative")
+	// ErrInvalidPoints is returned when the ROC point count is negative.
+	ErrInvalidPoints = errors.New("eval: ROC points must not be negative")
+	// ErrTooFewImages is returned when fewer than two images of the corpus
+	// could be hashed, so there are no impostor pairs.
+	ErrTooFewImages = errors.New("eval: at least two images are required")
+)
+
+// Hasher is a hasher under evaluation.
+type Hasher struct {
+	// Name identifies the hasher in reports, e.g. "pdq" or "phash-16x16".
+	Name string
+	imghash.HasherComparer
+}
+
+// Option configures Run.
+type Option interface{ apply(*config) }
+
+type config struct {
+	attacks   []Attack
+	workers   int
+	impostors int
+	points    int
+}
+
+type attacksOption []Attack
+
+func (o attacksOption) apply(c *config) { c.attacks = o }
+
+// WithAttacks sets the attacks applied to the corpus. It defaults to
+// Standard().
+func WithAttacks(attacks ...Attack) Option { return attacksOption(attacks) }
+
+type workersOption int
+
+func (o workersOption) apply(c *config) { c.workers = int(o) }
+
+// WithWorkers sets the number of images decoded, attacked and hashed
+// concurrently. It defaults to runtime.GOMAXPROCS(0).
+func WithWorkers(n int) Option { return workersOption(n) }
+
+type impostorsOption int
+
+func (o impostorsOption) apply(c *config) { c.impostors = int(o) }
+
+// WithImpostors sets how many other images every image is paired with as
+// impostors, so a corpus of n images yields n*k impostor pairs per attack.
+// Zero pairs every image with all others. It defaults to 100.
+func WithImpostors(k int) Option { return impostorsOption(k) }
+
+type pointsOption int
+
+func (o pointsOption) apply(c *config) { c.points = int(o) }
+
+// WithROCPoints limits the points kept of every ROC curve to n, evenly
+// spaced. AUC and EER are always computed on the full curve. Zero keeps
+// one point per distinct distance. It defaults to 100.
+func WithROCPoints(n int) Option { return pointsOption(n) }
+
+// Report is the outcome of Run.
+type Report struct {
+	// Images is the number of corpus images that were evaluated.
+	Images int `json:"images"`
+	// Results holds one entry per hasher and attack, ordered by hasher and
+	// then by attack as they were given.
+	Results []Result `json:"results"`
+	// Failures lists the images, attacks and hashes that failed. A failed
+	// image is left out of every pair it belongs to.
+	Failures []*Failure `json:"-"`
+}
+
+// Result measures one hasher under one attack.
+type Result struct {
+	Hasher string `json:"hasher"`
+	Attack string `json:"attack"`
+	// Genuine summarises the distances between images and their attacked
+	// copies, Impostor those between images and the attacked copies of
+	// other images.
+	Genuine  Distribution `json:"genuine"`
+	Impostor Distribution `json:"impostor"`
+	ROC      Curve        `json:"roc"`
+	// GenuineDistances and ImpostorDistances hold the distances of all
+	// pairs, for further analysis such as calibration.
+	GenuineDistances  []similarity.Distance `json:"-"`
+	ImpostorDistances []similarity.Distance `json:"-"`
+}
+
+// Failure reports an image that could not be decoded, attacked or hashed.
+type Failure struct {
+	// Key is the key of the corpus source.
+	Key string
+	// Attack names the attack that failed or whose image failed to hash.
+	// It is empty for the original image.
+	Attack string
+	// Hasher names the hasher that failed. It is empty when the image
+	// could not be decoded or attacked.
+	Hasher string
+	Err    error
+}
+
+func (f *Failure) Error() string {
+	s := f.Key
+	if f.Attack != "" {
+		s += " (" + f.Attack + ")"
+	}
+	if f.Hasher != "" {
+		s += ": " + f.Hasher
+	}
+	return s + ": " + f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error { return f.Err }
+
+// Run evaluates the hashers on a corpus, as described in the package
+// documentation. Every source is decoded once, turned upright according to
+// its EXIF orientation, and attacked with every attack. Only the hashes are
+// kept in memory, so the corpus can be large.
+//
+// Impostor pairs combine image i with the attacked copies of the k images
+// following it in corpus order, wrapping around. Hashers are called
+// concurrently and must be safe for concurrent use, as all hashers of the
+// imghash package are. Run stops early when ctx is cancelled and returns
+// its error.
+func Run(ctx context.Context, corpus iter.Seq[imghash.Source], hashers []Hasher, opts ...Option) (*Report, error) {
+	cfg := config{attacks: Standard(), workers: runtime.GOMAXPROCS(0), impostors: 100, points: 100}
+	for _, o := range opts {
+		o.apply(&cfg)
+	}
+	if err := cfg.validate(hashers); err != nil {
+		return nil, err
+	}
+
+	// hashes[h][a][i] is the hash of image i by hasher h, with a = 0 for
+	// the original and a = k+1 for attack k.
+	var mu sync.Mutex
+	var hashes [][][]hashtype.Hash
+	var failures []*Failure
+	for range hashers {
+		hashes = append(hashes, make([][]hashtype.Hash, len(cfg.attacks)+1))
+	}
+	n := 0
+
+	type job struct {
+		index  int
+		source imghash.Source
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for range cfg.workers {
+		wg.Go(func() {
+			for j := range jobs {
+				hs, fs := evaluateSource(hashers, cfg.attacks, j.source)
+				mu.Lock()
+				failures = append(failures, fs...)
+				for h := range hs {
+					for a, hash := range hs[h] {
+						hashes[h][a][j.index] = hash
+					}
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	for src := range corpus {
+		mu.Lock()
+		for h := range hashes {
+			for a := range hashes[h] {
+				hashes[h][a] = append(hashes[h][a], nil)
+			}
+		}
+		mu.Unlock()
+		select {
+		case jobs <- job{n, src}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		n++
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Failures: failures}
+	for i := range n {
+		if anyOriginal(hashes, i) {
+			report.Images++
+		}
+	}
+	if report.Images < 2 {
+		return report, ErrTooFewImages
+	}
+	for h, hasher := range hashers {
+		for a, attack := range cfg.attacks {
+			res, err := compare(hasher, hashes[h][0], hashes[h][a+1], cfg.impostors)
+			if err != nil {
+				return nil, fmt.Errorf("eval: %s under %s: %w", hasher.Name, attack.Name, err)
+			}
+			res.Hasher, res.Attack = hasher.Name, attack.Name
+			res.ROC = res.ROC.sample(cfg.points)
+			report.Results = append(report.Results, res)
+		}
+	}
+	return report, nil
+}
+
+func (c config) validate(hashers []Hasher) error {
+	if len(hashers) == 0 {
+		return ErrNoHashers
+	}
+	names := make(map[string]bool)
+	for _, h := range hashers {
+		if h.HasherComparer == nil {
+			return ErrNoHashers
+		}
+		if names[h.Name] {
+			return fmt.Errorf("%w: hasher %q", ErrDuplicateName, h.Name)
+		}
+		names[h.Name] = true
+	}
+	if len(c.attacks) == 0 {
+		return ErrNoAttacks
+	}
+	clear(names)
+	for _, a := range c.attacks {
+		if a.err != nil {
+			return a.err
+		}
+		if a.Apply == nil {
+			return fmt.Errorf("%w: %s has no Apply function", ErrInvalidAttack, a.Name)
+		}
+		if names[a.Name] {
+			return fmt.Errorf("%w: attack %q", ErrDuplicateName, a.Name)
+		}
+		names[a.Name] = true
+	}
+	switch {
+	case c.workers < 1:
+		return ErrInvalidWorkers
+	case c.impostors < 0:
+		return ErrInvalidImpostors
+	case c.points < 0:
+		return ErrInvalidPoints
+	}
+	return nil
+}
+
+// anyOriginal reports whether any hasher hashed the original of image i.
+func anyOriginal(hashes [][][]hashtype.Hash, i int) bool {
+	for h := range hashes {
+		if hashes[h][0][i] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateSource decodes src, applies every attack and hashes the original
+// and the attacked images with every hasher. hs[h][a] is indexed like the
+// hashes in Run.
+func evaluateSource(hashers []Hasher, attacks []Attack, src imghash.Source) ([][]hashtype.Hash, []*Failure) {
+	hs := make([][]hashtype.Hash, len(hashers))
+	for h := range hs {
+		hs[h] = make([]hashtype.Hash, len(attacks)+1)
+	}
+	img, err := decode(src)
+	if err != nil {
+		return hs, []*Failure{{Key: src.Key, Err: err}}
+	}
+	var failures []*Failure
+	hashAll := func(a int, name string, img image.Image) {
+		prep := imghash.Prepare(img)
+		for h, hasher := range hashers {
+			hash, err := imghash.CalculatePrepared(hasher, prep)
+			if err != nil {
+				failures = append(failures, &Failure{Key: src.Key, Attack: name, Hasher: hasher.Name, Err: err})
+				continue
+			}
+			hs[h][a] = hash
+		}
+	}
+	hashAll(0, "", img)
+	for k, attack := range attacks {
+		attacked, err := attack.Apply(img)
+		if err != nil {
+			failures = append(failures, &Failure{Key: src.Key, Attack: attack.Name, Err: err})
+			continue
+		}
+		hashAll(k+1, attack.Name, attacked)
+	}
+	return hs, failures
+}
+
+// decode returns the image of src, preferring Image, then Open, then Path
+// like imghash.HashAll.
+func decode(src imghash.Source) (image.Image, error) {
+	switch {
+	case src.Image != nil:
+		return src.Image, nil
+	case src.Open != nil:
+		rc, err := src.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rc.Close() }()
+		return imghash.Decode(rc)
+	case src.Path != "":
+		return imghash.Open(src.Path)
+	}
+	return nil, imghash.ErrEmptySource
+}
+
+// compare computes the genuine and impostor distances between the original
+// and attacked hashes of one hasher under one attack.
+func compare(h Hasher, orig, attacked []hashtype.Hash, impostors int) (Result, error) {
+	var r Result
+	n := len(orig)
+	k := impostors
+	if k == 0 || k > n-1 {
+		k = n - 1
+	}
+	for i := range n {
+		if orig[i] == nil {
+			continue
+		}
+		if attacked[i] != nil {
+			d, err := h.Compare(orig[i], attacked[i])
+			if err != nil {
+				return Result{}, err
+			}
+			r.GenuineDistances = append(r.GenuineDistances, d)
+		}
+		for off := 1; off <= k; off++ {
+			j := (i + off) % n
+			if attacked[j] == nil {
+				continue
+			}
+			d, err := h.Compare(orig[i], attacked[j])
+			if err != nil {
+				return Result{}, err
+			}
+			r.ImpostorDistances = append(r.ImpostorDistances, d)
+		}
+	}
+	r.Genuine = Summarize(r.GenuineDistances)
+	r.Impostor = Summarize(r.ImpostorDistances)
+	r.ROC = ROC(r.GenuineDistances, r.ImpostorDistances)
+	return r, nil
+}
+
+// WriteCSV writes one row per hasher and attack with the pair counts, the
+// main statistics of the distance distributions, the AUC and the EER.
+func (r *Report) WriteCSV(w io.Writer) error {
+	return writeCSV(w, summaryHeader, r.Results, summaryRow)
+}
+
+// WriteROCCSV writes one row per point of every ROC curve.
+func (r *Report) WriteROCCSV(w io.Writer) error {
+	return writeCSV(w, rocHeader, r.Results, rocRows)
+}
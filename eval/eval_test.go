@@ -0,0 +1,185 @@
+package eval_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/eval"
+)
+
+var assets = []string{
+	"../assets/lena.jpg", "../assets/baboon.jpg", "../assets/cat.jpg",
+	"../assets/monarch.jpg", "../assets/peppers.jpg", "../assets/tulips.jpg",
+}
+
+func hashers(t *testing.T) []eval.Hasher {
+	t.Helper()
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	phash, err := imghash.NewPHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []eval.Hasher{{Name: "average", HasherComparer: avg}, {Name: "phash", HasherComparer: phash}}
+}
+
+func TestRun(t *testing.T) {
+	attacks := []eval.Attack{eval.JPEG(50), eval.Blur(1), eval.FlipHorizontal()}
+	report, err := eval.Run(context.Background(), imghash.Files(assets...), hashers(t),
+		eval.WithAttacks(attacks...), eval.WithWorkers(3), eval.WithImpostors(2), eval.WithROCPoints(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Images != len(assets) || len(report.Failures) != 0 {
+		t.Fatalf("got %d images and failures %v", report.Images, report.Failures)
+	}
+	if len(report.Results) != 6 {
+		t.Fatalf("got %d results, want 6", len(report.Results))
+	}
+	for i, r := range report.Results {
+		if r.Hasher != hashers(t)[i/3].Name || r.Attack != attacks[i%3].Name {
+			t.Errorf("result %d is %s/%s", i, r.Hasher, r.Attack)
+		}
+		if r.Genuine.Count != len(assets) || r.Impostor.Count != 2*len(assets) {
+			t.Errorf("%s/%s: %d genuine and %d impostor pairs", r.Hasher, r.Attack, r.Genuine.Count, r.Impostor.Count)
+		}
+		if len(r.GenuineDistances) != r.Genuine.Count || len(r.ImpostorDistances) != r.Impostor.Count {
+			t.Errorf("%s/%s: distances not kept", r.Hasher, r.Attack)
+		}
+		if len(r.ROC.Points) > 5 {
+			t.Errorf("%s/%s: %d ROC points", r.Hasher, r.Attack, len(r.ROC.Points))
+		}
+		// Mild compression and blur leave the hashes of these images far
+		// closer to their originals than to other images.
+		if r.Attack != "fliph" && r.ROC.AUC != 1 {
+			t.Errorf("%s/%s: AUC %v, want 1", r.Hasher, r.Attack, r.ROC.AUC)
+		}
+	}
+}
+
+func TestRun_allImpostors(t *testing.T) {
+	report, err := eval.Run(context.Background(), imghash.Files(assets[:4]...), hashers(t)[:1],
+		eval.WithAttacks(eval.Gamma(0.8)), eval.WithImpostors(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Results[0].Impostor.Count; got != 12 {
+		t.Errorf("got %d impostor pairs, want 12", got)
+	}
+}
+
+func TestRun_failures(t *testing.T) {
+	corpus := func(yield func(imghash.Source) bool) {
+		_ = yield(imghash.FileSource("../assets/lena.jpg")) &&
+			yield(imghash.FileSource("missing.jpg")) &&
+			yield(imghash.Source{Key: "reader", Open: func() (io.ReadCloser, error) { return os.Open("../assets/cat.jpg") }}) &&
+			yield(imghash.Source{Key: "empty"})
+	}
+	fail := eval.Attack{Name: "fail", Apply: func(image.Image) (image.Image, error) { return nil, errors.New("boom") }}
+	report, err := eval.Run(context.Background(), corpus, hashers(t)[:1], eval.WithAttacks(eval.JPEG(80), fail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Images != 2 {
+		t.Errorf("got %d images, want 2", report.Images)
+	}
+	// Two sources cannot be decoded and the failing attack fails for the
+	// two others.
+	if len(report.Failures) != 4 {
+		t.Errorf("got failures %v", report.Failures)
+	}
+	for _, f := range report.Failures {
+		if f.Key == "empty" && !errors.Is(f, imghash.ErrEmptySource) {
+			t.Errorf("got %v, want ErrEmptySource", f)
+		}
+	}
+	if r := report.Results[1]; r.Genuine.Count != 0 || len(r.ROC.Points) != 0 {
+		t.Errorf("failing attack produced %+v", r)
+	}
+}
+
+func TestRun_errors(t *testing.T) {
+	hs := hashers(t)
+	tests := []struct {
+		name    string
+		corpus  []string
+		hashers []eval.Hasher
+		opts    []eval.Option
+		wantErr error
+	}{
+		{"no hashers", assets, nil, nil, eval.ErrNoHashers},
+		{"nil hasher", assets, []eval.Hasher{{Name: "nil"}}, nil, eval.ErrNoHashers},
+		{"duplicate hasher", assets, []eval.Hasher{hs[0], hs[0]}, nil, eval.ErrDuplicateName},
+		{"no attacks", assets, hs, []eval.Option{eval.WithAttacks()}, eval.ErrNoAttacks},
+		{"duplicate attack", assets, hs, []eval.Option{eval.WithAttacks(eval.JPEG(50), eval.JPEG(50))}, eval.ErrDuplicateName},
+		{"invalid attack", assets, hs, []eval.Option{eval.WithAttacks(eval.Scale(-1))}, eval.ErrInvalidAttack},
+		{"workers", assets, hs, []eval.Option{eval.WithWorkers(0)}, eval.ErrInvalidWorkers},
+		{"impostors", assets, hs, []eval.Option{eval.WithImpostors(-1)}, eval.ErrInvalidImpostors},
+		{"points", assets, hs, []eval.Option{eval.WithROCPoints(-1)}, eval.ErrInvalidPoints},
+		{"one image", assets[:1], hs, []eval.Option{eval.WithAttacks(eval.JPEG(50))}, eval.ErrTooFewImages},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := eval.Run(context.Background(), imghash.Files(tt.corpus...), tt.hashers, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRun_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := eval.Run(ctx, imghash.Files(assets...), hashers(t)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestReport_WriteCSV(t *testing.T) {
+	report, err := eval.Run(context.Background(), imghash.Files(assets[:3]...), hashers(t),
+		eval.WithAttacks(eval.JPEG(50), eval.Scale(0.5)), eval.WithROCPoints(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 || !strings.HasPrefix(strings.Join(rows[0], ","), "hasher,attack,genuine_count,") {
+		t.Fatalf("got rows %v", rows)
+	}
+	if rows[1][0] != "average" || rows[1][1] != "jpeg:50" || rows[1][2] != "3" {
+		t.Errorf("got row %v", rows[1])
+	}
+
+	buf.Reset()
+	if err := report.WriteROCCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := 0
+	for _, r := range report.Results {
+		points += len(r.ROC.Points)
+	}
+	if len(rows) != points+1 || strings.Join(rows[0], ",") != "hasher,attack,threshold,tp,fp,fn,tn,tpr,fpr,precision,recall" {
+		t.Errorf("got rows %v", rows)
+	}
+}
@@ -0,0 +1,42 @@
+package eval_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/eval"
+)
+
+func ExampleRun() {
+	phash, err := imghash.NewPHash()
+	if err != nil {
+		panic(err)
+	}
+	corpus := imghash.Files("../assets/lena.jpg", "../assets/baboon.jpg", "../assets/peppers.jpg", "../assets/tulips.jpg")
+	report, err := eval.Run(context.Background(), corpus, []eval.Hasher{{Name: "phash", HasherComparer: phash}},
+		eval.WithAttacks(eval.JPEG(50), eval.Blur(1)))
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range report.Results {
+		fmt.Printf("%s %s: AUC %.2f, EER %.2f\n", r.Hasher, r.Attack, r.ROC.AUC, r.ROC.EER)
+	}
+	// Output:
+	// phash jpeg:50: AUC 1.00, EER 0.00
+	// phash blur:1: AUC 1.00, EER 0.00
+}
+
+func ExampleParseAttacks() {
+	attacks, err := eval.ParseAttacks("jpeg:50,rotate:5,fliph")
+	if err != nil {
+		panic(err)
+	}
+	for _, a := range attacks {
+		fmt.Println(a.Name)
+	}
+	// Output:
+	// jpeg:50
+	// rotate:5
+	// fliph
+}
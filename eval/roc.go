@@ -0,0 +1,172 @@
+package eval
+
+import (
+	"math"
+	"slices"
+
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// Distribution summarises a set of distances.
+type Distribution struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	// P05, Median and P95 are the 5th, 50th and 95th percentiles, taken
+	// by nearest rank.
+	P05    float64 `json:"p05"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+}
+
+// Summarize returns the distribution of d. It is the zero Distribution
+// when d is empty.
+func Summarize(d []similarity.Distance) Distribution {
+	if len(d) == 0 {
+		return Distribution{}
+	}
+	s := sortedFloats(d)
+	var sum float64
+	for _, v := range s {
+		sum += v
+	}
+	mean := sum / float64(len(s))
+	var ss float64
+	for _, v := range s {
+		ss += (v - mean) * (v - mean)
+	}
+	return Distribution{
+		Count:  len(s),
+		Min:    s[0],
+		Max:    s[len(s)-1],
+		Mean:   mean,
+		StdDev: math.Sqrt(ss / float64(len(s))),
+		P05:    percentile(s, 5),
+		Median: percentile(s, 50),
+		P95:    percentile(s, 95),
+	}
+}
+
+// percentile returns the p-th percentile of sorted values by nearest rank.
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func sortedFloats(d []similarity.Distance) []float64 {
+	s := make([]float64, len(d))
+	for i, v := range d {
+		s[i] = float64(v)
+	}
+	slices.Sort(s)
+	return s
+}
+
+// Point is the performance of declaring a pair of images a match when
+// their distance is at most Threshold.
+type Point struct {
+	Threshold float64 `json:"threshold"`
+	// TP and FN count the genuine pairs, an image and its attacked copy,
+	// that are and are not matched. FP and TN count the impostor pairs,
+	// two different images, that are and are not matched.
+	TP int `json:"tp"`
+	FP int `json:"fp"`
+	FN int `json:"fn"`
+	TN int `json:"tn"`
+	// TPR, the true positive rate, equals the recall.
+	TPR float64 `json:"tpr"`
+	// FPR is the false positive rate.
+	FPR float64 `json:"fpr"`
+	// Precision is the fraction of matched pairs that are genuine. Unlike
+	// the rates it depends on the ratio of genuine to impostor pairs.
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+}
+
+// Curve is the receiver operating characteristic of a distance threshold
+// that separates genuine from impostor pairs.
+type Curve struct {
+	// Points holds one point per distinct distance, by increasing
+	// threshold. The last point matches every pair.
+	Points []Point `json:"points"`
+	// AUC is the area under the curve: the probability that a genuine
+	// pair is closer than an impostor pair, counting ties as one half.
+	AUC float64 `json:"auc"`
+	// EER is the equal error rate, where the false positive rate equals
+	// the false negative rate, interpolated between points.
+	EER float64 `json:"eer"`
+	// EERThreshold is the smallest threshold at which the false positive
+	// rate reaches the false negative rate.
+	EERThreshold float64 `json:"eer_threshold"`
+}
+
+// ROC computes the curve of genuine and impostor distances. Smaller
+// distances mean more similar images. The curve is empty when either
+// set is empty.
+func ROC(genuine, impostor []similarity.Distance) Curve {
+	if len(genuine) == 0 || len(impostor) == 0 {
+		return Curve{}
+	}
+	g, m := sortedFloats(genuine), sortedFloats(impostor)
+	var c Curve
+	var i, j int
+	prevTPR, prevFPR := 0.0, 0.0
+	eerFound := false
+	for i < len(g) || j < len(m) {
+		t := math.Inf(1)
+		if i < len(g) {
+			t = g[i]
+		}
+		if j < len(m) {
+			t = min(t, m[j])
+		}
+		for i < len(g) && g[i] <= t {
+			i++
+		}
+		for j < len(m) && m[j] <= t {
+			j++
+		}
+		p := Point{
+			Threshold: t,
+			TP:        i,
+			FP:        j,
+			FN:        len(g) - i,
+			TN:        len(m) - j,
+			TPR:       float64(i) / float64(len(g)),
+			FPR:       float64(j) / float64(len(m)),
+			Precision: float64(i) / float64(i+j),
+		}
+		p.Recall = p.TPR
+		c.Points = append(c.Points, p)
+		c.AUC += (p.FPR - prevFPR) * (p.TPR + prevTPR) / 2
+		if !eerFound && p.FPR >= 1-p.TPR {
+			// FPR - FNR changes sign between the previous point and this one.
+			d0, d1 := prevFPR-(1-prevTPR), p.FPR-(1-p.TPR)
+			s := 1.0
+			if d1 != d0 {
+				s = d0 / (d0 - d1)
+			}
+			c.EER = prevFPR + s*(p.FPR-prevFPR)
+			c.EERThreshold = t
+			eerFound = true
+		}
+		prevTPR, prevFPR = p.TPR, p.FPR
+	}
+	return c
+}
+
+// sample returns at most n points of c, evenly spaced and including the
+// last, or c itself when n is zero.
+func (c Curve) sample(n int) Curve {
+	if n == 0 || len(c.Points) <= n {
+		return c
+	}
+	pts := make([]Point, n)
+	for k := range pts {
+		pts[k] = c.Points[(k+1)*len(c.Points)/n-1]
+	}
+	c.Points = pts
+	return c
+}
@@ -0,0 +1,69 @@
+package eval_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2/eval"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+func TestSummarize(t *testing.T) {
+	d := []similarity.Distance{4, 1, 3, 2, 5, 6, 7, 8, 9, 10}
+	got := eval.Summarize(d)
+	want := eval.Distribution{Count: 10, Min: 1, Max: 10, Mean: 5.5, StdDev: math.Sqrt(8.25), P05: 1, Median: 5, P95: 10}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := eval.Summarize(nil); got != (eval.Distribution{}) {
+		t.Errorf("empty: got %+v", got)
+	}
+}
+
+func TestROC(t *testing.T) {
+	tests := []struct {
+		name              string
+		genuine, impostor []similarity.Distance
+		auc, eer, eerAt   float64
+		points            int
+	}{
+		{"separated", []similarity.Distance{0, 1, 2}, []similarity.Distance{5, 6, 7}, 1, 0, 2, 6},
+		{"identical", []similarity.Distance{3, 3}, []similarity.Distance{3, 3}, 0.5, 0.5, 3, 1},
+		{"reversed", []similarity.Distance{5, 6}, []similarity.Distance{1, 2}, 0, 1, 2, 4},
+		{"overlapping", []similarity.Distance{1, 2, 3, 4}, []similarity.Distance{3, 4, 5, 6}, 0.875, 0.25, 3, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := eval.ROC(tt.genuine, tt.impostor)
+			if math.Abs(c.AUC-tt.auc) > 1e-12 || math.Abs(c.EER-tt.eer) > 1e-12 || c.EERThreshold != tt.eerAt {
+				t.Errorf("AUC %v, EER %v at %v; want %v, %v at %v", c.AUC, c.EER, c.EERThreshold, tt.auc, tt.eer, tt.eerAt)
+			}
+			if len(c.Points) != tt.points {
+				t.Fatalf("got %d points, want %d", len(c.Points), tt.points)
+			}
+			last := c.Points[len(c.Points)-1]
+			if last.TPR != 1 || last.FPR != 1 || last.FN != 0 || last.TN != 0 {
+				t.Errorf("last point %+v does not match every pair", last)
+			}
+			for _, p := range c.Points {
+				if p.TP+p.FN != len(tt.genuine) || p.FP+p.TN != len(tt.impostor) || p.Recall != p.TPR {
+					t.Errorf("inconsistent point %+v", p)
+				}
+			}
+		})
+	}
+}
+
+func TestROC_precision(t *testing.T) {
+	c := eval.ROC([]similarity.Distance{1, 2}, []similarity.Distance{2, 3, 4})
+	p := c.Points[1]
+	if p.Threshold != 2 || p.TP != 2 || p.FP != 1 || math.Abs(p.Precision-2.0/3) > 1e-12 {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestROC_empty(t *testing.T) {
+	if c := eval.ROC(nil, []similarity.Distance{1}); len(c.Points) != 0 || c.AUC != 0 {
+		t.Errorf("got %+v, want empty curve", c)
+	}
+}
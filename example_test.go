@@ -2,9 +2,13 @@ package imghash_test
 
 import (
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
 	"os"
 
 	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/similarity"
 )
 
 func ExampleOpenImage() {
@@ -99,3 +103,131 @@ func ExampleInterpolation_String() {
 	// Bicubic
 	// Lanczos3
 }
+
+func ExampleWithAlphaPolicy() {
+	pdq, err := imghash.NewPDQ(imghash.WithAlphaPolicy(imghash.AlphaPolicy{
+		Mode:       imghash.AlphaComposite,
+		Background: color.White,
+	}))
+	if err != nil {
+		panic(err)
+	}
+	logo, err := imghash.OpenImage("assets/logo.png")
+	if err != nil {
+		panic(err)
+	}
+	onWhite := image.NewRGBA(logo.Bounds())
+	draw.Draw(onWhite, onWhite.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(onWhite, onWhite.Bounds(), logo, logo.Bounds().Min, draw.Over)
+
+	h1, err := pdq.Calculate(logo)
+	if err != nil {
+		panic(err)
+	}
+	h2, err := pdq.Calculate(onWhite)
+	if err != nil {
+		panic(err)
+	}
+	dist, err := pdq.Compare(h1, h2)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(dist)
+	// Output: 0
+}
+
+func ExampleNewCropResistant() {
+	phash, err := imghash.NewPHash()
+	if err != nil {
+		panic(err)
+	}
+	cr, err := imghash.NewCropResistant(phash, 16)
+	if err != nil {
+		panic(err)
+	}
+	img, err := imghash.OpenImage("assets/peppers.jpg")
+	if err != nil {
+		panic(err)
+	}
+	b := img.Bounds()
+	b.Max.X -= b.Dx() / 5
+	cropped := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(b)
+
+	h1, err := cr.Calculate(img)
+	if err != nil {
+		panic(err)
+	}
+	h2, err := cr.Calculate(cropped)
+	if err != nil {
+		panic(err)
+	}
+	matches, err := cr.Matches(h2, h1)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%d of %d segments match\n", matches, len(h2.(imghash.Composite)))
+	// Output: 5 of 7 segments match
+}
+
+func ExampleFitCalibration() {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		panic(err)
+	}
+	// Distances of labelled pairs, e.g. from the eval package.
+	genuine := []similarity.Distance{0, 4, 10, 18, 26, 40}
+	impostor := []similarity.Distance{34, 70, 96, 110, 118, 125}
+	c, err := imghash.FitCalibration(pdq, genuine, impostor, imghash.WithCalibrationMethod(imghash.Isotonic))
+	if err != nil {
+		panic(err)
+	}
+	th, _ := c.Calibration().Threshold(0.99)
+	fmt.Printf("P(match) at 30: %.2f\n", c.Calibration().Probability(30))
+	fmt.Printf("threshold for 99%% precision: %v\n", th)
+	// Output:
+	// P(match) at 30: 0.75
+	// threshold for 99% precision: 26.16
+}
+
+func ExampleNewEnsemble() {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		panic(err)
+	}
+	rash, err := imghash.NewRASH()
+	if err != nil {
+		panic(err)
+	}
+	// Match when either algorithm is within its threshold.
+	e, err := imghash.NewEnsemble([]imghash.Member{
+		{Name: "pdq", Hasher: pdq, Threshold: 31},
+		{Name: "rash", Hasher: rash, Threshold: 6},
+	}, imghash.WithFusion(imghash.FuseAnyMatch))
+	if err != nil {
+		panic(err)
+	}
+	img, err := imghash.OpenImage("assets/peppers.jpg")
+	if err != nil {
+		panic(err)
+	}
+	other, err := imghash.OpenImage("assets/baboon.jpg")
+	if err != nil {
+		panic(err)
+	}
+	h1, err := e.Calculate(img)
+	if err != nil {
+		panic(err)
+	}
+	h2, err := e.Calculate(other)
+	if err != nil {
+		panic(err)
+	}
+	d, err := e.Compare(h1, h2)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%d parts, match: %v\n", len(h1.(imghash.Composite)), d <= 1)
+	// Output: 2 parts, match: false
+}
@@ -0,0 +1,308 @@
+package imghash
+
+import (
+	"errors"
+	"image"
+	"math"
+	"math/bits"
+)
+
+// Feature matching errors.
+var (
+	// ErrInvalidMatchRatio is returned by MatchFeatures when the ratio test
+	// threshold is not in (0, 1].
+	ErrInvalidMatchRatio = errors.New("imghash: match ratio must be in (0, 1]")
+	// ErrInvalidReprojection is returned by MatchFeatures when the RANSAC
+	// reprojection threshold is not positive.
+	ErrInvalidReprojection = errors.New("imghash: reprojection threshold must be greater than zero")
+	// ErrInvalidIterations is returned by MatchFeatures when the RANSAC
+	// iteration count is zero.
+	ErrInvalidIterations = errors.New("imghash: iterations must be greater than zero")
+)
+
+// Keypoints are detected on an image pyramid. The largest level has a
+// longer side of at most featureBaseSize pixels, and each further level is
+// smaller by a factor of sqrt(2) until its shorter side would drop below
+// featureMinSize pixels.
+const (
+	featureBaseSize = 512
+	featureMinSize  = 48
+)
+
+// Keypoint is a local feature of an image: a corner or blob that can be
+// found again in other images showing the same content.
+type Keypoint struct {
+	// X and Y locate the keypoint in the coordinates of the image bounds.
+	X, Y float64
+	// Scale is the size of one pixel of the pyramid level the keypoint was
+	// detected on, in image pixels.
+	Scale float64
+	// Angle is the dominant orientation of the keypoint, in radians.
+	Angle float64
+	// Response is the detector response; stronger keypoints are more
+	// repeatable.
+	Response float64
+	// Descriptor is the 256-bit binary descriptor of the keypoint, which
+	// is invariant to its orientation. Descriptors are compared by
+	// Hamming distance.
+	Descriptor []byte
+}
+
+// Features holds the keypoints of an image and their descriptors, as
+// returned by BoVW.Features.
+type Features struct {
+	// Bounds are the bounds of the image the features were detected in.
+	Bounds image.Rectangle
+	// Keypoints are ordered by pyramid level, largest level first, and by
+	// decreasing response within a level.
+	Keypoints []Keypoint
+}
+
+// Features detects the keypoints of img with the configured feature
+// extractor and computes their descriptors. Unlike Calculate it keeps the
+// position of every keypoint, so two feature sets can be matched
+// geometrically with MatchFeatures.
+//
+// Keypoints are detected at several scales and keep the aspect ratio of
+// img, so the size set with WithSize does not apply. Alpha flattening
+// applies; border cropping does not, so keypoints always refer to the
+// full image. At most the configured maximum number of keypoints is
+// returned, shared among pyramid levels by area.
+func (b BoVW) Features(img image.Image) (Features, error) {
+	return b.FeaturesPrepared(Prepare(img))
+}
+
+// FeaturesPrepared is like Features but reuses the preprocessing cached in
+// a Prepared image.
+func (b BoVW) FeaturesPrepared(prep *Prepared) (Features, error) {
+	prep = prep.flatten(b.alphaPolicy)
+	img := prep.Image()
+	if img == nil || img.Bounds().Empty() {
+		return Features{}, ErrEmptyImage
+	}
+	bnds := img.Bounds()
+	base := min(1, featureBaseSize/float64(max(bnds.Dx(), bnds.Dy())))
+	type level struct{ w, h uint }
+	var levels []level
+	var area float64
+	for scale := base; ; scale /= math.Sqrt2 {
+		w := uint(math.Round(float64(bnds.Dx()) * scale))
+		h := uint(math.Round(float64(bnds.Dy()) * scale))
+		if len(levels) > 0 && min(w, h) < featureMinSize {
+			break
+		}
+		levels = append(levels, level{max(w, 1), max(h, 1)})
+		area += float64(w * h)
+		if min(w, h) < featureMinSize {
+			break
+		}
+	}
+
+	f := Features{Bounds: bnds}
+	remaining := int(b.maxKeypoints)
+	for i, l := range levels {
+		n := int(math.Round(float64(b.maxKeypoints) * float64(l.w*l.h) / area))
+		if i == len(levels)-1 {
+			n = remaining
+		}
+		n = min(n, remaining)
+		if n <= 0 {
+			continue
+		}
+		g, err := prep.ResizedGray(l.w, l.h, b.interp)
+		if err != nil {
+			return Features{}, err
+		}
+		kps, descs, err := b.extract(g, n)
+		if err != nil {
+			return Features{}, err
+		}
+		remaining -= len(kps)
+		sx := float64(bnds.Dx()) / float64(l.w)
+		sy := float64(bnds.Dy()) / float64(l.h)
+		for j, kp := range kps {
+			f.Keypoints = append(f.Keypoints, Keypoint{
+				X:          float64(bnds.Min.X) + (float64(kp.x)+0.5)*sx - 0.5,
+				Y:          float64(bnds.Min.Y) + (float64(kp.y)+0.5)*sy - 0.5,
+				Scale:      (sx + sy) / 2,
+				Angle:      kp.angle,
+				Response:   kp.response,
+				Descriptor: descs[j],
+			})
+		}
+	}
+	return f, nil
+}
+
+// FeaturePair is a keypoint of one image matched to a keypoint of another.
+type FeaturePair struct {
+	// Query and Train index the keypoints of the first and second feature
+	// sets passed to MatchFeatures.
+	Query, Train int
+	// Distance is the Hamming distance between the descriptors.
+	Distance int
+	// Inlier reports whether the pair agrees with the estimated transform.
+	Inlier bool
+}
+
+// FeatureMatch is the result of MatchFeatures.
+type FeatureMatch struct {
+	// Pairs holds the descriptor matches that passed the ratio test.
+	Pairs []FeaturePair
+	// Inliers is the number of pairs that agree with Transform.
+	Inliers int
+	// Transform maps points of the first image to the second. It is only
+	// meaningful when Inliers is at least 4.
+	Transform Homography
+}
+
+// Contained reports whether the first image appears within the second:
+// whether at least minInliers pairs support the transform and the first
+// image's corners map to a convex quadrilateral inside the second image.
+func (m FeatureMatch) Contained(a, b Features, minInliers int) bool {
+	if m.Inliers < max(minInliers, 4) {
+		return false
+	}
+	r := a.Bounds
+	corners := [4][2]float64{
+		{float64(r.Min.X), float64(r.Min.Y)},
+		{float64(r.Max.X), float64(r.Min.Y)},
+		{float64(r.Max.X), float64(r.Max.Y)},
+		{float64(r.Min.X), float64(r.Max.Y)},
+	}
+	// Allow corners a little outside the second image, as keypoints
+	// rarely lie at the very edge of the first.
+	outer := b.Bounds
+	slack := float64(max(outer.Dx(), outer.Dy())) / 20
+	var sign float64
+	for i, c := range corners {
+		x, y, ok := m.Transform.Apply(c[0], c[1])
+		if !ok || x < float64(outer.Min.X)-slack || x > float64(outer.Max.X)+slack ||
+			y < float64(outer.Min.Y)-slack || y > float64(outer.Max.Y)+slack {
+			return false
+		}
+		corners[i] = [2]float64{x, y}
+	}
+	for i := range corners {
+		p, q, r := corners[i], corners[(i+1)%4], corners[(i+2)%4]
+		cross := (q[0]-p[0])*(r[1]-q[1]) - (q[1]-p[1])*(r[0]-q[0])
+		if cross == 0 || (sign != 0 && (cross > 0) != (sign > 0)) {
+			return false
+		}
+		sign = cross
+	}
+	return true
+}
+
+// MatchOption configures MatchFeatures.
+type MatchOption interface{ applyMatch(*matchConfig) }
+
+type matchConfig struct {
+	ratio      float64
+	threshold  float64
+	iterations uint
+}
+
+type matchRatioOption float64
+
+func (o matchRatioOption) applyMatch(c *matchConfig) { c.ratio = float64(o) }
+
+// WithMatchRatio sets the ratio test threshold. A keypoint is matched to
+// its nearest neighbour only when that is closer than ratio times the
+// distance to the second nearest. The default is 0.8.
+func WithMatchRatio(ratio float64) MatchOption { return matchRatioOption(ratio) }
+
+type reprojectionOption float64
+
+func (o reprojectionOption) applyMatch(c *matchConfig) { c.threshold = float64(o) }
+
+// WithReprojectionThreshold sets how far, as a fraction of the longer side
+// of the second image, a transformed keypoint may land from its match and
+// still count as an inlier. The default is 0.01.
+func WithReprojectionThreshold(fraction float64) MatchOption { return reprojectionOption(fraction) }
+
+type iterationsOption uint
+
+func (o iterationsOption) applyMatch(c *matchConfig) { c.iterations = uint(o) }
+
+// WithRANSACIterations sets the maximum number of RANSAC iterations. The
+// search stops earlier once the best transform is found with 99.5%
+// confidence. The default is 2000.
+func WithRANSACIterations(n uint) MatchOption { return iterationsOption(n) }
+
+// MatchFeatures matches the keypoints of a to those of b and estimates the
+// homography that maps a onto b. Descriptors are matched by Hamming
+// distance with Lowe's ratio test, and the homography is estimated with
+// RANSAC, so matches on repeated textures and unrelated content are
+// rejected as outliers.
+//
+// A large number of inliers means that b shows the content of a, possibly
+// scaled, rotated, cropped or embedded in a larger picture such as a
+// collage or a screenshot. Unrelated images rarely produce more than a
+// handful of inliers; use FeatureMatch.Contained to also check where a
+// lands in b. The result is deterministic.
+func MatchFeatures(a, b Features, opts ...MatchOption) (FeatureMatch, error) {
+	cfg := matchConfig{ratio: 0.8, threshold: 0.01, iterations: 2000}
+	for _, o := range opts {
+		o.applyMatch(&cfg)
+	}
+	switch {
+	case !(cfg.ratio > 0 && cfg.ratio <= 1):
+		return FeatureMatch{}, ErrInvalidMatchRatio
+	case !(cfg.threshold > 0):
+		return FeatureMatch{}, ErrInvalidReprojection
+	case cfg.iterations == 0:
+		return FeatureMatch{}, ErrInvalidIterations
+	}
+
+	var m FeatureMatch
+	for i, qa := range a.Keypoints {
+		best, second := -1, math.MaxInt
+		bestDist := math.MaxInt
+		for j, kb := range b.Keypoints {
+			d := hammingBytes(qa.Descriptor, kb.Descriptor)
+			switch {
+			case d < bestDist:
+				second, bestDist, best = bestDist, d, j
+			case d < second:
+				second = d
+			}
+		}
+		if best >= 0 && float64(bestDist) < cfg.ratio*float64(second) {
+			m.Pairs = append(m.Pairs, FeaturePair{Query: i, Train: best, Distance: bestDist})
+		}
+	}
+	if len(m.Pairs) < 4 {
+		return m, nil
+	}
+
+	src := make([][2]float64, len(m.Pairs))
+	dst := make([][2]float64, len(m.Pairs))
+	for i, p := range m.Pairs {
+		src[i] = [2]float64{a.Keypoints[p.Query].X, a.Keypoints[p.Query].Y}
+		dst[i] = [2]float64{b.Keypoints[p.Train].X, b.Keypoints[p.Train].Y}
+	}
+	threshold := cfg.threshold * float64(max(b.Bounds.Dx(), b.Bounds.Dy()))
+	h, inliers := ransacHomography(src, dst, threshold, int(cfg.iterations))
+	if inliers == nil {
+		return m, nil
+	}
+	m.Transform = h
+	for i, in := range inliers {
+		if in {
+			m.Pairs[i].Inlier = true
+			m.Inliers++
+		}
+	}
+	return m, nil
+}
+
+// hammingBytes returns the number of differing bits between a and b,
+// counting the bytes missing from the shorter as all different.
+func hammingBytes(a, b []byte) int {
+	n := 8 * (max(len(a), len(b)) - min(len(a), len(b)))
+	for i := range min(len(a), len(b)) {
+		n += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return n
+}
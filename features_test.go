@@ -0,0 +1,194 @@
+package imghash_test
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	xdraw "golang.org/x/image/draw"
+)
+
+// collage scales img into place on a canvas showing background.
+func collage(img, background image.Image, canvas, place image.Rectangle) *image.RGBA {
+	dst := image.NewRGBA(canvas)
+	xdraw.BiLinear.Scale(dst, canvas, background, background.Bounds(), draw.Src, nil)
+	xdraw.BiLinear.Scale(dst, place, img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+func TestBoVW_Features(t *testing.T) {
+	b, err := imghash.NewBoVW(imghash.WithMaxKeypoints(300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := imghash.OpenImage("assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := b.Features(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Bounds != img.Bounds() {
+		t.Errorf("got bounds %v, want %v", f.Bounds, img.Bounds())
+	}
+	if n := len(f.Keypoints); n < 100 || n > 300 {
+		t.Errorf("got %d keypoints, want 100 to 300", n)
+	}
+	scales := map[float64]bool{}
+	for _, kp := range f.Keypoints {
+		if kp.X < 0 || kp.Y < 0 || kp.X >= float64(img.Bounds().Dx()) || kp.Y >= float64(img.Bounds().Dy()) {
+			t.Fatalf("keypoint (%v, %v) outside the image", kp.X, kp.Y)
+		}
+		if len(kp.Descriptor) != 32 {
+			t.Fatalf("got %d descriptor bytes, want 32", len(kp.Descriptor))
+		}
+		scales[kp.Scale] = true
+	}
+	if len(scales) < 2 {
+		t.Errorf("keypoints found on %d pyramid levels, want several", len(scales))
+	}
+
+	if _, err := b.Features(image.NewGray(image.Rect(0, 0, 0, 0))); !errors.Is(err, imghash.ErrEmptyImage) {
+		t.Errorf("empty image: got %v, want %v", err, imghash.ErrEmptyImage)
+	}
+}
+
+func TestMatchFeatures_embedded(t *testing.T) {
+	lena, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tulips, err := imghash.OpenImage("assets/tulips.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	baboon, err := imghash.OpenImage("assets/baboon.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	place := image.Rect(400, 150, 700, 450)
+	canvas := collage(lena, tulips, image.Rect(0, 0, 900, 700), place)
+
+	for _, ft := range []imghash.BoVWFeatureType{imghash.BoVWORB, imghash.BoVWAKAZE} {
+		t.Run(ft.String(), func(t *testing.T) {
+			b, err := imghash.NewBoVW(imghash.WithBoVWFeature(ft))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fl, err := b.Features(lena)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fc, err := b.Features(canvas)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fb, err := b.Features(baboon)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := imghash.MatchFeatures(fl, fc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Inliers < 20 {
+				t.Errorf("got %d inliers, want at least 20", m.Inliers)
+			}
+			if !m.Contained(fl, fc, 10) {
+				t.Error("embedded image not reported as contained")
+			}
+			// The corners of lena land on the corners of where it was placed.
+			lb := lena.Bounds()
+			for _, c := range []struct{ from, to image.Point }{
+				{lb.Min, place.Min},
+				{lb.Max, place.Max},
+			} {
+				x, y, ok := m.Transform.Apply(float64(c.from.X), float64(c.from.Y))
+				if !ok || math.Hypot(x-float64(c.to.X), y-float64(c.to.Y)) > 20 {
+					t.Errorf("corner %v mapped to (%.1f, %.1f), want near %v", c.from, x, y, c.to)
+				}
+			}
+
+			m, err = imghash.MatchFeatures(fb, fc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Inliers >= 10 || m.Contained(fb, fc, 10) {
+				t.Errorf("unrelated image: got %d inliers, contained %v", m.Inliers, m.Contained(fb, fc, 10))
+			}
+		})
+	}
+}
+
+// TestMatchFeatures_homography matches synthetic features related by a
+// known homography, with a third of the matches being outliers.
+func TestMatchFeatures_homography(t *testing.T) {
+	want := imghash.Homography{0.9, -0.2, 40, 0.15, 1.1, -25, 1e-4, -5e-5, 1}
+	rng := rand.New(rand.NewPCG(1, 2))
+	descriptor := func() []byte {
+		d := make([]byte, 32)
+		for i := range d {
+			d[i] = byte(rng.UintN(256))
+		}
+		return d
+	}
+	a := imghash.Features{Bounds: image.Rect(0, 0, 400, 300)}
+	b := imghash.Features{Bounds: image.Rect(0, 0, 500, 400)}
+	for i := range 60 {
+		x, y := rng.Float64()*400, rng.Float64()*300
+		d := descriptor()
+		a.Keypoints = append(a.Keypoints, imghash.Keypoint{X: x, Y: y, Descriptor: d})
+		u, v, _ := want.Apply(x, y)
+		if i%3 == 0 {
+			u, v = rng.Float64()*500, rng.Float64()*400
+		}
+		b.Keypoints = append(b.Keypoints, imghash.Keypoint{X: u, Y: v, Descriptor: d})
+	}
+	m, err := imghash.MatchFeatures(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Pairs) != 60 {
+		t.Fatalf("got %d pairs, want 60", len(m.Pairs))
+	}
+	if m.Inliers != 40 {
+		t.Errorf("got %d inliers, want 40", m.Inliers)
+	}
+	for i, p := range m.Pairs {
+		if p.Inlier == (p.Query%3 == 0) {
+			t.Errorf("pair %d: inlier %v", i, p.Inlier)
+		}
+	}
+	for _, pt := range [][2]float64{{0, 0}, {400, 0}, {400, 300}, {0, 300}} {
+		x, y, _ := m.Transform.Apply(pt[0], pt[1])
+		u, v, _ := want.Apply(pt[0], pt[1])
+		if math.Hypot(x-u, y-v) > 1e-6 {
+			t.Errorf("%v mapped to (%v, %v), want (%v, %v)", pt, x, y, u, v)
+		}
+	}
+}
+
+func TestMatchFeatures_options(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  imghash.MatchOption
+		want error
+	}{
+		{"zero ratio", imghash.WithMatchRatio(0), imghash.ErrInvalidMatchRatio},
+		{"ratio above one", imghash.WithMatchRatio(1.5), imghash.ErrInvalidMatchRatio},
+		{"zero threshold", imghash.WithReprojectionThreshold(0), imghash.ErrInvalidReprojection},
+		{"zero iterations", imghash.WithRANSACIterations(0), imghash.ErrInvalidIterations},
+		{"valid", imghash.WithMatchRatio(0.7), nil},
+	}
+	for _, tt := range tests {
+		if _, err := imghash.MatchFeatures(imghash.Features{}, imghash.Features{}, tt.opt); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package imghash
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+// Frame is one frame of a possibly animated image.
+type Frame struct {
+	// Image is the frame as displayed: for animations it is composited
+	// over the previous frames according to their disposal methods and
+	// covers the whole logical screen.
+	Image image.Image
+	// Delay is how long the frame is displayed. It is zero for still images.
+	Delay time.Duration
+}
+
+// FrameHashes holds the hashes of every frame of an image.
+type FrameHashes struct {
+	// Frames holds one hash per frame, in display order.
+	Frames []hashtype.Hash
+	// Aggregate summarises all frames weighted by display time: a bitwise
+	// majority vote for Binary hashes, the mean for UInt8 and Float64
+	// hashes, and the aggregate of each part for Composite hashes. For a
+	// still image it equals the hash of its only frame.
+	Aggregate hashtype.Hash
+}
+
+// Browsers display animation frames with a delay below minFrameDelay for
+// defaultFrameDelay, and the aggregate hash weights frames the same way.
+const (
+	minFrameDelay     = 20 * time.Millisecond
+	defaultFrameDelay = 100 * time.Millisecond
+)
+
+// OpenFrames reads and decodes all frames of an image file.
+// Animated GIFs yield one composited frame per animation frame, as do
+// formats added with RegisterDecoder that decode frames; other formats
+// yield a single frame. Like Open, it applies the EXIF orientation unless
+// disabled with WithOrientation(false).
+func OpenFrames(path string, opts ...DecodeOption) ([]Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return DecodeFrames(f, opts...)
+}
+
+// DecodeFrames decodes all frames of an image from the given reader.
+// It handles the same formats and options as OpenFrames.
+func DecodeFrames(r io.Reader, opts ...DecodeOption) ([]Frame, error) {
+	cfg := newDecodeConfig(true, opts)
+	if !cfg.orient {
+		return decodeFrames(r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	frames, err := decodeFrames(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if o := orientationOf(data); o != OrientationNormal {
+		for i := range frames {
+			frames[i].Image = ApplyOrientation(frames[i].Image, o)
+		}
+	}
+	return frames, nil
+}
+
+func decodeFrames(r io.Reader) ([]Frame, error) {
+	br, d, ok := lookupDecoder(r)
+	if ok && d.DecodeFrames != nil {
+		frames, err := d.DecodeFrames(br)
+		if err == nil && len(frames) == 0 {
+			err = fmt.Errorf("%w: %s decoder", ErrNoFrames, d.Name)
+		}
+		return frames, err
+	}
+	img, err := decodeFormat(br)
+	if err != nil {
+		return nil, err
+	}
+	return []Frame{{Image: img}}, nil
+}
+
+// compositeGIF renders every frame of an animated GIF onto the logical
+// screen, applying the disposal method of each frame before drawing the
+// next. The screen starts transparent, which is how browsers treat the
+// background colour.
+func compositeGIF(g *gif.GIF) []Frame {
+	screen := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if screen.Empty() && len(g.Image) > 0 {
+		screen = g.Image[0].Bounds()
+		for _, p := range g.Image[1:] {
+			screen = screen.Union(p.Bounds())
+		}
+	}
+	canvas := image.NewRGBA(screen)
+	frames := make([]Frame, len(g.Image))
+	var saved *image.RGBA
+	for i, p := range g.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			saved = cloneRGBA(canvas)
+		}
+		draw.Draw(canvas, p.Bounds(), p, p.Bounds().Min, draw.Over)
+		frames[i].Image = cloneRGBA(canvas)
+		if i < len(g.Delay) {
+			frames[i].Delay = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		}
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, p.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = saved
+		}
+	}
+	return frames
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	c := *img
+	c.Pix = append([]uint8(nil), img.Pix...)
+	return &c
+}
+
+// HashFileFrames opens an image file and hashes each of its frames.
+// Options are as for OpenFrames.
+func HashFileFrames(hasher Hasher, path string, opts ...DecodeOption) (FrameHashes, error) {
+	frames, err := OpenFrames(path, opts...)
+	if err != nil {
+		return FrameHashes{}, err
+	}
+	return hashFrames(hasher, frames)
+}
+
+// HashReaderFrames decodes an image from a reader and hashes each of its frames.
+// Options are as for DecodeFrames.
+func HashReaderFrames(hasher Hasher, r io.Reader, opts ...DecodeOption) (FrameHashes, error) {
+	frames, err := DecodeFrames(r, opts...)
+	if err != nil {
+		return FrameHashes{}, err
+	}
+	return hashFrames(hasher, frames)
+}
+
+func hashFrames(hasher Hasher, frames []Frame) (FrameHashes, error) {
+	if len(frames) == 0 {
+		return FrameHashes{}, ErrNoFrames
+	}
+	res := FrameHashes{Frames: make([]hashtype.Hash, len(frames))}
+	weights := make([]float64, len(frames))
+	for i, f := range frames {
+		h, err := hasher.Calculate(f.Image)
+		if err != nil {
+			return FrameHashes{}, err
+		}
+		res.Frames[i] = h
+		d := f.Delay
+		if d < minFrameDelay {
+			d = defaultFrameDelay
+		}
+		weights[i] = d.Seconds()
+	}
+	agg, err := aggregateHashes(res.Frames, weights)
+	if err != nil {
+		return FrameHashes{}, err
+	}
+	res.Aggregate = agg
+	return res, nil
+}
+
+// aggregateHashes combines hashes of the same type and length into one,
+// weighting each by the matching weight.
+func aggregateHashes(hashes []hashtype.Hash, weights []float64) (hashtype.Hash, error) {
+	if len(hashes) == 1 {
+		return hashes[0], nil
+	}
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	n := hashes[0].Len()
+	for _, h := range hashes[1:] {
+		if h.Len() != n {
+			return nil, ErrHashLengthMismatch
+		}
+	}
+	switch hashes[0].(type) {
+	case hashtype.Binary:
+		votes := make([]float64, 8*n)
+		for i, h := range hashes {
+			b, ok := h.(hashtype.Binary)
+			if !ok {
+				return nil, ErrIncompatibleHash
+			}
+			for bit := range votes {
+				if b[bit/8]&(1<<(bit%8)) != 0 {
+					votes[bit] += weights[i]
+				}
+			}
+		}
+		out := make(hashtype.Binary, n)
+		for bit, v := range votes {
+			if v > total/2 {
+				out[bit/8] |= 1 << (bit % 8)
+			}
+		}
+		return out, nil
+	case hashtype.UInt8:
+		mean, err := weightedMean[hashtype.UInt8](hashes, weights, total)
+		if err != nil {
+			return nil, err
+		}
+		out := make(hashtype.UInt8, n)
+		for i, v := range mean {
+			out[i] = uint8(math.Round(v))
+		}
+		return out, nil
+	case hashtype.Float64:
+		mean, err := weightedMean[hashtype.Float64](hashes, weights, total)
+		if err != nil {
+			return nil, err
+		}
+		return hashtype.Float64(mean), nil
+	case hashtype.Composite:
+		return aggregateComposites(hashes, weights)
+	}
+	return nil, ErrIncompatibleHash
+}
+
+// aggregateComposites aggregates Composite hashes part by part. Every
+// frame must have the same number of parts, and matching parts the same
+// type and length, so a CropResistant hash only aggregates when every
+// frame splits into segments of the same count.
+func aggregateComposites(hashes []hashtype.Hash, weights []float64) (hashtype.Hash, error) {
+	first := hashes[0].(hashtype.Composite)
+	parts := make([]hashtype.Hash, len(hashes))
+	out := make(hashtype.Composite, len(first))
+	for p := range first {
+		for i, h := range hashes {
+			c, ok := h.(hashtype.Composite)
+			if !ok {
+				return nil, ErrIncompatibleHash
+			}
+			if len(c) != len(first) {
+				return nil, ErrHashLengthMismatch
+			}
+			parts[i] = c[p]
+		}
+		agg, err := aggregateHashes(parts, weights)
+		if err != nil {
+			return nil, err
+		}
+		out[p] = agg
+	}
+	return out, nil
+}
+
+func weightedMean[T hashtype.UInt8 | hashtype.Float64](hashes []hashtype.Hash, weights []float64, total float64) ([]float64, error) {
+	mean := make([]float64, hashes[0].Len())
+	for i, h := range hashes {
+		if _, ok := h.(T); !ok {
+			return nil, ErrIncompatibleHash
+		}
+		for j := range mean {
+			mean[j] += h.ValueAt(j) * weights[i] / total
+		}
+	}
+	return mean, nil
+}
@@ -0,0 +1,237 @@
+package imghash_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+var (
+	gifRed   = color.RGBA{255, 0, 0, 255}
+	gifGreen = color.RGBA{0, 255, 0, 255}
+	gifBlue  = color.RGBA{0, 0, 255, 255}
+	gifClear = color.RGBA{}
+)
+
+// animatedGIF encodes a 4x4 animation that exercises every disposal method.
+func animatedGIF(t *testing.T) []byte {
+	t.Helper()
+	palette := color.Palette{color.RGBA{}, gifRed, gifGreen, gifBlue}
+	frame := func(r image.Rectangle, c uint8) *image.Paletted {
+		p := image.NewPaletted(r, palette)
+		for i := range p.Pix {
+			p.Pix[i] = c
+		}
+		return p
+	}
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			frame(image.Rect(0, 0, 4, 4), 1),
+			frame(image.Rect(0, 0, 2, 2), 2),
+			frame(image.Rect(2, 2, 4, 4), 3),
+			frame(image.Rect(3, 0, 4, 1), 2),
+		},
+		Delay:    []int{10, 0, 50, 0},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		Config:   image.Config{ColorModel: palette, Width: 4, Height: 4},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeFrames_gifDisposal(t *testing.T) {
+	frames, err := imghash.DecodeFrames(bytes.NewReader(animatedGIF(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDelays := []time.Duration{100 * time.Millisecond, 0, 500 * time.Millisecond, 0}
+	// Expected colours at (0,0), (3,0) and (3,3) of every frame.
+	want := [][3]color.RGBA{
+		{gifRed, gifRed, gifRed},
+		{gifGreen, gifRed, gifRed},
+		{gifClear, gifRed, gifBlue},
+		{gifClear, gifGreen, gifRed},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(want))
+	}
+	for i, f := range frames {
+		if f.Delay != wantDelays[i] {
+			t.Errorf("frame %d: got delay %v, want %v", i, f.Delay, wantDelays[i])
+		}
+		if b := f.Image.Bounds(); b != image.Rect(0, 0, 4, 4) {
+			t.Errorf("frame %d: got bounds %v, want the logical screen", i, b)
+		}
+		for j, p := range []image.Point{{0, 0}, {3, 0}, {3, 3}} {
+			got := color.RGBAModel.Convert(f.Image.At(p.X, p.Y))
+			if got != want[i][j] {
+				t.Errorf("frame %d at %v: got %v, want %v", i, p, got, want[i][j])
+			}
+		}
+	}
+}
+
+func TestDecodeFrames_still(t *testing.T) {
+	frames, err := imghash.OpenFrames("assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := imghash.OpenImage("assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0].Delay != 0 || !reflect.DeepEqual(frames[0].Image, img) {
+		t.Errorf("got %d frames, want the decoded image", len(frames))
+	}
+}
+
+func TestDecodeFrames_invalid(t *testing.T) {
+	if _, err := imghash.DecodeFrames(bytes.NewReader([]byte("GIF89a truncated"))); err == nil {
+		t.Error("expected error for truncated GIF")
+	}
+	if _, err := imghash.OpenFrames("nonexistent.gif"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+// sequenceHasher returns its hashes in turn, one per call.
+type sequenceHasher struct {
+	hashes []hashtype.Hash
+	next   *int
+}
+
+func (s sequenceHasher) Calculate(image.Image) (hashtype.Hash, error) {
+	h := s.hashes[*s.next]
+	*s.next++
+	return h, nil
+}
+
+func TestHashReaderFrames_aggregate(t *testing.T) {
+	// The frames are displayed for 100ms, 100ms (delay 0), 500ms and
+	// 100ms (delay 0), so the third frame outweighs the others combined.
+	tests := []struct {
+		name   string
+		hashes []hashtype.Hash
+		want   hashtype.Hash
+	}{
+		{
+			"binary",
+			[]hashtype.Hash{hashtype.Binary{0b0011}, hashtype.Binary{0b0111}, hashtype.Binary{0b1000}, hashtype.Binary{0b0111}},
+			hashtype.Binary{0b1000},
+		},
+		{
+			"uint8",
+			[]hashtype.Hash{hashtype.UInt8{0, 8}, hashtype.UInt8{0, 8}, hashtype.UInt8{8, 8}, hashtype.UInt8{0, 9}},
+			hashtype.UInt8{5, 8},
+		},
+		{
+			"float64",
+			[]hashtype.Hash{hashtype.Float64{0}, hashtype.Float64{0}, hashtype.Float64{8}, hashtype.Float64{0}},
+			hashtype.Float64{5},
+		},
+		{
+			"composite",
+			[]hashtype.Hash{
+				hashtype.Composite{hashtype.Binary{0b0011}, hashtype.Float64{0}},
+				hashtype.Composite{hashtype.Binary{0b0111}, hashtype.Float64{0}},
+				hashtype.Composite{hashtype.Binary{0b1000}, hashtype.Float64{8}},
+				hashtype.Composite{hashtype.Binary{0b0111}, hashtype.Float64{0}},
+			},
+			hashtype.Composite{hashtype.Binary{0b1000}, hashtype.Float64{5}},
+		},
+	}
+	data := animatedGIF(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := imghash.HashReaderFrames(sequenceHasher{tt.hashes, new(int)}, bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Frames, tt.hashes) {
+				t.Errorf("got frames %v, want %v", got.Frames, tt.hashes)
+			}
+			if !reflect.DeepEqual(got.Aggregate, tt.want) {
+				t.Errorf("got aggregate %v, want %v", got.Aggregate, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashReaderFrames_mismatch(t *testing.T) {
+	data := animatedGIF(t)
+	tests := []struct {
+		name   string
+		hashes []hashtype.Hash
+		err    error
+	}{
+		{"length", []hashtype.Hash{hashtype.Binary{0}, hashtype.Binary{0, 0}, hashtype.Binary{0}, hashtype.Binary{0}}, imghash.ErrHashLengthMismatch},
+		{"type", []hashtype.Hash{hashtype.Binary{0}, hashtype.UInt8{0}, hashtype.Binary{0}, hashtype.Binary{0}}, imghash.ErrIncompatibleHash},
+		{"composite parts", []hashtype.Hash{
+			hashtype.Composite{hashtype.Binary{0}, hashtype.Binary{0}},
+			hashtype.Composite{hashtype.UInt8{0, 0}},
+			hashtype.Composite{hashtype.Binary{0}, hashtype.Binary{0}},
+			hashtype.Composite{hashtype.Binary{0}, hashtype.Binary{0}},
+		}, imghash.ErrHashLengthMismatch},
+		{"composite part type", []hashtype.Hash{
+			hashtype.Composite{hashtype.Binary{0}},
+			hashtype.Composite{hashtype.UInt8{0}},
+			hashtype.Composite{hashtype.Binary{0}},
+			hashtype.Composite{hashtype.Binary{0}},
+		}, imghash.ErrIncompatibleHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := imghash.HashReaderFrames(sequenceHasher{tt.hashes, new(int)}, bytes.NewReader(data))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestHashFileFrames(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "anim.gif")
+	if err := os.WriteFile(path, animatedGIF(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := imghash.HashFileFrames(avg, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := imghash.HashFile(avg, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Frames) != 4 || !reflect.DeepEqual(got.Frames[0], first) {
+		t.Errorf("got frames %v, want 4 frames starting with %v", got.Frames, first)
+	}
+
+	still, err := imghash.HashFileFrames(avg, "assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := imghash.HashFile(avg, "assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(still.Frames) != 1 || !reflect.DeepEqual(still.Aggregate, want) {
+		t.Errorf("still image: got %+v, want one frame hashed %v", still, want)
+	}
+}
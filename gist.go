@@ -3,9 +3,9 @@ package imghash
 import (
 	"image"
 	"math"
+	"slices"
 
 	"github.com/ajdnik/imghash/v2/hashtype"
-	"github.com/ajdnik/imghash/v2/internal/imgproc"
 	"github.com/ajdnik/imghash/v2/similarity"
 )
 
@@ -26,7 +26,7 @@ type GIST struct {
 // Without options, sensible defaults are used.
 func NewGIST(opts ...GISTOption) (GIST, error) {
 	g := GIST{
-		baseConfig: baseConfig{width: 64, height: 64, interp: Bilinear},
+		baseConfig: baseConfig{width: 64, height: 64, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 		gridX:      4,
 		gridY:      4,
 	}
@@ -44,14 +44,31 @@ func NewGIST(opts ...GISTOption) (GIST, error) {
 
 // Calculate returns a perceptual image hash.
 func (g GIST) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(g.width, g.height, img, g.interp.resizeType())
-	gray, err := imgproc.Grayscale(r)
+	return g.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Float64 hash with enough capacity. See IntoHasher.
+func (g GIST) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return g.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (g GIST) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return g.calculate(nil, prep)
+}
+
+func (g GIST) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(g.alphaPolicy).cropBorders(g.border)
+	gray, err := prep.ResizedGray(g.width, g.height, g.interp)
 	if err != nil {
 		return nil, err
 	}
 	mat := g.normalizeGray(gray)
-	desc := g.computeDescriptor(mat)
-	return hashtype.Float64(desc), nil
+	return g.computeDescriptor(dst, mat), nil
 }
 
 func (g GIST) normalizeGray(img *image.Gray) [][]float64 {
@@ -95,14 +112,14 @@ func (g GIST) normalizeGray(img *image.Gray) [][]float64 {
 	return mat
 }
 
-func (g GIST) computeDescriptor(img [][]float64) []float64 {
+func (g GIST) computeDescriptor(dst hashtype.Hash, img [][]float64) hashtype.Float64 {
 	h := len(img)
 	if h == 0 {
-		return []float64{}
+		return hashInto[hashtype.Float64](dst, 0)
 	}
 	w := len(img[0])
 	if w == 0 {
-		return []float64{}
+		return hashInto[hashtype.Float64](dst, 0)
 	}
 
 	gridX, gridY := int(g.gridX), int(g.gridY)
@@ -119,7 +136,7 @@ func (g GIST) computeDescriptor(img [][]float64) []float64 {
 	for _, o := range gistOrientationsPerScale {
 		totalOrientations += o
 	}
-	descriptor := make([]float64, 0, gridX*gridY*totalOrientations)
+	descriptor := slices.Grow(hashInto[hashtype.Float64](dst, 0), gridX*gridY*totalOrientations)
 
 	wavelengths := []float64{4, 8, 12}
 	for s, nOrient := range gistOrientationsPerScale {
@@ -0,0 +1,275 @@
+package imghash_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+var (
+	goldenReport = flag.Bool("golden.report", false,
+		"log the per-algorithm disagreement with testdata/golden/golden.json")
+	goldenUpdate = flag.Bool("golden.update", false,
+		"record this library's hashes for the algorithms in testdata/golden/golden.json that have no reference hashes")
+)
+
+const (
+	goldenFile = "testdata/golden/golden.json"
+	// goldenSelf marks golden hashes recorded by this library rather than
+	// by a reference implementation.
+	goldenSelf = "imghash"
+	// goldenFloatTolerance is the relative L2 error accepted between float
+	// descriptors computed with different summation orders.
+	goldenFloatTolerance = 1e-6
+)
+
+// goldenAlgorithms are the algorithms that cite a reference
+// implementation, keyed as in golden.json. Each is constructed with its
+// default options.
+var goldenAlgorithms = []struct {
+	key    string
+	name   string
+	params map[string]any
+	order  hashtype.BitOrder
+}{
+	{"pdq", "pdq", nil, hashtype.LSB0},
+	{"phash", "phash", nil, hashtype.MSB0},
+	{"blockmean", "blockmean", nil, hashtype.MSB0},
+	{"blockmean_overlap", "blockmean", map[string]any{"block_mean_method": "Overlap"}, hashtype.MSB0},
+	{"marrhildreth", "marrhildreth", nil, hashtype.MSB0},
+	{"radialvariance", "radialvariance", nil, hashtype.MSB0},
+	{"colormoment", "colormoment", nil, hashtype.MSB0},
+}
+
+type goldenEntry struct {
+	// Source names the implementation that produced the hashes.
+	Source string                     `json:"source"`
+	Hashes map[string]json.RawMessage `json:"hashes"`
+}
+
+// TestGoldenVectors compares the hashes of the test images with the golden
+// vectors in testdata/golden/golden.json. Entries recorded by this library
+// are regression vectors and must match on every image. Entries recorded by
+// a reference implementation (see testdata/golden/reference.py) must match
+// on lossless images; JPEG decoders differ between libraries, so JPEG images
+// are only reported for them. Run with -golden.report to also log the
+// disagreement of every algorithm:
+//
+//	go test -run TestGoldenVectors -v . -golden.report
+func TestGoldenVectors(t *testing.T) {
+	golden := map[string]*goldenEntry{}
+	data, err := os.ReadFile(goldenFile)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &golden); err != nil {
+			t.Fatal(err)
+		}
+	case !errors.Is(err, fs.ErrNotExist) || !*goldenUpdate:
+		t.Fatal(err)
+	}
+
+	t.Run("algorithms", func(t *testing.T) {
+		for _, alg := range goldenAlgorithms {
+			entry := golden[alg.key]
+			if entry == nil {
+				if !*goldenUpdate {
+					t.Errorf("%s: no golden hashes", alg.key)
+					continue
+				}
+				entry = &goldenEntry{Source: goldenSelf}
+				golden[alg.key] = entry
+			}
+			t.Run(alg.key, func(t *testing.T) {
+				t.Parallel()
+				h, err := imghash.New(alg.name, alg.params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *goldenUpdate && entry.Source == goldenSelf {
+					hashes, err := recordGolden(h, alg.order)
+					if err != nil {
+						t.Fatal(err)
+					}
+					entry.Hashes = hashes
+					return
+				}
+				checkGolden(t, alg.key, h, alg.order, entry)
+			})
+		}
+	})
+
+	if *goldenUpdate {
+		out, err := json.MarshalIndent(golden, "", "\t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(goldenFile, append(out, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkGolden(t *testing.T, key string, h imghash.HasherComparer, order hashtype.BitOrder, entry *goldenEntry) {
+	paths := slices.Sorted(func(yield func(string) bool) {
+		for p := range entry.Hashes {
+			if !yield(p) {
+				return
+			}
+		}
+	})
+	var exact, jpegs int
+	var worst, jpegSum, jpegMax float64
+	var worstPath string
+	for _, path := range paths {
+		want, err := decodeGoldenHash(entry.Hashes[path], order)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		img, err := imghash.OpenImage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := h.Calculate(img)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		d, err := goldenDisagreement(got, want)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if d == 0 {
+			exact++
+		}
+		if isJPEG(path) {
+			jpegs++
+			jpegSum += d
+			jpegMax = max(jpegMax, d)
+			if entry.Source != goldenSelf {
+				continue
+			}
+		} else if d > worst {
+			worst, worstPath = d, path
+		}
+		if d > 0 {
+			t.Errorf("%s: disagreement %.4f with %s\n got %v\nwant %v", path, d, entry.Source, got, want)
+		}
+	}
+	if *goldenReport {
+		line := fmt.Sprintf("%-18s %-22s %d/%d exact, lossless max %.4f", key, entry.Source, exact, len(paths), worst)
+		if worstPath != "" {
+			line += " (" + filepath.Base(worstPath) + ")"
+		}
+		if jpegs > 0 {
+			line += fmt.Sprintf(", JPEG mean %.4f max %.4f", jpegSum/float64(jpegs), jpegMax)
+		}
+		t.Log(line)
+	}
+}
+
+// recordGolden hashes the test images with h.
+func recordGolden(h imghash.Hasher, order hashtype.BitOrder) (map[string]json.RawMessage, error) {
+	var paths []string
+	for _, pattern := range []string{"assets/*.jpg", "assets/*.png", "testdata/golden/synthetic/*.png"} {
+		m, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, m...)
+	}
+	hashes := make(map[string]json.RawMessage, len(paths))
+	for _, path := range paths {
+		img, err := imghash.OpenImage(path)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := h.Calculate(img)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		var v any
+		switch hash := hash.(type) {
+		case hashtype.Binary:
+			v = hash.Hex(order)
+		case hashtype.UInt8:
+			v = hex.EncodeToString(hash)
+		case hashtype.Float64:
+			v = []float64(hash)
+		default:
+			return nil, fmt.Errorf("%s: unexpected hash type %T", path, hash)
+		}
+		if hashes[path], err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+// decodeGoldenHash reads a golden hash: a hex string for binary and
+// byte-valued hashes, or an array for float descriptors.
+func decodeGoldenHash(raw json.RawMessage, order hashtype.BitOrder) (hashtype.Hash, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return hashtype.ParseHex(s, order)
+	}
+	var f []float64
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, err
+	}
+	return hashtype.Float64(f), nil
+}
+
+// goldenDisagreement returns the fraction of differing bits for
+// binary hashes, the fraction of differing elements for byte-valued
+// hashes and the relative L2 error, rounded to zero within
+// goldenFloatTolerance, for float descriptors.
+func goldenDisagreement(got, want hashtype.Hash) (float64, error) {
+	if got.Len() != want.Len() {
+		return 0, fmt.Errorf("got %d elements, want %d", got.Len(), want.Len())
+	}
+	switch got := got.(type) {
+	case hashtype.Binary:
+		var n int
+		for i, b := range got {
+			n += bits.OnesCount8(b ^ want.(hashtype.Binary)[i])
+		}
+		return float64(n) / float64(8*len(got)), nil
+	case hashtype.UInt8:
+		// Golden byte-valued hashes are stored as hex and decode as Binary.
+		var n int
+		for i, b := range got {
+			if b != want.(hashtype.Binary)[i] {
+				n++
+			}
+		}
+		return float64(n) / float64(len(got)), nil
+	}
+	var diff, norm float64
+	for i := range got.Len() {
+		d := got.ValueAt(i) - want.ValueAt(i)
+		diff += d * d
+		norm += want.ValueAt(i) * want.ValueAt(i)
+	}
+	rel := math.Sqrt(diff / norm)
+	if rel <= goldenFloatTolerance {
+		return 0, nil
+	}
+	return rel, nil
+}
+
+func isJPEG(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jpg" || ext == ".jpeg"
+}
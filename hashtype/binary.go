@@ -9,8 +9,11 @@ package hashtype
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"slices"
 )
 
 // Binary represents a hash type where the smallest hash element is a bit.
@@ -27,6 +30,67 @@ func (h Binary) String() string {
 	return fmt.Sprintf("%v", []byte(h))
 }
 
+// BitOrder selects how the bit positions of a Binary hash map onto the
+// digits of its hex and base64 forms.
+type BitOrder uint8
+
+const (
+	// MSB0 encodes bytes in storage order. For hashes built with SetReverse
+	// the string reads as a number in which position 0 is the most
+	// significant bit. This is the convention used by Python imagehash.
+	MSB0 BitOrder = iota
+	// LSB0 encodes bytes in reverse storage order. For hashes built with Set
+	// the string reads as a number in which position 0 is the least
+	// significant bit. This is the convention used by Meta's PDQ reference
+	// implementation and by pHash's 64-bit DCT hash.
+	LSB0
+)
+
+// Hex returns the hash as a lowercase hex string.
+// The optional order selects the bit order and defaults to MSB0.
+func (h Binary) Hex(order ...BitOrder) string {
+	return hex.EncodeToString(h.ordered(order))
+}
+
+// ParseHex decodes a hex string produced by Hex or by another perceptual
+// hashing tool. Upper and lower case digits are accepted.
+// The optional order selects the bit order and defaults to MSB0.
+func ParseHex(s string, order ...BitOrder) (Binary, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEncoding, err)
+	}
+	return Binary(b).ordered(order), nil
+}
+
+// Base64 returns the hash as a padded standard base64 string.
+// The optional order selects the bit order and defaults to MSB0.
+func (h Binary) Base64(order ...BitOrder) string {
+	return base64.StdEncoding.EncodeToString(h.ordered(order))
+}
+
+// ParseBase64 decodes a padded standard base64 string produced by Base64.
+// The optional order selects the bit order and defaults to MSB0.
+func ParseBase64(s string, order ...BitOrder) (Binary, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEncoding, err)
+	}
+	return Binary(b).ordered(order), nil
+}
+
+// ordered returns the bytes laid out for the requested bit order.
+// Reversing the byte order is its own inverse, so the same helper
+// serves both encoding and decoding.
+func (h Binary) ordered(order []BitOrder) Binary {
+	if len(order) > 0 && order[0] == LSB0 {
+		r := slices.Clone(h)
+		slices.Reverse(r)
+		return r
+	}
+	return h
+}
+
 // ErrOutOfBounds is reported when the bit position is larger than the number of bits in the hash.
 var ErrOutOfBounds = errors.New("position out of bounds")
 
@@ -77,3 +141,50 @@ func (h Binary) setBit(position, bit uint) error {
 	h[byt] |= 1 << bit
 	return nil
 }
+
+// MarshalBinary encodes the hash in the self-describing binary wire format.
+func (h Binary) MarshalBinary() ([]byte, error) {
+	return marshalWire(Envelope{Hash: h})
+}
+
+// UnmarshalBinary decodes a hash produced by MarshalBinary.
+// Encodings of other hash kinds are rejected with ErrKindMismatch.
+func (h *Binary) UnmarshalBinary(data []byte) error {
+	v, err := unmarshalKind(data, KindBinary)
+	if err != nil {
+		return err
+	}
+	*h = v.(Binary)
+	return nil
+}
+
+// MarshalText encodes the hash as "binary:" followed by lowercase hex.
+func (h Binary) MarshalText() ([]byte, error) {
+	return marshalText(h), nil
+}
+
+// UnmarshalText decodes a hash produced by MarshalText.
+// Encodings of other hash kinds are rejected with ErrKindMismatch.
+func (h *Binary) UnmarshalText(text []byte) error {
+	v, err := unmarshalTextKind(text, KindBinary)
+	if err != nil {
+		return err
+	}
+	*h = v.(Binary)
+	return nil
+}
+
+// MarshalJSON encodes the hash as a JSON string holding its text form.
+func (h Binary) MarshalJSON() ([]byte, error) {
+	return marshalJSON(h)
+}
+
+// UnmarshalJSON decodes a hash produced by MarshalJSON.
+func (h *Binary) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalJSONKind(data, KindBinary)
+	if err != nil {
+		return err
+	}
+	*h = v.(Binary)
+	return nil
+}
@@ -241,3 +241,110 @@ func TestNewBinary(t *testing.T) {
 		})
 	}
 }
+
+var binaryHexTests = []struct {
+	name   string
+	hash   hashtype.Binary
+	order  []hashtype.BitOrder
+	result string
+}{
+	{"empty", hashtype.Binary{}, nil, ""},
+	{"default order", hashtype.Binary{0x0c, 0xc8}, nil, "0cc8"},
+	{"msb0", hashtype.Binary{0x0c, 0xc8}, []hashtype.BitOrder{hashtype.MSB0}, "0cc8"},
+	{"lsb0", hashtype.Binary{0x0c, 0xc8}, []hashtype.BitOrder{hashtype.LSB0}, "c80c"},
+}
+
+func TestBinary_Hex(t *testing.T) {
+	for _, tt := range binaryHexTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := tt.hash.Hex(tt.order...); res != tt.result {
+				t.Errorf("got %v, want %v", res, tt.result)
+			}
+			back, err := hashtype.ParseHex(tt.result, tt.order...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !back.Equal(tt.hash) {
+				t.Errorf("round trip: got %v, want %v", back, tt.hash)
+			}
+		})
+	}
+}
+
+func TestBinary_Hex_bitPositions(t *testing.T) {
+	set := hashtype.NewBinary(16)
+	_ = set.Set(0)
+	_ = set.Set(13)
+	if res := set.Hex(hashtype.LSB0); res != "2001" {
+		t.Errorf("Set with LSB0: got %v, want 2001", res)
+	}
+	rev := hashtype.NewBinary(16)
+	_ = rev.SetReverse(0)
+	_ = rev.SetReverse(13)
+	if res := rev.Hex(hashtype.MSB0); res != "8004" {
+		t.Errorf("SetReverse with MSB0: got %v, want 8004", res)
+	}
+}
+
+func TestParseHex_uppercase(t *testing.T) {
+	res, err := hashtype.ParseHex("0CC8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Equal(hashtype.Binary{0x0c, 0xc8}) {
+		t.Errorf("got %v, want [12 200]", res)
+	}
+}
+
+func TestParseHex_error(t *testing.T) {
+	for _, s := range []string{"abc", "zz", "0x0c"} {
+		if _, err := hashtype.ParseHex(s); !errors.Is(err, hashtype.ErrInvalidEncoding) {
+			t.Errorf("%q: got %v, want %v", s, err, hashtype.ErrInvalidEncoding)
+		}
+	}
+}
+
+var binaryBase64Tests = []struct {
+	name   string
+	hash   hashtype.Binary
+	order  []hashtype.BitOrder
+	result string
+}{
+	{"empty", hashtype.Binary{}, nil, ""},
+	{"default order", hashtype.Binary{0x0c, 0xc8, 0xff}, nil, "DMj/"},
+	{"lsb0", hashtype.Binary{0x0c, 0xc8, 0xff}, []hashtype.BitOrder{hashtype.LSB0}, "/8gM"},
+	{"padded", hashtype.Binary{0x01}, nil, "AQ=="},
+}
+
+func TestBinary_Base64(t *testing.T) {
+	for _, tt := range binaryBase64Tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := tt.hash.Base64(tt.order...); res != tt.result {
+				t.Errorf("got %v, want %v", res, tt.result)
+			}
+			back, err := hashtype.ParseBase64(tt.result, tt.order...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !back.Equal(tt.hash) {
+				t.Errorf("round trip: got %v, want %v", back, tt.hash)
+			}
+		})
+	}
+}
+
+func TestParseBase64_error(t *testing.T) {
+	if _, err := hashtype.ParseBase64("AQ"); !errors.Is(err, hashtype.ErrInvalidEncoding) {
+		t.Errorf("got %v, want %v", err, hashtype.ErrInvalidEncoding)
+	}
+}
+
+func ExampleBinary_Hex() {
+	hash := hashtype.NewBinary(16)
+	_ = hash.Set(0)
+	fmt.Println(hash.Hex())
+	fmt.Println(hash.Hex(hashtype.LSB0))
+	// Output:
+	// 0100
+	// 0001
+}
@@ -0,0 +1,93 @@
+package hashtype
+
+import "strings"
+
+// Composite is a hash made of several hashes, such as the member hashes
+// of an imghash.Ensemble or the segment hashes of an imghash.CropResistant.
+// Every part is a Binary, UInt8 or Float64 hash; composites do not nest.
+type Composite []Hash
+
+// String returns the string representations of all parts in brackets.
+func (h Composite) String() string {
+	s := make([]string, len(h))
+	for i, p := range h {
+		s[i] = p.String()
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+// Len returns the total number of elements in all parts.
+func (h Composite) Len() int {
+	n := 0
+	for _, p := range h {
+		n += p.Len()
+	}
+	return n
+}
+
+// ValueAt returns the element at the given index of the parts laid end to
+// end.
+func (h Composite) ValueAt(idx int) float64 {
+	for _, p := range h {
+		if idx < p.Len() {
+			return p.ValueAt(idx)
+		}
+		idx -= p.Len()
+	}
+	panic("hashtype: Composite index out of range")
+}
+
+// MarshalBinary encodes the hash in the self-describing binary wire format.
+func (h Composite) MarshalBinary() ([]byte, error) {
+	return marshalWire(Envelope{Hash: h})
+}
+
+// UnmarshalBinary decodes a hash produced by MarshalBinary.
+// Encodings of other hash kinds are rejected with ErrKindMismatch.
+func (h *Composite) UnmarshalBinary(data []byte) error {
+	v, err := unmarshalKind(data, KindComposite)
+	if err != nil {
+		return err
+	}
+	*h = v.(Composite)
+	return nil
+}
+
+// MarshalText encodes the hash as "composite:" followed by the text forms
+// of its parts separated by semicolons, e.g.
+// "composite:binary:0cc8;float64:0.5,2".
+func (h Composite) MarshalText() ([]byte, error) {
+	if err := checkParts(h); err != nil {
+		return nil, err
+	}
+	return marshalText(h), nil
+}
+
+// UnmarshalText decodes a hash produced by MarshalText.
+// Encodings of other hash kinds are rejected with ErrKindMismatch.
+func (h *Composite) UnmarshalText(text []byte) error {
+	v, err := unmarshalTextKind(text, KindComposite)
+	if err != nil {
+		return err
+	}
+	*h = v.(Composite)
+	return nil
+}
+
+// MarshalJSON encodes the hash as a JSON string holding its text form.
+func (h Composite) MarshalJSON() ([]byte, error) {
+	if err := checkParts(h); err != nil {
+		return nil, err
+	}
+	return marshalJSON(h)
+}
+
+// UnmarshalJSON decodes a hash produced by MarshalJSON.
+func (h *Composite) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalJSONKind(data, KindComposite)
+	if err != nil {
+		return err
+	}
+	*h = v.(Composite)
+	return nil
+}
@@ -0,0 +1,576 @@
+package hashtype
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind identifies the concrete representation of a hash.
+type Kind uint8
+
+// Supported hash kinds.
+const (
+	KindBinary Kind = iota + 1
+	KindUInt8
+	KindFloat64
+	KindComposite
+)
+
+var kindNames = [...]string{
+	KindBinary:    "binary",
+	KindUInt8:     "uint8",
+	KindFloat64:   "float64",
+	KindComposite: "composite",
+}
+
+// String returns the name of the hash kind.
+func (k Kind) String() string {
+	if k.valid() {
+		return kindNames[k]
+	}
+	return "unknown"
+}
+
+func (k Kind) valid() bool {
+	return k >= KindBinary && k <= KindComposite
+}
+
+// ParseKind returns the Kind with the given name.
+func ParseKind(name string) (Kind, error) {
+	for k := KindBinary; k <= KindComposite; k++ {
+		if kindNames[k] == name {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown hash kind %q", ErrInvalidEncoding, name)
+}
+
+// KindOf returns the kind of the given hash.
+// It returns zero for hash implementations outside this package.
+func KindOf(h Hash) Kind {
+	switch h.(type) {
+	case Binary:
+		return KindBinary
+	case UInt8:
+		return KindUInt8
+	case Float64:
+		return KindFloat64
+	case Composite:
+		return KindComposite
+	default:
+		return 0
+	}
+}
+
+// Encoding errors.
+var (
+	// ErrInvalidEncoding is reported when encoded data is malformed or truncated.
+	ErrInvalidEncoding = errors.New("invalid hash encoding")
+	// ErrUnsupportedEncoding is reported when encoded data uses an unknown format version.
+	ErrUnsupportedEncoding = errors.New("unsupported hash encoding version")
+	// ErrKindMismatch is reported when encoded data holds a different hash kind than the target type.
+	ErrKindMismatch = errors.New("encoded hash kind does not match target type")
+)
+
+// Binary wire format (all integers are unsigned varints unless noted):
+//
+//	magic          4 bytes "IMGH"
+//	format version 1 byte
+//	kind           1 byte
+//	flags          1 byte, bit 0 set when algorithm metadata follows
+//	[algorithm name length, name bytes]
+//	[algorithm version]
+//	[parameter count, then key length, key, value length, value; sorted by key]
+//	element count  number of parts for Composite
+//	payload        Binary and UInt8 as raw bytes, Float64 as 8-byte big-endian IEEE 754,
+//	               Composite as the kind byte, element count and payload of each part
+const (
+	wireMagic   = "IMGH"
+	wireVersion = 1
+
+	wireFlagMetadata = 1 << 0
+)
+
+// envelopeTextPrefix marks the text form of an Envelope.
+const envelopeTextPrefix = "imgh:"
+
+// Envelope wraps a hash together with the algorithm name, algorithm
+// version and options that produced it, so persisted hashes remain
+// interpretable across releases.
+type Envelope struct {
+	// Algorithm is the name of the algorithm that produced the hash.
+	Algorithm string
+	// Version is the algorithm version. It changes whenever the same
+	// options would produce different hashes.
+	Version uint
+	// Params holds the options that influence the hash value.
+	Params map[string]string
+	// Hash is the wrapped hash value.
+	Hash Hash
+}
+
+// Kind returns the kind of the wrapped hash.
+func (e Envelope) Kind() Kind {
+	return KindOf(e.Hash)
+}
+
+// MarshalBinary encodes the envelope in the versioned binary wire format.
+func (e Envelope) MarshalBinary() ([]byte, error) {
+	return marshalWire(e)
+}
+
+// UnmarshalBinary decodes an envelope from the binary wire format.
+func (e *Envelope) UnmarshalBinary(data []byte) error {
+	dec, err := unmarshalWire(data)
+	if err != nil {
+		return err
+	}
+	*e = dec
+	return nil
+}
+
+// MarshalText encodes the envelope as "imgh:" followed by the
+// unpadded URL-safe base64 form of its binary encoding.
+func (e Envelope) MarshalText() ([]byte, error) {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(envelopeTextPrefix)+base64.RawURLEncoding.EncodedLen(len(data)))
+	copy(out, envelopeTextPrefix)
+	base64.RawURLEncoding.Encode(out[len(envelopeTextPrefix):], data)
+	return out, nil
+}
+
+// UnmarshalText decodes an envelope produced by MarshalText.
+func (e *Envelope) UnmarshalText(text []byte) error {
+	s, ok := strings.CutPrefix(string(text), envelopeTextPrefix)
+	if !ok {
+		return fmt.Errorf("%w: missing %q prefix", ErrInvalidEncoding, envelopeTextPrefix)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEncoding, err)
+	}
+	return e.UnmarshalBinary(data)
+}
+
+type envelopeJSON struct {
+	Kind      string            `json:"kind"`
+	Algorithm string            `json:"algorithm,omitempty"`
+	Version   uint              `json:"version,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Hash      string            `json:"hash"`
+}
+
+// MarshalJSON encodes the envelope as a JSON object with the kind,
+// algorithm, version, params and the hash payload in its text form.
+func (e Envelope) MarshalJSON() ([]byte, error) {
+	kind := e.Kind()
+	if !kind.valid() {
+		return nil, fmt.Errorf("%w: unsupported hash type %T", ErrInvalidEncoding, e.Hash)
+	}
+	if err := checkParts(e.Hash); err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelopeJSON{
+		Kind:      kind.String(),
+		Algorithm: e.Algorithm,
+		Version:   e.Version,
+		Params:    e.Params,
+		Hash:      formatPayload(e.Hash),
+	})
+}
+
+// UnmarshalJSON decodes an envelope produced by MarshalJSON.
+func (e *Envelope) UnmarshalJSON(data []byte) error {
+	var v envelopeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	kind, err := ParseKind(v.Kind)
+	if err != nil {
+		return err
+	}
+	h, err := parsePayload(kind, v.Hash)
+	if err != nil {
+		return err
+	}
+	*e = Envelope{Algorithm: v.Algorithm, Version: v.Version, Params: v.Params, Hash: h}
+	return nil
+}
+
+// Decode reconstructs a hash of the correct concrete type from any
+// binary or text encoding produced by this package, including envelopes.
+func Decode(data []byte) (Hash, error) {
+	e, err := DecodeEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	return e.Hash, nil
+}
+
+// DecodeEnvelope decodes any binary or text encoding produced by this
+// package. Plain hash encodings yield an envelope without algorithm metadata.
+func DecodeEnvelope(data []byte) (Envelope, error) {
+	var e Envelope
+	switch {
+	case bytes.HasPrefix(data, []byte(wireMagic)):
+		err := e.UnmarshalBinary(data)
+		return e, err
+	case bytes.HasPrefix(data, []byte(envelopeTextPrefix)):
+		err := e.UnmarshalText(data)
+		return e, err
+	}
+	h, err := parseText(string(data))
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{Hash: h}, nil
+}
+
+func marshalWire(e Envelope) ([]byte, error) {
+	kind := e.Kind()
+	if !kind.valid() {
+		return nil, fmt.Errorf("%w: unsupported hash type %T", ErrInvalidEncoding, e.Hash)
+	}
+	var flags byte
+	if e.Algorithm != "" || e.Version != 0 || len(e.Params) > 0 {
+		flags |= wireFlagMetadata
+	}
+	if err := checkParts(e.Hash); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, 16+e.Hash.Len()*8)
+	buf = append(buf, wireMagic...)
+	buf = append(buf, wireVersion, byte(kind), flags)
+	if flags&wireFlagMetadata != 0 {
+		buf = appendString(buf, e.Algorithm)
+		buf = binary.AppendUvarint(buf, uint64(e.Version))
+		keys := make([]string, 0, len(e.Params))
+		for k := range e.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf = binary.AppendUvarint(buf, uint64(len(keys)))
+		for _, k := range keys {
+			buf = appendString(buf, k)
+			buf = appendString(buf, e.Params[k])
+		}
+	}
+	return appendPayload(buf, e.Hash), nil
+}
+
+// appendPayload appends the element count and payload of h.
+func appendPayload(buf []byte, h Hash) []byte {
+	switch v := h.(type) {
+	case Binary:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		buf = append(buf, v...)
+	case UInt8:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		buf = append(buf, v...)
+	case Float64:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		for _, f := range v {
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(f))
+		}
+	case Composite:
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		for _, p := range v {
+			buf = append(buf, byte(KindOf(p)))
+			buf = appendPayload(buf, p)
+		}
+	}
+	return buf
+}
+
+// checkParts reports an error if h is a Composite with a part that is not
+// a Binary, UInt8 or Float64 hash.
+func checkParts(h Hash) error {
+	c, ok := h.(Composite)
+	if !ok {
+		return nil
+	}
+	for i, p := range c {
+		if k := KindOf(p); !k.valid() || k == KindComposite {
+			return fmt.Errorf("%w: unsupported composite part %d of type %T", ErrInvalidEncoding, i, p)
+		}
+	}
+	return nil
+}
+
+func unmarshalWire(data []byte) (Envelope, error) {
+	if !bytes.HasPrefix(data, []byte(wireMagic)) || len(data) < len(wireMagic)+3 {
+		return Envelope{}, fmt.Errorf("%w: missing header", ErrInvalidEncoding)
+	}
+	data = data[len(wireMagic):]
+	if data[0] != wireVersion {
+		return Envelope{}, fmt.Errorf("%w: %d", ErrUnsupportedEncoding, data[0])
+	}
+	kind, flags := Kind(data[1]), data[2]
+	if !kind.valid() {
+		return Envelope{}, fmt.Errorf("%w: unknown hash kind %d", ErrInvalidEncoding, data[1])
+	}
+	r := wireReader{buf: data[3:]}
+	var e Envelope
+	if flags&wireFlagMetadata != 0 {
+		e.Algorithm = r.string()
+		e.Version = uint(r.uvarint())
+		n := r.uvarint()
+		if n > uint64(len(r.buf)) {
+			return Envelope{}, fmt.Errorf("%w: truncated params", ErrInvalidEncoding)
+		}
+		if n > 0 {
+			e.Params = make(map[string]string, n)
+		}
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			k := r.string()
+			e.Params[k] = r.string()
+		}
+	}
+	if r.err != nil {
+		return Envelope{}, r.err
+	}
+	e.Hash = r.payload(kind)
+	if r.err != nil {
+		return Envelope{}, r.err
+	}
+	if len(r.buf) != 0 {
+		return Envelope{}, fmt.Errorf("%w: payload length mismatch", ErrInvalidEncoding)
+	}
+	return e, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// wireReader sequentially consumes varint-prefixed fields and records
+// the first error so callers can check once after a run of reads.
+type wireReader struct {
+	buf []byte
+	err error
+}
+
+func (r *wireReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = fmt.Errorf("%w: malformed varint", ErrInvalidEncoding)
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+// payload reads the element count and payload of a hash of the given kind.
+func (r *wireReader) payload(kind Kind) Hash {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	size := n
+	if kind == KindFloat64 {
+		size = n * 8
+	}
+	if n > uint64(len(r.buf)) || size > uint64(len(r.buf)) {
+		r.err = fmt.Errorf("%w: payload length mismatch", ErrInvalidEncoding)
+		return nil
+	}
+	switch kind {
+	case KindBinary:
+		h := Binary(bytes.Clone(r.buf[:n]))
+		r.buf = r.buf[n:]
+		return h
+	case KindUInt8:
+		h := UInt8(bytes.Clone(r.buf[:n]))
+		r.buf = r.buf[n:]
+		return h
+	case KindFloat64:
+		h := make(Float64, n)
+		for i := range h {
+			h[i] = math.Float64frombits(binary.BigEndian.Uint64(r.buf[i*8:]))
+		}
+		r.buf = r.buf[size:]
+		return h
+	case KindComposite:
+		h := make(Composite, n)
+		for i := range h {
+			if len(r.buf) == 0 {
+				r.err = fmt.Errorf("%w: truncated composite", ErrInvalidEncoding)
+				return nil
+			}
+			part := Kind(r.buf[0])
+			if !part.valid() || part == KindComposite {
+				r.err = fmt.Errorf("%w: invalid composite part kind %d", ErrInvalidEncoding, r.buf[0])
+				return nil
+			}
+			r.buf = r.buf[1:]
+			if h[i] = r.payload(part); r.err != nil {
+				return nil
+			}
+		}
+		return h
+	}
+	r.err = fmt.Errorf("%w: unknown hash kind %d", ErrInvalidEncoding, kind)
+	return nil
+}
+
+func (r *wireReader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = fmt.Errorf("%w: truncated string", ErrInvalidEncoding)
+		return ""
+	}
+	s := string(r.buf[:n])
+	r.buf = r.buf[n:]
+	return s
+}
+
+// unmarshalKind decodes binary data and checks that it holds the wanted kind.
+func unmarshalKind(data []byte, want Kind) (Hash, error) {
+	e, err := unmarshalWire(data)
+	if err != nil {
+		return nil, err
+	}
+	if e.Kind() != want {
+		return nil, fmt.Errorf("%w: got %v, want %v", ErrKindMismatch, e.Kind(), want)
+	}
+	return e.Hash, nil
+}
+
+// Text form of plain hashes: "<kind>:<payload>". Binary and UInt8
+// payloads are lowercase hex, Float64 payloads are comma-separated
+// shortest round-trip decimal values, and Composite payloads are the text
+// forms of the parts separated by semicolons.
+
+func marshalText(h Hash) []byte {
+	return []byte(KindOf(h).String() + ":" + formatPayload(h))
+}
+
+// unmarshalTextKind parses a text form and checks that it holds the wanted kind.
+func unmarshalTextKind(text []byte, want Kind) (Hash, error) {
+	h, err := parseText(string(text))
+	if err != nil {
+		return nil, err
+	}
+	if got := KindOf(h); got != want {
+		return nil, fmt.Errorf("%w: got %v, want %v", ErrKindMismatch, got, want)
+	}
+	return h, nil
+}
+
+func parseText(s string) (Hash, error) {
+	name, payload, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing kind prefix", ErrInvalidEncoding)
+	}
+	kind, err := ParseKind(name)
+	if err != nil {
+		return nil, err
+	}
+	return parsePayload(kind, payload)
+}
+
+func formatPayload(h Hash) string {
+	switch v := h.(type) {
+	case Binary:
+		return hex.EncodeToString(v)
+	case UInt8:
+		return hex.EncodeToString(v)
+	case Float64:
+		var sb strings.Builder
+		for i, f := range v {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+		return sb.String()
+	case Composite:
+		parts := make([]string, len(v))
+		for i, p := range v {
+			parts[i] = string(marshalText(p))
+		}
+		return strings.Join(parts, ";")
+	default:
+		return ""
+	}
+}
+
+func parsePayload(kind Kind, s string) (Hash, error) {
+	switch kind {
+	case KindBinary, KindUInt8:
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEncoding, err)
+		}
+		if kind == KindBinary {
+			return Binary(b), nil
+		}
+		return UInt8(b), nil
+	case KindFloat64:
+		if s == "" {
+			return Float64{}, nil
+		}
+		parts := strings.Split(s, ",")
+		h := make(Float64, len(parts))
+		for i, p := range parts {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidEncoding, err)
+			}
+			h[i] = v
+		}
+		return h, nil
+	case KindComposite:
+		if s == "" {
+			return Composite{}, nil
+		}
+		parts := strings.Split(s, ";")
+		h := make(Composite, len(parts))
+		for i, p := range parts {
+			part, err := parseText(p)
+			if err != nil {
+				return nil, err
+			}
+			if KindOf(part) == KindComposite {
+				return nil, fmt.Errorf("%w: nested composite", ErrInvalidEncoding)
+			}
+			h[i] = part
+		}
+		return h, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown hash kind %d", ErrInvalidEncoding, kind)
+	}
+}
+
+// marshalJSON encodes a plain hash as a JSON string holding its text form.
+func marshalJSON(h Hash) ([]byte, error) {
+	return json.Marshal(string(marshalText(h)))
+}
+
+// unmarshalJSONKind decodes a JSON string holding a text form of the wanted kind.
+func unmarshalJSONKind(data []byte, want Kind) (Hash, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return unmarshalTextKind([]byte(s), want)
+}
@@ -0,0 +1,329 @@
+package hashtype_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+var encodingHashes = []struct {
+	name string
+	hash hashtype.Hash
+	text string
+}{
+	{"binary", hashtype.Binary{0x0c, 0xc8, 0xff}, "binary:0cc8ff"},
+	{"empty binary", hashtype.Binary{}, "binary:"},
+	{"uint8", hashtype.UInt8{140, 97, 12}, "uint8:8c610c"},
+	{"float64", hashtype.Float64{0, -1.5, 3.141592653589793, 1e-17}, "float64:0,-1.5,3.141592653589793,1e-17"},
+	{"empty float64", hashtype.Float64{}, "float64:"},
+	{"composite", hashtype.Composite{hashtype.Binary{0x0c, 0xc8}, hashtype.Float64{0.5, 2}, hashtype.UInt8{}}, "composite:binary:0cc8;float64:0.5,2;uint8:"},
+	{"empty composite", hashtype.Composite{}, "composite:"},
+}
+
+func hashEqual(a, b hashtype.Hash) bool {
+	switch v := a.(type) {
+	case hashtype.Binary:
+		w, ok := b.(hashtype.Binary)
+		return ok && v.Equal(w)
+	case hashtype.UInt8:
+		w, ok := b.(hashtype.UInt8)
+		return ok && v.Equal(w)
+	case hashtype.Float64:
+		w, ok := b.(hashtype.Float64)
+		return ok && v.Equal(w)
+	case hashtype.Composite:
+		w, ok := b.(hashtype.Composite)
+		if !ok || len(v) != len(w) {
+			return false
+		}
+		for i := range v {
+			if !hashEqual(v[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func TestEncoding_roundTrip(t *testing.T) {
+	for _, tt := range encodingHashes {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, err := tt.hash.(interface{ MarshalBinary() ([]byte, error) }).MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+			got, err := hashtype.Decode(bin)
+			if err != nil {
+				t.Fatalf("Decode binary: %v", err)
+			}
+			if !hashEqual(tt.hash, got) {
+				t.Errorf("binary round trip: got %v, want %v", got, tt.hash)
+			}
+
+			txt, err := tt.hash.(interface{ MarshalText() ([]byte, error) }).MarshalText()
+			if err != nil {
+				t.Fatalf("MarshalText: %v", err)
+			}
+			if string(txt) != tt.text {
+				t.Errorf("text: got %q, want %q", txt, tt.text)
+			}
+			got, err = hashtype.Decode(txt)
+			if err != nil {
+				t.Fatalf("Decode text: %v", err)
+			}
+			if !hashEqual(tt.hash, got) {
+				t.Errorf("text round trip: got %v, want %v", got, tt.hash)
+			}
+		})
+	}
+}
+
+func TestEncoding_json(t *testing.T) {
+	type record struct {
+		B hashtype.Binary  `json:"b"`
+		U hashtype.UInt8   `json:"u"`
+		F hashtype.Float64 `json:"f"`
+	}
+	in := record{
+		B: hashtype.Binary{1, 2, 255},
+		U: hashtype.UInt8{3, 4},
+		F: hashtype.Float64{0.25, math.Inf(1)},
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"b":"binary:0102ff","u":"uint8:0304","f":"float64:0.25,+Inf"}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	var out record
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !out.B.Equal(in.B) || !out.U.Equal(in.U) || out.F[0] != 0.25 || !math.IsInf(out.F[1], 1) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestEncoding_kindMismatch(t *testing.T) {
+	bin, err := hashtype.UInt8{1, 2}.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var b hashtype.Binary
+	if err := b.UnmarshalBinary(bin); !errors.Is(err, hashtype.ErrKindMismatch) {
+		t.Errorf("UnmarshalBinary: got %v, want %v", err, hashtype.ErrKindMismatch)
+	}
+	var f hashtype.Float64
+	if err := f.UnmarshalText([]byte("binary:00")); !errors.Is(err, hashtype.ErrKindMismatch) {
+		t.Errorf("UnmarshalText: got %v, want %v", err, hashtype.ErrKindMismatch)
+	}
+	var u hashtype.UInt8
+	if err := u.UnmarshalJSON([]byte(`"float64:1"`)); !errors.Is(err, hashtype.ErrKindMismatch) {
+		t.Errorf("UnmarshalJSON: got %v, want %v", err, hashtype.ErrKindMismatch)
+	}
+}
+
+var decodeErrorTests = []struct {
+	name   string
+	data   []byte
+	expect error
+}{
+	{"empty", []byte{}, hashtype.ErrInvalidEncoding},
+	{"no kind prefix", []byte("0cc8"), hashtype.ErrInvalidEncoding},
+	{"unknown kind", []byte("int16:00"), hashtype.ErrInvalidEncoding},
+	{"bad hex", []byte("binary:zz"), hashtype.ErrInvalidEncoding},
+	{"bad float", []byte("float64:1,x"), hashtype.ErrInvalidEncoding},
+	{"header only", []byte("IMGH"), hashtype.ErrInvalidEncoding},
+	{"future version", []byte("IMGH\x09\x01\x00\x00"), hashtype.ErrUnsupportedEncoding},
+	{"bad kind byte", []byte("IMGH\x01\x07\x00\x00"), hashtype.ErrInvalidEncoding},
+	{"truncated payload", []byte("IMGH\x01\x01\x00\x04\x01\x02"), hashtype.ErrInvalidEncoding},
+	{"trailing payload", []byte("IMGH\x01\x01\x00\x01\x01\x02"), hashtype.ErrInvalidEncoding},
+	{"truncated float", []byte("IMGH\x01\x03\x00\x01\x00\x00\x00"), hashtype.ErrInvalidEncoding},
+	{"truncated metadata", []byte("IMGH\x01\x01\x01\x05ab"), hashtype.ErrInvalidEncoding},
+	{"huge param count", []byte("IMGH\x01\x01\x01\x00\x00\xff\xff\x03"), hashtype.ErrInvalidEncoding},
+	{"bad envelope base64", []byte("imgh:***"), hashtype.ErrInvalidEncoding},
+	{"nested composite text", []byte("composite:composite:"), hashtype.ErrInvalidEncoding},
+	{"bad composite part", []byte("composite:binary:00;x"), hashtype.ErrInvalidEncoding},
+	{"nested composite part", []byte("IMGH\x01\x04\x00\x01\x04\x00"), hashtype.ErrInvalidEncoding},
+	{"bad composite part kind", []byte("IMGH\x01\x04\x00\x01\x09\x00"), hashtype.ErrInvalidEncoding},
+	{"truncated composite", []byte("IMGH\x01\x04\x00\x02\x01\x01\xff"), hashtype.ErrInvalidEncoding},
+	{"trailing composite", []byte("IMGH\x01\x04\x00\x01\x01\x00\x00"), hashtype.ErrInvalidEncoding},
+}
+
+func TestDecode_errors(t *testing.T) {
+	for _, tt := range decodeErrorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := hashtype.Decode(tt.data); !errors.Is(err, tt.expect) {
+				t.Errorf("got %v, want %v", err, tt.expect)
+			}
+		})
+	}
+}
+
+func TestEnvelope_roundTrip(t *testing.T) {
+	env := hashtype.Envelope{
+		Algorithm: "pdq",
+		Version:   1,
+		Params:    map[string]string{"interpolation": "Bilinear", "size": "64x64"},
+		Hash:      hashtype.Binary{0xbf, 0x00, 0x7b},
+	}
+	check := func(t *testing.T, got hashtype.Envelope) {
+		t.Helper()
+		if got.Algorithm != env.Algorithm || got.Version != env.Version {
+			t.Errorf("got %s v%d, want %s v%d", got.Algorithm, got.Version, env.Algorithm, env.Version)
+		}
+		if len(got.Params) != len(env.Params) {
+			t.Fatalf("got params %v, want %v", got.Params, env.Params)
+		}
+		for k, v := range env.Params {
+			if got.Params[k] != v {
+				t.Errorf("param %s: got %q, want %q", k, got.Params[k], v)
+			}
+		}
+		if got.Kind() != hashtype.KindBinary || !hashEqual(env.Hash, got.Hash) {
+			t.Errorf("got hash %v, want %v", got.Hash, env.Hash)
+		}
+	}
+
+	t.Run("binary", func(t *testing.T) {
+		data, err := env.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		got, err := hashtype.DecodeEnvelope(data)
+		if err != nil {
+			t.Fatalf("DecodeEnvelope: %v", err)
+		}
+		check(t, got)
+
+		var b hashtype.Binary
+		if err := b.UnmarshalBinary(data); err != nil || !b.Equal(env.Hash.(hashtype.Binary)) {
+			t.Errorf("plain decode: got %v, %v", b, err)
+		}
+	})
+	t.Run("text", func(t *testing.T) {
+		data, err := env.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText: %v", err)
+		}
+		got, err := hashtype.DecodeEnvelope(data)
+		if err != nil {
+			t.Fatalf("DecodeEnvelope: %v", err)
+		}
+		check(t, got)
+	})
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(env)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		want := `{"kind":"binary","algorithm":"pdq","version":1,"params":{"interpolation":"Bilinear","size":"64x64"},"hash":"bf007b"}`
+		if string(data) != want {
+			t.Errorf("got %s, want %s", data, want)
+		}
+		var got hashtype.Envelope
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		check(t, got)
+	})
+}
+
+func TestEnvelope_stableBinary(t *testing.T) {
+	env := hashtype.Envelope{
+		Algorithm: "phash",
+		Version:   1,
+		Params:    map[string]string{"size": "32x32", "interpolation": "BilinearExact"},
+		Hash:      hashtype.Binary{1, 2, 3, 4, 5, 6, 7, 8},
+	}
+	data, err := env.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	want := "IMGH\x01\x01\x01\x05phash\x01\x02\x0dinterpolation\x0dBilinearExact\x04size\x0532x32\x08\x01\x02\x03\x04\x05\x06\x07\x08"
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+}
+
+func TestEnvelope_unsupportedHash(t *testing.T) {
+	if _, err := (hashtype.Envelope{}).MarshalBinary(); !errors.Is(err, hashtype.ErrInvalidEncoding) {
+		t.Errorf("got %v, want %v", err, hashtype.ErrInvalidEncoding)
+	}
+}
+
+func TestComposite(t *testing.T) {
+	h := hashtype.Composite{hashtype.Binary{0xf0}, hashtype.UInt8{7, 9}}
+	if got, want := h.String(), "[[240] [7 9]]"; got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+	if h.Len() != 3 {
+		t.Errorf("Len: got %d, want 3", h.Len())
+	}
+	if got := []float64{h.ValueAt(0), h.ValueAt(1), h.ValueAt(2)}; got[0] != 240 || got[1] != 7 || got[2] != 9 {
+		t.Errorf("ValueAt: got %v, want [240 7 9]", got)
+	}
+	if hashtype.KindOf(h) != hashtype.KindComposite {
+		t.Errorf("KindOf: got %v, want %v", hashtype.KindOf(h), hashtype.KindComposite)
+	}
+
+	bin, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	want := "IMGH\x01\x04\x00\x02\x01\x01\xf0\x02\x02\x07\x09"
+	if string(bin) != want {
+		t.Errorf("MarshalBinary: got %q, want %q", bin, want)
+	}
+	var got hashtype.Composite
+	if err := got.UnmarshalBinary(bin); err != nil || !hashEqual(h, got) {
+		t.Errorf("UnmarshalBinary: got %v, %v", got, err)
+	}
+	if err := got.UnmarshalJSON([]byte(`"binary:00"`)); !errors.Is(err, hashtype.ErrKindMismatch) {
+		t.Errorf("UnmarshalJSON: got %v, want %v", err, hashtype.ErrKindMismatch)
+	}
+
+	for _, bad := range []hashtype.Composite{{hashtype.Composite{}}, {nil}} {
+		if _, err := bad.MarshalBinary(); !errors.Is(err, hashtype.ErrInvalidEncoding) {
+			t.Errorf("MarshalBinary(%v): got %v, want %v", bad, err, hashtype.ErrInvalidEncoding)
+		}
+		if _, err := bad.MarshalText(); !errors.Is(err, hashtype.ErrInvalidEncoding) {
+			t.Errorf("MarshalText(%v): got %v, want %v", bad, err, hashtype.ErrInvalidEncoding)
+		}
+	}
+}
+
+func ExampleDecode() {
+	data, err := hashtype.Float64{0.5, 2}.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	hash, err := hashtype.Decode(data)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%T %v\n", hash, hash)
+	// Output: hashtype.Float64 [0.5 2]
+}
+
+func ExampleEnvelope_MarshalJSON() {
+	env := hashtype.Envelope{
+		Algorithm: "average",
+		Version:   1,
+		Params:    map[string]string{"size": "8x8"},
+		Hash:      hashtype.Binary{255, 255, 15, 7, 1, 0, 0, 0},
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(data))
+	// Output: {"kind":"binary","algorithm":"average","version":1,"params":{"size":"8x8"},"hash":"ffff0f0701000000"}
+}
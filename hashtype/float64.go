@@ -45,3 +45,51 @@ func (h Float64) Equal(fh Float64) bool {
 	}
 	return true
 }
+
+// MarshalBinary encodes the hash in the self-describing binary wire format.
+func (h Float64) MarshalBinary() ([]byte, error) {
+	return marshalWire(Envelope{Hash: h})
+}
+
+// UnmarshalBinary decodes a hash produced by MarshalBinary.
+// Encodings of other hash kinds are rejected with ErrKindMismatch.
+func (h *Float64) UnmarshalBinary(data []byte) error {
+	v, err := unmarshalKind(data, KindFloat64)
+	if err != nil {
+		return err
+	}
+	*h = v.(Float64)
+	return nil
+}
+
+// MarshalText encodes the hash as "float64:" followed by comma-separated
+// values in their shortest round-trip decimal form.
+func (h Float64) MarshalText() ([]byte, error) {
+	return marshalText(h), nil
+}
+
+// UnmarshalText decodes a hash produced by MarshalText.
+// Encodings of other hash kinds are rejected with ErrKindMismatch.
+func (h *Float64) UnmarshalText(text []byte) error {
+	v, err := unmarshalTextKind(text, KindFloat64)
+	if err != nil {
+		return err
+	}
+	*h = v.(Float64)
+	return nil
+}
+
+// MarshalJSON encodes the hash as a JSON string holding its text form.
+func (h Float64) MarshalJSON() ([]byte, error) {
+	return marshalJSON(h)
+}
+
+// UnmarshalJSON decodes a hash produced by MarshalJSON.
+func (h *Float64) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalJSONKind(data, KindFloat64)
+	if err != nil {
+		return err
+	}
+	*h = v.(Float64)
+	return nil
+}
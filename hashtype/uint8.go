@@ -42,3 +42,50 @@ func (h UInt8) Equal(uh UInt8) bool {
 	}
 	return true
 }
+
+// MarshalBinary encodes the hash in the self-describing binary wire format.
+func (h UInt8) MarshalBinary() ([]byte, error) {
+	return marshalWire(Envelope{Hash: h})
+}
+
+// UnmarshalBinary decodes a hash produced by MarshalBinary.
+// Encodings of other hash kinds are rejected with ErrKindMismatch.
+func (h *UInt8) UnmarshalBinary(data []byte) error {
+	v, err := unmarshalKind(data, KindUInt8)
+	if err != nil {
+		return err
+	}
+	*h = v.(UInt8)
+	return nil
+}
+
+// MarshalText encodes the hash as "uint8:" followed by lowercase hex.
+func (h UInt8) MarshalText() ([]byte, error) {
+	return marshalText(h), nil
+}
+
+// UnmarshalText decodes a hash produced by MarshalText.
+// Encodings of other hash kinds are rejected with ErrKindMismatch.
+func (h *UInt8) UnmarshalText(text []byte) error {
+	v, err := unmarshalTextKind(text, KindUInt8)
+	if err != nil {
+		return err
+	}
+	*h = v.(UInt8)
+	return nil
+}
+
+// MarshalJSON encodes the hash as a JSON string holding its text form.
+func (h UInt8) MarshalJSON() ([]byte, error) {
+	return marshalJSON(h)
+}
+
+// UnmarshalJSON decodes a hash produced by MarshalJSON.
+func (h *UInt8) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalJSONKind(data, KindUInt8)
+	if err != nil {
+		return err
+	}
+	*h = v.(UInt8)
+	return nil
+}
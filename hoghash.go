@@ -5,7 +5,6 @@ import (
 	"math"
 
 	"github.com/ajdnik/imghash/v2/hashtype"
-	"github.com/ajdnik/imghash/v2/internal/imgproc"
 	"github.com/ajdnik/imghash/v2/similarity"
 )
 
@@ -31,7 +30,7 @@ type HOGHash struct {
 // Without options, sensible defaults are used.
 func NewHOGHash(opts ...HOGHashOption) (HOGHash, error) {
 	h := HOGHash{
-		baseConfig: baseConfig{width: 256, height: 256, interp: Bilinear},
+		baseConfig: baseConfig{width: 256, height: 256, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 		cellSize:   8,
 		numBins:    9,
 	}
@@ -52,15 +51,33 @@ func NewHOGHash(opts ...HOGHashOption) (HOGHash, error) {
 
 // Calculate returns a perceptual image hash.
 func (hh HOGHash) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(hh.width, hh.height, img, hh.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return hh.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a UInt8 hash with enough capacity. See IntoHasher.
+func (hh HOGHash) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return hh.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (hh HOGHash) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return hh.calculate(nil, prep)
+}
+
+func (hh HOGHash) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(hh.alphaPolicy).cropBorders(hh.border)
+	g, err := prep.ResizedGray(hh.width, hh.height, hh.interp)
 	if err != nil {
 		return nil, err
 	}
 	bounds := g.Bounds()
 	w, h := bounds.Dx(), bounds.Dy()
 	mag, orient := hh.computeGradients(g, w, h)
-	return hh.computeHash(mag, orient, w, h), nil
+	return hh.computeHash(dst, mag, orient, w, h), nil
 }
 
 // computeGradients computes gradient magnitude and unsigned orientation
@@ -103,7 +120,7 @@ func (hh HOGHash) computeGradients(img *image.Gray, w, h int) ([]float64, []floa
 
 // computeHash builds a UInt8 hash from the gradient data by computing
 // magnitude-weighted orientation histograms for each cell.
-func (hh HOGHash) computeHash(mag, orient []float64, w, h int) hashtype.UInt8 {
+func (hh HOGHash) computeHash(dst hashtype.Hash, mag, orient []float64, w, h int) hashtype.UInt8 {
 	cs := int(hh.cellSize)
 	nb := int(hh.numBins)
 	cellsX := w / cs
@@ -116,7 +133,7 @@ func (hh HOGHash) computeHash(mag, orient []float64, w, h int) hashtype.UInt8 {
 	}
 
 	binWidth := 180.0 / float64(nb)
-	hash := make(hashtype.UInt8, cellsX*cellsY*nb)
+	hash := hashInto[hashtype.UInt8](dst, cellsX*cellsY*nb)
 
 	for cy := 0; cy < cellsY; cy++ {
 		for cx := 0; cx < cellsX; cx++ {
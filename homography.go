@@ -0,0 +1,235 @@
+package imghash
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// Homography is a projective transform of the plane, stored as a 3x3
+// matrix in row-major order. It maps (x, y) to (x', y') with
+//
+//	x' = (H[0]x + H[1]y + H[2]) / (H[6]x + H[7]y + H[8])
+//	y' = (H[3]x + H[4]y + H[5]) / (H[6]x + H[7]y + H[8])
+type Homography [9]float64
+
+// Apply maps the point (x, y). It reports false when the point is mapped
+// to infinity.
+func (h Homography) Apply(x, y float64) (float64, float64, bool) {
+	w := h[6]*x + h[7]*y + h[8]
+	if math.Abs(w) < 1e-12 {
+		return 0, 0, false
+	}
+	return (h[0]*x + h[1]*y + h[2]) / w, (h[3]*x + h[4]*y + h[5]) / w, true
+}
+
+// mul returns the matrix product h * g.
+func (h Homography) mul(g Homography) Homography {
+	var r Homography
+	for i := range 3 {
+		for j := range 3 {
+			for k := range 3 {
+				r[3*i+j] += h[3*i+k] * g[3*k+j]
+			}
+		}
+	}
+	return r
+}
+
+// RANSAC parameters. The seed keeps matching deterministic.
+const (
+	ransacConfidence = 0.995
+	ransacSeed       = 0x9E3779B97F4A7C15
+)
+
+// ransacHomography estimates the homography mapping src onto dst with
+// RANSAC, refining the best model on its inliers by least squares. It
+// returns the homography and the inlier mask, or a nil mask when no
+// homography could be estimated.
+func ransacHomography(src, dst [][2]float64, threshold float64, iterations int) (Homography, []bool) {
+	n := len(src)
+	if n < 4 {
+		return Homography{}, nil
+	}
+	rng := rand.New(rand.NewPCG(ransacSeed, uint64(n)))
+	t2 := threshold * threshold
+	var best Homography
+	bestCount := 0
+	mask := make([]bool, n)
+	var sample [4]int
+	for it := 0; it < iterations; it++ {
+		for i := range sample {
+			for {
+				sample[i] = rng.IntN(n)
+				if !slices.Contains(sample[:i], sample[i]) {
+					break
+				}
+			}
+		}
+		var s, d [4][2]float64
+		for i, k := range sample {
+			s[i], d[i] = src[k], dst[k]
+		}
+		if collinear(s[:]) || collinear(d[:]) {
+			continue
+		}
+		h, ok := fitHomography(s[:], d[:])
+		if !ok {
+			continue
+		}
+		if count := countInliers(h, src, dst, t2, mask); count > bestCount {
+			best, bestCount = h, count
+			// Stop once a better model is unlikely to exist.
+			w := float64(count) / float64(n)
+			if need := math.Log(1-ransacConfidence) / math.Log(1-w*w*w*w); w == 1 || float64(it+1) >= need {
+				break
+			}
+		}
+	}
+	if bestCount < 4 {
+		return Homography{}, nil
+	}
+	countInliers(best, src, dst, t2, mask)
+	var is, id [][2]float64
+	for i, in := range mask {
+		if in {
+			is, id = append(is, src[i]), append(id, dst[i])
+		}
+	}
+	refined := make([]bool, n)
+	if h, ok := fitHomography(is, id); ok && countInliers(h, src, dst, t2, refined) >= bestCount {
+		return h, refined
+	}
+	return best, mask
+}
+
+// countInliers marks the pairs that h maps within a squared distance of
+// t2 of each other and returns how many there are.
+func countInliers(h Homography, src, dst [][2]float64, t2 float64, mask []bool) int {
+	count := 0
+	for i := range src {
+		x, y, ok := h.Apply(src[i][0], src[i][1])
+		dx, dy := x-dst[i][0], y-dst[i][1]
+		mask[i] = ok && dx*dx+dy*dy <= t2
+		if mask[i] {
+			count++
+		}
+	}
+	return count
+}
+
+// collinear reports whether any three of the points lie on a line.
+func collinear(p [][2]float64) bool {
+	for i := range p {
+		for j := i + 1; j < len(p); j++ {
+			for k := j + 1; k < len(p); k++ {
+				dx1, dy1 := p[j][0]-p[i][0], p[j][1]-p[i][1]
+				dx2, dy2 := p[k][0]-p[i][0], p[k][1]-p[i][1]
+				if math.Abs(dx1*dy2-dy1*dx2) <= 1e-6*(math.Abs(dx1)+math.Abs(dy1)+math.Abs(dx2)+math.Abs(dy2)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// fitHomography returns the least-squares homography mapping src onto dst
+// for four or more point pairs, using the direct linear transform on
+// normalised coordinates with the last matrix element fixed to one.
+func fitHomography(src, dst [][2]float64) (Homography, bool) {
+	ts, _ := normalizing(src)
+	td, tdInv := normalizing(dst)
+	// Normal equations A^T A h = A^T b of the 2n x 8 system.
+	var ata [8][8]float64
+	var atb [8]float64
+	for i := range src {
+		x, y, _ := ts.Apply(src[i][0], src[i][1])
+		u, v, _ := td.Apply(dst[i][0], dst[i][1])
+		rows := [2][8]float64{
+			{x, y, 1, 0, 0, 0, -u * x, -u * y},
+			{0, 0, 0, x, y, 1, -v * x, -v * y},
+		}
+		rhs := [2]float64{u, v}
+		for r, row := range rows {
+			for j := range row {
+				atb[j] += row[j] * rhs[r]
+				for k := range row {
+					ata[j][k] += row[j] * row[k]
+				}
+			}
+		}
+	}
+	sol, ok := solve8(ata, atb)
+	if !ok {
+		return Homography{}, false
+	}
+	hn := Homography{sol[0], sol[1], sol[2], sol[3], sol[4], sol[5], sol[6], sol[7], 1}
+	h := tdInv.mul(hn).mul(ts)
+	if math.Abs(h[8]) < 1e-12 {
+		return Homography{}, false
+	}
+	for i := range h {
+		h[i] /= h[8]
+	}
+	return h, true
+}
+
+// normalizing returns the similarity transform that moves the centroid of
+// the points to the origin and their mean distance from it to sqrt(2),
+// and its inverse.
+func normalizing(p [][2]float64) (Homography, Homography) {
+	var cx, cy float64
+	for _, q := range p {
+		cx += q[0]
+		cy += q[1]
+	}
+	cx /= float64(len(p))
+	cy /= float64(len(p))
+	var d float64
+	for _, q := range p {
+		d += math.Hypot(q[0]-cx, q[1]-cy)
+	}
+	d /= float64(len(p))
+	s := 1.0
+	if d > 0 {
+		s = math.Sqrt2 / d
+	}
+	return Homography{s, 0, -s * cx, 0, s, -s * cy, 0, 0, 1},
+		Homography{1 / s, 0, cx, 0, 1 / s, cy, 0, 0, 1}
+}
+
+// solve8 solves the 8x8 linear system a x = b by Gaussian elimination with
+// partial pivoting. It reports false when a is singular.
+func solve8(a [8][8]float64, b [8]float64) ([8]float64, bool) {
+	const n = 8
+	for c := range n {
+		p := c
+		for r := c + 1; r < n; r++ {
+			if math.Abs(a[r][c]) > math.Abs(a[p][c]) {
+				p = r
+			}
+		}
+		if math.Abs(a[p][c]) < 1e-12 {
+			return [8]float64{}, false
+		}
+		a[c], a[p] = a[p], a[c]
+		b[c], b[p] = b[p], b[c]
+		for r := c + 1; r < n; r++ {
+			f := a[r][c] / a[c][c]
+			for k := c; k < n; k++ {
+				a[r][k] -= f * a[c][k]
+			}
+			b[r] -= f * b[c]
+		}
+	}
+	var x [8]float64
+	for r := n - 1; r >= 0; r-- {
+		s := b[r]
+		for k := r + 1; k < n; k++ {
+			s -= a[r][k] * x[k]
+		}
+		x[r] = s / a[r][r]
+	}
+	return x, true
+}
@@ -36,6 +36,39 @@ type HasherComparer interface {
 	Comparer
 }
 
+// HammingComparer is implemented by comparers that can measure the
+// Hamming distance between Binary hashes. Search structures that look up
+// hashes by Hamming distance, such as the indexes of the index package,
+// find every match of a comparer for which ComparesHamming reports true.
+type HammingComparer interface {
+	Comparer
+	// ComparesHamming reports whether Compare returns the Hamming distance.
+	// It is false when the comparer is configured with another metric,
+	// for instance through WithDistance or WithWeights.
+	ComparesHamming() bool
+}
+
+// ComparesHamming reports whether c is a HammingComparer whose Compare
+// returns the Hamming distance.
+func ComparesHamming(c Comparer) bool {
+	hc, ok := c.(HammingComparer)
+	return ok && hc.ComparesHamming()
+}
+
+// Compile-time assertions: the algorithms whose Compare defaults to the
+// Hamming distance satisfy HammingComparer.
+var (
+	_ HammingComparer = Average{}
+	_ HammingComparer = Difference{}
+	_ HammingComparer = Median{}
+	_ HammingComparer = PHash{}
+	_ HammingComparer = BlockMean{}
+	_ HammingComparer = MarrHildreth{}
+	_ HammingComparer = WHash{}
+	_ HammingComparer = PDQ{}
+	_ HammingComparer = RASH{}
+)
+
 // Compile-time assertions: every algorithm satisfies HasherComparer.
 var (
 	_ HasherComparer = Average{}
@@ -58,6 +91,50 @@ var (
 	_ HasherComparer = GIST{}
 )
 
+// Compile-time assertions: every algorithm satisfies PreparedHasher.
+var (
+	_ PreparedHasher = Average{}
+	_ PreparedHasher = Difference{}
+	_ PreparedHasher = Median{}
+	_ PreparedHasher = PHash{}
+	_ PreparedHasher = BlockMean{}
+	_ PreparedHasher = MarrHildreth{}
+	_ PreparedHasher = RadialVariance{}
+	_ PreparedHasher = ColorMoment{}
+	_ PreparedHasher = CLD{}
+	_ PreparedHasher = EHD{}
+	_ PreparedHasher = WHash{}
+	_ PreparedHasher = LBP{}
+	_ PreparedHasher = HOGHash{}
+	_ PreparedHasher = BoVW{}
+	_ PreparedHasher = PDQ{}
+	_ PreparedHasher = RASH{}
+	_ PreparedHasher = Zernike{}
+	_ PreparedHasher = GIST{}
+)
+
+// Compile-time assertions: every algorithm satisfies IntoHasher.
+var (
+	_ IntoHasher = Average{}
+	_ IntoHasher = Difference{}
+	_ IntoHasher = Median{}
+	_ IntoHasher = PHash{}
+	_ IntoHasher = BlockMean{}
+	_ IntoHasher = MarrHildreth{}
+	_ IntoHasher = RadialVariance{}
+	_ IntoHasher = ColorMoment{}
+	_ IntoHasher = CLD{}
+	_ IntoHasher = EHD{}
+	_ IntoHasher = WHash{}
+	_ IntoHasher = LBP{}
+	_ IntoHasher = HOGHash{}
+	_ IntoHasher = BoVW{}
+	_ IntoHasher = PDQ{}
+	_ IntoHasher = RASH{}
+	_ IntoHasher = Zernike{}
+	_ IntoHasher = GIST{}
+)
+
 // Re-export core types so most consumers only need to import "imghash".
 
 // Hash is the common interface for all hash representations.
@@ -72,6 +149,10 @@ type UInt8 = hashtype.UInt8
 // Float64 represents a hash where the smallest element is a float64.
 type Float64 = hashtype.Float64
 
+// Composite represents a hash made of several hashes, such as those of an
+// Ensemble or a CropResistant.
+type Composite = hashtype.Composite
+
 // Distance represents a similarity measure between two hashes.
 type Distance = similarity.Distance
 
@@ -83,12 +164,23 @@ var ErrIncompatibleHash = hashtype.ErrIncompatibleHash
 // have different lengths and cannot be compared safely.
 var ErrHashLengthMismatch = errors.New("imghash: hash lengths must match")
 
+// ErrEmptyImage is returned when hashing an image that has no pixels.
+var ErrEmptyImage = errors.New("imghash: image has no pixels")
+
+// ErrNoFrames is returned when a decoder added with RegisterDecoder
+// decodes an image into zero frames.
+var ErrNoFrames = errors.New("imghash: image has no frames")
+
 // Constructor validation errors.
 var (
 	// ErrInvalidSize is returned when width or height is zero.
 	ErrInvalidSize = errors.New("imghash: size dimensions must be greater than zero")
 	// ErrInvalidInterpolation is returned when an unsupported interpolation enum is supplied.
 	ErrInvalidInterpolation = errors.New("imghash: invalid interpolation method")
+	// ErrInvalidAlphaMode is returned when an unsupported alpha mode is supplied.
+	ErrInvalidAlphaMode = errors.New("imghash: invalid alpha mode")
+	// ErrInvalidTolerance is returned when the border crop tolerance exceeds 255.
+	ErrInvalidTolerance = errors.New("imghash: border tolerance must not exceed 255")
 	// ErrInvalidBlockSize is returned when block width or height is zero.
 	ErrInvalidBlockSize = errors.New("imghash: block size dimensions must be greater than zero")
 	// ErrInvalidAngles is returned when the number of projection angles is not positive.
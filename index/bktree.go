@@ -0,0 +1,273 @@
+package index
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// BKTree is a Burkhard-Keller tree over Binary hashes using the Hamming
+// distance. It suits small search radii and needs no tuning.
+//
+// Deleted entries are kept as tombstones that still route searches and
+// are dropped by an automatic rebuild once they outnumber live entries.
+// A BKTree is safe for concurrent use.
+type BKTree[ID comparable] struct {
+	mu    sync.RWMutex
+	root  *bkNode[ID]
+	nodes map[ID]*bkNode[ID]
+	bits  int
+	dead  int
+	seq   uint64
+}
+
+type bkNode[ID comparable] struct {
+	id       ID
+	hash     []uint64
+	seq      uint64
+	deleted  bool
+	children []bkEdge[ID]
+}
+
+// bkEdge links a child at the given distance from its parent.
+// Edges are kept sorted by distance.
+type bkEdge[ID comparable] struct {
+	dist int
+	node *bkNode[ID]
+}
+
+// NewBKTree creates an empty BK-tree.
+func NewBKTree[ID comparable]() *BKTree[ID] {
+	return &BKTree[ID]{nodes: make(map[ID]*bkNode[ID])}
+}
+
+// Insert adds a hash under id, replacing any hash already stored under id.
+func (t *BKTree[ID]) Insert(id ID, hash hashtype.Hash) error {
+	words, bits, err := packBinary(hash)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.root != nil && bits != t.bits {
+		return ErrHashLengthMismatch
+	}
+	t.bits = bits
+	if old, ok := t.nodes[id]; ok {
+		old.deleted = true
+		t.dead++
+	}
+	t.seq++
+	n := &bkNode[ID]{id: id, hash: words, seq: t.seq}
+	t.nodes[id] = n
+	t.attach(n)
+	t.maybeRebuild()
+	return nil
+}
+
+func (t *BKTree[ID]) attach(n *bkNode[ID]) {
+	if t.root == nil {
+		t.root = n
+		return
+	}
+	cur := t.root
+	for {
+		d := hamming(cur.hash, n.hash)
+		i := sort.Search(len(cur.children), func(i int) bool { return cur.children[i].dist >= d })
+		if i < len(cur.children) && cur.children[i].dist == d {
+			cur = cur.children[i].node
+			continue
+		}
+		cur.children = append(cur.children, bkEdge[ID]{})
+		copy(cur.children[i+1:], cur.children[i:])
+		cur.children[i] = bkEdge[ID]{dist: d, node: n}
+		return
+	}
+}
+
+// Delete removes the hash stored under id and reports whether it existed.
+func (t *BKTree[ID]) Delete(id ID) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.nodes[id]
+	if !ok {
+		return false
+	}
+	n.deleted = true
+	delete(t.nodes, id)
+	t.dead++
+	t.maybeRebuild()
+	return true
+}
+
+// maybeRebuild reconstructs the tree from live nodes once tombstones
+// outnumber them, keeping the original insertion order.
+func (t *BKTree[ID]) maybeRebuild() {
+	if t.dead <= len(t.nodes) {
+		return
+	}
+	live := make([]*bkNode[ID], 0, len(t.nodes))
+	for _, n := range t.nodes {
+		live = append(live, n)
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].seq < live[j].seq })
+	t.root = nil
+	t.dead = 0
+	for _, n := range live {
+		n.children = nil
+		t.attach(n)
+	}
+}
+
+// Len returns the number of stored hashes.
+func (t *BKTree[ID]) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.nodes)
+}
+
+// RadiusSearch returns all hashes within maxDist bits of hash, nearest first.
+func (t *BKTree[ID]) RadiusSearch(hash hashtype.Hash, maxDist similarity.Distance) ([]Result[ID], error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	q, err := t.query(hash)
+	if err != nil {
+		return nil, err
+	}
+	r := binaryRadius(maxDist, t.bits)
+	var hits []hit[ID]
+	t.search(q, func() int { return r }, func(n *bkNode[ID], d int) {
+		if d <= r {
+			hits = append(hits, hit[ID]{Result[ID]{n.id, similarity.Distance(d)}, n.seq})
+		}
+	})
+	return sortHits(hits), nil
+}
+
+// KNN returns the k hashes nearest to hash, nearest first.
+func (t *BKTree[ID]) KNN(hash hashtype.Hash, k int) ([]Result[ID], error) {
+	if k <= 0 {
+		return nil, ErrInvalidK
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	q, err := t.query(hash)
+	if err != nil {
+		return nil, err
+	}
+	best := newTopK[ID](k)
+	radius := func() int {
+		if best.full() {
+			return best.worst()
+		}
+		return t.bits
+	}
+	t.search(q, radius, func(n *bkNode[ID], d int) {
+		best.push(hit[ID]{Result[ID]{n.id, similarity.Distance(d)}, n.seq})
+	})
+	return sortHits(best.hits), nil
+}
+
+// query packs hash and checks that its length matches the stored hashes.
+// The caller must hold t.mu, so the check still holds during the search.
+func (t *BKTree[ID]) query(hash hashtype.Hash) ([]uint64, error) {
+	q, bits, err := packBinary(hash)
+	if err != nil {
+		return nil, err
+	}
+	if t.root != nil && bits != t.bits {
+		return nil, ErrHashLengthMismatch
+	}
+	return q, nil
+}
+
+// search walks the tree, visiting every live node that may lie within the
+// current radius. The radius is re-read at each step so KNN can shrink it
+// as better matches are found.
+func (t *BKTree[ID]) search(q []uint64, radius func() int, visit func(*bkNode[ID], int)) {
+	if t.root == nil {
+		return
+	}
+	stack := []*bkNode[ID]{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := hamming(q, n.hash)
+		if !n.deleted {
+			visit(n, d)
+		}
+		r := radius()
+		lo := sort.Search(len(n.children), func(i int) bool { return n.children[i].dist >= d-r })
+		for i := lo; i < len(n.children) && n.children[i].dist <= d+r; i++ {
+			stack = append(stack, n.children[i].node)
+		}
+	}
+}
+
+// topK keeps the k best hits seen so far as a max-heap on distance.
+type topK[ID comparable] struct {
+	k    int
+	hits []hit[ID]
+}
+
+func newTopK[ID comparable](k int) *topK[ID] {
+	return &topK[ID]{k: k}
+}
+
+func (h *topK[ID]) full() bool { return len(h.hits) >= h.k }
+
+func (h *topK[ID]) worst() int { return int(h.hits[0].Distance) }
+
+func (h *topK[ID]) less(i, j int) bool {
+	a, b := h.hits[i], h.hits[j]
+	if a.Distance != b.Distance {
+		return a.Distance > b.Distance
+	}
+	return a.seq > b.seq
+}
+
+func (h *topK[ID]) push(x hit[ID]) {
+	if h.full() {
+		top := h.hits[0]
+		if x.Distance > top.Distance || (x.Distance == top.Distance && x.seq > top.seq) {
+			return
+		}
+		h.hits[0] = x
+		h.down(0)
+		return
+	}
+	h.hits = append(h.hits, x)
+	h.up(len(h.hits) - 1)
+}
+
+func (h *topK[ID]) up(i int) {
+	for i > 0 {
+		p := (i - 1) / 2
+		if !h.less(i, p) {
+			return
+		}
+		h.hits[i], h.hits[p] = h.hits[p], h.hits[i]
+		i = p
+	}
+}
+
+func (h *topK[ID]) down(i int) {
+	n := len(h.hits)
+	for {
+		l := 2*i + 1
+		if l >= n {
+			return
+		}
+		m := l
+		if r := l + 1; r < n && h.less(r, l) {
+			m = r
+		}
+		if !h.less(m, i) {
+			return
+		}
+		h.hits[i], h.hits[m] = h.hits[m], h.hits[i]
+		i = m
+	}
+}
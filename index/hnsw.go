@@ -0,0 +1,551 @@
+package index
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// DistanceFunc computes the distance between two hashes. Functions from the
+// similarity package and the Compare method of any imghash Comparer can be
+// used directly, e.g. similarity.L2 or gist.Compare.
+type DistanceFunc func(hashtype.Hash, hashtype.Hash) (similarity.Distance, error)
+
+// HNSW is an approximate nearest neighbour index based on hierarchical
+// navigable small world graphs (Malkov and Yashunin, "Efficient and robust
+// approximate nearest neighbor search using Hierarchical Navigable Small
+// World graphs", TPAMI 2018).
+//
+// Unlike BKTree and MIH it works with any hash type and any DistanceFunc,
+// which makes it suitable for Float64 and UInt8 descriptors compared with
+// L1, L2, cosine or similar metrics. Searches are approximate; recall is
+// traded against speed with WithEfSearch or SetEfSearch.
+//
+// The hash kind and length are fixed by the first insert. Deleted entries
+// are kept as tombstones that still route searches and are dropped by an
+// automatic rebuild once they outnumber live entries. An HNSW is safe for
+// concurrent use.
+type HNSW[ID comparable] struct {
+	mu       sync.RWMutex
+	dist     DistanceFunc
+	m        int
+	efBuild  int
+	efSearch int
+	ml       float64
+	rng      *rand.Rand
+	kind     hashtype.Kind
+	length   int
+	nodes    []*hnswNode[ID]
+	ids      map[ID]int32
+	entry    int32
+	maxLevel int
+	dead     int
+	seq      uint64
+}
+
+type hnswNode[ID comparable] struct {
+	id      ID
+	hash    hashtype.Hash
+	seq     uint64
+	deleted bool
+	links   [][]int32
+}
+
+// HNSWOption configures an HNSW index.
+type HNSWOption interface {
+	applyHNSW(*hnswConfig)
+}
+
+type hnswConfig struct {
+	neighbors      int
+	efConstruction int
+	efSearch       int
+	seed           int64
+}
+
+type neighborsOption int
+
+func (o neighborsOption) applyHNSW(c *hnswConfig) { c.neighbors = int(o) }
+
+type efConstructionOption int
+
+func (o efConstructionOption) applyHNSW(c *hnswConfig) { c.efConstruction = int(o) }
+
+type efSearchOption int
+
+func (o efSearchOption) applyHNSW(c *hnswConfig) { c.efSearch = int(o) }
+
+type seedOption int64
+
+func (o seedOption) applyHNSW(c *hnswConfig) { c.seed = int64(o) }
+
+// WithNeighbors sets the number of links kept per node on the upper graph
+// layers (M in the HNSW paper); the bottom layer keeps twice as many.
+// Larger values improve recall at the cost of memory and insert time.
+// The default is 16.
+func WithNeighbors(m int) HNSWOption { return neighborsOption(m) }
+
+// WithEfConstruction sets the candidate list size used while inserting.
+// Larger values build a better graph more slowly. The default is 200.
+func WithEfConstruction(ef int) HNSWOption { return efConstructionOption(ef) }
+
+// WithEfSearch sets the candidate list size used while searching.
+// Larger values improve recall at the cost of query time. The default is 64.
+func WithEfSearch(ef int) HNSWOption { return efSearchOption(ef) }
+
+// WithSeed sets the seed used to draw node levels, making graph
+// construction reproducible for a given insert order. The default is 1.
+func WithSeed(seed int64) HNSWOption { return seedOption(seed) }
+
+// NewHNSW creates an empty HNSW index that compares hashes with dist.
+func NewHNSW[ID comparable](dist DistanceFunc, opts ...HNSWOption) (*HNSW[ID], error) {
+	cfg := hnswConfig{neighbors: 16, efConstruction: 200, efSearch: 64, seed: 1}
+	for _, o := range opts {
+		o.applyHNSW(&cfg)
+	}
+	if dist == nil {
+		return nil, ErrNilDistance
+	}
+	if cfg.neighbors < 2 {
+		return nil, ErrInvalidNeighbors
+	}
+	if cfg.efConstruction <= 0 || cfg.efSearch <= 0 {
+		return nil, ErrInvalidEf
+	}
+	return &HNSW[ID]{
+		dist:     dist,
+		m:        cfg.neighbors,
+		efBuild:  cfg.efConstruction,
+		efSearch: cfg.efSearch,
+		ml:       1 / math.Log(float64(cfg.neighbors)),
+		rng:      rand.New(rand.NewSource(cfg.seed)),
+		ids:      make(map[ID]int32),
+		entry:    -1,
+	}, nil
+}
+
+// SetEfSearch changes the candidate list size used by subsequent searches.
+func (x *HNSW[ID]) SetEfSearch(ef int) error {
+	if ef <= 0 {
+		return ErrInvalidEf
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.efSearch = ef
+	return nil
+}
+
+// Len returns the number of stored hashes.
+func (x *HNSW[ID]) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.ids)
+}
+
+// Insert adds a hash under id, replacing any hash already stored under id.
+func (x *HNSW[ID]) Insert(id ID, hash hashtype.Hash) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.validate(hash); err != nil {
+		return err
+	}
+	if x.entry < 0 {
+		x.kind, x.length = hashtype.KindOf(hash), hash.Len()
+	}
+	old, replace := x.ids[id]
+	x.seq++
+	if err := x.insert(id, cloneHash(hash), x.seq); err != nil {
+		return err
+	}
+	if replace {
+		x.nodes[old].deleted = true
+		x.dead++
+	}
+	return x.maybeRebuild()
+}
+
+// linkUpdate is a neighbour list computed during an insert and applied
+// only once every distance needed by the insert has been computed.
+type linkUpdate struct {
+	node  int32
+	level int
+	links []int32
+}
+
+func (x *HNSW[ID]) insert(id ID, hash hashtype.Hash, seq uint64) error {
+	level := int(-math.Log(1-x.rng.Float64()) * x.ml)
+	idx := int32(len(x.nodes))
+	n := &hnswNode[ID]{id: id, hash: hash, seq: seq, links: make([][]int32, level+1)}
+	// The node is reachable by index for distance computations but not yet
+	// linked from the graph, so it is simply dropped again on error.
+	x.nodes = append(x.nodes, n)
+
+	var updates []linkUpdate
+	if x.entry >= 0 {
+		eps, err := x.descend(hash, level)
+		if err != nil {
+			x.nodes = x.nodes[:idx]
+			return err
+		}
+		for lc := min(level, x.maxLevel); lc >= 0; lc-- {
+			w, err := x.searchLayer(hash, eps, x.efBuild, lc)
+			if err != nil {
+				x.nodes = x.nodes[:idx]
+				return err
+			}
+			nbs, err := x.selectNeighbors(w, x.m)
+			if err != nil {
+				x.nodes = x.nodes[:idx]
+				return err
+			}
+			n.links[lc] = candNodes(nbs)
+			for _, nb := range nbs {
+				links := append(slices.Clone(x.nodes[nb.node].links[lc]), idx)
+				if len(links) > x.maxLinks(lc) {
+					if links, err = x.shrink(nb.node, links, lc); err != nil {
+						x.nodes = x.nodes[:idx]
+						return err
+					}
+				}
+				updates = append(updates, linkUpdate{nb.node, lc, links})
+			}
+			eps = w
+		}
+	}
+
+	for _, u := range updates {
+		x.nodes[u.node].links[u.level] = u.links
+	}
+	x.ids[id] = idx
+	if x.entry < 0 || level > x.maxLevel {
+		x.entry, x.maxLevel = idx, level
+	}
+	return nil
+}
+
+func (x *HNSW[ID]) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * x.m
+	}
+	return x.m
+}
+
+// shrink reduces the links of owner to the per-layer maximum using the
+// neighbour selection heuristic.
+func (x *HNSW[ID]) shrink(owner int32, links []int32, level int) ([]int32, error) {
+	cands := make([]cand, len(links))
+	for i, l := range links {
+		d, err := x.distance(x.nodes[owner].hash, l)
+		if err != nil {
+			return nil, err
+		}
+		cands[i] = cand{l, d}
+	}
+	sortCands(cands)
+	kept, err := x.selectNeighbors(cands, x.maxLinks(level))
+	if err != nil {
+		return nil, err
+	}
+	return candNodes(kept), nil
+}
+
+// selectNeighbors picks up to m neighbours from cands (sorted by distance),
+// preferring candidates that are closer to the base element than to any
+// neighbour already selected, and filling any remaining slots with the
+// closest discarded candidates.
+func (x *HNSW[ID]) selectNeighbors(cands []cand, m int) ([]cand, error) {
+	out := make([]cand, 0, m)
+	var pruned []cand
+	for _, c := range cands {
+		if len(out) >= m {
+			break
+		}
+		keep := true
+		for _, r := range out {
+			d, err := x.distance(x.nodes[c.node].hash, r.node)
+			if err != nil {
+				return nil, err
+			}
+			if d < c.dist {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, c)
+		} else {
+			pruned = append(pruned, c)
+		}
+	}
+	for _, c := range pruned {
+		if len(out) >= m {
+			break
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// Delete removes the hash stored under id and reports whether it existed.
+func (x *HNSW[ID]) Delete(id ID) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	idx, ok := x.ids[id]
+	if !ok {
+		return false
+	}
+	x.nodes[idx].deleted = true
+	delete(x.ids, id)
+	x.dead++
+	// A failed rebuild leaves the previous graph in place, which still
+	// answers queries correctly.
+	_ = x.maybeRebuild()
+	return true
+}
+
+// maybeRebuild reconstructs the graph from live nodes once tombstones
+// outnumber them, keeping the original insertion order.
+func (x *HNSW[ID]) maybeRebuild() error {
+	if x.dead <= len(x.ids) {
+		return nil
+	}
+	nodes, ids, entry, maxLevel := x.nodes, x.ids, x.entry, x.maxLevel
+	x.nodes = make([]*hnswNode[ID], 0, len(ids))
+	x.ids = make(map[ID]int32, len(ids))
+	x.entry, x.maxLevel = -1, 0
+	for _, n := range nodes {
+		if n.deleted {
+			continue
+		}
+		if err := x.insert(n.id, n.hash, n.seq); err != nil {
+			x.nodes, x.ids, x.entry, x.maxLevel = nodes, ids, entry, maxLevel
+			return err
+		}
+	}
+	x.dead = 0
+	return nil
+}
+
+// KNN returns approximately the k hashes nearest to hash, nearest first.
+func (x *HNSW[ID]) KNN(hash hashtype.Hash, k int) ([]Result[ID], error) {
+	if k <= 0 {
+		return nil, ErrInvalidK
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if err := x.validate(hash); err != nil {
+		return nil, err
+	}
+	if x.entry < 0 {
+		return nil, nil
+	}
+	// Tombstones take up candidate slots, so widen the search until
+	// enough live nodes are found or the whole graph has been covered.
+	for ef := max(x.efSearch, k); ; ef *= 2 {
+		w, err := x.search(hash, ef)
+		if err != nil {
+			return nil, err
+		}
+		hits := x.liveHits(w, math.Inf(1))
+		if len(hits) >= k || ef >= len(x.nodes) {
+			res := sortHits(hits)
+			return res[:min(k, len(res))], nil
+		}
+	}
+}
+
+// RadiusSearch returns approximately all hashes within maxDist of hash,
+// nearest first. The candidate list is widened until its farthest entry
+// lies beyond maxDist, so recall depends on graph quality rather than on
+// how many matches there are.
+func (x *HNSW[ID]) RadiusSearch(hash hashtype.Hash, maxDist similarity.Distance) ([]Result[ID], error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if err := x.validate(hash); err != nil {
+		return nil, err
+	}
+	if x.entry < 0 {
+		return nil, nil
+	}
+	r := float64(maxDist)
+	for ef := x.efSearch; ; ef *= 2 {
+		w, err := x.search(hash, ef)
+		if err != nil {
+			return nil, err
+		}
+		if len(w) < ef || w[len(w)-1].dist > r || ef >= len(x.nodes) {
+			return sortHits(x.liveHits(w, r)), nil
+		}
+	}
+}
+
+func (x *HNSW[ID]) liveHits(w []cand, maxDist float64) []hit[ID] {
+	var hits []hit[ID]
+	for _, c := range w {
+		n := x.nodes[c.node]
+		if !n.deleted && c.dist <= maxDist {
+			hits = append(hits, hit[ID]{Result[ID]{n.id, similarity.Distance(c.dist)}, n.seq})
+		}
+	}
+	return hits
+}
+
+// validate checks that hash matches the kind and length of stored hashes.
+func (x *HNSW[ID]) validate(hash hashtype.Hash) error {
+	if hash == nil {
+		return ErrIncompatibleHash
+	}
+	if x.entry < 0 {
+		return nil
+	}
+	if hashtype.KindOf(hash) != x.kind {
+		return ErrIncompatibleHash
+	}
+	if hash.Len() != x.length {
+		return ErrHashLengthMismatch
+	}
+	return nil
+}
+
+func (x *HNSW[ID]) search(q hashtype.Hash, ef int) ([]cand, error) {
+	eps, err := x.descend(q, 0)
+	if err != nil {
+		return nil, err
+	}
+	return x.searchLayer(q, eps, ef, 0)
+}
+
+// descend greedily walks from the entry point down to the given layer and
+// returns the closest node found there.
+func (x *HNSW[ID]) descend(q hashtype.Hash, level int) ([]cand, error) {
+	d, err := x.distance(q, x.entry)
+	if err != nil {
+		return nil, err
+	}
+	eps := []cand{{x.entry, d}}
+	for lc := x.maxLevel; lc > level; lc-- {
+		if eps, err = x.searchLayer(q, eps, 1, lc); err != nil {
+			return nil, err
+		}
+	}
+	return eps, nil
+}
+
+// searchLayer returns up to ef nodes on the given layer closest to q,
+// sorted by distance, starting from the entry points eps.
+func (x *HNSW[ID]) searchLayer(q hashtype.Hash, eps []cand, ef, level int) ([]cand, error) {
+	visited := make(map[int32]struct{}, ef*2)
+	frontier := &candHeap{}
+	found := &candHeap{max: true}
+	for _, e := range eps {
+		visited[e.node] = struct{}{}
+		heap.Push(frontier, e)
+		heap.Push(found, e)
+		if found.Len() > ef {
+			heap.Pop(found)
+		}
+	}
+	for frontier.Len() > 0 {
+		c := heap.Pop(frontier).(cand)
+		if found.Len() >= ef && c.dist > found.items[0].dist {
+			break
+		}
+		for _, nb := range x.nodes[c.node].links[level] {
+			if _, ok := visited[nb]; ok {
+				continue
+			}
+			visited[nb] = struct{}{}
+			d, err := x.distance(q, nb)
+			if err != nil {
+				return nil, err
+			}
+			if found.Len() < ef || d < found.items[0].dist {
+				heap.Push(frontier, cand{nb, d})
+				heap.Push(found, cand{nb, d})
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+	out := found.items
+	sortCands(out)
+	return out, nil
+}
+
+func (x *HNSW[ID]) distance(q hashtype.Hash, node int32) (float64, error) {
+	d, err := x.dist(q, x.nodes[node].hash)
+	return float64(d), err
+}
+
+// cand is a graph node paired with its distance to the current query.
+type cand struct {
+	node int32
+	dist float64
+}
+
+// candLess orders by distance, then by node index so results are
+// deterministic when distances tie.
+func candLess(a, b cand) bool {
+	if a.dist != b.dist {
+		return a.dist < b.dist
+	}
+	return a.node < b.node
+}
+
+func sortCands(c []cand) {
+	sort.Slice(c, func(i, j int) bool { return candLess(c[i], c[j]) })
+}
+
+func candNodes(c []cand) []int32 {
+	out := make([]int32, len(c))
+	for i := range c {
+		out[i] = c[i].node
+	}
+	return out
+}
+
+// candHeap is a min-heap of candidates, or a max-heap when max is set.
+type candHeap struct {
+	items []cand
+	max   bool
+}
+
+func (h *candHeap) Len() int { return len(h.items) }
+
+func (h *candHeap) Less(i, j int) bool {
+	if h.max {
+		return candLess(h.items[j], h.items[i])
+	}
+	return candLess(h.items[i], h.items[j])
+}
+
+func (h *candHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *candHeap) Push(v any) { h.items = append(h.items, v.(cand)) }
+
+func (h *candHeap) Pop() any {
+	v := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return v
+}
+
+// cloneHash copies the built-in hash types so later changes by the caller
+// do not affect the index.
+func cloneHash(h hashtype.Hash) hashtype.Hash {
+	switch v := h.(type) {
+	case hashtype.Binary:
+		return slices.Clone(v)
+	case hashtype.UInt8:
+		return slices.Clone(v)
+	case hashtype.Float64:
+		return slices.Clone(v)
+	}
+	return h
+}
@@ -0,0 +1,279 @@
+package index_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/index"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+func randomFloat64(rng *rand.Rand, dim int) hashtype.Float64 {
+	h := make(hashtype.Float64, dim)
+	for i := range h {
+		h[i] = rng.NormFloat64()
+	}
+	return h
+}
+
+func randomUInt8(rng *rand.Rand, dim int) hashtype.Hash {
+	h := make(hashtype.UInt8, dim)
+	for i := range h {
+		h[i] = uint8(rng.Intn(256))
+	}
+	return h
+}
+
+func exactNeighbors(corpus map[int]hashtype.Hash, q hashtype.Hash, dist index.DistanceFunc) []match {
+	var res []match
+	for id, h := range corpus {
+		d, err := dist(q, h)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, match{id, d})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].dist != res[j].dist {
+			return res[i].dist < res[j].dist
+		}
+		return res[i].id < res[j].id
+	})
+	return res
+}
+
+var hnswRecallTests = []struct {
+	name   string
+	dist   index.DistanceFunc
+	random func(*rand.Rand) hashtype.Hash
+}{
+	{"Float64 L2", similarity.L2, func(r *rand.Rand) hashtype.Hash { return randomFloat64(r, 32) }},
+	{"Float64 cosine", similarity.Cosine, func(r *rand.Rand) hashtype.Hash { return randomFloat64(r, 32) }},
+	{"UInt8 L1", similarity.L1, func(r *rand.Rand) hashtype.Hash { return randomUInt8(r, 18) }},
+}
+
+func TestHNSW_recall(t *testing.T) {
+	const (
+		n       = 1000
+		queries = 50
+		k       = 10
+	)
+	for _, tt := range hnswRecallTests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(7))
+			idx, err := index.NewHNSW[int](tt.dist, index.WithEfConstruction(100))
+			if err != nil {
+				t.Fatalf("NewHNSW: %v", err)
+			}
+			corpus := make(map[int]hashtype.Hash)
+			for id := range n {
+				h := tt.random(rng)
+				if err := idx.Insert(id, h); err != nil {
+					t.Fatalf("Insert: %v", err)
+				}
+				corpus[id] = h
+			}
+			for id := 0; id < n; id += 4 {
+				idx.Delete(id)
+				delete(corpus, id)
+			}
+			if idx.Len() != len(corpus) {
+				t.Fatalf("Len: got %d, want %d", idx.Len(), len(corpus))
+			}
+
+			var found int
+			for range queries {
+				q := tt.random(rng)
+				want := exactNeighbors(corpus, q, tt.dist)[:k]
+				got, err := idx.KNN(q, k)
+				if err != nil {
+					t.Fatalf("KNN: %v", err)
+				}
+				if len(got) != k {
+					t.Fatalf("got %d results, want %d", len(got), k)
+				}
+				ids := make(map[int]bool)
+				for i, r := range got {
+					if _, ok := corpus[r.ID]; !ok {
+						t.Fatalf("deleted id %d returned", r.ID)
+					}
+					if i > 0 && r.Distance < got[i-1].Distance {
+						t.Fatalf("results not sorted: %v", got)
+					}
+					ids[r.ID] = true
+				}
+				for _, w := range want {
+					if ids[w.id] {
+						found++
+					}
+				}
+			}
+			if recall := float64(found) / (queries * k); recall < 0.95 {
+				t.Errorf("recall %.3f below 0.95", recall)
+			}
+		})
+	}
+}
+
+func TestHNSW_radiusSearch(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	idx, err := index.NewHNSW[int](similarity.L2, index.WithEfSearch(8))
+	if err != nil {
+		t.Fatalf("NewHNSW: %v", err)
+	}
+	corpus := make(map[int]hashtype.Hash)
+	for id := range 1000 {
+		h := randomFloat64(rng, 8)
+		if err := idx.Insert(id, h); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		corpus[id] = h
+	}
+	q := randomFloat64(rng, 8)
+	all := exactNeighbors(corpus, q, similarity.L2)
+	// Pick a radius holding several times more matches than efSearch, so
+	// the search has to widen its candidate list.
+	r := all[40].dist
+	got, err := idx.RadiusSearch(q, r)
+	if err != nil {
+		t.Fatalf("RadiusSearch: %v", err)
+	}
+	if len(got) < 39 || len(got) > 41 {
+		t.Errorf("got %d results, want 41", len(got))
+	}
+	for _, m := range got {
+		if m.Distance > r {
+			t.Errorf("result %+v beyond radius %v", m, r)
+		}
+	}
+}
+
+func TestHNSW_replace(t *testing.T) {
+	idx, err := index.NewHNSW[string](similarity.L1)
+	if err != nil {
+		t.Fatalf("NewHNSW: %v", err)
+	}
+	for _, id := range []string{"a", "b", "a"} {
+		if err := idx.Insert(id, hashtype.UInt8{uint8(len(id)), 0}); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	if err := idx.Insert("b", hashtype.UInt8{9, 9}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	got, err := idx.KNN(hashtype.UInt8{9, 9}, 5)
+	if err != nil {
+		t.Fatalf("KNN: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "b" || got[0].Distance != 0 || got[1].ID != "a" {
+		t.Errorf("got %v", got)
+	}
+	if !idx.Delete("a") || idx.Delete("a") || idx.Len() != 1 {
+		t.Errorf("Delete: unexpected state, Len %d", idx.Len())
+	}
+}
+
+func TestHNSW_rebuild(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	idx, err := index.NewHNSW[int](similarity.L2)
+	if err != nil {
+		t.Fatalf("NewHNSW: %v", err)
+	}
+	for id := range 100 {
+		if err := idx.Insert(id, randomFloat64(rng, 4)); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	// Deleting more than half of the entries triggers a rebuild.
+	for id := range 60 {
+		idx.Delete(id)
+	}
+	got, err := idx.KNN(randomFloat64(rng, 4), 100)
+	if err != nil {
+		t.Fatalf("KNN: %v", err)
+	}
+	if len(got) != 40 {
+		t.Fatalf("got %d results, want 40", len(got))
+	}
+	for _, r := range got {
+		if r.ID < 60 {
+			t.Errorf("deleted id %d returned", r.ID)
+		}
+	}
+}
+
+var hnswOptionTests = []struct {
+	name   string
+	dist   index.DistanceFunc
+	opts   []index.HNSWOption
+	expect error
+}{
+	{"nil distance", nil, nil, index.ErrNilDistance},
+	{"one neighbor", similarity.L2, []index.HNSWOption{index.WithNeighbors(1)}, index.ErrInvalidNeighbors},
+	{"zero ef construction", similarity.L2, []index.HNSWOption{index.WithEfConstruction(0)}, index.ErrInvalidEf},
+	{"negative ef search", similarity.L2, []index.HNSWOption{index.WithEfSearch(-1)}, index.ErrInvalidEf},
+	{"valid", similarity.L2, []index.HNSWOption{index.WithNeighbors(4), index.WithSeed(9)}, nil},
+}
+
+func TestNewHNSW_options(t *testing.T) {
+	for _, tt := range hnswOptionTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := index.NewHNSW[int](tt.dist, tt.opts...); !errors.Is(err, tt.expect) {
+				t.Errorf("got %v, want %v", err, tt.expect)
+			}
+		})
+	}
+}
+
+func TestHNSW_errors(t *testing.T) {
+	idx, err := index.NewHNSW[int](similarity.L2)
+	if err != nil {
+		t.Fatalf("NewHNSW: %v", err)
+	}
+	if got, err := idx.KNN(hashtype.Float64{1}, 1); err != nil || len(got) != 0 {
+		t.Errorf("empty KNN: got %v, %v", got, err)
+	}
+	if err := idx.Insert(1, hashtype.Float64{1, 2}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := idx.Insert(2, hashtype.UInt8{1, 2}); !errors.Is(err, index.ErrIncompatibleHash) {
+		t.Errorf("Insert: got %v, want %v", err, index.ErrIncompatibleHash)
+	}
+	if err := idx.Insert(2, hashtype.Float64{1}); !errors.Is(err, index.ErrHashLengthMismatch) {
+		t.Errorf("Insert: got %v, want %v", err, index.ErrHashLengthMismatch)
+	}
+	if _, err := idx.RadiusSearch(hashtype.Float64{1, 2, 3}, 1); !errors.Is(err, index.ErrHashLengthMismatch) {
+		t.Errorf("RadiusSearch: got %v, want %v", err, index.ErrHashLengthMismatch)
+	}
+	if _, err := idx.KNN(hashtype.Float64{1, 2}, 0); !errors.Is(err, index.ErrInvalidK) {
+		t.Errorf("KNN: got %v, want %v", err, index.ErrInvalidK)
+	}
+	if err := idx.SetEfSearch(0); !errors.Is(err, index.ErrInvalidEf) {
+		t.Errorf("SetEfSearch: got %v, want %v", err, index.ErrInvalidEf)
+	}
+}
+
+func ExampleHNSW() {
+	idx, err := index.NewHNSW[string](similarity.L2)
+	if err != nil {
+		panic(err)
+	}
+	_ = idx.Insert("red", hashtype.Float64{1, 0, 0})
+	_ = idx.Insert("orange", hashtype.Float64{1, 0.5, 0})
+	_ = idx.Insert("blue", hashtype.Float64{0, 0, 1})
+
+	nearest, err := idx.KNN(hashtype.Float64{0.9, 0.1, 0}, 2)
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range nearest {
+		fmt.Printf("%s %.3f\n", r.ID, r.Distance)
+	}
+	// Output:
+	// red 0.141
+	// orange 0.412
+}
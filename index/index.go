@@ -0,0 +1,126 @@
+// Package index implements in-memory search indexes that find hashes
+// within a distance of a query without comparing against every stored hash.
+//
+// BKTree and MIH index Binary hashes under the Hamming distance and work
+// with any fixed hash length, such as those produced by Average, PHash,
+// PDQ or BoVW SimHash. Their results are exact.
+//
+// HNSW is an approximate nearest neighbour index for any hash type and
+// distance function, intended for Float64 and UInt8 descriptors such as
+// GIST, CLD or BoVW histograms.
+package index
+
+import (
+	"errors"
+	"math/bits"
+	"sort"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// Index is the common interface implemented by all indexes in this package.
+type Index[ID comparable] interface {
+	// Insert adds a hash under id, replacing any hash already stored under id.
+	Insert(id ID, hash hashtype.Hash) error
+	// Delete removes the hash stored under id and reports whether it existed.
+	Delete(id ID) bool
+	// RadiusSearch returns all hashes within maxDist of hash, nearest first.
+	RadiusSearch(hash hashtype.Hash, maxDist similarity.Distance) ([]Result[ID], error)
+	// KNN returns the k hashes nearest to hash, nearest first.
+	KNN(hash hashtype.Hash, k int) ([]Result[ID], error)
+	// Len returns the number of stored hashes.
+	Len() int
+}
+
+// Result is a single search match.
+type Result[ID comparable] struct {
+	ID       ID
+	Distance similarity.Distance
+}
+
+// Compile-time assertions: every index satisfies Index.
+var (
+	_ Index[int] = (*BKTree[int])(nil)
+	_ Index[int] = (*MIH[int])(nil)
+	_ Index[int] = (*HNSW[int])(nil)
+)
+
+var (
+	// ErrHashLengthMismatch is returned when a hash length differs from
+	// the length of the hashes already stored in the index.
+	ErrHashLengthMismatch = errors.New("index: hash lengths must match")
+	// ErrInvalidSubstrings is returned when the MIH substring count is not
+	// positive or yields substrings wider than 64 bits.
+	ErrInvalidSubstrings = errors.New("index: invalid substring count")
+	// ErrInvalidK is returned when a KNN query asks for a non-positive count.
+	ErrInvalidK = errors.New("index: k must be greater than zero")
+	// ErrNilDistance is returned when an HNSW index is created without a
+	// distance function.
+	ErrNilDistance = errors.New("index: distance function must not be nil")
+	// ErrInvalidNeighbors is returned when the HNSW neighbour count is
+	// less than two.
+	ErrInvalidNeighbors = errors.New("index: neighbour count must be at least two")
+	// ErrInvalidEf is returned when an HNSW candidate list size is not positive.
+	ErrInvalidEf = errors.New("index: ef must be greater than zero")
+)
+
+// ErrIncompatibleHash is returned when a hash type is not supported by an index.
+var ErrIncompatibleHash = hashtype.ErrIncompatibleHash
+
+// packBinary converts a Binary hash into 64-bit words so distances can be
+// computed a word at a time. Bit position p (as set by hashtype.Binary.Set)
+// ends up at bit p%64 of word p/64. It also returns the hash length in bits.
+func packBinary(h hashtype.Hash) ([]uint64, int, error) {
+	b, ok := h.(hashtype.Binary)
+	if !ok {
+		return nil, 0, ErrIncompatibleHash
+	}
+	words := make([]uint64, (len(b)+7)/8)
+	for i, v := range b {
+		words[i/8] |= uint64(v) << (8 * uint(i%8))
+	}
+	return words, len(b) * 8, nil
+}
+
+func hamming(a, b []uint64) int {
+	var d int
+	for i := range a {
+		d += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return d
+}
+
+// binaryRadius converts a distance threshold into the largest whole number
+// of differing bits it admits between hashes of nbits bits. It is -1 for
+// negative and NaN thresholds.
+func binaryRadius(maxDist similarity.Distance, nbits int) int {
+	if !(maxDist >= 0) {
+		return -1
+	}
+	if maxDist >= similarity.Distance(nbits) {
+		return nbits
+	}
+	return int(maxDist)
+}
+
+// hit is a match that also carries the insertion sequence number so
+// results with equal distance are returned in a deterministic order.
+type hit[ID comparable] struct {
+	Result[ID]
+	seq uint64
+}
+
+func sortHits[ID comparable](hits []hit[ID]) []Result[ID] {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Distance != hits[j].Distance {
+			return hits[i].Distance < hits[j].Distance
+		}
+		return hits[i].seq < hits[j].seq
+	})
+	res := make([]Result[ID], len(hits))
+	for i := range hits {
+		res[i] = hits[i].Result
+	}
+	return res
+}
@@ -0,0 +1,246 @@
+package index_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/index"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+var indexes = []struct {
+	name  string
+	build func() index.Index[int]
+}{
+	{"BKTree", func() index.Index[int] { return index.NewBKTree[int]() }},
+	{"MIH", func() index.Index[int] {
+		x, err := index.NewMIH[int]()
+		if err != nil {
+			panic(err)
+		}
+		return x
+	}},
+	{"MIH 5 substrings", func() index.Index[int] {
+		x, err := index.NewMIH[int](index.WithSubstrings(5))
+		if err != nil {
+			panic(err)
+		}
+		return x
+	}},
+}
+
+// randomCorpus returns n hashes of the given byte length, clustered around
+// a few centers so small-radius searches have matches.
+func randomCorpus(rng *rand.Rand, n, size int) []hashtype.Binary {
+	centers := make([]hashtype.Binary, 8)
+	for i := range centers {
+		centers[i] = make(hashtype.Binary, size)
+		rng.Read(centers[i])
+	}
+	out := make([]hashtype.Binary, n)
+	for i := range out {
+		h := hashtype.Binary(append([]byte(nil), centers[rng.Intn(len(centers))]...))
+		for range rng.Intn(size * 2) {
+			h[rng.Intn(size)] ^= 1 << rng.Intn(8)
+		}
+		out[i] = h
+	}
+	return out
+}
+
+type match struct {
+	id   int
+	dist similarity.Distance
+}
+
+func bruteForce(corpus map[int]hashtype.Binary, q hashtype.Binary) []match {
+	var res []match
+	for id, h := range corpus {
+		d, err := similarity.Hamming(q, h)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, match{id, d})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].dist != res[j].dist {
+			return res[i].dist < res[j].dist
+		}
+		return res[i].id < res[j].id
+	})
+	return res
+}
+
+func checkResults(t *testing.T, got []index.Result[int], want []match) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d", len(got), len(want))
+	}
+	for i := range got {
+		// IDs are inserted in ascending order, so ties break by ID.
+		if got[i].ID != want[i].id || got[i].Distance != want[i].dist {
+			t.Fatalf("result %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestIndex_matchesBruteForce(t *testing.T) {
+	for _, size := range []int{8, 9, 32} {
+		for _, ix := range indexes {
+			t.Run(fmt.Sprintf("%s/%d bytes", ix.name, size), func(t *testing.T) {
+				rng := rand.New(rand.NewSource(int64(size)))
+				idx := ix.build()
+				corpus := make(map[int]hashtype.Binary)
+				for id, h := range randomCorpus(rng, 500, size) {
+					if err := idx.Insert(id, h); err != nil {
+						t.Fatalf("Insert: %v", err)
+					}
+					corpus[id] = h
+				}
+				for id := 0; id < 500; id += 3 {
+					if !idx.Delete(id) {
+						t.Fatalf("Delete(%d) reported missing", id)
+					}
+					delete(corpus, id)
+				}
+				if idx.Len() != len(corpus) {
+					t.Fatalf("Len: got %d, want %d", idx.Len(), len(corpus))
+				}
+
+				queries := randomCorpus(rng, 20, size)
+				for _, q := range queries {
+					all := bruteForce(corpus, q)
+					for _, r := range []similarity.Distance{0, 3, 10, 40, 1e30, similarity.Distance(math.Inf(1))} {
+						got, err := idx.RadiusSearch(q, r)
+						if err != nil {
+							t.Fatalf("RadiusSearch: %v", err)
+						}
+						n := sort.Search(len(all), func(i int) bool { return all[i].dist > r })
+						checkResults(t, got, all[:n])
+					}
+					for _, k := range []int{1, 5, 50} {
+						got, err := idx.KNN(q, k)
+						if err != nil {
+							t.Fatalf("KNN: %v", err)
+						}
+						checkResults(t, got, all[:k])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestIndex_replace(t *testing.T) {
+	for _, ix := range indexes {
+		t.Run(ix.name, func(t *testing.T) {
+			idx := ix.build()
+			if err := idx.Insert(1, hashtype.Binary{0x00, 0x00}); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			if err := idx.Insert(1, hashtype.Binary{0xff, 0xff}); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			if idx.Len() != 1 {
+				t.Errorf("Len: got %d, want 1", idx.Len())
+			}
+			got, err := idx.RadiusSearch(hashtype.Binary{0x00, 0x00}, 8)
+			if err != nil || len(got) != 0 {
+				t.Errorf("old hash still indexed: %v, %v", got, err)
+			}
+			got, err = idx.KNN(hashtype.Binary{0xff, 0xfe}, 3)
+			if err != nil || len(got) != 1 || got[0].ID != 1 || got[0].Distance != 1 {
+				t.Errorf("got %v, %v", got, err)
+			}
+			if idx.Delete(2) {
+				t.Error("Delete of unknown id reported success")
+			}
+		})
+	}
+}
+
+func TestIndex_errors(t *testing.T) {
+	for _, ix := range indexes {
+		t.Run(ix.name, func(t *testing.T) {
+			idx := ix.build()
+			if got, err := idx.KNN(hashtype.Binary{0}, 1); err != nil || len(got) != 0 {
+				t.Errorf("empty KNN: got %v, %v", got, err)
+			}
+			if err := idx.Insert(1, hashtype.Binary{1, 2, 3, 4}); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			if err := idx.Insert(2, hashtype.Binary{1, 2}); !errors.Is(err, index.ErrHashLengthMismatch) {
+				t.Errorf("Insert: got %v, want %v", err, index.ErrHashLengthMismatch)
+			}
+			if err := idx.Insert(2, hashtype.UInt8{1, 2, 3, 4}); !errors.Is(err, index.ErrIncompatibleHash) {
+				t.Errorf("Insert: got %v, want %v", err, index.ErrIncompatibleHash)
+			}
+			if _, err := idx.RadiusSearch(hashtype.Binary{1}, 1); !errors.Is(err, index.ErrHashLengthMismatch) {
+				t.Errorf("RadiusSearch: got %v, want %v", err, index.ErrHashLengthMismatch)
+			}
+			if _, err := idx.KNN(hashtype.Binary{1, 2, 3, 4}, 0); !errors.Is(err, index.ErrInvalidK) {
+				t.Errorf("KNN: got %v, want %v", err, index.ErrInvalidK)
+			}
+		})
+	}
+}
+
+// TestBKTree_concurrentLengthChange searches while another goroutine
+// empties the tree and refills it with a hash of another length. Every
+// search must see a consistent tree and either match or report a length
+// mismatch.
+func TestBKTree_concurrentLengthChange(t *testing.T) {
+	idx := index.NewBKTree[int]()
+	short, long := hashtype.Binary{1, 2}, hashtype.Binary{1, 2, 3, 4}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 500 {
+			h := short
+			if i%2 == 1 {
+				h = long
+			}
+			idx.Delete(1)
+			if err := idx.Insert(1, h); err != nil {
+				t.Errorf("Insert: %v", err)
+				return
+			}
+		}
+	}()
+	for range 500 {
+		for _, q := range []hashtype.Binary{short, long} {
+			if _, err := idx.RadiusSearch(q, 4); err != nil && !errors.Is(err, index.ErrHashLengthMismatch) {
+				t.Fatalf("RadiusSearch: %v", err)
+			}
+			if _, err := idx.KNN(q, 1); err != nil && !errors.Is(err, index.ErrHashLengthMismatch) {
+				t.Fatalf("KNN: %v", err)
+			}
+		}
+	}
+	wg.Wait()
+}
+
+func ExampleBKTree() {
+	tree := index.NewBKTree[string]()
+	_ = tree.Insert("cat", hashtype.Binary{0xff, 0x00, 0x0f, 0xf0})
+	_ = tree.Insert("cat-resized", hashtype.Binary{0xff, 0x00, 0x0f, 0xf1})
+	_ = tree.Insert("dog", hashtype.Binary{0x12, 0x34, 0x56, 0x78})
+
+	matches, err := tree.RadiusSearch(hashtype.Binary{0xff, 0x00, 0x0f, 0xf0}, 5)
+	if err != nil {
+		panic(err)
+	}
+	for _, m := range matches {
+		fmt.Println(m.ID, m.Distance)
+	}
+	// Output:
+	// cat 0
+	// cat-resized 1
+}
@@ -0,0 +1,359 @@
+package index
+
+import (
+	"sync"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// MIH is a multi-index hashing index over Binary hashes using the Hamming
+// distance (Norouzi, Punjani and Fleet, "Fast Search in Hamming Space with
+// Multi-Index Hashing", CVPR 2012).
+//
+// Each hash is split into m contiguous bit substrings, and every substring
+// is stored in its own hash table. By the pigeonhole principle, any hash
+// within distance r of a query matches it in at least one substring with
+// at most r/m differing bits, so a search only probes nearby substring
+// values and verifies the resulting candidates. When probing would cost
+// more than scanning, the index scans instead, so results are always exact.
+//
+// The hash length is fixed by the first insert. An MIH is safe for
+// concurrent use.
+type MIH[ID comparable] struct {
+	mu         sync.RWMutex
+	substrings int
+	bits       int
+	chunks     []mihChunk
+	tables     []map[uint64][]int32
+	entries    []mihEntry[ID]
+	ids        map[ID]int32
+	seq        uint64
+}
+
+type mihChunk struct {
+	start, width int
+}
+
+type mihEntry[ID comparable] struct {
+	id    ID
+	hash  []uint64
+	seq   uint64
+	alive bool
+}
+
+// MIHOption configures an MIH index.
+type MIHOption interface {
+	applyMIH(*mihConfig)
+}
+
+type mihConfig struct {
+	substrings int
+	set        bool
+}
+
+type substringsOption int
+
+func (o substringsOption) applyMIH(c *mihConfig) {
+	c.substrings = int(o)
+	c.set = true
+}
+
+// WithSubstrings sets the number of bit substrings a hash is split into.
+// By default one substring is used per 16 bits of hash length.
+func WithSubstrings(m int) MIHOption { return substringsOption(m) }
+
+// NewMIH creates an empty multi-index hashing index.
+func NewMIH[ID comparable](opts ...MIHOption) (*MIH[ID], error) {
+	var cfg mihConfig
+	for _, o := range opts {
+		o.applyMIH(&cfg)
+	}
+	if cfg.set && cfg.substrings <= 0 {
+		return nil, ErrInvalidSubstrings
+	}
+	return &MIH[ID]{substrings: cfg.substrings, ids: make(map[ID]int32)}, nil
+}
+
+// Insert adds a hash under id, replacing any hash already stored under id.
+func (x *MIH[ID]) Insert(id ID, hash hashtype.Hash) error {
+	words, bits, err := packBinary(hash)
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.chunks == nil {
+		if err := x.layout(bits); err != nil {
+			return err
+		}
+	} else if bits != x.bits {
+		return ErrHashLengthMismatch
+	}
+	if old, ok := x.ids[id]; ok {
+		x.remove(old)
+	}
+	x.seq++
+	x.add(mihEntry[ID]{id: id, hash: words, seq: x.seq, alive: true})
+	x.maybeCompact()
+	return nil
+}
+
+// layout splits a hash of the given length into substrings, spreading
+// any remainder bits over the first substrings.
+func (x *MIH[ID]) layout(bits int) error {
+	m := x.substrings
+	if m == 0 {
+		m = max(1, (bits+15)/16)
+	}
+	if bits > 0 && (m > bits || (bits+m-1)/m > 64) {
+		return ErrInvalidSubstrings
+	}
+	x.bits = bits
+	x.chunks = make([]mihChunk, m)
+	x.tables = make([]map[uint64][]int32, m)
+	start := 0
+	for i := range m {
+		w := bits / m
+		if i < bits%m {
+			w++
+		}
+		x.chunks[i] = mihChunk{start, w}
+		x.tables[i] = make(map[uint64][]int32)
+		start += w
+	}
+	return nil
+}
+
+func (x *MIH[ID]) add(e mihEntry[ID]) {
+	idx := int32(len(x.entries))
+	x.entries = append(x.entries, e)
+	x.ids[e.id] = idx
+	for i, c := range x.chunks {
+		key := substring(e.hash, c)
+		x.tables[i][key] = append(x.tables[i][key], idx)
+	}
+}
+
+func (x *MIH[ID]) remove(idx int32) {
+	e := &x.entries[idx]
+	for i, c := range x.chunks {
+		key := substring(e.hash, c)
+		bucket := x.tables[i][key]
+		for j, v := range bucket {
+			if v == idx {
+				bucket[j] = bucket[len(bucket)-1]
+				bucket = bucket[:len(bucket)-1]
+				break
+			}
+		}
+		if len(bucket) == 0 {
+			delete(x.tables[i], key)
+		} else {
+			x.tables[i][key] = bucket
+		}
+	}
+	e.alive = false
+	delete(x.ids, e.id)
+}
+
+// maybeCompact drops removed entries once they outnumber live ones.
+func (x *MIH[ID]) maybeCompact() {
+	if len(x.entries)-len(x.ids) <= len(x.ids) {
+		return
+	}
+	entries := x.entries
+	x.entries = make([]mihEntry[ID], 0, len(x.ids))
+	for i := range x.tables {
+		x.tables[i] = make(map[uint64][]int32)
+	}
+	for _, e := range entries {
+		if e.alive {
+			x.add(e)
+		}
+	}
+}
+
+// Delete removes the hash stored under id and reports whether it existed.
+func (x *MIH[ID]) Delete(id ID) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	idx, ok := x.ids[id]
+	if !ok {
+		return false
+	}
+	x.remove(idx)
+	x.maybeCompact()
+	return true
+}
+
+// Len returns the number of stored hashes.
+func (x *MIH[ID]) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.ids)
+}
+
+// RadiusSearch returns all hashes within maxDist bits of hash, nearest first.
+func (x *MIH[ID]) RadiusSearch(hash hashtype.Hash, maxDist similarity.Distance) ([]Result[ID], error) {
+	q, bits, err := packBinary(hash)
+	if err != nil {
+		return nil, err
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.chunks == nil {
+		return nil, nil
+	}
+	if bits != x.bits {
+		return nil, ErrHashLengthMismatch
+	}
+	r := binaryRadius(maxDist, x.bits)
+	if r < 0 {
+		return nil, nil
+	}
+	var hits []hit[ID]
+	visit := func(idx int32) {
+		e := &x.entries[idx]
+		if d := hamming(q, e.hash); d <= r {
+			hits = append(hits, hit[ID]{Result[ID]{e.id, similarity.Distance(d)}, e.seq})
+		}
+	}
+	s := r / len(x.chunks)
+	var cost float64
+	for t := 0; t <= s; t++ {
+		cost += x.probeCost(t)
+	}
+	if cost > float64(len(x.ids)) {
+		x.scan(visit)
+		return sortHits(hits), nil
+	}
+	seen := make(map[int32]struct{})
+	for t := 0; t <= s; t++ {
+		x.probe(q, t, seen, visit)
+	}
+	return sortHits(hits), nil
+}
+
+// KNN returns the k hashes nearest to hash, nearest first.
+//
+// Substrings are probed at increasing radius s until the k-th best match
+// is closer than m*(s+1), after which no unprobed hash can improve on it.
+func (x *MIH[ID]) KNN(hash hashtype.Hash, k int) ([]Result[ID], error) {
+	if k <= 0 {
+		return nil, ErrInvalidK
+	}
+	q, bits, err := packBinary(hash)
+	if err != nil {
+		return nil, err
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.chunks == nil {
+		return nil, nil
+	}
+	if bits != x.bits {
+		return nil, ErrHashLengthMismatch
+	}
+	best := newTopK[ID](k)
+	seen := make(map[int32]struct{})
+	visit := func(idx int32) {
+		e := &x.entries[idx]
+		best.push(hit[ID]{Result[ID]{e.id, similarity.Distance(hamming(q, e.hash))}, e.seq})
+	}
+	m := len(x.chunks)
+	var cost float64
+	for s := 0; ; s++ {
+		cost += x.probeCost(s)
+		if k >= len(x.ids) || cost > float64(len(x.ids)) {
+			x.scan(func(idx int32) {
+				if _, ok := seen[idx]; !ok {
+					visit(idx)
+				}
+			})
+			break
+		}
+		x.probe(q, s, seen, visit)
+		if best.full() && best.worst() < m*(s+1) {
+			break
+		}
+	}
+	return sortHits(best.hits), nil
+}
+
+// probeCost returns the number of table lookups needed to probe every
+// substring at exactly s differing bits.
+func (x *MIH[ID]) probeCost(s int) float64 {
+	var cost float64
+	for _, c := range x.chunks {
+		cost += binomial(c.width, s)
+	}
+	return cost
+}
+
+// probe visits every unseen live entry whose substrings differ from the
+// query's in exactly s bits for at least one substring.
+func (x *MIH[ID]) probe(q []uint64, s int, seen map[int32]struct{}, visit func(int32)) {
+	for i, c := range x.chunks {
+		if s > c.width {
+			continue
+		}
+		key := substring(q, c)
+		flips(c.width, s, 0, 0, func(mask uint64) {
+			for _, idx := range x.tables[i][key^mask] {
+				if _, ok := seen[idx]; ok {
+					continue
+				}
+				seen[idx] = struct{}{}
+				visit(idx)
+			}
+		})
+	}
+}
+
+func (x *MIH[ID]) scan(visit func(int32)) {
+	for i := range x.entries {
+		if x.entries[i].alive {
+			visit(int32(i))
+		}
+	}
+}
+
+// substring extracts the bits covered by c as an integer.
+func substring(words []uint64, c mihChunk) uint64 {
+	if c.width == 0 {
+		return 0
+	}
+	w, off := c.start/64, c.start%64
+	v := words[w] >> off
+	if off+c.width > 64 {
+		v |= words[w+1] << (64 - off)
+	}
+	if c.width < 64 {
+		v &= 1<<c.width - 1
+	}
+	return v
+}
+
+// flips calls fn with every width-bit mask that has exactly n bits set
+// at positions from start upward, combined with mask.
+func flips(width, n, start int, mask uint64, fn func(uint64)) {
+	if n == 0 {
+		fn(mask)
+		return
+	}
+	for b := start; b <= width-n; b++ {
+		flips(width, n-1, b+1, mask|1<<b, fn)
+	}
+}
+
+func binomial(n, k int) float64 {
+	if k < 0 || k > n {
+		return 0
+	}
+	r := 1.0
+	for i := range k {
+		r = r * float64(n-i) / float64(i+1)
+	}
+	return r
+}
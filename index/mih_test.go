@@ -0,0 +1,68 @@
+package index_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/index"
+)
+
+var mihSubstringTests = []struct {
+	name       string
+	substrings int
+	size       int
+	expect     error
+}{
+	{"zero", 0, 8, index.ErrInvalidSubstrings},
+	{"negative", -1, 8, index.ErrInvalidSubstrings},
+	{"more than bits", 65, 8, index.ErrInvalidSubstrings},
+	{"substring wider than 64 bits", 1, 16, index.ErrInvalidSubstrings},
+	{"one per bit", 64, 8, nil},
+	{"uneven", 5, 32, nil},
+}
+
+func TestMIH_substrings(t *testing.T) {
+	for _, tt := range mihSubstringTests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := index.NewMIH[int](index.WithSubstrings(tt.substrings))
+			if err == nil {
+				err = x.Insert(1, make(hashtype.Binary, tt.size))
+			}
+			if !errors.Is(err, tt.expect) {
+				t.Fatalf("got %v, want %v", err, tt.expect)
+			}
+			if err != nil {
+				return
+			}
+			q := make(hashtype.Binary, tt.size)
+			q[0] = 0x03
+			got, err := x.KNN(q, 1)
+			if err != nil || len(got) != 1 || got[0].Distance != 2 {
+				t.Errorf("got %v, %v", got, err)
+			}
+		})
+	}
+}
+
+func ExampleMIH() {
+	mih, err := index.NewMIH[int](index.WithSubstrings(4))
+	if err != nil {
+		panic(err)
+	}
+	_ = mih.Insert(1, hashtype.Binary{0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00})
+	_ = mih.Insert(2, hashtype.Binary{0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x07})
+	_ = mih.Insert(3, hashtype.Binary{0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff})
+
+	nearest, err := mih.KNN(hashtype.Binary{0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x01}, 2)
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range nearest {
+		fmt.Println(r.ID, r.Distance)
+	}
+	// Output:
+	// 1 1
+	// 2 2
+}
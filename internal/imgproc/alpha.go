@@ -0,0 +1,56 @@
+package imgproc
+
+import (
+	"image"
+	"image/color"
+)
+
+// Composite blends img over the opaque background colour bg and returns
+// the opaque result. It rounds like draw.Draw with draw.Over, so the
+// result equals drawing img over a background filled with bg.
+func Composite(img image.Image, bg color.RGBA) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	br, bgg, bb := uint32(bg.R)*0x101, uint32(bg.G)*0x101, uint32(bg.B)*0x101
+	i := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			t := 0xffff - a
+			dst.Pix[i+0] = uint8((r + br*t/0xffff) >> 8)
+			dst.Pix[i+1] = uint8((g + bgg*t/0xffff) >> 8)
+			dst.Pix[i+2] = uint8((bl + bb*t/0xffff) >> 8)
+			dst.Pix[i+3] = 0xff
+			i += 4
+		}
+	}
+	return dst
+}
+
+// DropAlpha returns img with every pixel made opaque, keeping its colour
+// without alpha premultiplication. For *image.NRGBA images the stored
+// colours are kept as they are, including under fully transparent pixels.
+func DropAlpha(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	i := 0
+	if n, ok := img.(*image.NRGBA); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := n.Pix[n.PixOffset(b.Min.X, y):]
+			for x := range b.Dx() {
+				copy(dst.Pix[i:i+3], row[4*x:4*x+3])
+				dst.Pix[i+3] = 0xff
+				i += 4
+			}
+		}
+		return dst
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			dst.Pix[i+0], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = c.R, c.G, c.B, 0xff
+			i += 4
+		}
+	}
+	return dst
+}
@@ -0,0 +1,63 @@
+package imgproc
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestComposite(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	tests := []struct {
+		name string
+		c    color.NRGBA
+		bg   color.RGBA
+		want color.RGBA
+	}{
+		{"opaque", color.NRGBA{10, 20, 30, 255}, white, color.RGBA{10, 20, 30, 255}},
+		{"transparent", color.NRGBA{10, 20, 30, 0}, white, white},
+		{"transparent over colour", color.NRGBA{200, 0, 0, 0}, color.RGBA{0, 128, 255, 255}, color.RGBA{0, 128, 255, 255}},
+		{"half over white", color.NRGBA{0, 0, 0, 128}, white, color.RGBA{127, 127, 127, 255}},
+		{"half over black", color.NRGBA{255, 255, 255, 128}, color.RGBA{0, 0, 0, 255}, color.RGBA{128, 128, 128, 255}},
+	}
+	for _, tt := range tests {
+		img := image.NewNRGBA(image.Rect(2, 3, 3, 4))
+		img.SetNRGBA(2, 3, tt.c)
+		out := Composite(img, tt.bg)
+		if out.Bounds() != img.Bounds() {
+			t.Fatalf("%s: got bounds %v, want %v", tt.name, out.Bounds(), img.Bounds())
+		}
+		if got := out.RGBAAt(2, 3); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDropAlpha(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		want color.RGBA
+	}{
+		{"nrgba keeps hidden colour", func() image.Image {
+			img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+			img.SetNRGBA(0, 0, color.NRGBA{200, 100, 50, 0})
+			return img
+		}(), color.RGBA{200, 100, 50, 255}},
+		{"rgba unpremultiplies", func() image.Image {
+			img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+			img.SetRGBA(0, 0, color.RGBA{50, 25, 0, 128})
+			return img
+		}(), color.RGBA{99, 49, 0, 255}},
+		{"gray", func() image.Image {
+			img := image.NewGray(image.Rect(0, 0, 1, 1))
+			img.SetGray(0, 0, color.Gray{77})
+			return img
+		}(), color.RGBA{77, 77, 77, 255}},
+	}
+	for _, tt := range tests {
+		if got := DropAlpha(tt.img).RGBAAt(0, 0); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
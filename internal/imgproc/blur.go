@@ -4,12 +4,29 @@ package imgproc
 
 import (
 	"image"
+	"image/draw"
 	"math"
 )
 
 // GaussianBlur computes and returns an image with an applied Gaussian filter.
 // Both kernel and sigma are parameters used for generating a Gaussian filter kernel.
 func GaussianBlur(img image.Image, kernel int, sigma float64) image.Image {
+	width, height := getSize(img)
+	r := image.Rect(0, 0, width, height)
+	var dst draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		dst = image.NewGray(r)
+	} else {
+		dst = image.NewRGBA(r)
+	}
+	GaussianBlurInto(dst, img, kernel, sigma)
+	return dst
+}
+
+// GaussianBlurInto is like GaussianBlur but writes into dst, which must
+// have the size of img and be an *image.Gray when img is one and an
+// *image.RGBA otherwise.
+func GaussianBlurInto(dst draw.Image, img image.Image, kernel int, sigma float64) {
 	// If kernel size is zero compute it from sigma.
 	if kernel == 0 && sigma > 0 {
 		kernel = cvRound(sigma*3*2+1) | 1
@@ -21,9 +38,9 @@ func GaussianBlur(img image.Image, kernel int, sigma float64) image.Image {
 	}
 	switch i := img.(type) {
 	case *image.Gray:
-		return sepFilter2DGray(i, kernelInt)
+		sepFilter2DGray(dst.(*image.Gray), i, kernelInt)
 	default:
-		return sepFilter2D(i, kernelInt)
+		sepFilter2D(dst.(*image.RGBA), i, kernelInt)
 	}
 }
 
@@ -0,0 +1,110 @@
+package imgproc
+
+import (
+	"image"
+	"image/draw"
+	"slices"
+)
+
+// A border line may have one pixel, plus one in borderOutliers, that
+// differs from the border colour by more than the tolerance. This absorbs
+// JPEG ringing and stray noise.
+const borderOutliers = 50
+
+// ContentBounds returns the bounds of img without the uniform borders on
+// each side. A side has a border when its outermost row or column is of
+// one colour, the per-channel median of that line; the border extends
+// inwards over every line whose pixels stay within tolerance of that
+// colour on all 8-bit channels, allowing a few stray pixels. Rows are
+// trimmed first, and columns are then measured between the remaining rows.
+// An image that is uniform throughout has no content to crop to and its
+// bounds are returned unchanged.
+func ContentBounds(img image.Image, tolerance uint8) image.Rectangle {
+	b := img.Bounds()
+	if b.Empty() {
+		return b
+	}
+	c := b
+	c.Min.Y += borderDepth(img, image.Rect(c.Min.X, c.Min.Y, c.Max.X, c.Min.Y+1), image.Pt(0, 1), c.Dy(), tolerance)
+	c.Max.Y -= borderDepth(img, image.Rect(c.Min.X, c.Max.Y-1, c.Max.X, c.Max.Y), image.Pt(0, -1), c.Dy(), tolerance)
+	if c.Dy() <= 0 {
+		return b
+	}
+	c.Min.X += borderDepth(img, image.Rect(c.Min.X, c.Min.Y, c.Min.X+1, c.Max.Y), image.Pt(1, 0), c.Dx(), tolerance)
+	c.Max.X -= borderDepth(img, image.Rect(c.Max.X-1, c.Min.Y, c.Max.X, c.Max.Y), image.Pt(-1, 0), c.Dx(), tolerance)
+	if c.Dx() <= 0 {
+		return b
+	}
+	return c
+}
+
+// borderDepth returns how many of n lines, starting at the one-pixel-thick
+// outer line and stepping inwards by step, belong to a uniform border.
+func borderDepth(img image.Image, outer image.Rectangle, step image.Point, n int, tolerance uint8) int {
+	ref := medianColor(img, outer)
+	allowed := 1 + max(outer.Dx(), outer.Dy())/borderOutliers
+	line := outer
+	for d := range n {
+		outliers := 0
+		for y := line.Min.Y; y < line.Max.Y; y++ {
+			for x := line.Min.X; x < line.Max.X; x++ {
+				if !within(rgb8(img, x, y), ref, tolerance) {
+					if outliers++; outliers > allowed {
+						return d
+					}
+				}
+			}
+		}
+		line = line.Add(step)
+	}
+	return n
+}
+
+// medianColor returns the per-channel median colour of the pixels in r.
+func medianColor(img image.Image, r image.Rectangle) [3]uint8 {
+	var ch [3][]uint8
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			px := rgb8(img, x, y)
+			for c := range ch {
+				ch[c] = append(ch[c], px[c])
+			}
+		}
+	}
+	var m [3]uint8
+	for c := range ch {
+		slices.Sort(ch[c])
+		m[c] = ch[c][len(ch[c])/2]
+	}
+	return m
+}
+
+func rgb8(img image.Image, x, y int) [3]uint8 {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}
+}
+
+func within(a, b [3]uint8, tolerance uint8) bool {
+	for c := range a {
+		d := int(a[c]) - int(b[c])
+		if d > int(tolerance) || -d > int(tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+// Crop copies the part of img inside r to a new image whose bounds start
+// at the origin. Gray images stay gray and other images become RGBA.
+func Crop(img image.Image, r image.Rectangle) image.Image {
+	r = r.Intersect(img.Bounds())
+	dr := image.Rect(0, 0, r.Dx(), r.Dy())
+	var dst draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		dst = image.NewGray(dr)
+	} else {
+		dst = image.NewRGBA(dr)
+	}
+	draw.Draw(dst, dr, img, r.Min, draw.Src)
+	return dst
+}
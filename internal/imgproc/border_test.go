@@ -0,0 +1,78 @@
+package imgproc
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// padded returns a 40x30 image with a textured 20x10 content area at
+// (12, 8), surrounded by black bars above and below and white bars on the
+// sides, with noise of up to noise levels added to the bars.
+func padded(noise int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	seed := uint32(1)
+	next := func() int {
+		seed = seed*1664525 + 1013904223
+		return int(seed >> 24)
+	}
+	for y := range 30 {
+		for x := range 40 {
+			var c color.RGBA
+			switch {
+			case y < 8 || y >= 18:
+				v := uint8(next() % (noise + 1))
+				c = color.RGBA{v, v, v, 255}
+			case x < 12 || x >= 32:
+				v := 255 - uint8(next()%(noise+1))
+				c = color.RGBA{v, v, v, 255}
+			default:
+				c = color.RGBA{uint8(x * 12), uint8(y * 9), 128, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestContentBounds(t *testing.T) {
+	noisy := padded(6)
+	// A few stray pixels in the top bar, as left by JPEG ringing.
+	noisy.SetRGBA(3, 2, color.RGBA{200, 0, 0, 255})
+	uniform := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range uniform.Pix {
+		uniform.Pix[i] = 90
+	}
+	tests := []struct {
+		name      string
+		img       image.Image
+		tolerance uint8
+		want      image.Rectangle
+	}{
+		{"clean borders", padded(0), 0, image.Rect(12, 8, 32, 18)},
+		{"noisy borders", noisy, 8, image.Rect(12, 8, 32, 18)},
+		{"noise above tolerance", padded(40), 8, image.Rect(0, 0, 40, 30)},
+		{"uniform image", uniform, 0, uniform.Bounds()},
+		{"empty image", image.NewRGBA(image.Rect(0, 0, 0, 0)), 0, image.Rect(0, 0, 0, 0)},
+		{"offset bounds", padded(0).SubImage(image.Rect(5, 4, 40, 30)), 0, image.Rect(12, 8, 32, 18)},
+	}
+	for _, tt := range tests {
+		if got := ContentBounds(tt.img, tt.tolerance); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCrop(t *testing.T) {
+	img := padded(0)
+	out := Crop(img, image.Rect(12, 8, 32, 18))
+	if out.Bounds() != image.Rect(0, 0, 20, 10) {
+		t.Fatalf("got bounds %v, want (0,0)-(20,10)", out.Bounds())
+	}
+	if got, want := out.At(3, 2), img.At(15, 10); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, ok := Crop(image.NewGray(image.Rect(0, 0, 4, 4)), image.Rect(1, 1, 3, 3)).(*image.Gray); !ok {
+		t.Error("gray image was not cropped to a gray image")
+	}
+}
@@ -3,7 +3,6 @@ package imgproc
 import (
 	"errors"
 	"image"
-	"image/color"
 )
 
 // ErrImageIsNil is returned when a nil image is passed to a conversion function.
@@ -14,14 +13,39 @@ func Grayscale(img image.Image) (*image.Gray, error) {
 	if img == nil {
 		return nil, ErrImageIsNil
 	}
+	gray := image.NewGray(img.Bounds())
+	GrayscaleInto(gray, img)
+	return gray, nil
+}
+
+// GrayscaleInto is like Grayscale but writes into gray, which must have
+// the bounds of img.
+func GrayscaleInto(gray *image.Gray, img image.Image) {
 	bounds := img.Bounds()
-	gray := image.NewGray(bounds)
-	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
-		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
-			gray.Set(x, y, img.At(x, y))
+	switch src := img.(type) {
+	case *image.Gray:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			copy(gray.Pix[gray.PixOffset(bounds.Min.X, y):][:bounds.Dx()], src.Pix[src.PixOffset(bounds.Min.X, y):])
+		}
+	case *image.YCbCr, *image.RGBA, *image.NRGBA:
+		row, put := getScratch[uint32](&u32Pool, 4*bounds.Dx())
+		defer put()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			RGBA64Row(img, y, row)
+			dst := gray.Pix[gray.PixOffset(bounds.Min.X, y):]
+			for x := range bounds.Dx() {
+				// The luma formula of color.GrayModel.
+				r, g, b := row[4*x], row[4*x+1], row[4*x+2]
+				dst[x] = uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+			}
+		}
+	default:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				gray.Set(x, y, img.At(x, y))
+			}
 		}
 	}
-	return gray, nil
 }
 
 // YCrCb converts an image from RGB to YCrCb color space.
@@ -29,16 +53,25 @@ func YCrCb(img image.Image) (image.Image, error) {
 	if img == nil {
 		return nil, ErrImageIsNil
 	}
+	ycrcb := image.NewRGBA(img.Bounds())
+	YCrCbInto(ycrcb, img)
+	return ycrcb, nil
+}
+
+// YCrCbInto is like YCrCb but writes into dst, which must have the bounds
+// of img.
+func YCrCbInto(dst *image.RGBA, img image.Image) {
 	bounds := img.Bounds()
-	ycrcb := image.NewRGBA(bounds)
-	for x := bounds.Min.X; x < bounds.Max.X; x++ {
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			r, g, b, a := img.At(x, y).RGBA()
-			yy, cb, cr := rgbToYCbCr(uint8(r/0x101), uint8(g/0x101), uint8(b/0x101))
-			ycrcb.SetRGBA(x, y, color.RGBA{cb, cr, yy, uint8(a / 0x101)})
+	row, put := getScratch[uint32](&u32Pool, 4*bounds.Dx())
+	defer put()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		RGBA64Row(img, y, row)
+		pix := dst.Pix[dst.PixOffset(bounds.Min.X, y):]
+		for x := range bounds.Dx() {
+			yy, cb, cr := rgbToYCbCr(uint8(row[4*x]/0x101), uint8(row[4*x+1]/0x101), uint8(row[4*x+2]/0x101))
+			pix[4*x], pix[4*x+1], pix[4*x+2], pix[4*x+3] = cb, cr, yy, uint8(row[4*x+3]/0x101)
 		}
 	}
-	return ycrcb, nil
 }
 
 // HSV converts an image from RGB to HSV color space.
@@ -46,16 +79,25 @@ func HSV(img image.Image) (image.Image, error) {
 	if img == nil {
 		return nil, ErrImageIsNil
 	}
+	hsv := image.NewRGBA(img.Bounds())
+	HSVInto(hsv, img)
+	return hsv, nil
+}
+
+// HSVInto is like HSV but writes into dst, which must have the bounds of
+// img.
+func HSVInto(dst *image.RGBA, img image.Image) {
 	bounds := img.Bounds()
-	hsv := image.NewRGBA(bounds)
-	for x := bounds.Min.X; x < bounds.Max.X; x++ {
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			r, g, b, a := img.At(x, y).RGBA()
-			h, s, v := rgbToHSV(uint8(r/0x101), uint8(g/0x101), uint8(b/0x101))
-			hsv.SetRGBA(x, y, color.RGBA{v, s, h, uint8(a / 0x101)})
+	row, put := getScratch[uint32](&u32Pool, 4*bounds.Dx())
+	defer put()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		RGBA64Row(img, y, row)
+		pix := dst.Pix[dst.PixOffset(bounds.Min.X, y):]
+		for x := range bounds.Dx() {
+			h, s, v := rgbToHSV(uint8(row[4*x]/0x101), uint8(row[4*x+1]/0x101), uint8(row[4*x+2]/0x101))
+			pix[4*x], pix[4*x+1], pix[4*x+2], pix[4*x+3] = v, s, h, uint8(row[4*x+3]/0x101)
 		}
 	}
-	return hsv, nil
 }
 
 // rgbToYCbCr converts a single RGB pixel to YCbCr using fixed-point arithmetic.
@@ -6,12 +6,11 @@ import "image"
 func GrayToF32(img *image.Gray) [][]float32 {
 	bounds := img.Bounds()
 	width, height := getSize(img)
-	f32Img := make([][]float32, height)
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		f32Img[y-bounds.Min.Y] = make([]float32, width)
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			pixel := img.GrayAt(x, y).Y
-			f32Img[y-bounds.Min.Y][x-bounds.Min.X] = saturateCastUI8ToF32(pixel)
+	f32Img := NewMatF32(height, width)
+	for y := range f32Img {
+		pix := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+		for x := range f32Img[y] {
+			f32Img[y][x] = saturateCastUI8ToF32(pix[x])
 		}
 	}
 	return f32Img
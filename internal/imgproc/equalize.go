@@ -8,9 +8,16 @@ import (
 // EqualizeHist equalizes the histogram of the input image to
 // normalize the brightness and increases the contrast of the image.
 func EqualizeHist(img *image.Gray) *image.Gray {
+	gray := image.NewGray(img.Bounds())
+	EqualizeHistInto(gray, img)
+	return gray
+}
+
+// EqualizeHistInto is like EqualizeHist but writes into dst, which must
+// have the bounds of img.
+func EqualizeHistInto(dst, img *image.Gray) {
 	const histogramSize = 256
 	bounds := img.Bounds()
-	gray := image.NewGray(bounds)
 	histogram := [histogramSize]int{}
 	for x := bounds.Min.X; x < bounds.Max.X; x++ {
 		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
@@ -36,8 +43,7 @@ func EqualizeHist(img *image.Gray) *image.Gray {
 	for x := bounds.Min.X; x < bounds.Max.X; x++ {
 		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 			pixel := img.GrayAt(x, y).Y
-			gray.SetGray(x, y, color.Gray{lut[pixel]})
+			dst.SetGray(x, y, color.Gray{lut[pixel]})
 		}
 	}
-	return gray
 }
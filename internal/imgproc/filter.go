@@ -2,191 +2,220 @@ package imgproc
 
 import (
 	"image"
-	"image/color"
 )
 
-// Filter2DGray applies a 2-D convolution kernel to a grayscale image.
+// Filter2DGray applies a 2-D convolution kernel to a grayscale image,
+// reflecting the image at its borders.
 func Filter2DGray(img *image.Gray, kernel [][]float32) [][]float32 {
-	bounds := img.Bounds()
 	width, height := getSize(img)
-	ret := make([][]float32, height)
-	for i := 0; i < height; i++ {
-		ret[i] = make([]float32, width)
+	ret := NewMatF32(height, width)
+	if width == 0 || height == 0 {
+		return ret
+	}
+	kh, kw := len(kernel), len(kernel[0])
+	midY, midX := (kh-1)/2, (kw-1)/2
+
+	// Pad the image by the kernel radius so the inner loop runs over
+	// contiguous memory without border handling.
+	pw, ph := width+kw-1, height+kh-1
+	scratch, put := getScratch[float64](&f64Pool, pw*ph+kh*kw)
+	defer put()
+	pad, k := scratch[:pw*ph], scratch[pw*ph:]
+	cols, putCols := getScratch[int](&intPool, pw)
+	defer putCols()
+	for px := range cols {
+		cols[px] = reflect101(px-midX, width)
+	}
+	bounds := img.Bounds()
+	for py := range ph {
+		dst := pad[py*pw : (py+1)*pw]
+		iy := reflect101(py-midY, height)
+		if iy < 0 {
+			clear(dst)
+			continue
+		}
+		src := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+iy):]
+		for px, ix := range cols {
+			if ix < 0 {
+				dst[px] = 0
+				continue
+			}
+			dst[px] = float64(src[ix])
+		}
+	}
+
+	for ky := range kh {
+		for kx := range kw {
+			k[ky*kw+kx] = float64(kernel[ky][kx])
+		}
 	}
-	midY, midX := (len(kernel)-1)/2, (len(kernel[0])-1)/2
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+	for y := range height {
+		out := ret[y]
+		for x := range width {
 			var sum float64
-			for yo, ky := y-midY, 0; yo <= y+midY; yo, ky = yo+1, ky+1 {
-				for xo, kx := x-midX, 0; xo <= x+midX; xo, kx = xo+1, kx+1 {
-					iX, iY := borderReflect101(xo, yo, bounds)
-					sum += float64(kernel[ky][kx]) * float64(img.GrayAt(iX, iY).Y)
+			for ky := range kh {
+				krow := k[ky*kw : (ky+1)*kw]
+				prow := pad[(y+ky)*pw+x:][:kw]
+				for kx, kv := range krow {
+					sum += kv * prow[kx]
 				}
 			}
-			ret[y][x] = float32(sum)
+			out[x] = float32(sum)
 		}
 	}
 	return ret
 }
 
-func borderReflect101(x, y int, bounds image.Rectangle) (int, int) {
-	rX, rY := x, y
-	if rX < bounds.Min.X {
-		rX = bounds.Min.X + (bounds.Min.X - x)
+// reflect101 mirrors an index that lies outside [0, n) once at the nearest
+// border without repeating the border element, like OpenCV's
+// BORDER_REFLECT_101. It returns -1 when the index is still outside, which
+// only happens for kernels larger than the image; such pixels read as 0.
+func reflect101(i, n int) int {
+	switch {
+	case i < 0:
+		i = -i
+	case i >= n:
+		i = 2*n - 2 - i
+	}
+	if i < 0 || i >= n {
+		return -1
+	}
+	return i
+}
+
+// sepTaps returns the indices of the neighbours i pixels before and after
+// index x on an axis of length n. Neighbours past a border are taken i
+// pixels inside it, and -1 marks neighbours that are still outside.
+func sepTaps(x, i, n int) (int, int) {
+	p, q := x-i, x+i
+	if p < 0 {
+		p = i
 	}
-	if rX >= bounds.Max.X {
-		rX = bounds.Max.X - 1 - (x - bounds.Max.X + 1)
+	if q >= n {
+		q = n - 1 - i
 	}
-	if rY < bounds.Min.Y {
-		rY = bounds.Min.Y + (bounds.Min.Y - y)
+	if p >= n {
+		p = -1
 	}
-	if rY >= bounds.Max.Y {
-		rY = bounds.Max.Y - 1 - (y - bounds.Max.Y + 1)
+	if q < 0 {
+		q = -1
+	}
+	return p, q
+}
+
+// sepTap returns buf[i], or 0 when i is -1.
+func sepTap[T uint8 | int](buf []T, i int) int {
+	if i < 0 {
+		return 0
+	}
+	return int(buf[i])
+}
+
+// sepRound converts a filtered fixed-point sum back to 8 bits.
+func sepRound(s int) uint8 {
+	s = (s + 1<<15) >> 16
+	switch {
+	case s > 255:
+		return 255
+	case s < 0:
+		return 0
+	default:
+		return uint8(s - 1)
 	}
-	return rX, rY
 }
 
-func sepFilter2DGray(img *image.Gray, kernel []int) image.Image {
+func sepFilter2DGray(dst, img *image.Gray, kernel []int) {
 	bounds := img.Bounds()
 	width, height := getSize(img)
-	dst := image.NewGray(image.Rect(0, 0, width, height))
-	buff := make([]int, width*height)
+	// One pooled buffer holds the horizontal pass and a column, so the
+	// pool hands back a buffer of the same size on the next call.
+	scratch, put := getScratch[int](&intPool, width*height+height)
+	defer put()
+	buff, col := scratch[:width*height], scratch[width*height:]
 	mid := (len(kernel) - 1) / 2
 	rem := len(kernel) - 1 - mid
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			g := img.GrayAt(x, y).Y
-			sG := int(g) * kernel[mid]
+	for y := range height {
+		src := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+y):][:width]
+		out := buff[y*width : (y+1)*width]
+		for x := range width {
+			sG := int(src[x]) * kernel[mid]
 			for i := 1; i <= rem; i++ {
-				iX := x - i
-				if iX < bounds.Min.X {
-					iX = bounds.Min.X + i
-				}
-				gP := img.GrayAt(iX, y).Y
-				iX = x + i
-				if iX >= bounds.Max.X {
-					iX = bounds.Max.X - 1 - i
-				}
-				gN := img.GrayAt(iX, y).Y
-				sG += int(gP)*kernel[mid-i] + int(gN)*kernel[mid+i]
+				p, q := sepTaps(x, i, width)
+				sG += sepTap(src, p)*kernel[mid-i] + sepTap(src, q)*kernel[mid+i]
 			}
-			buff[y*width+x] = sG
+			out[x] = sG
 		}
 	}
-	for x := bounds.Min.X; x < bounds.Max.X; x++ {
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			g := buff[y*width+x]
-			sG := g*kernel[mid] + 65536
+	for x := range width {
+		for y := range height {
+			col[y] = buff[y*width+x]
+		}
+		for y := range height {
+			sG := col[y]*kernel[mid] + 65536
 			for i := 1; i <= rem; i++ {
-				iY := y - i
-				if iY < bounds.Min.Y {
-					iY = bounds.Min.Y + i
-				}
-				gP := buff[iY*width+x]
-				iY = y + i
-				if iY >= bounds.Max.Y {
-					iY = bounds.Max.Y - 1 - i
-				}
-				gN := buff[iY*width+x]
-				sG += gP*kernel[mid-i] + gN*kernel[mid+i]
-			}
-			sG = (sG + 1<<15) >> 16
-			if sG > 255 {
-				sG = 255
-			} else if sG < 0 {
-				sG = 0
-			} else {
-				sG--
+				p, q := sepTaps(y, i, height)
+				sG += sepTap(col, p)*kernel[mid-i] + sepTap(col, q)*kernel[mid+i]
 			}
-			dst.SetGray(x, y, color.Gray{uint8(sG)})
+			dst.Pix[y*dst.Stride+x] = sepRound(sG)
 		}
 	}
-	return dst
 }
 
-func sepFilter2D(img image.Image, kernel []int) image.Image {
-	bounds := img.Bounds()
+func sepFilter2D(dst *image.RGBA, img image.Image, kernel []int) {
 	width, height := getSize(img)
-	dst := image.NewRGBA(image.Rect(0, 0, width, height))
-	buffR := make([]int, width*height)
-	buffG := make([]int, width*height)
-	buffB := make([]int, width*height)
+	// Horizontal pass into one plane per channel; alpha is kept as is.
+	// One pooled buffer holds the planes, the source row and a column, so
+	// the pool hands back a buffer of the same size on the next call.
+	scratch, put := getScratch[int](&intPool, 4*width*height+3*width+height)
+	defer put()
+	buff := scratch[:4*width*height]
+	src := scratch[4*width*height : 4*width*height+3*width]
+	col := scratch[4*width*height+3*width:]
+	planes := [3][]int{buff[:width*height], buff[width*height : 2*width*height], buff[2*width*height : 3*width*height]}
+	alpha := buff[3*width*height : 4*width*height]
+	row, putRow := getScratch[uint32](&u32Pool, 4*width)
+	defer putRow()
 	mid := (len(kernel) - 1) / 2
 	rem := len(kernel) - 1 - mid
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, _ := img.At(x, y).RGBA()
-			sR := int(r/0x101) * kernel[mid]
-			sG := int(g/0x101) * kernel[mid]
-			sB := int(b/0x101) * kernel[mid]
-			for i := 1; i <= rem; i++ {
-				iX := x - i
-				if iX < bounds.Min.X {
-					iX = bounds.Min.X + i
-				}
-				rP, gP, bP, _ := img.At(iX, y).RGBA()
-				iX = x + i
-				if iX >= bounds.Max.X {
-					iX = bounds.Max.X - 1 - i
-				}
-				rN, gN, bN, _ := img.At(iX, y).RGBA()
-				sR += int(rP/0x101)*kernel[mid-i] + int(rN/0x101)*kernel[mid+i]
-				sG += int(gP/0x101)*kernel[mid-i] + int(gN/0x101)*kernel[mid+i]
-				sB += int(bP/0x101)*kernel[mid-i] + int(bN/0x101)*kernel[mid+i]
+	for y := range height {
+		RGBA64Row(img, img.Bounds().Min.Y+y, row)
+		for x := range width {
+			for c := range 3 {
+				src[c*width+x] = int(row[4*x+c] / 0x101)
 			}
-			buffR[y*width+x] = sR
-			buffG[y*width+x] = sG
-			buffB[y*width+x] = sB
+			alpha[y*width+x] = int(row[4*x+3] / 0x101)
 		}
-	}
-	for x := bounds.Min.X; x < bounds.Max.X; x++ {
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			r, g, b := buffR[y*width+x], buffG[y*width+x], buffB[y*width+x]
-			sR := r*kernel[mid] + 65536
-			sG := g*kernel[mid] + 65536
-			sB := b*kernel[mid] + 65536
-			for i := 1; i <= rem; i++ {
-				iY := y - i
-				if iY < bounds.Min.Y {
-					iY = bounds.Min.Y + i
+		for c, plane := range planes {
+			s := src[c*width : (c+1)*width]
+			out := plane[y*width : (y+1)*width]
+			for x := range width {
+				sum := s[x] * kernel[mid]
+				for i := 1; i <= rem; i++ {
+					p, q := sepTaps(x, i, width)
+					sum += sepTap(s, p)*kernel[mid-i] + sepTap(s, q)*kernel[mid+i]
 				}
-				rP, gP, bP := buffR[iY*width+x], buffG[iY*width+x], buffB[iY*width+x]
-				iY = y + i
-				if iY >= bounds.Max.Y {
-					iY = bounds.Max.Y - 1 - i
-				}
-				rN, gN, bN := buffR[iY*width+x], buffG[iY*width+x], buffB[iY*width+x]
-				sR += rP*kernel[mid-i] + rN*kernel[mid+i]
-				sG += gP*kernel[mid-i] + gN*kernel[mid+i]
-				sB += bP*kernel[mid-i] + bN*kernel[mid+i]
-			}
-			sR = (sR + 1<<15) >> 16
-			if sR > 255 {
-				sR = 255
-			} else if sR < 0 {
-				sR = 0
-			} else {
-				sR--
+				out[x] = sum
 			}
-			sG = (sG + 1<<15) >> 16
-			if sG > 255 {
-				sG = 255
-			} else if sG < 0 {
-				sG = 0
-			} else {
-				sG--
+		}
+	}
+	for c, plane := range planes {
+		for x := range width {
+			for y := range height {
+				col[y] = plane[y*width+x]
 			}
-			sB = (sB + 1<<15) >> 16
-			if sB > 255 {
-				sB = 255
-			} else if sB < 0 {
-				sB = 0
-			} else {
-				sB--
+			for y := range height {
+				sum := col[y]*kernel[mid] + 65536
+				for i := 1; i <= rem; i++ {
+					p, q := sepTaps(y, i, height)
+					sum += sepTap(col, p)*kernel[mid-i] + sepTap(col, q)*kernel[mid+i]
+				}
+				dst.Pix[y*dst.Stride+4*x+c] = sepRound(sum)
 			}
-			_, _, _, a := img.At(x, y).RGBA()
-			dst.Set(x, y, color.RGBA{uint8(sR), uint8(sG), uint8(sB), uint8(a / 0x101)})
 		}
 	}
-	return dst
+	for y := range height {
+		for x, a := range alpha[y*width : (y+1)*width] {
+			dst.Pix[y*dst.Stride+4*x+3] = uint8(a)
+		}
+	}
 }
@@ -6,26 +6,24 @@ import (
 	"testing"
 )
 
-func TestBorderReflect101(t *testing.T) {
-	bounds := image.Rect(0, 0, 10, 10)
+func TestReflect101(t *testing.T) {
 	tests := []struct {
-		name    string
-		x, y    int
-		expectX int
-		expectY int
+		name string
+		i    int
+		want int
 	}{
-		{"inside", 5, 5, 5, 5},
-		{"left edge", -1, 5, 1, 5},
-		{"right edge", 10, 5, 8, 5},
-		{"top edge", 5, -1, 5, 1},
-		{"bottom edge", 5, 10, 5, 8},
-		{"corner", -1, -1, 1, 1},
+		{"inside", 5, 5},
+		{"left edge", -1, 1},
+		{"right edge", 10, 8},
+		{"two past left edge", -2, 2},
+		{"two past right edge", 11, 7},
+		{"beyond reflection", -10, -1},
+		{"beyond right reflection", 19, -1},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rx, ry := borderReflect101(tt.x, tt.y, bounds)
-			if rx != tt.expectX || ry != tt.expectY {
-				t.Errorf("got (%d, %d), want (%d, %d)", rx, ry, tt.expectX, tt.expectY)
+			if got := reflect101(tt.i, 10); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
 			}
 		})
 	}
@@ -60,10 +58,12 @@ func TestSepFilter2DGray(t *testing.T) {
 		}
 	}
 	kernel := []int{64, 128, 64}
-	result := sepFilter2DGray(img, kernel)
-	bounds := result.Bounds()
-	if bounds.Dx() != 5 || bounds.Dy() != 5 {
-		t.Errorf("expected 5x5 result, got %dx%d", bounds.Dx(), bounds.Dy())
+	result := image.NewGray(img.Bounds())
+	sepFilter2DGray(result, img, kernel)
+	for i, v := range result.Pix {
+		if v != 128 {
+			t.Fatalf("pixel %d = %d, want 128", i, v)
+		}
 	}
 }
 
@@ -75,9 +75,9 @@ func TestSepFilter2D(t *testing.T) {
 		}
 	}
 	kernel := []int{64, 128, 64}
-	result := sepFilter2D(img, kernel)
-	bounds := result.Bounds()
-	if bounds.Dx() != 5 || bounds.Dy() != 5 {
-		t.Errorf("expected 5x5 result, got %dx%d", bounds.Dx(), bounds.Dy())
+	result := image.NewRGBA(img.Bounds())
+	sepFilter2D(result, img, kernel)
+	if got := result.RGBAAt(2, 2); got != (color.RGBA{128, 128, 128, 255}) {
+		t.Errorf("center pixel = %v, want {128 128 128 255}", got)
 	}
 }
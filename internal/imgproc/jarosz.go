@@ -4,68 +4,77 @@ package imgproc
 // The filter is an iterative 1-D box average applied first along rows
 // then along columns, each direction repeated nreps times.
 // windowSize is the half-width of the box kernel; the full kernel width
-// is 2*windowSize+1.
+// is 2*windowSize+1. Near the borders the window shrinks to the pixels
+// inside the matrix, as in the PDQ reference implementation.
+//
+// Earlier versions padded the left and top borders with the first sample
+// and the right and bottom borders with zeros, so the result changed when
+// the matrix was flipped. Truncating the window treats both ends of an axis
+// alike and makes the filter commute with flips and transposition, so the
+// dihedral PDQ variants derived from one filtered image agree with the
+// hashes of the transformed images up to rounding. The change altered every
+// PDQ hash, hence the PDQ version bump.
 func JaroszFilter(buf [][]float32, windowSize, nreps int) {
 	if len(buf) == 0 || len(buf[0]) == 0 {
 		return
 	}
 	rows := len(buf)
 	cols := len(buf[0])
+	full := 2*windowSize + 1
+	scratch, put := getScratch[float32](&f32Pool, max(rows, cols)+rows)
+	defer put()
+	out, col := scratch[:max(rows, cols)], scratch[max(rows, cols):]
 	for i := 0; i < nreps; i++ {
-		boxAlongRows(buf, rows, cols, windowSize)
+		for r := 0; r < rows; r++ {
+			box1D(buf[r], out[:cols], full)
+			copy(buf[r], out)
+		}
 	}
 	for i := 0; i < nreps; i++ {
-		boxAlongCols(buf, rows, cols, windowSize)
-	}
-}
-
-func boxAlongRows(buf [][]float32, rows, cols, windowSize int) {
-	w := float32(2*windowSize + 1)
-	for i := 0; i < rows; i++ {
-		row := buf[i]
-		s := row[0] * float32(windowSize)
-		for j := 1; j <= windowSize && j < cols; j++ {
-			s += row[j]
-		}
-		s += row[0]
-		row[0] = s / w
-		for j := 1; j < cols; j++ {
-			jn := j + windowSize
-			jp := j - windowSize - 1
-			var lead, trail float32
-			if jn < cols {
-				lead = row[jn]
+		for c := 0; c < cols; c++ {
+			for r := 0; r < rows; r++ {
+				col[r] = buf[r][c]
 			}
-			if jp >= 0 {
-				trail = row[jp]
+			box1D(col, out[:rows], full)
+			for r := 0; r < rows; r++ {
+				buf[r][c] = out[r]
 			}
-			s += lead - trail
-			row[j] = s / w
 		}
 	}
 }
 
-func boxAlongCols(buf [][]float32, rows, cols, windowSize int) {
-	w := float32(2*windowSize + 1)
-	for j := 0; j < cols; j++ {
-		s := buf[0][j] * float32(windowSize)
-		for i := 1; i <= windowSize && i < rows; i++ {
-			s += buf[i][j]
-		}
-		s += buf[0][j]
-		buf[0][j] = s / w
-		for i := 1; i < rows; i++ {
-			in := i + windowSize
-			ip := i - windowSize - 1
-			var lead, trail float32
-			if in < rows {
-				lead = buf[in][j]
-			}
-			if ip >= 0 {
-				trail = buf[ip][j]
-			}
-			s += lead - trail
-			buf[i][j] = s / w
-		}
+// box1D writes the centred moving average of in to out using a window of
+// window samples. The window is truncated at both ends of the vector and
+// the average taken over the samples it covers.
+func box1D(in, out []float32, window int) {
+	window = min(window, len(in))
+	half := (window + 2) / 2
+	var sum, size float32
+	ri, li, oi := 0, 0, 0
+	// Accumulate the leading half window without writing.
+	for ; ri < half-1; ri++ {
+		sum += in[ri]
+		size++
+	}
+	// Grow the window up to its full size.
+	for ; ri < window; ri++ {
+		sum += in[ri]
+		size++
+		out[oi] = sum / size
+		oi++
+	}
+	// Slide the full window.
+	for ; ri < len(in); ri++ {
+		sum += in[ri] - in[li]
+		li++
+		out[oi] = sum / size
+		oi++
+	}
+	// Shrink the window over the trailing half.
+	for ; oi < len(out); oi++ {
+		sum -= in[li]
+		li++
+		size--
+		out[oi] = sum / size
 	}
 }
@@ -0,0 +1,107 @@
+package imgproc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBox1D(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     []float32
+		window int
+		expect []float32
+	}{
+		{"constant", []float32{4, 4, 4, 4, 4, 4}, 5, []float32{4, 4, 4, 4, 4, 4}},
+		{"ramp", []float32{0, 1, 2, 3, 4, 5, 6}, 5, []float32{1, 1.5, 2, 3, 4, 4.5, 5}},
+		{"window 3", []float32{0, 3, 0, 3}, 3, []float32{1.5, 1, 2, 1.5}},
+		{"window wider than input", []float32{1, 2, 3}, 9, []float32{1.5, 2, 2.5}},
+		{"single value", []float32{7}, 5, []float32{7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := make([]float32, len(tt.in))
+			box1D(tt.in, out, tt.window)
+			for i := range out {
+				if math.Abs(float64(out[i]-tt.expect[i])) > 1e-6 {
+					t.Fatalf("got %v, want %v", out, tt.expect)
+				}
+			}
+		})
+	}
+}
+
+func TestJaroszFilter(t *testing.T) {
+	t.Run("constant matrix is unchanged", func(t *testing.T) {
+		buf := make([][]float32, 8)
+		for i := range buf {
+			buf[i] = []float32{9, 9, 9, 9, 9, 9}
+		}
+		JaroszFilter(buf, 2, 2)
+		for i := range buf {
+			for j := range buf[i] {
+				if math.Abs(float64(buf[i][j]-9)) > 1e-5 {
+					t.Fatalf("buf[%d][%d] = %v, want 9", i, j, buf[i][j])
+				}
+			}
+		}
+	})
+
+	t.Run("mirror symmetric", func(t *testing.T) {
+		const n = 16
+		buf := make([][]float32, n)
+		mirror := make([][]float32, n)
+		for i := range buf {
+			buf[i] = make([]float32, n)
+			mirror[i] = make([]float32, n)
+			for j := range buf[i] {
+				v := float32((i*7 + j*j*3) % 23)
+				buf[i][j] = v
+			}
+		}
+		for i := range buf {
+			for j := range buf[i] {
+				mirror[n-1-i][n-1-j] = buf[i][j]
+			}
+		}
+		JaroszFilter(buf, 2, 2)
+		JaroszFilter(mirror, 2, 2)
+		for i := range buf {
+			for j := range buf[i] {
+				if math.Abs(float64(buf[i][j]-mirror[n-1-i][n-1-j])) > 1e-4 {
+					t.Fatalf("filter is not mirror symmetric at (%d,%d): %v vs %v", i, j, buf[i][j], mirror[n-1-i][n-1-j])
+				}
+			}
+		}
+	})
+
+	t.Run("transpose symmetric", func(t *testing.T) {
+		const rows, cols = 12, 20
+		buf := make([][]float32, rows)
+		transposed := make([][]float32, cols)
+		for j := range transposed {
+			transposed[j] = make([]float32, rows)
+		}
+		for i := range buf {
+			buf[i] = make([]float32, cols)
+			for j := range buf[i] {
+				buf[i][j] = float32((i*i*5 + j*11) % 29)
+				transposed[j][i] = buf[i][j]
+			}
+		}
+		JaroszFilter(buf, 2, 2)
+		JaroszFilter(transposed, 2, 2)
+		for i := range buf {
+			for j := range buf[i] {
+				if math.Abs(float64(buf[i][j]-transposed[j][i])) > 1e-4 {
+					t.Fatalf("filter is not transpose symmetric at (%d,%d): %v vs %v", i, j, buf[i][j], transposed[j][i])
+				}
+			}
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		JaroszFilter(nil, 2, 2)
+		JaroszFilter([][]float32{{}}, 2, 2)
+	})
+}
@@ -77,10 +77,13 @@ func getMomentsDefault(img image.Image) []Moments {
 	mom[1] = Moments{}
 	mom[2] = Moments{}
 	bounds := img.Bounds()
+	row := make([]uint32, 4*bounds.Dx())
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		var x0R, x0G, x0B, x1R, x1G, x1B, x2R, x2G, x2B, x3R, x3G, x3B float64
+		RGBA64Row(img, y, row)
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, _ := img.At(x, y).RGBA()
+			px := row[4*(x-bounds.Min.X):]
+			r, g, b := px[0], px[1], px[2]
 			r /= 0x101
 			g /= 0x101
 			b /= 0x101
@@ -0,0 +1,64 @@
+package imgproc
+
+import (
+	"image"
+	"image/color"
+)
+
+// Orient applies an EXIF orientation (1 to 8) to img, returning the image
+// as it should be displayed. Orientations 5 to 8 swap width and height.
+// Gray images stay gray; other images are converted to RGBA. Any other
+// orientation value returns img unchanged.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	r := image.Rect(0, 0, dw, dh)
+
+	// dst maps source pixel (x, y), relative to the bounds, to its
+	// displayed position.
+	dst := func(x, y int) (int, int) {
+		switch orientation {
+		case 2:
+			return w - 1 - x, y
+		case 3:
+			return w - 1 - x, h - 1 - y
+		case 4:
+			return x, h - 1 - y
+		case 5:
+			return y, x
+		case 6:
+			return h - 1 - y, x
+		case 7:
+			return h - 1 - y, w - 1 - x
+		}
+		return y, w - 1 - x
+	}
+
+	if g, ok := img.(*image.Gray); ok {
+		out := image.NewGray(r)
+		for y := range h {
+			for x := range w {
+				dx, dy := dst(x, y)
+				out.Pix[dy*out.Stride+dx] = g.Pix[g.PixOffset(b.Min.X+x, b.Min.Y+y)]
+			}
+		}
+		return out
+	}
+	out := image.NewRGBA(r)
+	for y := range h {
+		for x := range w {
+			dx, dy := dst(x, y)
+			c := color.RGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.RGBA)
+			i := out.PixOffset(dx, dy)
+			out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+	}
+	return out
+}
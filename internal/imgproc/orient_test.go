@@ -0,0 +1,70 @@
+package imgproc
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestOrient(t *testing.T) {
+	// A 3x2 source image
+	//	1 2 3
+	//	4 5 6
+	src := image.NewGray(image.Rect(10, 20, 13, 22))
+	copy(src.Pix, []uint8{1, 2, 3})
+	copy(src.Pix[src.Stride:], []uint8{4, 5, 6})
+
+	tests := []struct {
+		orientation int
+		w, h        int
+		want        []uint8
+	}{
+		{1, 3, 2, []uint8{1, 2, 3, 4, 5, 6}},
+		{2, 3, 2, []uint8{3, 2, 1, 6, 5, 4}},
+		{3, 3, 2, []uint8{6, 5, 4, 3, 2, 1}},
+		{4, 3, 2, []uint8{4, 5, 6, 1, 2, 3}},
+		{5, 2, 3, []uint8{1, 4, 2, 5, 3, 6}},
+		{6, 2, 3, []uint8{4, 1, 5, 2, 6, 3}},
+		{7, 2, 3, []uint8{6, 3, 5, 2, 4, 1}},
+		{8, 2, 3, []uint8{3, 6, 2, 5, 1, 4}},
+		{0, 3, 2, []uint8{1, 2, 3, 4, 5, 6}},
+		{9, 3, 2, []uint8{1, 2, 3, 4, 5, 6}},
+	}
+	for _, tt := range tests {
+		out := Orient(src, tt.orientation)
+		b := out.Bounds()
+		if b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("orientation %d: got %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.w, tt.h)
+			continue
+		}
+		var got []uint8
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				got = append(got, out.(*image.Gray).GrayAt(x, y).Y)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("orientation %d: got %v, want %v", tt.orientation, got, tt.want)
+		}
+	}
+}
+
+func TestOrient_color(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	src.SetNRGBA(1, 0, color.NRGBA{0, 0, 255, 255})
+	out, ok := Orient(src, 6).(*image.RGBA)
+	if !ok {
+		t.Fatalf("got %T, want *image.RGBA", Orient(src, 6))
+	}
+	if out.Bounds() != image.Rect(0, 0, 1, 2) {
+		t.Fatalf("got bounds %v, want 1x2", out.Bounds())
+	}
+	if got := out.RGBAAt(0, 0); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("top: got %v, want red", got)
+	}
+	if got := out.RGBAAt(0, 1); got != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("bottom: got %v, want blue", got)
+	}
+}
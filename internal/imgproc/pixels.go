@@ -0,0 +1,86 @@
+package imgproc
+
+import (
+	"image"
+	"image/color"
+	"sync"
+)
+
+// RGBA64Row stores the colour of every pixel in row y of img in dst, four
+// values per pixel, exactly as img.At(x, y).RGBA() returns them. The
+// image types produced by the standard decoders are read directly from
+// their pixel buffers instead of through the color.Color interface, which
+// allocates for every pixel. dst must hold 4*img.Bounds().Dx() values.
+func RGBA64Row(img image.Image, y int, dst []uint32) {
+	b := img.Bounds()
+	w := b.Dx()
+	dst = dst[:4*w]
+	switch m := img.(type) {
+	case *image.YCbCr:
+		yi := m.YOffset(b.Min.X, y)
+		for x := range w {
+			ci := m.COffset(b.Min.X+x, y)
+			r, g, bl, a := color.YCbCr{Y: m.Y[yi+x], Cb: m.Cb[ci], Cr: m.Cr[ci]}.RGBA()
+			dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = r, g, bl, a
+		}
+	case *image.RGBA:
+		pix := m.Pix[m.PixOffset(b.Min.X, y):]
+		for x := range w {
+			s := pix[4*x : 4*x+4 : 4*x+4]
+			dst[4*x] = uint32(s[0]) * 0x101
+			dst[4*x+1] = uint32(s[1]) * 0x101
+			dst[4*x+2] = uint32(s[2]) * 0x101
+			dst[4*x+3] = uint32(s[3]) * 0x101
+		}
+	case *image.NRGBA:
+		pix := m.Pix[m.PixOffset(b.Min.X, y):]
+		for x := range w {
+			s := pix[4*x : 4*x+4 : 4*x+4]
+			r, g, bl, a := color.NRGBA{R: s[0], G: s[1], B: s[2], A: s[3]}.RGBA()
+			dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = r, g, bl, a
+		}
+	case *image.Gray:
+		pix := m.Pix[m.PixOffset(b.Min.X, y):]
+		for x := range w {
+			v := uint32(pix[x]) * 0x101
+			dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = v, v, v, 0xffff
+		}
+	default:
+		for x := range w {
+			r, g, bl, a := img.At(b.Min.X+x, y).RGBA()
+			dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = r, g, bl, a
+		}
+	}
+}
+
+// NewMatF32 returns a rows x cols matrix whose rows share one contiguous
+// backing array.
+func NewMatF32(rows, cols int) [][]float32 {
+	buf := make([]float32, rows*cols)
+	mat := make([][]float32, rows)
+	for i := range mat {
+		mat[i] = buf[i*cols : (i+1)*cols : (i+1)*cols]
+	}
+	return mat
+}
+
+// Scratch buffers are pooled so repeated hashing does not allocate them
+// again. Buffers taken from a pool hold arbitrary values.
+var (
+	u8Pool  = sync.Pool{New: func() any { return new([]uint8) }}
+	u32Pool = sync.Pool{New: func() any { return new([]uint32) }}
+	f32Pool = sync.Pool{New: func() any { return new([]float32) }}
+	f64Pool = sync.Pool{New: func() any { return new([]float64) }}
+	intPool = sync.Pool{New: func() any { return new([]int) }}
+)
+
+// getScratch returns a pooled slice of length n and a function that
+// returns it to the pool.
+func getScratch[T any](pool *sync.Pool, n int) ([]T, func()) {
+	p := pool.Get().(*[]T)
+	if cap(*p) < n {
+		*p = make([]T, n)
+	}
+	*p = (*p)[:n]
+	return *p, func() { pool.Put(p) }
+}
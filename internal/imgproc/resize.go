@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"image"
 	"math"
+	"sync"
+	"sync/atomic"
 
 	"golang.org/x/image/draw"
 )
@@ -25,9 +27,6 @@ const (
 // Resize scales img to the given dimensions using the specified interpolation.
 func Resize(width, height uint, img image.Image, typ ResizeType) image.Image {
 	dr := image.Rect(0, 0, int(width), int(height))
-	sr := img.Bounds()
-	interp := interpolatorFor(typ)
-
 	var dst draw.Image
 	switch img.(type) {
 	case *image.Gray:
@@ -35,11 +34,54 @@ func Resize(width, height uint, img image.Image, typ ResizeType) image.Image {
 	default:
 		dst = image.NewRGBA(dr)
 	}
-
-	interp.Scale(dst, dr, img, sr, draw.Src, nil)
+	ResizeInto(dst, img, typ)
 	return dst
 }
 
+// ResizeInto is like Resize but scales img to the bounds of dst, which
+// must be an *image.Gray when img is one and an *image.RGBA otherwise.
+func ResizeInto(dst draw.Image, img image.Image, typ ResizeType) {
+	dr, sr := dst.Bounds(), img.Bounds()
+	scalerFor(typ, dr.Dx(), dr.Dy(), sr.Dx(), sr.Dy()).Scale(dst, dr, img, sr, draw.Src, nil)
+}
+
+// maxScalers bounds the number of cached kernel scalers, so hashing images
+// of many different sizes does not grow the cache without limit.
+const maxScalers = 64
+
+type scalerKey struct {
+	typ            ResizeType
+	dw, dh, sw, sh int
+}
+
+var (
+	scalers     sync.Map
+	scalerCount atomic.Int32
+)
+
+// scalerFor returns a scaler for the given interpolation and sizes. Kernel
+// scalers precompute their weights and pool their temporary buffers, so
+// they are cached by size and reused across calls.
+func scalerFor(typ ResizeType, dw, dh, sw, sh int) draw.Scaler {
+	interp := interpolatorFor(typ)
+	k, ok := interp.(*draw.Kernel)
+	if !ok {
+		return interp
+	}
+	key := scalerKey{typ, dw, dh, sw, sh}
+	if s, ok := scalers.Load(key); ok {
+		return s.(draw.Scaler)
+	}
+	if scalerCount.Load() >= maxScalers {
+		return k
+	}
+	s, loaded := scalers.LoadOrStore(key, k.NewScaler(dw, dh, sw, sh))
+	if !loaded {
+		scalerCount.Add(1)
+	}
+	return s.(draw.Scaler)
+}
+
 var (
 	mitchellNetravali = &draw.Kernel{
 		Support: 2,
@@ -0,0 +1,62 @@
+package imgproc
+
+import (
+	"image"
+	"sort"
+)
+
+// Segments divides img into regions of similar brightness. Pixels above
+// threshold and the remaining pixels are each grouped into 4-connected
+// components, and the bounding box of every component with at least
+// minSize pixels is returned, largest component first.
+func Segments(img *image.Gray, threshold uint8, minSize int) []image.Rectangle {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	seen := make([]bool, w*h)
+	bright := func(i int) bool {
+		return img.Pix[img.PixOffset(b.Min.X+i%w, b.Min.Y+i/w)] > threshold
+	}
+	type segment struct {
+		r    image.Rectangle
+		size int
+	}
+	var segs []segment
+	var stack []int
+	var side bool
+	visit := func(ok bool, n int) {
+		if ok && !seen[n] && bright(n) == side {
+			seen[n] = true
+			stack = append(stack, n)
+		}
+	}
+	for start := range seen {
+		if seen[start] {
+			continue
+		}
+		side = bright(start)
+		seen[start] = true
+		stack = append(stack[:0], start)
+		r := image.Rect(start%w, start/w, start%w+1, start/w+1)
+		size := 0
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			size++
+			x, y := i%w, i/w
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+			visit(x > 0, i-1)
+			visit(x < w-1, i+1)
+			visit(y > 0, i-w)
+			visit(y < h-1, i+w)
+		}
+		if size >= minSize {
+			segs = append(segs, segment{r.Add(b.Min), size})
+		}
+	}
+	sort.SliceStable(segs, func(i, j int) bool { return segs[i].size > segs[j].size })
+	rects := make([]image.Rectangle, len(segs))
+	for i, s := range segs {
+		rects[i] = s.r
+	}
+	return rects
+}
@@ -0,0 +1,44 @@
+package imgproc
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestSegments(t *testing.T) {
+	// A dark 10x8 image with a bright 4x3 block and a single bright pixel.
+	img := image.NewGray(image.Rect(0, 0, 10, 8))
+	for y := 2; y < 5; y++ {
+		for x := 5; x < 9; x++ {
+			img.Pix[img.PixOffset(x, y)] = 200
+		}
+	}
+	img.Pix[img.PixOffset(1, 6)] = 200
+	tests := []struct {
+		name    string
+		img     *image.Gray
+		minSize int
+		want    []image.Rectangle
+	}{
+		{"all segments", img, 1, []image.Rectangle{
+			image.Rect(0, 0, 10, 8),
+			image.Rect(5, 2, 9, 5),
+			image.Rect(1, 6, 2, 7),
+		}},
+		{"small segments dropped", img, 2, []image.Rectangle{
+			image.Rect(0, 0, 10, 8),
+			image.Rect(5, 2, 9, 5),
+		}},
+		{"offset bounds", img.SubImage(image.Rect(4, 1, 10, 8)).(*image.Gray), 2, []image.Rectangle{
+			image.Rect(4, 1, 10, 8),
+			image.Rect(5, 2, 9, 5),
+		}},
+		{"empty image", image.NewGray(image.Rect(0, 0, 0, 0)), 1, []image.Rectangle{}},
+	}
+	for _, tt := range tests {
+		if got := Segments(tt.img, 128, tt.minSize); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
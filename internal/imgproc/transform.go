@@ -1,61 +1,175 @@
 package imgproc
 
-import "math"
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
 
-// DCT computes a 2-D orthogonal DCT-II on a float32 matrix.
+// DCT computes a 2-D orthogonal DCT-II on a float32 matrix. The transform
+// is separable: a 1-D DCT of every row is followed by a 1-D DCT of every
+// column, in float64 on a flat buffer.
 func DCT(mat [][]float32) [][]float32 {
-	mat64 := matf32Tof64(mat)
-	for i := range mat64 {
-		mat64[i] = dctOrthogonal(mat64[i])
+	rows := len(mat)
+	if rows == 0 {
+		return [][]float32{}
+	}
+	cols := len(mat[0])
+	n := max(rows, cols)
+	buf, put := getScratch[float64](&f64Pool, rows*cols+4*n)
+	defer put()
+	tmp, in, out := buf[:rows*cols], buf[rows*cols:rows*cols+n], buf[rows*cols+n:rows*cols+2*n]
+	work := buf[rows*cols+2*n:]
+	rowPlan := dctPlanFor(cols)
+	for r, row := range mat {
+		for c, v := range row {
+			in[c] = float64(v)
+		}
+		rowPlan.transform(tmp[r*cols:(r+1)*cols], in[:cols], work)
+	}
+	colPlan := dctPlanFor(rows)
+	res := NewMatF32(rows, cols)
+	for c := range cols {
+		for r := range rows {
+			in[r] = tmp[r*cols+c]
+		}
+		colPlan.transform(out[:rows], in[:rows], work)
+		for r := range rows {
+			res[r][c] = float32(out[r])
+		}
+	}
+	return res
+}
+
+// maxDCTPlans bounds the number of cached DCT plans, so transforming
+// matrices of many different sizes does not grow the cache without limit.
+const maxDCTPlans = 32
+
+var (
+	dctPlans     sync.Map
+	dctPlanCount atomic.Int32
+)
+
+// dctPlan holds the precomputed tables of a 1-D orthogonal DCT-II of
+// length n. Power-of-two lengths use an FFT of the reordered input
+// (Makhoul's algorithm) in O(n log n); other lengths multiply by the
+// cosine basis directly.
+type dctPlan struct {
+	n int
+	// FFT tables: the bit-reversal permutation, the n/2 twiddle factors
+	// exp(-2πik/n), and the output rotations exp(-iπk/2n) with the
+	// orthogonal scaling folded in.
+	perm         []int
+	twRe, twIm   []float64
+	rotRe, rotIm []float64
+	// basis is the n x n cosine basis for lengths that are not a power
+	// of two, row k holding the k-th basis function.
+	basis []float64
+}
+
+// dctPlanFor returns the DCT plan for length n, caching it while the
+// cache holds fewer than maxDCTPlans entries.
+func dctPlanFor(n int) *dctPlan {
+	if p, ok := dctPlans.Load(n); ok {
+		return p.(*dctPlan)
+	}
+	if dctPlanCount.Load() >= maxDCTPlans {
+		return newDCTPlan(n)
 	}
-	mat64 = transpose(mat64)
-	for i := range mat64 {
-		mat64[i] = dctOrthogonal(mat64[i])
+	p, loaded := dctPlans.LoadOrStore(n, newDCTPlan(n))
+	if !loaded {
+		dctPlanCount.Add(1)
 	}
-	mat64 = transpose(mat64)
-	return matf64Tof32(mat64)
+	return p.(*dctPlan)
 }
 
-// dctOrthogonal computes a 1-D orthogonal DCT-II.
-func dctOrthogonal(x []float64) []float64 {
-	n := len(x)
+func newDCTPlan(n int) *dctPlan {
+	p := &dctPlan{n: n}
 	c0 := math.Sqrt(1.0 / float64(n))
 	c1 := math.Sqrt(2.0 / float64(n))
-	result := make([]float64, n)
-	for k := 0; k < n; k++ {
-		var sum float64
-		for i := 0; i < n; i++ {
-			sum += x[i] * math.Cos(math.Pi*float64(2*i+1)*float64(k)/float64(2*n))
+	if n&(n-1) != 0 {
+		p.basis = make([]float64, n*n)
+		for k := range n {
+			scale := c1
+			if k == 0 {
+				scale = c0
+			}
+			for i := range n {
+				p.basis[k*n+i] = scale * math.Cos(math.Pi*float64(2*i+1)*float64(k)/float64(2*n))
+			}
 		}
+		return p
+	}
+	shift := bits.UintSize - bits.TrailingZeros(uint(n))
+	p.perm = make([]int, n)
+	for i := range n {
+		if n > 1 {
+			p.perm[i] = int(bits.Reverse(uint(i)) >> shift)
+		}
+	}
+	p.twRe = make([]float64, n/2)
+	p.twIm = make([]float64, n/2)
+	for k := range n / 2 {
+		s, c := math.Sincos(-2 * math.Pi * float64(k) / float64(n))
+		p.twRe[k], p.twIm[k] = c, s
+	}
+	p.rotRe = make([]float64, n)
+	p.rotIm = make([]float64, n)
+	for k := range n {
+		scale := c1
 		if k == 0 {
-			result[k] = sum * c0
-		} else {
-			result[k] = sum * c1
+			scale = c0
 		}
+		s, c := math.Sincos(-math.Pi * float64(k) / float64(2*n))
+		p.rotRe[k], p.rotIm[k] = scale*c, scale*s
 	}
-	return result
+	return p
 }
 
-func matf32Tof64(mat [][]float32) [][]float64 {
-	res := make([][]float64, len(mat))
-	for i := 0; i < len(mat); i++ {
-		res[i] = make([]float64, len(mat[i]))
-		for j := 0; j < len(mat[i]); j++ {
-			res[i][j] = float64(mat[i][j])
+// transform computes the 1-D orthogonal DCT-II of x into dst. work must
+// hold at least 2*n values.
+func (p *dctPlan) transform(dst, x, work []float64) {
+	n := p.n
+	if p.basis != nil {
+		for k := range n {
+			basis := p.basis[k*n : (k+1)*n]
+			var sum float64
+			for i, v := range x {
+				sum += v * basis[i]
+			}
+			dst[k] = sum
 		}
+		return
 	}
-	return res
-}
-
-func matf64Tof32(mat [][]float64) [][]float32 {
-	res := make([][]float32, len(mat))
-	for i := 0; i < len(mat); i++ {
-		res[i] = make([]float32, len(mat[i]))
-		for j := 0; j < len(mat[i]); j++ {
-			res[i][j] = float32(mat[i][j])
+	re, im := work[:n], work[n:2*n]
+	// Even samples in order followed by odd samples reversed, stored in
+	// bit-reversed order for the in-place FFT.
+	for i := range n / 2 {
+		re[p.perm[i]] = x[2*i]
+		re[p.perm[n-1-i]] = x[2*i+1]
+	}
+	if n == 1 {
+		re[0] = x[0]
+	}
+	clear(im)
+	for size := 2; size <= n; size <<= 1 {
+		half := size / 2
+		step := n / size
+		for start := 0; start < n; start += size {
+			for j := range half {
+				wr, wi := p.twRe[j*step], p.twIm[j*step]
+				a, b := start+j, start+j+half
+				tr := re[b]*wr - im[b]*wi
+				ti := re[b]*wi + im[b]*wr
+				re[b], im[b] = re[a]-tr, im[a]-ti
+				re[a], im[a] = re[a]+tr, im[a]+ti
+			}
 		}
 	}
-	return res
+	for k := range n {
+		dst[k] = re[k]*p.rotRe[k] - im[k]*p.rotIm[k]
+	}
 }
 
 // HaarDWT2D applies a multi-level 2-D Haar discrete wavelet transform
@@ -80,7 +194,8 @@ func HaarDWT2D(mat [][]float32, levels int) {
 
 func haarRows(mat [][]float32, rows, cols int) {
 	half := cols / 2
-	tmp := make([]float32, cols)
+	tmp, put := getScratch[float32](&f32Pool, cols)
+	defer put()
 	for r := 0; r < rows; r++ {
 		for c := 0; c < half; c++ {
 			tmp[c] = (mat[r][2*c] + mat[r][2*c+1]) / 2
@@ -92,7 +207,8 @@ func haarRows(mat [][]float32, rows, cols int) {
 
 func haarCols(mat [][]float32, rows, cols int) {
 	half := rows / 2
-	tmp := make([]float32, rows)
+	tmp, put := getScratch[float32](&f32Pool, rows)
+	defer put()
 	for c := 0; c < cols; c++ {
 		for r := 0; r < half; r++ {
 			tmp[r] = (mat[2*r][c] + mat[2*r+1][c]) / 2
@@ -103,18 +219,3 @@ func haarCols(mat [][]float32, rows, cols int) {
 		}
 	}
 }
-
-func transpose(mat [][]float64) [][]float64 {
-	height := len(mat)
-	width := len(mat[0])
-	res := make([][]float64, height)
-	for i := 0; i < height; i++ {
-		res[i] = make([]float64, width)
-	}
-	for i := 0; i < height; i++ {
-		for j := 0; j < width; j++ {
-			res[i][j] = mat[j][i]
-		}
-	}
-	return res
-}
@@ -28,6 +28,25 @@ func TestDCT_1x1(t *testing.T) {
 	}
 }
 
+// dctOrthogonal is the direct O(n²) evaluation of the 1-D orthogonal
+// DCT-II, used as an oracle for the fast transform.
+func dctOrthogonal(x []float64) []float64 {
+	n := len(x)
+	out := make([]float64, n)
+	for k := range n {
+		var sum float64
+		for i, v := range x {
+			sum += v * math.Cos(math.Pi*float64(2*i+1)*float64(k)/float64(2*n))
+		}
+		if k == 0 {
+			out[k] = sum * math.Sqrt(1.0/float64(n))
+		} else {
+			out[k] = sum * math.Sqrt(2.0/float64(n))
+		}
+	}
+	return out
+}
+
 func TestDctOrthogonal(t *testing.T) {
 	input := []float64{1, 2, 3, 4}
 	result := dctOrthogonal(input)
@@ -40,34 +59,73 @@ func TestDctOrthogonal(t *testing.T) {
 	}
 }
 
-func TestTranspose(t *testing.T) {
-	input := [][]float64{
-		{1, 2, 3},
-		{4, 5, 6},
-		{7, 8, 9},
+func TestDCTPlan_transform(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 5, 8, 12, 16, 32, 64, 100, 128} {
+		x := make([]float64, n)
+		for i := range x {
+			x[i] = float64((i*7)%31) - 11.5 + math.Sin(float64(i))
+		}
+		want := dctOrthogonal(x)
+		got := make([]float64, n)
+		newDCTPlan(n).transform(got, x, make([]float64, 2*n))
+		for k := range n {
+			if math.Abs(got[k]-want[k]) > 1e-9 {
+				t.Fatalf("n=%d: [%d] = %v, want %v", n, k, got[k], want[k])
+			}
+		}
+	}
+}
+
+func TestDCTPlanFor_bounded(t *testing.T) {
+	for n := 1; n <= 2*maxDCTPlans; n++ {
+		dctPlanFor(n)
 	}
-	result := transpose(input)
-	if result[0][1] != 4 || result[1][0] != 2 {
-		t.Errorf("transpose incorrect: [0][1]=%v (want 4), [1][0]=%v (want 2)", result[0][1], result[1][0])
+	if got := dctPlanCount.Load(); got > maxDCTPlans {
+		t.Errorf("cached %d plans, want at most %d", got, maxDCTPlans)
 	}
-	if result[2][0] != 3 || result[0][2] != 7 {
-		t.Errorf("transpose incorrect: [2][0]=%v (want 3), [0][2]=%v (want 7)", result[2][0], result[0][2])
+	if p := dctPlanFor(3 * maxDCTPlans); p.n != 3*maxDCTPlans {
+		t.Errorf("uncached plan has length %d, want %d", p.n, 3*maxDCTPlans)
 	}
 }
 
-func TestMatf32Tof64(t *testing.T) {
-	input := [][]float32{{1.5, 2.5}, {3.5, 4.5}}
-	result := matf32Tof64(input)
-	if result[0][0] != 1.5 || result[1][1] != 4.5 {
-		t.Errorf("conversion incorrect")
+// TestDCT_reference checks DCT against the direct evaluation of the
+// separable transform.
+func TestDCT_reference(t *testing.T) {
+	for _, size := range [][2]int{{1, 1}, {3, 3}, {8, 8}, {32, 32}, {5, 8}, {64, 12}} {
+		rows, cols := size[0], size[1]
+		mat := make([][]float32, rows)
+		for i := range mat {
+			mat[i] = make([]float32, cols)
+			for j := range mat[i] {
+				mat[i][j] = float32((i*7+j*13)%31) - 11.5
+			}
+		}
+		tmp := make([][]float64, rows)
+		for i, row := range mat {
+			x := make([]float64, cols)
+			for j, v := range row {
+				x[j] = float64(v)
+			}
+			tmp[i] = dctOrthogonal(x)
+		}
+		got := DCT(mat)
+		for j := range cols {
+			col := make([]float64, rows)
+			for i := range rows {
+				col[i] = tmp[i][j]
+			}
+			for i, v := range dctOrthogonal(col) {
+				if math.Abs(float64(got[i][j])-v) > 1e-4 {
+					t.Fatalf("%dx%d: [%d][%d] = %v, want %v", rows, cols, i, j, got[i][j], v)
+				}
+			}
+		}
 	}
 }
 
-func TestMatf64Tof32(t *testing.T) {
-	input := [][]float64{{1.5, 2.5}, {3.5, 4.5}}
-	result := matf64Tof32(input)
-	if result[0][0] != 1.5 || result[1][1] != 4.5 {
-		t.Errorf("conversion incorrect")
+func TestDCT_empty(t *testing.T) {
+	if got := DCT(nil); len(got) != 0 {
+		t.Errorf("got %d rows, want 0", len(got))
 	}
 }
 
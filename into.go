@@ -0,0 +1,142 @@
+package imghash
+
+import (
+	"image"
+	"sync"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+// IntoHasher is implemented by hashers that can write a hash into memory
+// supplied by the caller. All algorithms in this package implement it.
+//
+// CalculateInto computes the same hash as Calculate. When dst is a hash of
+// the type the algorithm produces and has enough capacity, the result is
+// written into its memory; otherwise a new hash is allocated. As with
+// append, the returned hash must be used and dst only serves as storage:
+//
+//	var h imghash.Hash
+//	for _, img := range images {
+//		h, err = phash.CalculateInto(h, img)
+//		...
+//	}
+//
+// Hashes kept across calls must be copied first, since the next call
+// overwrites them. The intermediate images of the computation come from
+// pools shared by all hashers, so hashing many images allocates little
+// besides the hash itself. Calculate uses the same pools.
+type IntoHasher interface {
+	Hasher
+	CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error)
+}
+
+// CalculateInto computes the hash of img with h, writing it into dst when
+// h implements IntoHasher and calling h.Calculate otherwise.
+func CalculateInto(h Hasher, dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	if ih, ok := h.(IntoHasher); ok {
+		return ih.CalculateInto(dst, img)
+	}
+	return h.Calculate(img)
+}
+
+// preparedIntoHasher is implemented by the algorithms of this package,
+// which can both reuse a Prepared image and write into dst.
+type preparedIntoHasher interface {
+	calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error)
+}
+
+// calculatePreparedInto computes the hash of a Prepared image with h,
+// reusing its cached preprocessing and the memory of dst as far as h
+// supports them.
+func calculatePreparedInto(h Hasher, dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	switch v := h.(type) {
+	case preparedIntoHasher:
+		return v.calculate(dst, prep)
+	case PreparedHasher:
+		return v.CalculatePrepared(prep)
+	}
+	return CalculateInto(h, dst, prep.Image())
+}
+
+// hashInto returns a zeroed hash of type H with n elements, reusing the
+// memory of dst when it is an H with enough capacity.
+func hashInto[H ~[]E, E any](dst hashtype.Hash, n int) H {
+	if h, ok := dst.(H); ok && cap(h) >= n {
+		h = h[:n]
+		clear(h)
+		return h
+	}
+	return make(H, n)
+}
+
+// binaryInto is like hashtype.NewBinary but reuses the memory of dst.
+func binaryInto(dst hashtype.Hash, bits uint) hashtype.Binary {
+	return hashInto[hashtype.Binary](dst, int((bits+7)/8))
+}
+
+// pixPool holds the pixel buffers of intermediate images.
+var pixPool = sync.Pool{New: func() any { return new([]uint8) }}
+
+// scratch hands out pooled pixel buffers for the intermediate images of a
+// single hash computation and returns them to the pool on release.
+type scratch struct {
+	mu   sync.Mutex
+	bufs []*[]uint8
+}
+
+func (s *scratch) pix(n int) []uint8 {
+	p := pixPool.Get().(*[]uint8)
+	if cap(*p) < n {
+		*p = make([]uint8, n)
+	}
+	*p = (*p)[:n]
+	s.mu.Lock()
+	s.bufs = append(s.bufs, p)
+	s.mu.Unlock()
+	return *p
+}
+
+func (s *scratch) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.bufs {
+		pixPool.Put(p)
+	}
+	s.bufs = nil
+}
+
+// prepareScratch is like Prepare but backs the intermediate images with
+// pooled memory. The Prepared image is private to one computation: once
+// the hash is computed, release returns the memory to the pool and
+// neither the Prepared image nor the images it returned may be used.
+func prepareScratch(img image.Image) *Prepared {
+	p := Prepare(img)
+	p.scratch = new(scratch)
+	return p
+}
+
+// release returns the memory of a Prepared image created with
+// prepareScratch to the pool.
+func (p *Prepared) release() {
+	if p.scratch != nil {
+		p.scratch.release()
+	}
+}
+
+// newGray returns a grayscale image with bounds r whose pixels have
+// arbitrary values.
+func (p *Prepared) newGray(r image.Rectangle) *image.Gray {
+	if p.scratch == nil {
+		return image.NewGray(r)
+	}
+	return &image.Gray{Pix: p.scratch.pix(r.Dx() * r.Dy()), Stride: r.Dx(), Rect: r}
+}
+
+// newRGBA returns an RGBA image with bounds r whose pixels have arbitrary
+// values.
+func (p *Prepared) newRGBA(r image.Rectangle) *image.RGBA {
+	if p.scratch == nil {
+		return image.NewRGBA(r)
+	}
+	return &image.RGBA{Pix: p.scratch.pix(4 * r.Dx() * r.Dy()), Stride: 4 * r.Dx(), Rect: r}
+}
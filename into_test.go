@@ -0,0 +1,153 @@
+package imghash_test
+
+import (
+	"image"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+)
+
+func TestCalculateInto(t *testing.T) {
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := imghash.OpenImage("assets/baboon.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range imghash.Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			h, err := imghash.New(name, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ih, ok := h.(imghash.IntoHasher)
+			if !ok {
+				t.Fatalf("%T does not implement IntoHasher", h)
+			}
+			want, err := h.Calculate(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantOther, err := h.Calculate(other)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ih.CalculateInto(nil, img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("nil dst: got %v, want %v", got, want)
+			}
+			// Hashing another image into the previous hash reuses its memory.
+			ptr := reflect.ValueOf(got).Pointer()
+			got, err = ih.CalculateInto(got, other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, wantOther) {
+				t.Errorf("reused dst: got %v, want %v", got, wantOther)
+			}
+			if reflect.ValueOf(got).Pointer() != ptr {
+				t.Error("dst memory was not reused")
+			}
+			// A hash of another type, or an empty one, is not written to.
+			wrong := imghash.Composite{}
+			if got, err = ih.CalculateInto(wrong, img); err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("mismatched dst: got %v, %v; want %v", got, err, want)
+			}
+		})
+	}
+}
+
+func TestCalculateInto_concurrent(t *testing.T) {
+	img, err := imghash.OpenImage("assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	phash, err := imghash.NewPHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := phash.Calculate(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	got := make([]imghash.Hash, 8)
+	for i := range got {
+		wg.Go(func() {
+			var h imghash.Hash
+			for range 5 {
+				if h, errs[i] = phash.CalculateInto(h, img); errs[i] != nil {
+					return
+				}
+			}
+			got[i] = h
+		})
+	}
+	wg.Wait()
+	for i := range got {
+		if errs[i] != nil || !reflect.DeepEqual(got[i], want) {
+			t.Errorf("goroutine %d: got %v, %v; want %v", i, got[i], errs[i], want)
+		}
+	}
+}
+
+func TestCalculateInto_fallback(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := avg.Calculate(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A Hasher without CalculateInto is called through Calculate.
+	h := struct{ imghash.Hasher }{avg}
+	got, err := imghash.CalculateInto(h, imghash.Binary{0xff}, img)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestCropResistant_CalculateInto(t *testing.T) {
+	img, err := imghash.OpenImage("assets/tulips.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr, err := imghash.NewCropResistant(avg, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := cr.Calculate(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := cr.CalculateInto(nil, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := reflect.ValueOf(dst.(imghash.Composite)[0]).Pointer()
+	got, err := cr.CalculateInto(dst, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if reflect.ValueOf(got.(imghash.Composite)[0]).Pointer() != first {
+		t.Error("segment hash memory was not reused")
+	}
+}
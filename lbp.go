@@ -4,7 +4,6 @@ import (
 	"image"
 
 	"github.com/ajdnik/imghash/v2/hashtype"
-	"github.com/ajdnik/imghash/v2/internal/imgproc"
 	"github.com/ajdnik/imghash/v2/similarity"
 )
 
@@ -30,7 +29,7 @@ type LBP struct {
 // Without options, sensible defaults are used.
 func NewLBP(opts ...LBPOption) (LBP, error) {
 	l := LBP{
-		baseConfig: baseConfig{width: 256, height: 256, interp: Bilinear},
+		baseConfig: baseConfig{width: 256, height: 256, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 		gridX:      1,
 		gridY:      1,
 	}
@@ -48,15 +47,33 @@ func NewLBP(opts ...LBPOption) (LBP, error) {
 
 // Calculate returns a perceptual image hash.
 func (lh LBP) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(lh.width, lh.height, img, lh.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return lh.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a UInt8 hash with enough capacity. See IntoHasher.
+func (lh LBP) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return lh.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (lh LBP) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return lh.calculate(nil, prep)
+}
+
+func (lh LBP) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(lh.alphaPolicy).cropBorders(lh.border)
+	g, err := prep.ResizedGray(lh.width, lh.height, lh.interp)
 	if err != nil {
 		return nil, err
 	}
 	bounds := g.Bounds()
 	w, h := bounds.Dx(), bounds.Dy()
 	lbpImg := lh.computeLBP(g, w, h)
-	return lh.computeHash(lbpImg, w, h), nil
+	return lh.computeHash(dst, lbpImg, w, h), nil
 }
 
 // 8-neighbor offsets starting from the right, going clockwise.
@@ -89,9 +106,9 @@ func (lh LBP) computeLBP(img *image.Gray, w, h int) []uint8 {
 
 // computeHash builds a UInt8 hash from the LBP code image by computing
 // a normalized 256-bin histogram for each grid cell.
-func (lh LBP) computeHash(lbpImg []uint8, w, h int) hashtype.UInt8 {
+func (lh LBP) computeHash(dst hashtype.Hash, lbpImg []uint8, w, h int) hashtype.UInt8 {
 	gx, gy := int(lh.gridX), int(lh.gridY)
-	hash := make(hashtype.UInt8, gx*gy*256)
+	hash := hashInto[hashtype.UInt8](dst, gx*gy*256)
 	cellW := w / gx
 	cellH := h / gy
 
@@ -39,7 +39,7 @@ type MarrHildreth struct {
 // Without options, sensible defaults are used.
 func NewMarrHildreth(opts ...MarrHildrethOption) (MarrHildreth, error) {
 	mh := MarrHildreth{
-		baseConfig: baseConfig{width: 512, height: 512, interp: Bicubic},
+		baseConfig: baseConfig{width: 512, height: 512, interp: Bicubic, alphaPolicy: defaultAlphaPolicy},
 		scale:      1,
 		alpha:      2,
 		kernel:     7,
@@ -69,16 +69,36 @@ func NewMarrHildreth(opts ...MarrHildrethOption) (MarrHildreth, error) {
 
 // Calculate returns a perceptual image hash.
 func (mhh MarrHildreth) Calculate(img image.Image) (hashtype.Hash, error) {
-	g, err := imgproc.Grayscale(img)
+	return mhh.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Binary hash with enough capacity. See IntoHasher.
+func (mhh MarrHildreth) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return mhh.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (mhh MarrHildreth) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return mhh.calculate(nil, prep)
+}
+
+func (mhh MarrHildreth) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(mhh.alphaPolicy).cropBorders(mhh.border)
+	g, err := prep.Gray()
 	if err != nil {
 		return nil, err
 	}
-	b := imgproc.GaussianBlur(g, mhh.kernel, mhh.sigma)
-	r := imgproc.Resize(mhh.width, mhh.height, b, mhh.interp.resizeType())
-	eq := imgproc.EqualizeHist(r.(*image.Gray))
+	b := prep.blur(g, mhh.kernel, mhh.sigma)
+	r := prep.resize(b, mhh.width, mhh.height, mhh.interp)
+	eq := prep.newGray(r.Bounds())
+	imgproc.EqualizeHistInto(eq, r.(*image.Gray))
 	f := imgproc.Filter2DGray(eq, mhh.kernels)
 	blks := mhh.blocksSum(f)
-	return mhh.createHash(blks), nil
+	return mhh.createHash(dst, blks), nil
 }
 
 // Compute sums of blocks.
@@ -100,11 +120,11 @@ func (mhh MarrHildreth) blocksSum(img [][]float32) [][]float32 {
 }
 
 // Compute binary hash from block sums.
-func (mhh MarrHildreth) createHash(blocks [][]float32) hashtype.Binary {
+func (mhh MarrHildreth) createHash(dst hashtype.Hash, blocks [][]float32) hashtype.Binary {
 	gridLimit := mhNumBlocks - mhSubBlock + 1
 	gridSteps := (gridLimit-1)/mhStride + 1
 	hashBits := gridSteps * gridSteps * mhSubBlock * mhSubBlock
-	hash := make(hashtype.Binary, hashBits/8)
+	hash := hashInto[hashtype.Binary](dst, hashBits/8)
 	var count uint
 	for r := 0; r < gridLimit; r += mhStride {
 		for c := 0; c < gridLimit; c += mhStride {
@@ -158,3 +178,9 @@ func (mhh MarrHildreth) Compare(h1, h2 hashtype.Hash) (similarity.Distance, erro
 	}
 	return similarity.Hamming(h1, h2)
 }
+
+// ComparesHamming reports whether Compare returns the Hamming distance,
+// which it does unless WithDistance was given. See HammingComparer.
+func (mhh MarrHildreth) ComparesHamming() bool {
+	return mhh.distFunc == nil
+}
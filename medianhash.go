@@ -21,7 +21,7 @@ type Median struct {
 // Without options, sensible defaults are used.
 func NewMedian(opts ...MedianOption) (Median, error) {
 	m := Median{
-		baseConfig: baseConfig{width: 8, height: 8, interp: Bilinear},
+		baseConfig: baseConfig{width: 8, height: 8, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 	}
 	for _, o := range opts {
 		o.applyMedian(&m)
@@ -34,8 +34,26 @@ func NewMedian(opts ...MedianOption) (Median, error) {
 
 // Calculate returns a perceptual image hash.
 func (mh Median) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(mh.width, mh.height, img, mh.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return mh.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Binary hash with enough capacity. See IntoHasher.
+func (mh Median) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return mh.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (mh Median) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return mh.calculate(nil, prep)
+}
+
+func (mh Median) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(mh.alphaPolicy).cropBorders(mh.border)
+	g, err := prep.ResizedGray(mh.width, mh.height, mh.interp)
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +61,7 @@ func (mh Median) Calculate(img image.Image) (hashtype.Hash, error) {
 	if err != nil {
 		return nil, err
 	}
-	return thresholdHash(g, uint(math.Round(med)))
+	return thresholdHash(dst, g, uint(math.Round(med)))
 }
 
 // Compare computes the Hamming distance between two Median hashes.
@@ -56,3 +74,9 @@ func (mh Median) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
 	}
 	return similarity.Hamming(h1, h2)
 }
+
+// ComparesHamming reports whether Compare returns the Hamming distance,
+// which it does unless WithDistance was given. See HammingComparer.
+func (mh Median) ComparesHamming() bool {
+	return mh.distFunc == nil
+}
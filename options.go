@@ -1,17 +1,26 @@
 package imghash
 
-// baseConfig holds the resize dimensions and interpolation method shared by
-// most hash algorithms. Algorithms embed this struct so that WithSize and
-// WithInterpolation options can target a single applyBase method.
+// baseConfig holds the resize dimensions, interpolation method, alpha
+// policy and border cropping shared by most hash algorithms. Algorithms
+// embed this struct so that WithSize, WithInterpolation, WithAlphaPolicy
+// and WithBorderCrop options can target a single applyBase method.
 type baseConfig struct {
 	width, height uint
 	interp        Interpolation
+	alphaPolicy   alphaConfig
+	border        cropConfig
 }
 
 func (b baseConfig) validate() error {
 	if b.width == 0 || b.height == 0 {
 		return ErrInvalidSize
 	}
+	if err := b.alphaPolicy.validate(); err != nil {
+		return err
+	}
+	if err := b.border.validate(); err != nil {
+		return err
+	}
 	return b.interp.validate()
 }
 
@@ -202,6 +211,110 @@ func (o interpolationOption) applyZernike(z *Zernike)           { o.applyBase(&z
 func (o interpolationOption) applyGIST(g *GIST)                 { o.applyBase(&g.baseConfig) }
 func (o interpolationOption) applyBoVW(b *BoVW)                 { o.applyBase(&b.baseConfig) }
 
+// AlphaPolicyOption sets how the alpha channel is handled.
+type AlphaPolicyOption interface {
+	AverageOption
+	DifferenceOption
+	MedianOption
+	PHashOption
+	BlockMeanOption
+	MarrHildrethOption
+	RadialVarianceOption
+	ColorMomentOption
+	CLDOption
+	EHDOption
+	WHashOption
+	LBPOption
+	HOGHashOption
+	PDQOption
+	RASHOption
+	ZernikeOption
+	GISTOption
+	BoVWOption
+	CropResistantOption
+}
+
+// alphaPolicyOption sets the mode, the background or both of an alpha policy,
+// so that the registry can map alpha_mode and background separately.
+type alphaPolicyOption struct {
+	cfg                    alphaConfig
+	setMode, setBackground bool
+}
+
+func (o alphaPolicyOption) apply(a *alphaConfig) {
+	if o.setMode {
+		a.mode = o.cfg.mode
+	}
+	if o.setBackground {
+		a.bg = o.cfg.bg
+	}
+}
+
+func (o alphaPolicyOption) applyAverage(a *Average)               { o.apply(&a.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyDifference(d *Difference)         { o.apply(&d.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyMedian(m *Median)                 { o.apply(&m.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyPHash(p *PHash)                   { o.apply(&p.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyBlockMean(b *BlockMean)           { o.apply(&b.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyMarrHildreth(m *MarrHildreth)     { o.apply(&m.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyRadialVariance(r *RadialVariance) { o.apply(&r.alphaPolicy) }
+func (o alphaPolicyOption) applyColorMoment(c *ColorMoment)       { o.apply(&c.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyCLD(c *CLD)                       { o.apply(&c.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyEHD(e *EHD)                       { o.apply(&e.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyWHash(w *WHash)                   { o.apply(&w.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyLBP(l *LBP)                       { o.apply(&l.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyHOGHash(h *HOGHash)               { o.apply(&h.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyPDQ(p *PDQ)                       { o.apply(&p.alphaPolicy) }
+func (o alphaPolicyOption) applyRASH(r *RASH)                     { o.apply(&r.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyZernike(z *Zernike)               { o.apply(&z.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyGIST(g *GIST)                     { o.apply(&g.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyBoVW(b *BoVW)                     { o.apply(&b.baseConfig.alphaPolicy) }
+func (o alphaPolicyOption) applyCropResistant(c *CropResistant)   { o.apply(&c.alphaPolicy) }
+
+// BorderCropOption enables cropping of uniform borders.
+type BorderCropOption interface {
+	AverageOption
+	DifferenceOption
+	MedianOption
+	PHashOption
+	BlockMeanOption
+	MarrHildrethOption
+	RadialVarianceOption
+	ColorMomentOption
+	CLDOption
+	EHDOption
+	WHashOption
+	LBPOption
+	HOGHashOption
+	PDQOption
+	RASHOption
+	ZernikeOption
+	GISTOption
+	BoVWOption
+	CropResistantOption
+}
+
+type borderCropOption struct{ cfg cropConfig }
+
+func (o borderCropOption) applyAverage(a *Average)               { a.baseConfig.border = o.cfg }
+func (o borderCropOption) applyDifference(d *Difference)         { d.baseConfig.border = o.cfg }
+func (o borderCropOption) applyMedian(m *Median)                 { m.baseConfig.border = o.cfg }
+func (o borderCropOption) applyPHash(p *PHash)                   { p.baseConfig.border = o.cfg }
+func (o borderCropOption) applyBlockMean(b *BlockMean)           { b.baseConfig.border = o.cfg }
+func (o borderCropOption) applyMarrHildreth(m *MarrHildreth)     { m.baseConfig.border = o.cfg }
+func (o borderCropOption) applyRadialVariance(r *RadialVariance) { r.border = o.cfg }
+func (o borderCropOption) applyColorMoment(c *ColorMoment)       { c.baseConfig.border = o.cfg }
+func (o borderCropOption) applyCLD(c *CLD)                       { c.baseConfig.border = o.cfg }
+func (o borderCropOption) applyEHD(e *EHD)                       { e.baseConfig.border = o.cfg }
+func (o borderCropOption) applyWHash(w *WHash)                   { w.baseConfig.border = o.cfg }
+func (o borderCropOption) applyLBP(l *LBP)                       { l.baseConfig.border = o.cfg }
+func (o borderCropOption) applyHOGHash(h *HOGHash)               { h.baseConfig.border = o.cfg }
+func (o borderCropOption) applyPDQ(p *PDQ)                       { p.border = o.cfg }
+func (o borderCropOption) applyRASH(r *RASH)                     { r.baseConfig.border = o.cfg }
+func (o borderCropOption) applyZernike(z *Zernike)               { z.baseConfig.border = o.cfg }
+func (o borderCropOption) applyGIST(g *GIST)                     { g.baseConfig.border = o.cfg }
+func (o borderCropOption) applyBoVW(b *BoVW)                     { b.baseConfig.border = o.cfg }
+func (o borderCropOption) applyCropResistant(c *CropResistant)   { c.border = o.cfg }
+
 // KernelSizeOption sets the Gaussian kernel size.
 type KernelSizeOption interface {
 	MarrHildrethOption
@@ -331,15 +444,21 @@ type degreeOption struct{ degree int }
 
 func (o degreeOption) applyZernike(z *Zernike) { z.degree = o.degree }
 
-// WeightsOption sets the per-byte weights for weighted distance.
+// WeightsOption sets the per-byte weights for weighted distance, or the
+// member weights of an ensemble.
 type WeightsOption interface {
 	PHashOption
+	EnsembleOption
 }
 
 type weightsOption struct{ weights []float64 }
 
 func (o weightsOption) applyPHash(p *PHash) { p.weights = append([]float64(nil), o.weights...) }
 
+func (o weightsOption) applyEnsemble(e *Ensemble) {
+	e.weights = append([]float64(nil), o.weights...)
+}
+
 // BoVWFeatureOption sets the local feature extractor for BoVW.
 type BoVWFeatureOption interface {
 	BoVWOption
@@ -408,6 +527,24 @@ func WithInterpolation(interp Interpolation) InterpolationOption {
 	return interpolationOption{interp}
 }
 
+// WithAlphaPolicy sets how transparent pixels are handled before the image
+// is converted to grayscale or another colour space. The default,
+// AlphaPremultiply, treats transparent pixels as black; use AlphaComposite
+// to match logos and stickers against how they look on a page.
+// Applies to all algorithms.
+func WithAlphaPolicy(policy AlphaPolicy) AlphaPolicyOption {
+	return alphaPolicyOption{cfg: newAlphaConfig(policy), setMode: true, setBackground: true}
+}
+
+// WithBorderCrop crops uniform borders, such as letterbox bars or the
+// padding of a screenshot, before the image is resized, so that padding
+// does not change the hash. tolerance is the largest difference per 8-bit
+// channel from the border colour, between 0 and 255; see ContentBounds.
+// Applies to all algorithms.
+func WithBorderCrop(tolerance uint) BorderCropOption {
+	return borderCropOption{cropConfig{enabled: true, tolerance: tolerance}}
+}
+
 // WithKernelSize sets the Gaussian kernel size.
 // Applies to MarrHildreth and ColorMoment.
 func WithKernelSize(size int) KernelSizeOption {
@@ -489,7 +626,9 @@ func WithDegree(degree int) DegreeOption {
 
 // WithWeights sets the per-byte weights used for weighted Hamming distance.
 // The slice length must match the number of hash bytes (8 for default PHash).
-// Applies to PHash.
+// For an Ensemble it sets the weight of every member in the fused distance
+// instead; see Fusion.
+// Applies to PHash and Ensemble.
 func WithWeights(weights []float64) WeightsOption {
 	return weightsOption{append([]float64(nil), weights...)}
 }
@@ -97,3 +97,7 @@ var _ BoVWOption = WithMaxKeypoints(0)
 var _ BoVWOption = WithMinHashSize(0)
 var _ BoVWOption = WithSimHashBits(0)
 var _ BoVWOption = WithDistance(nil)
+
+var _ EnsembleOption = WithWeights(nil)
+var _ EnsembleOption = WithFusion(FuseWeightedSum)
+var _ EnsembleOption = WithFusionIntercept(0)
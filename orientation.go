@@ -0,0 +1,170 @@
+package imghash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+
+	"github.com/ajdnik/imghash/v2/internal/imgproc"
+)
+
+// Orientation is the EXIF orientation of an image: how the stored pixels
+// must be transformed to display the image upright.
+type Orientation int
+
+// EXIF orientation values.
+const (
+	// OrientationNormal needs no transform. It is also reported for images
+	// without orientation metadata.
+	OrientationNormal Orientation = iota + 1
+	// OrientationFlipH mirrors the image horizontally.
+	OrientationFlipH
+	// OrientationRotate180 rotates the image by 180 degrees.
+	OrientationRotate180
+	// OrientationFlipV mirrors the image vertically.
+	OrientationFlipV
+	// OrientationTranspose mirrors the image along its main diagonal.
+	OrientationTranspose
+	// OrientationRotate90 rotates the image 90 degrees clockwise.
+	OrientationRotate90
+	// OrientationTransverse mirrors the image along its anti-diagonal.
+	OrientationTransverse
+	// OrientationRotate270 rotates the image 90 degrees counter-clockwise.
+	OrientationRotate270
+)
+
+// exifOrientationTag is the TIFF tag holding the orientation.
+const exifOrientationTag = 0x0112
+
+// ReadOrientation reads the EXIF orientation of an encoded image. It
+// understands EXIF in JPEG APP1 segments, TIFF headers, WebP EXIF chunks
+// and PNG eXIf chunks, and reports OrientationNormal when there is no
+// orientation tag.
+func ReadOrientation(r io.Reader) (Orientation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return orientationOf(data), nil
+}
+
+// ApplyOrientation transforms img, as stored, so that it displays upright
+// under orientation o. Gray images stay gray and other images are
+// converted to RGBA; OrientationNormal and unknown values return img.
+func ApplyOrientation(img image.Image, o Orientation) image.Image {
+	return imgproc.Orient(img, int(o))
+}
+
+func orientationOf(data []byte) Orientation {
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		tiff = jpegEXIF(data)
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		tiff = data
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		tiff = webpEXIF(data[12:])
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		tiff = pngEXIF(data[8:])
+	}
+	if o := tiffOrientation(tiff); o >= OrientationNormal && o <= OrientationRotate270 {
+		return o
+	}
+	return OrientationNormal
+}
+
+// jpegEXIF returns the TIFF structure of the EXIF APP1 segment.
+func jpegEXIF(data []byte) []byte {
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			i++
+			continue
+		case marker == 0xD8 || marker == 0x01 || marker >= 0xD0 && marker <= 0xD7:
+			i += 2
+			continue
+		case marker == 0xD9 || marker == 0xDA:
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return nil
+		}
+		seg := data[i+4 : i+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+		i += 2 + n
+	}
+	return nil
+}
+
+// webpEXIF returns the payload of the EXIF chunk of a WebP file.
+func webpEXIF(chunks []byte) []byte {
+	for len(chunks) >= 8 {
+		n := int(binary.LittleEndian.Uint32(chunks[4:]))
+		if n < 0 || 8+n > len(chunks) {
+			return nil
+		}
+		if string(chunks[:4]) == "EXIF" {
+			// Some writers keep the JPEG APP1 prefix.
+			return bytes.TrimPrefix(chunks[8:8+n], []byte("Exif\x00\x00"))
+		}
+		chunks = chunks[8+n+n%2:]
+	}
+	return nil
+}
+
+// pngEXIF returns the payload of the eXIf chunk of a PNG file.
+func pngEXIF(chunks []byte) []byte {
+	for len(chunks) >= 12 {
+		n := int(binary.BigEndian.Uint32(chunks))
+		if n < 0 || 12+n > len(chunks) {
+			return nil
+		}
+		switch string(chunks[4:8]) {
+		case "eXIf":
+			return chunks[8 : 8+n]
+		case "IEND":
+			return nil
+		}
+		chunks = chunks[12+n:]
+	}
+	return nil
+}
+
+// tiffOrientation returns the orientation tag of the first IFD of a TIFF
+// structure, or 0 if there is none.
+func tiffOrientation(tiff []byte) Orientation {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int64(order.Uint32(tiff[4:]))
+	if ifd+2 > int64(len(tiff)) {
+		return 0
+	}
+	entries := tiff[ifd+2:]
+	for range order.Uint16(tiff[ifd:]) {
+		if len(entries) < 12 {
+			return 0
+		}
+		// Orientation is a single SHORT stored in the value field.
+		if order.Uint16(entries) == exifOrientationTag && order.Uint16(entries[2:]) == 3 {
+			return Orientation(order.Uint16(entries[8:]))
+		}
+		entries = entries[12:]
+	}
+	return 0
+}
@@ -0,0 +1,244 @@
+package imghash_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+)
+
+// exifTIFF returns a TIFF structure whose first IFD holds only the given
+// orientation tag.
+func exifTIFF(order binary.ByteOrder, o imghash.Orientation) []byte {
+	b := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(b, "II*\x00")
+	} else {
+		copy(b, "MM\x00*")
+	}
+	order.PutUint32(b[4:], 8)
+	order.PutUint16(b[8:], 1)
+	order.PutUint16(b[10:], 0x0112)
+	order.PutUint16(b[12:], 3)
+	order.PutUint32(b[14:], 1)
+	order.PutUint16(b[18:], uint16(o))
+	return b
+}
+
+// withJPEGEXIF inserts an EXIF APP1 segment after the SOI marker.
+func withJPEGEXIF(data, tiff []byte) []byte {
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	out := append([]byte(nil), data[:2]...)
+	out = append(out, seg...)
+	out = append(out, payload...)
+	return append(out, data[2:]...)
+}
+
+// withPNGEXIF inserts an eXIf chunk after the IHDR chunk.
+func withPNGEXIF(data, tiff []byte) []byte {
+	const ihdrEnd = 8 + 25
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(tiff)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, tiff...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	out := append([]byte(nil), data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
+
+// webpWithEXIF returns a WebP container holding only an EXIF chunk.
+func webpWithEXIF(payload []byte) []byte {
+	chunk := append([]byte("EXIF"), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	out := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(4+len(chunk)))...)
+	out = append(out, "WEBP"...)
+	return append(out, chunk...)
+}
+
+// uprightImage returns a small image in which every pixel differs.
+func uprightImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 5, 3))
+	for y := range 3 {
+		for x := range 5 {
+			img.SetRGBA(x, y, color.RGBA{uint8(40 * x), uint8(80 * y), 100, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadOrientation(t *testing.T) {
+	jpg := encodeJPEG(t, uprightImage())
+	pngData := encodePNG(t, uprightImage())
+	tests := []struct {
+		name string
+		data []byte
+		want imghash.Orientation
+	}{
+		{"jpeg", withJPEGEXIF(jpg, exifTIFF(binary.BigEndian, imghash.OrientationRotate90)), imghash.OrientationRotate90},
+		{"jpeg little endian", withJPEGEXIF(jpg, exifTIFF(binary.LittleEndian, imghash.OrientationFlipV)), imghash.OrientationFlipV},
+		{"jpeg without exif", jpg, imghash.OrientationNormal},
+		{"tiff", exifTIFF(binary.LittleEndian, imghash.OrientationRotate270), imghash.OrientationRotate270},
+		{"webp", webpWithEXIF(exifTIFF(binary.LittleEndian, imghash.OrientationRotate180)), imghash.OrientationRotate180},
+		{"webp with exif prefix", webpWithEXIF(append([]byte("Exif\x00\x00"), exifTIFF(binary.BigEndian, imghash.OrientationTranspose)...)), imghash.OrientationTranspose},
+		{"png", withPNGEXIF(pngData, exifTIFF(binary.BigEndian, imghash.OrientationTransverse)), imghash.OrientationTransverse},
+		{"png without exif", pngData, imghash.OrientationNormal},
+		{"invalid value", exifTIFF(binary.BigEndian, 9), imghash.OrientationNormal},
+		{"truncated", withJPEGEXIF(jpg, exifTIFF(binary.BigEndian, imghash.OrientationRotate90)[:12]), imghash.OrientationNormal},
+		{"not an image", []byte("not an image"), imghash.OrientationNormal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := imghash.ReadOrientation(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// inverse maps each orientation to the transform that undoes it.
+var inverse = map[imghash.Orientation]imghash.Orientation{
+	imghash.OrientationNormal:     imghash.OrientationNormal,
+	imghash.OrientationFlipH:      imghash.OrientationFlipH,
+	imghash.OrientationRotate180:  imghash.OrientationRotate180,
+	imghash.OrientationFlipV:      imghash.OrientationFlipV,
+	imghash.OrientationTranspose:  imghash.OrientationTranspose,
+	imghash.OrientationRotate90:   imghash.OrientationRotate270,
+	imghash.OrientationTransverse: imghash.OrientationTransverse,
+	imghash.OrientationRotate270:  imghash.OrientationRotate90,
+}
+
+func TestDecode_orientation(t *testing.T) {
+	want := uprightImage()
+	for o := imghash.OrientationNormal; o <= imghash.OrientationRotate270; o++ {
+		stored := imghash.ApplyOrientation(want, inverse[o])
+		data := withPNGEXIF(encodePNG(t, stored), exifTIFF(binary.BigEndian, o))
+
+		got, err := imghash.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameRGBA(got, want) {
+			t.Errorf("orientation %d: decoded image is not upright", o)
+		}
+
+		raw, err := imghash.DecodeImage(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw.Bounds().Size() != stored.Bounds().Size() {
+			t.Errorf("orientation %d: DecodeImage got size %v, want stored size %v", o, raw.Bounds().Size(), stored.Bounds().Size())
+		}
+		off, err := imghash.Decode(bytes.NewReader(data), imghash.WithOrientation(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameRGBA(off, stored) {
+			t.Errorf("orientation %d: WithOrientation(false) changed the image", o)
+		}
+	}
+}
+
+func sameRGBA(a, b image.Image) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return false
+	}
+	ao, bo := a.Bounds().Min, b.Bounds().Min
+	for y := range a.Bounds().Dy() {
+		for x := range a.Bounds().Dx() {
+			ar, ag, ab, aa := a.At(ao.X+x, ao.Y+y).RGBA()
+			br, bg, bb, ba := b.At(bo.X+x, bo.Y+y).RGBA()
+			if ar != br || ag != bg || ab != bb || aa != ba {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestHashFile_orientation(t *testing.T) {
+	upright, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := imghash.ApplyOrientation(upright, imghash.OrientationRotate270)
+	path := filepath.Join(t.TempDir(), "rotated.jpg")
+	data := withJPEGEXIF(encodeJPEG(t, stored), exifTIFF(binary.LittleEndian, imghash.OrientationRotate90))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := imghash.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Size() != upright.Bounds().Size() {
+		t.Errorf("Open got size %v, want %v", img.Bounds().Size(), upright.Bounds().Size())
+	}
+
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := pdq.Calculate(upright)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		opts    []imghash.DecodeOption
+		upright bool
+	}{
+		{"default", nil, false},
+		{"orientation applied", []imghash.DecodeOption{imghash.WithOrientation(true)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := imghash.HashFile(pdq, path, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dist, err := pdq.Compare(got, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.upright != (dist <= 16) {
+				t.Errorf("got distance %v to the upright hash, upright = %v", dist, tt.upright)
+			}
+		})
+	}
+}
@@ -29,10 +29,19 @@ const pdqJaroszReps = 2
 // It produces a 256-bit hash robust to JPEG compression, rescaling,
 // and minor edits while remaining fast enough for large-scale deduplication.
 //
+// Hash bits are laid out like the reference implementation, so
+// Binary.Hex(hashtype.LSB0) yields the 64-character hex format used by
+// Meta's tooling and ThreatExchange, and hashtype.ParseHex with LSB0
+// reads such strings back.
+//
 // See https://github.com/facebook/ThreatExchange/tree/main/pdq for more information.
 type PDQ struct {
 	// Resize interpolation method.
-	interp   Interpolation
+	interp Interpolation
+	// Alpha channel handling.
+	alphaPolicy alphaConfig
+	// Border cropping.
+	border   cropConfig
 	distFunc DistanceFunc
 }
 
@@ -40,7 +49,8 @@ type PDQ struct {
 // Without options, sensible defaults are used.
 func NewPDQ(opts ...PDQOption) (PDQ, error) {
 	p := PDQ{
-		interp: Bilinear,
+		interp:      Bilinear,
+		alphaPolicy: defaultAlphaPolicy,
 	}
 	for _, o := range opts {
 		o.applyPDQ(&p)
@@ -48,22 +58,162 @@ func NewPDQ(opts ...PDQOption) (PDQ, error) {
 	if err := p.interp.validate(); err != nil {
 		return PDQ{}, err
 	}
+	if err := p.alphaPolicy.validate(); err != nil {
+		return PDQ{}, err
+	}
+	if err := p.border.validate(); err != nil {
+		return PDQ{}, err
+	}
 	return p, nil
 }
 
 // Calculate returns a 256-bit perceptual hash of the image.
 func (p PDQ) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(pdqDCTSize, pdqDCTSize, img, p.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return p.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Binary hash with enough capacity. See IntoHasher.
+func (p PDQ) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return p.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (p PDQ) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return p.calculate(nil, prep)
+}
+
+func (p PDQ) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(p.alphaPolicy).cropBorders(p.border)
+	block, _, err := p.coefficients(prep)
 	if err != nil {
 		return nil, err
 	}
+	return p.computeHash(dst, block, p.median(block)), nil
+}
+
+// CalculateWithQuality returns the hash together with its quality score,
+// an integer between 0 and 100 computed from the image gradients like the
+// reference implementation. Flat or nearly blank images score low; Meta
+// recommends discarding hashes with a quality below 50 before matching.
+func (p PDQ) CalculateWithQuality(img image.Image) (hashtype.Hash, int, error) {
+	block, quality, err := p.coefficients(Prepare(img).flatten(p.alphaPolicy).cropBorders(p.border))
+	if err != nil {
+		return nil, 0, err
+	}
+	return p.computeHash(nil, block, p.median(block)), quality, nil
+}
+
+// CalculateDihedral returns the hashes of the eight dihedral transforms of
+// the image (rotations by multiples of 90 degrees and mirrors), indexed by
+// Dihedral, together with the quality score of CalculateWithQuality. The
+// variants are derived from a single DCT instead of hashing transformed
+// copies of the image, so matching a query against all eight detects
+// rotated and mirrored copies at the cost of one hash computation.
+func (p PDQ) CalculateDihedral(img image.Image) ([]hashtype.Hash, int, error) {
+	block, quality, err := p.coefficients(Prepare(img).flatten(p.alphaPolicy).cropBorders(p.border))
+	if err != nil {
+		return nil, 0, err
+	}
+	hashes := make([]hashtype.Hash, dihedralCount)
+	for d := range Dihedral(dihedralCount) {
+		t := pdqDihedralBlock(block, d)
+		hashes[d] = p.computeHash(nil, t, p.median(t))
+	}
+	return hashes, quality, nil
+}
+
+// coefficients returns the low-frequency DCT block and the quality score
+// of the image.
+func (p PDQ) coefficients(prep *Prepared) ([][]float32, int, error) {
+	if img := prep.Image(); img != nil && img.Bounds().Empty() {
+		return nil, 0, ErrEmptyImage
+	}
+	g, err := prep.ResizedGray(pdqDCTSize, pdqDCTSize, p.interp)
+	if err != nil {
+		return nil, 0, err
+	}
 	buf := imgproc.GrayToF32(g)
 	imgproc.JaroszFilter(buf, pdqJaroszWindow, pdqJaroszReps)
 	dct := imgproc.DCT(buf)
-	block := p.extractBlock(dct)
-	med := p.median(block)
-	return p.computeHash(block, med), nil
+	return p.extractBlock(dct), pdqQuality(buf), nil
+}
+
+// pdqQuality sums the absolute vertical and horizontal differences of the
+// filtered image, scaled to percent of the pixel range, as in the
+// reference implementation.
+func pdqQuality(buf [][]float32) int {
+	var sum int
+	for i := 0; i < len(buf)-1; i++ {
+		for j := range buf[i] {
+			sum += pdqGradient(buf[i][j], buf[i+1][j])
+		}
+	}
+	for i := range buf {
+		for j := 0; j < len(buf[i])-1; j++ {
+			sum += pdqGradient(buf[i][j], buf[i][j+1])
+		}
+	}
+	return min(sum/90, 100)
+}
+
+func pdqGradient(u, v float32) int {
+	d := int((u - v) * 100 / 255)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// pdqOddFrequency reports whether coefficient index i of the DCT block
+// holds an odd frequency. Mirroring the image along an axis negates the
+// odd frequencies along that axis.
+func pdqOddFrequency(i int) bool {
+	return i&1 == 1
+}
+
+// pdqDihedralBlock returns the DCT block of the image transformed by d,
+// computed from the block of the original image. Rows of the block are
+// vertical frequencies and columns horizontal ones.
+func pdqDihedralBlock(a [][]float32, d Dihedral) [][]float32 {
+	b := make([][]float32, len(a))
+	for i := range b {
+		b[i] = make([]float32, len(a[i]))
+	}
+	for i := range a {
+		for j, v := range a[i] {
+			oi, oj := pdqOddFrequency(i), pdqOddFrequency(j)
+			switch d {
+			case DihedralOriginal:
+				b[i][j] = v
+			case DihedralRotate90:
+				b[j][i] = flipSign(v, oj)
+			case DihedralRotate180:
+				b[i][j] = flipSign(v, oi != oj)
+			case DihedralRotate270:
+				b[j][i] = flipSign(v, oi)
+			case DihedralFlipX:
+				b[i][j] = flipSign(v, oi)
+			case DihedralFlipY:
+				b[i][j] = flipSign(v, oj)
+			case DihedralFlipPlus1:
+				b[j][i] = v
+			case DihedralFlipMinus1:
+				b[j][i] = flipSign(v, oi != oj)
+			}
+		}
+	}
+	return b
+}
+
+func flipSign(v float32, negate bool) float32 {
+	if negate {
+		return -v
+	}
+	return v
 }
 
 // extractBlock returns the top-left pdqCoefSize x pdqCoefSize block from the DCT output.
@@ -82,8 +232,8 @@ func (p PDQ) median(block [][]float32) float32 {
 }
 
 // computeHash thresholds the DCT block against the median to produce a 256-bit hash.
-func (p PDQ) computeHash(block [][]float32, median float32) hashtype.Binary {
-	hash := make(hashtype.Binary, pdqHashBytes)
+func (p PDQ) computeHash(dst hashtype.Hash, block [][]float32, median float32) hashtype.Binary {
+	hash := hashInto[hashtype.Binary](dst, pdqHashBytes)
 	var c uint
 	for i := range block {
 		for j := range block[i] {
@@ -106,3 +256,49 @@ func (p PDQ) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
 	}
 	return similarity.Hamming(h1, h2)
 }
+
+// ComparesHamming reports whether Compare returns the Hamming distance,
+// which it does unless WithDistance was given. See HammingComparer.
+func (p PDQ) ComparesHamming() bool {
+	return p.distFunc == nil
+}
+
+// Dihedral identifies one of the eight symmetries of a square image: the
+// rotations by multiples of 90 degrees and the mirrors about the axes and
+// diagonals. It indexes the hashes returned by PDQ.CalculateDihedral, in
+// the order used by the reference PDQ implementation.
+type Dihedral int
+
+// Dihedral transforms.
+const (
+	// DihedralOriginal is the untransformed image.
+	DihedralOriginal Dihedral = iota
+	// DihedralRotate90 is the image rotated 90 degrees counter-clockwise.
+	DihedralRotate90
+	// DihedralRotate180 is the image rotated 180 degrees.
+	DihedralRotate180
+	// DihedralRotate270 is the image rotated 270 degrees counter-clockwise.
+	DihedralRotate270
+	// DihedralFlipX is the image mirrored about the horizontal axis (upside down).
+	DihedralFlipX
+	// DihedralFlipY is the image mirrored about the vertical axis (left to right).
+	DihedralFlipY
+	// DihedralFlipPlus1 is the image mirrored about the main diagonal (transposed).
+	DihedralFlipPlus1
+	// DihedralFlipMinus1 is the image mirrored about the anti-diagonal.
+	DihedralFlipMinus1
+)
+
+const dihedralCount = 8
+
+var dihedralNames = [dihedralCount]string{
+	"Original", "Rotate90", "Rotate180", "Rotate270", "FlipX", "FlipY", "FlipPlus1", "FlipMinus1",
+}
+
+// String returns the name of the transform.
+func (d Dihedral) String() string {
+	if d >= 0 && d < dihedralCount {
+		return dihedralNames[d]
+	}
+	return "Unknown"
+}
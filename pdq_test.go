@@ -2,6 +2,8 @@ package imghash_test
 
 import (
 	"fmt"
+	"image"
+	"image/color"
 	"testing"
 
 	"github.com/ajdnik/imghash/v2"
@@ -14,12 +16,12 @@ var pdqCalculateTests = []struct {
 	hash       hashtype.Binary
 	resizeType imghash.Interpolation
 }{
-	{"assets/lena.jpg", hashtype.Binary{191, 0, 123, 5, 107, 81, 181, 32, 255, 82, 205, 10, 101, 173, 121, 166, 146, 229, 208, 180, 210, 252, 0, 219, 64, 127, 24, 219, 0, 253, 88, 125}, imghash.Bilinear},
-	{"assets/baboon.jpg", hashtype.Binary{255, 0, 5, 234, 7, 169, 191, 1, 225, 248, 133, 43, 17, 108, 251, 128, 16, 127, 131, 39, 0, 255, 234, 85, 64, 255, 226, 221, 64, 255, 106, 85}, imghash.Bilinear},
-	{"assets/cat.jpg", hashtype.Binary{255, 0, 255, 0, 233, 42, 61, 168, 171, 5, 179, 17, 119, 2, 85, 174, 152, 255, 140, 217, 96, 247, 72, 93, 0, 253, 2, 119, 4, 255, 0, 255}, imghash.Bilinear},
-	{"assets/monarch.jpg", hashtype.Binary{191, 0, 255, 1, 38, 136, 63, 0, 153, 247, 237, 41, 128, 240, 71, 2, 198, 93, 128, 253, 104, 245, 0, 255, 64, 255, 0, 255, 64, 255, 224, 255}, imghash.Bilinear},
-	{"assets/peppers.jpg", hashtype.Binary{239, 1, 253, 144, 63, 0, 9, 229, 227, 8, 131, 218, 131, 218, 187, 87, 192, 246, 148, 10, 80, 255, 6, 255, 0, 253, 38, 109, 24, 255, 118, 36}, imghash.Bilinear},
-	{"assets/tulips.jpg", hashtype.Binary{171, 0, 127, 0, 126, 4, 127, 8, 63, 8, 123, 16, 52, 120, 165, 11, 160, 251, 47, 95, 200, 55, 202, 53, 128, 247, 128, 253, 212, 255, 192, 247}, imghash.Bilinear},
+	{"assets/lena.jpg", hashtype.Binary{153, 0, 99, 159, 106, 219, 180, 52, 174, 82, 204, 106, 101, 169, 105, 182, 22, 165, 213, 181, 210, 156, 22, 193, 107, 51, 24, 155, 49, 217, 234, 108}, imghash.Bilinear},
+	{"assets/baboon.jpg", hashtype.Binary{251, 16, 4, 234, 6, 161, 190, 7, 248, 240, 5, 87, 27, 44, 241, 164, 27, 30, 129, 47, 129, 206, 143, 37, 143, 75, 165, 205, 99, 222, 239, 201}, imghash.Bilinear},
+	{"assets/cat.jpg", hashtype.Binary{171, 30, 211, 90, 225, 43, 61, 169, 42, 117, 146, 49, 230, 242, 85, 78, 153, 18, 156, 153, 227, 226, 89, 109, 35, 93, 38, 167, 21, 50, 193, 184}, imghash.Bilinear},
+	{"assets/monarch.jpg", hashtype.Binary{151, 97, 222, 131, 102, 202, 63, 240, 25, 246, 105, 47, 136, 112, 206, 2, 198, 91, 128, 173, 248, 225, 25, 248, 25, 29, 14, 54, 102, 144, 255, 135}, imghash.Bilinear},
+	{"assets/peppers.jpg", hashtype.Binary{197, 111, 253, 16, 62, 212, 8, 165, 227, 12, 136, 219, 147, 210, 187, 119, 195, 116, 148, 90, 208, 201, 128, 170, 99, 101, 165, 105, 123, 141, 214, 164}, imghash.Bilinear},
+	{"assets/tulips.jpg", hashtype.Binary{163, 132, 117, 105, 194, 109, 95, 186, 55, 200, 122, 144, 52, 120, 37, 10, 32, 115, 47, 94, 104, 27, 223, 49, 137, 183, 39, 89, 214, 95, 148, 138}, imghash.Bilinear},
 }
 
 func TestPDQ_Calculate(t *testing.T) {
@@ -60,7 +62,62 @@ func ExamplePDQ_Calculate() {
 	}
 
 	fmt.Println(hash)
-	// Output: [255 0 255 0 233 42 61 168 171 5 179 17 119 2 85 174 152 255 140 217 96 247 72 93 0 253 2 119 4 255 0 255]
+	// Output: [171 30 211 90 225 43 61 169 42 117 146 49 230 242 85 78 153 18 156 153 227 226 89 109 35 93 38 167 21 50 193 184]
+}
+
+// pdqReferenceHexTests spell out the hex format of Hash256::format in
+// Meta's reference PDQ implementation. The reference sets the bit of DCT
+// coefficient (i, j) as bit k = i*16+j of the hash, stores it in 16-bit
+// word k/16 at bit k%16 and prints the words from 15 down to 0.
+var pdqReferenceHexTests = []struct {
+	name string
+	bits []int
+	hex  string
+}{
+	{"coefficient (0,0)", []int{0}, "0000000000000000000000000000000000000000000000000000000000000001"},
+	{"coefficient (0,8)", []int{8}, "0000000000000000000000000000000000000000000000000000000000000100"},
+	{"coefficient (0,15)", []int{15}, "0000000000000000000000000000000000000000000000000000000000008000"},
+	{"coefficient (1,0)", []int{16}, "0000000000000000000000000000000000000000000000000000000000010000"},
+	{"coefficient (15,15)", []int{255}, "8000000000000000000000000000000000000000000000000000000000000000"},
+	{"first row", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, "000000000000000000000000000000000000000000000000000000000000ffff"},
+	{"diagonal", []int{0, 17, 34, 51, 68, 85, 102, 119, 136, 153, 170, 187, 204, 221, 238, 255}, "8000400020001000080004000200010000800040002000100008000400020001"},
+}
+
+func TestPDQ_referenceHex(t *testing.T) {
+	for _, tt := range pdqReferenceHexTests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := make(hashtype.Binary, 32)
+			for _, k := range tt.bits {
+				if err := hash.Set(uint(k)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if got := hash.Hex(hashtype.LSB0); got != tt.hex {
+				t.Errorf("got %v, want %v", got, tt.hex)
+			}
+			back, err := hashtype.ParseHex(tt.hex, hashtype.LSB0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !back.Equal(hash) {
+				t.Errorf("round trip: got %v, want %v", back, hash)
+			}
+		})
+	}
+}
+
+func ExamplePDQ_hex() {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		panic(err)
+	}
+	hash, err := imghash.HashFile(pdq, "assets/cat.jpg")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(hash.(imghash.Binary).Hex(hashtype.LSB0))
+	// Output: b8c13215a7265d236d59e2e3999c12994e55f2e63192752aa93d2be15ad31eab
 }
 
 var pdqDistanceTests = []struct {
@@ -69,11 +126,11 @@ var pdqDistanceTests = []struct {
 	distance    similarity.Distance
 	resizeType  imghash.Interpolation
 }{
-	{"assets/lena.jpg", "assets/cat.jpg", 90, imghash.Bilinear},
-	{"assets/lena.jpg", "assets/monarch.jpg", 80, imghash.Bilinear},
-	{"assets/baboon.jpg", "assets/cat.jpg", 102, imghash.Bilinear},
-	{"assets/peppers.jpg", "assets/baboon.jpg", 98, imghash.Bilinear},
-	{"assets/tulips.jpg", "assets/monarch.jpg", 84, imghash.Bilinear},
+	{"assets/lena.jpg", "assets/cat.jpg", 130, imghash.Bilinear},
+	{"assets/lena.jpg", "assets/monarch.jpg", 128, imghash.Bilinear},
+	{"assets/baboon.jpg", "assets/cat.jpg", 126, imghash.Bilinear},
+	{"assets/peppers.jpg", "assets/baboon.jpg", 132, imghash.Bilinear},
+	{"assets/tulips.jpg", "assets/monarch.jpg", 130, imghash.Bilinear},
 }
 
 func TestPDQ_Distance(t *testing.T) {
@@ -109,3 +166,169 @@ func TestPDQ_Distance(t *testing.T) {
 		})
 	}
 }
+
+func TestPDQ_CalculateWithQuality(t *testing.T) {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+	flat := image.NewUniform(color.Gray{Y: 128})
+	tests := []struct {
+		name       string
+		img        image.Image
+		minQuality int
+		maxQuality int
+	}{
+		{"flat", &image.Gray{Pix: make([]uint8, 64*64), Stride: 64, Rect: image.Rect(0, 0, 64, 64)}, 0, 0},
+		{"uniform gray", imageFrom(flat, 100, 80), 0, 0},
+		{"gradient", horizontalGradient(256, 256), 1, 49},
+		{"lena", mustOpen(t, "assets/lena.jpg"), 100, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, quality, err := pdq.CalculateWithQuality(tt.img)
+			if err != nil {
+				t.Fatalf("CalculateWithQuality: %v", err)
+			}
+			if quality < tt.minQuality || quality > tt.maxQuality {
+				t.Errorf("got quality %d, want [%d, %d]", quality, tt.minQuality, tt.maxQuality)
+			}
+			want, err := pdq.Calculate(tt.img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dist, _ := similarity.Hamming(hash, want); dist != 0 {
+				t.Errorf("hash differs from Calculate by %v bits", dist)
+			}
+		})
+	}
+}
+
+func TestPDQ_CalculateDihedral(t *testing.T) {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+	img := mustOpen(t, "assets/lena.jpg")
+	hashes, quality, err := pdq.CalculateDihedral(img)
+	if err != nil {
+		t.Fatalf("CalculateDihedral: %v", err)
+	}
+	if len(hashes) != 8 || quality != 100 {
+		t.Fatalf("got %d hashes with quality %d, want 8 with quality 100", len(hashes), quality)
+	}
+	orig, err := pdq.Calculate(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dist, _ := similarity.Hamming(hashes[imghash.DihedralOriginal], orig); dist != 0 {
+		t.Errorf("original variant differs from Calculate by %v bits", dist)
+	}
+
+	// Hashing a transformed copy must land closest to the matching variant.
+	for d := imghash.DihedralOriginal; d <= imghash.DihedralFlipMinus1; d++ {
+		t.Run(d.String(), func(t *testing.T) {
+			h, err := pdq.Calculate(transformImage(img, d))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := similarity.Hamming(h, hashes[d])
+			if want > 8 {
+				t.Errorf("distance to %v variant is %v bits", d, want)
+			}
+			for e, other := range hashes {
+				if imghash.Dihedral(e) == d {
+					continue
+				}
+				if dist, _ := similarity.Hamming(h, other); dist <= want {
+					t.Errorf("%v variant is closer (%v bits) than %v (%v bits)", imghash.Dihedral(e), dist, d, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDihedral_String(t *testing.T) {
+	if got := imghash.DihedralFlipPlus1.String(); got != "FlipPlus1" {
+		t.Errorf("got %q, want FlipPlus1", got)
+	}
+	if got := imghash.Dihedral(8).String(); got != "Unknown" {
+		t.Errorf("got %q, want Unknown", got)
+	}
+}
+
+// transformImage applies the dihedral transform d to a square image.
+func transformImage(src image.Image, d imghash.Dihedral) image.Image {
+	b := src.Bounds()
+	n := b.Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, n, n))
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			sx, sy := x, y
+			switch d {
+			case imghash.DihedralRotate90:
+				sx, sy = n-1-y, x
+			case imghash.DihedralRotate180:
+				sx, sy = n-1-x, n-1-y
+			case imghash.DihedralRotate270:
+				sx, sy = y, n-1-x
+			case imghash.DihedralFlipX:
+				sy = n - 1 - y
+			case imghash.DihedralFlipY:
+				sx = n - 1 - x
+			case imghash.DihedralFlipPlus1:
+				sx, sy = y, x
+			case imghash.DihedralFlipMinus1:
+				sx, sy = n-1-y, n-1-x
+			}
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+func horizontalGradient(w, h int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(x * 255 / (w - 1))})
+		}
+	}
+	return img
+}
+
+func imageFrom(src image.Image, w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, src.At(x, y))
+		}
+	}
+	return img
+}
+
+func mustOpen(t *testing.T, path string) image.Image {
+	t.Helper()
+	img, err := imghash.OpenImage(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	return img
+}
+
+func ExamplePDQ_CalculateDihedral() {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		panic(err)
+	}
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		panic(err)
+	}
+	hashes, quality, err := pdq.CalculateDihedral(img)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(len(hashes), quality)
+	// Output: 8 100
+}
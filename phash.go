@@ -2,6 +2,7 @@ package imghash
 
 import (
 	"image"
+	"slices"
 
 	"github.com/ajdnik/imghash/v2/hashtype"
 	"github.com/ajdnik/imghash/v2/internal/imgproc"
@@ -27,7 +28,7 @@ type PHash struct {
 // Without options, sensible defaults are used.
 func NewPHash(opts ...PHashOption) (PHash, error) {
 	p := PHash{
-		baseConfig: baseConfig{width: 32, height: 32, interp: BilinearExact},
+		baseConfig: baseConfig{width: 32, height: 32, interp: BilinearExact, alphaPolicy: defaultAlphaPolicy},
 	}
 	for _, o := range opts {
 		o.applyPHash(&p)
@@ -46,8 +47,26 @@ func NewPHash(opts ...PHashOption) (PHash, error) {
 
 // Calculate returns a perceptual image hash.
 func (ph PHash) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(ph.width, ph.height, img, ph.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return ph.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Binary hash with enough capacity. See IntoHasher.
+func (ph PHash) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return ph.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (ph PHash) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return ph.calculate(nil, prep)
+}
+
+func (ph PHash) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(ph.alphaPolicy).cropBorders(ph.border)
+	g, err := prep.ResizedGray(ph.width, ph.height, ph.interp)
 	if err != nil {
 		return nil, err
 	}
@@ -58,12 +77,12 @@ func (ph PHash) Calculate(img image.Image) (hashtype.Hash, error) {
 	tLeft[0][0] = 0
 	mean := ph.mean(tLeft)
 	bitImg := ph.compare(tLeft, mean)
-	return ph.computeHash(bitImg), nil
+	return ph.computeHash(dst, bitImg), nil
 }
 
 // Computes the binary hash based on the binary image supplied.
-func (ph PHash) computeHash(img [][]float32) hashtype.Binary {
-	hash := make(hashtype.Binary, dctCoefSize)
+func (ph PHash) computeHash(dst hashtype.Hash, img [][]float32) hashtype.Binary {
+	hash := hashInto[hashtype.Binary](dst, dctCoefSize)
 	var c uint
 	for i := range img {
 		for j := range img[i] {
@@ -123,3 +142,10 @@ func (ph PHash) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
 	}
 	return similarity.WeightedHamming(h1, h2, ph.weights)
 }
+
+// ComparesHamming reports whether Compare returns the Hamming distance,
+// which it does unless WithDistance was given or a weight differs from 1.
+// See HammingComparer.
+func (ph PHash) ComparesHamming() bool {
+	return ph.distFunc == nil && !slices.ContainsFunc(ph.weights, func(w float64) bool { return w != 1 })
+}
@@ -0,0 +1,213 @@
+package imghash
+
+import (
+	"image"
+	"image/draw"
+	"sync"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/internal/imgproc"
+)
+
+// PreparedHasher is implemented by hashers that can reuse the preprocessing
+// cached in a Prepared image. All algorithms in this package implement it.
+type PreparedHasher interface {
+	Hasher
+	CalculatePrepared(*Prepared) (hashtype.Hash, error)
+}
+
+// Prepared is an image together with lazily memoised preprocessing that
+// hash algorithms share: the grayscale conversion and resized variants
+// keyed by size and interpolation. Computing several hashes of one image
+// through a Prepared image does each resize and grayscale conversion once:
+//
+//	p := imghash.Prepare(img)
+//	a, err := avg.CalculatePrepared(p)
+//	d, err := diff.CalculatePrepared(p)
+//
+// A Prepared image is safe for concurrent use. The images it returns are
+// shared between callers and must not be modified.
+type Prepared struct {
+	img   image.Image
+	mu    sync.Mutex
+	cache map[preparedKey]func() (image.Image, error)
+	// derived holds the Prepared images derived from this one, keyed by
+	// the alphaConfig or cropConfig that produced them.
+	derived map[any]func() *Prepared
+	// scratch, when set, supplies pooled memory for the cached images.
+	scratch *scratch
+}
+
+type preparedStep uint8
+
+const (
+	preparedGray preparedStep = iota
+	preparedResized
+	preparedResizedGray
+)
+
+type preparedKey struct {
+	step          preparedStep
+	width, height uint
+	interp        Interpolation
+}
+
+// Prepare wraps img for use with CalculatePrepared. No work is done until
+// a hasher requests it.
+func Prepare(img image.Image) *Prepared {
+	return &Prepared{img: img, cache: make(map[preparedKey]func() (image.Image, error))}
+}
+
+// Image returns the original image.
+func (p *Prepared) Image() image.Image {
+	return p.img
+}
+
+// Flatten returns the Prepared image that algorithms configured with the
+// given alpha policy work on. Under AlphaPremultiply, or when the image is
+// opaque, it returns p itself. The flattened image is computed once per
+// policy and shares nothing else with p.
+func (p *Prepared) Flatten(policy AlphaPolicy) *Prepared {
+	return p.flatten(newAlphaConfig(policy))
+}
+
+func (p *Prepared) flatten(a alphaConfig) *Prepared {
+	if a.mode == AlphaPremultiply {
+		return p
+	}
+	return p.derive(a, func() (image.Image, bool) { return a.flatten(p.img) })
+}
+
+// CropBorders returns the Prepared image cropped to ContentBounds with the
+// given tolerance, the image that algorithms configured with
+// WithBorderCrop work on. When there is no border it returns p itself.
+func (p *Prepared) CropBorders(tolerance uint8) *Prepared {
+	return p.cropBorders(cropConfig{enabled: true, tolerance: uint(tolerance)})
+}
+
+func (p *Prepared) cropBorders(c cropConfig) *Prepared {
+	if !c.enabled {
+		return p
+	}
+	return p.derive(c, func() (image.Image, bool) { return c.crop(p.img) })
+}
+
+// derive returns the Prepared image for the result of fn, computing it
+// once per key. fn reports false when the image is unchanged, in which
+// case p itself is returned.
+func (p *Prepared) derive(key any, fn func() (image.Image, bool)) *Prepared {
+	p.mu.Lock()
+	if p.derived == nil {
+		p.derived = make(map[any]func() *Prepared)
+	}
+	f, ok := p.derived[key]
+	if !ok {
+		f = sync.OnceValue(func() *Prepared {
+			img, ok := fn()
+			if !ok {
+				return p
+			}
+			d := Prepare(img)
+			d.scratch = p.scratch
+			return d
+		})
+		p.derived[key] = f
+	}
+	p.mu.Unlock()
+	return f()
+}
+
+// Gray returns the image converted to grayscale at its original size.
+func (p *Prepared) Gray() (*image.Gray, error) {
+	img, err := p.memo(preparedKey{step: preparedGray}, func() (image.Image, error) {
+		if p.img == nil {
+			return nil, imgproc.ErrImageIsNil
+		}
+		g := p.newGray(p.img.Bounds())
+		imgproc.GrayscaleInto(g, p.img)
+		return g, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img.(*image.Gray), nil
+}
+
+// Resized returns the image scaled to width x height with the given
+// interpolation method.
+func (p *Prepared) Resized(width, height uint, interp Interpolation) (image.Image, error) {
+	return p.memo(preparedKey{preparedResized, width, height, interp}, func() (image.Image, error) {
+		if p.img == nil {
+			return nil, imgproc.ErrImageIsNil
+		}
+		return p.resize(p.img, width, height, interp), nil
+	})
+}
+
+// ResizedGray returns the grayscale conversion of Resized(width, height, interp).
+func (p *Prepared) ResizedGray(width, height uint, interp Interpolation) (*image.Gray, error) {
+	img, err := p.memo(preparedKey{preparedResizedGray, width, height, interp}, func() (image.Image, error) {
+		r, err := p.Resized(width, height, interp)
+		if err != nil {
+			return nil, err
+		}
+		g := p.newGray(r.Bounds())
+		imgproc.GrayscaleInto(g, r)
+		return g, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img.(*image.Gray), nil
+}
+
+// resize scales img to width x height, into memory from p's scratch pool
+// when it has one.
+func (p *Prepared) resize(img image.Image, width, height uint, interp Interpolation) image.Image {
+	r := image.Rect(0, 0, int(width), int(height))
+	var dst draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		dst = p.newGray(r)
+	} else {
+		dst = p.newRGBA(r)
+	}
+	imgproc.ResizeInto(dst, img, interp.resizeType())
+	return dst
+}
+
+// blur applies a Gaussian filter to img, into memory from p's scratch pool
+// when it has one.
+func (p *Prepared) blur(img image.Image, kernel int, sigma float64) image.Image {
+	r := image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+	var dst draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		dst = p.newGray(r)
+	} else {
+		dst = p.newRGBA(r)
+	}
+	imgproc.GaussianBlurInto(dst, img, kernel, sigma)
+	return dst
+}
+
+// memo returns the cached result for key, computing it with fn on first use.
+// Concurrent callers requesting the same key wait for a single computation.
+func (p *Prepared) memo(key preparedKey, fn func() (image.Image, error)) (image.Image, error) {
+	p.mu.Lock()
+	f, ok := p.cache[key]
+	if !ok {
+		f = sync.OnceValues(fn)
+		p.cache[key] = f
+	}
+	p.mu.Unlock()
+	return f()
+}
+
+// CalculatePrepared computes the hash of a prepared image with h, reusing
+// its cached preprocessing when h implements PreparedHasher and calling
+// h.Calculate on the original image otherwise.
+func CalculatePrepared(h Hasher, p *Prepared) (hashtype.Hash, error) {
+	if ph, ok := h.(PreparedHasher); ok {
+		return ph.CalculatePrepared(p)
+	}
+	return h.Calculate(p.Image())
+}
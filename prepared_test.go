@@ -0,0 +1,144 @@
+package imghash_test
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+)
+
+func TestCalculatePrepared(t *testing.T) {
+	img, err := imghash.OpenImage("assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prep := imghash.Prepare(img)
+	for _, name := range []string{
+		"average", "difference", "median", "phash", "blockmean", "marrhildreth",
+		"radialvariance", "colormoment", "cld", "ehd", "whash", "lbp",
+		"hoghash", "bovw", "pdq", "rash", "zernike", "gist",
+	} {
+		t.Run(name, func(t *testing.T) {
+			h, err := imghash.New(name, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ph, ok := h.(imghash.PreparedHasher)
+			if !ok {
+				t.Fatalf("%T does not implement PreparedHasher", h)
+			}
+			want, err := h.Calculate(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ph.CalculatePrepared(prep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPrepared_cache(t *testing.T) {
+	img, err := imghash.OpenImage("assets/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prep := imghash.Prepare(img)
+	if prep.Image() != img {
+		t.Error("Image does not return the original image")
+	}
+
+	var wg sync.WaitGroup
+	grays := make([]*image.Gray, 8)
+	for i := range grays {
+		wg.Go(func() {
+			grays[i], _ = prep.ResizedGray(32, 32, imghash.Bilinear)
+		})
+	}
+	wg.Wait()
+	for _, g := range grays {
+		if g == nil || g != grays[0] {
+			t.Fatal("ResizedGray was not memoised")
+		}
+	}
+	if b := grays[0].Bounds(); b.Dx() != 32 || b.Dy() != 32 {
+		t.Errorf("got bounds %v, want 32x32", b)
+	}
+
+	other, err := prep.ResizedGray(32, 32, imghash.Bicubic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == grays[0] {
+		t.Error("different interpolation methods share a cache entry")
+	}
+
+	g1, err := prep.Gray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, _ := prep.Gray()
+	if g1 != g2 || g1.Bounds() != img.Bounds() {
+		t.Error("Gray was not memoised at the original size")
+	}
+}
+
+func TestPrepared_nilImage(t *testing.T) {
+	prep := imghash.Prepare(nil)
+	if _, err := prep.Resized(8, 8, imghash.Bilinear); err == nil {
+		t.Error("Resized: expected error for nil image")
+	}
+	if _, err := prep.Gray(); err == nil {
+		t.Error("Gray: expected error for nil image")
+	}
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := avg.CalculatePrepared(prep); err == nil {
+		t.Error("CalculatePrepared: expected error for nil image")
+	}
+}
+
+func TestCalculatePrepared_fallback(t *testing.T) {
+	h, err := imghash.CalculatePrepared(failingHasher{}, imghash.Prepare(image.NewGray(image.Rect(0, 0, 1, 1))))
+	if h != nil || err == nil || errors.Is(err, imghash.ErrNoHashers) {
+		t.Errorf("got %v, %v, want the error from Calculate", h, err)
+	}
+}
+
+func ExamplePrepare() {
+	img, err := imghash.OpenImage("assets/cat.jpg")
+	if err != nil {
+		panic(err)
+	}
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		panic(err)
+	}
+	med, err := imghash.NewMedian()
+	if err != nil {
+		panic(err)
+	}
+
+	// Both hashes reuse the same 8x8 grayscale thumbnail.
+	prep := imghash.Prepare(img)
+	h1, err := avg.CalculatePrepared(prep)
+	if err != nil {
+		panic(err)
+	}
+	h2, err := med.CalculatePrepared(prep)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(h1, h2)
+	// Output: [255 255 15 7 1 0 0 0] [255 255 31 7 1 1 1 7]
+}
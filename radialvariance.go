@@ -17,7 +17,11 @@ type RadialVariance struct {
 	// Gaussian kernel standard deviation.
 	sigma float64
 	// Number of angles to consider.
-	angles   int
+	angles int
+	// Alpha channel handling.
+	alphaPolicy alphaConfig
+	// Border cropping.
+	border   cropConfig
 	distFunc DistanceFunc
 }
 
@@ -28,8 +32,9 @@ const sqTwo = math.Sqrt2
 // Without options, sensible defaults are used.
 func NewRadialVariance(opts ...RadialVarianceOption) (RadialVariance, error) {
 	rv := RadialVariance{
-		sigma:  1,
-		angles: 180,
+		sigma:       1,
+		angles:      180,
+		alphaPolicy: defaultAlphaPolicy,
 	}
 	for _, o := range opts {
 		o.applyRadialVariance(&rv)
@@ -40,19 +45,44 @@ func NewRadialVariance(opts ...RadialVarianceOption) (RadialVariance, error) {
 	if rv.sigma < 0 {
 		return RadialVariance{}, ErrInvalidSigma
 	}
+	if err := rv.alphaPolicy.validate(); err != nil {
+		return RadialVariance{}, err
+	}
+	if err := rv.border.validate(); err != nil {
+		return RadialVariance{}, err
+	}
 	return rv, nil
 }
 
 // Calculate returns a perceptual image hash.
 func (rv RadialVariance) Calculate(img image.Image) (hashtype.Hash, error) {
-	g, err := imgproc.Grayscale(img)
+	return rv.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a UInt8 hash with enough capacity. See IntoHasher.
+func (rv RadialVariance) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return rv.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (rv RadialVariance) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return rv.calculate(nil, prep)
+}
+
+func (rv RadialVariance) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(rv.alphaPolicy).cropBorders(rv.border)
+	g, err := prep.Gray()
 	if err != nil {
 		return nil, err
 	}
 	b := imgproc.GaussianBlur(g, 0, rv.sigma)
 	proj, ppl, dim := rv.radialProjections(b.(*image.Gray))
 	feat := rv.findFeatureVector(proj, ppl, dim)
-	return rv.computeHash(feat), nil
+	return rv.computeHash(dst, feat), nil
 }
 
 func roundingFactor(val float32) float32 {
@@ -143,8 +173,8 @@ func (rv RadialVariance) findFeatureVector(proj []uint8, ppl []int32, dim int) [
 	return feat
 }
 
-func (rv RadialVariance) computeHash(feat []float64) hashtype.UInt8 {
-	hash := make(hashtype.UInt8, hashSize)
+func (rv RadialVariance) computeHash(dst hashtype.Hash, feat []float64) hashtype.UInt8 {
+	hash := hashInto[hashtype.UInt8](dst, hashSize)
 	temp := make([]float64, hashSize)
 	var hi, lo float64
 	for i := 0; i < hashSize; i++ {
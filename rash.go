@@ -35,7 +35,7 @@ const rashHashBits = 64
 // Without options, sensible defaults are used.
 func NewRASH(opts ...RASHOption) (RASH, error) {
 	r := RASH{
-		baseConfig: baseConfig{width: 256, height: 256, interp: Bilinear},
+		baseConfig: baseConfig{width: 256, height: 256, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 		sigma:      1,
 		rings:      180,
 	}
@@ -56,14 +56,32 @@ func NewRASH(opts ...RASHOption) (RASH, error) {
 
 // Calculate returns a perceptual image hash.
 func (r RASH) Calculate(img image.Image) (hashtype.Hash, error) {
-	resized := imgproc.Resize(r.width, r.height, img, r.interp.resizeType())
-	g, err := imgproc.Grayscale(resized)
+	return r.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Binary hash with enough capacity. See IntoHasher.
+func (r RASH) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return r.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (r RASH) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return r.calculate(nil, prep)
+}
+
+func (r RASH) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(r.alphaPolicy).cropBorders(r.border)
+	g, err := prep.ResizedGray(r.width, r.height, r.interp)
 	if err != nil {
 		return nil, err
 	}
 	blurred := imgproc.GaussianBlur(g, 0, r.sigma)
 	means := r.ringMeans(blurred.(*image.Gray))
-	return r.computeHash(means)
+	return r.computeHash(dst, means)
 }
 
 // ringMeans computes the mean pixel intensity for each concentric ring.
@@ -106,7 +124,7 @@ func (r RASH) ringMeans(img *image.Gray) []float64 {
 // computeHash applies a 1-D DCT to the ring means, keeps the first
 // rashHashBits low-frequency coefficients (skipping DC), and binarises
 // them against the median.
-func (r RASH) computeHash(means []float64) (hashtype.Binary, error) {
+func (r RASH) computeHash(dst hashtype.Hash, means []float64) (hashtype.Binary, error) {
 	n := len(means)
 	dct := make([]float64, n)
 	c0 := math.Sqrt(1.0 / float64(n))
@@ -128,7 +146,7 @@ func (r RASH) computeHash(means []float64) (hashtype.Binary, error) {
 		hashBits = n - 1
 	}
 	if hashBits <= 0 {
-		return hashtype.NewBinary(0), nil
+		return binaryInto(dst, 0), nil
 	}
 	coeffs := dct[1 : hashBits+1]
 
@@ -137,7 +155,7 @@ func (r RASH) computeHash(means []float64) (hashtype.Binary, error) {
 	sort.Float64s(sorted)
 	median := sorted[len(sorted)/2]
 
-	hash := hashtype.NewBinary(uint(hashBits))
+	hash := binaryInto(dst, uint(hashBits))
 	for i, c := range coeffs {
 		if c > median {
 			if err := hash.Set(uint(i)); err != nil {
@@ -158,3 +176,9 @@ func (r RASH) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
 	}
 	return similarity.Hamming(h1, h2)
 }
+
+// ComparesHamming reports whether Compare returns the Hamming distance,
+// which it does unless WithDistance was given. See HammingComparer.
+func (r RASH) ComparesHamming() bool {
+	return r.distFunc == nil
+}
@@ -0,0 +1,486 @@
+package imghash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+// Registry errors.
+var (
+	// ErrUnknownAlgorithm is returned when no algorithm is registered under a name.
+	ErrUnknownAlgorithm = errors.New("imghash: unknown algorithm")
+	// ErrAlgorithmExists is returned when registering a name that is already taken.
+	ErrAlgorithmExists = errors.New("imghash: algorithm already registered")
+	// ErrInvalidAlgorithm is returned when registering an algorithm without
+	// a name, constructor or describe function.
+	ErrInvalidAlgorithm = errors.New("imghash: algorithm must have a name, New and Describe")
+	// ErrUnknownParam is returned when a parameter is not in an algorithm's schema.
+	ErrUnknownParam = errors.New("imghash: unknown parameter")
+	// ErrInvalidParam is returned when a parameter value cannot be converted
+	// to the type declared in the schema.
+	ErrInvalidParam = errors.New("imghash: invalid parameter value")
+	// ErrAlgorithmVersion is returned when an envelope was produced by a
+	// different version of an algorithm than the one registered.
+	ErrAlgorithmVersion = errors.New("imghash: algorithm version mismatch")
+)
+
+// ParamType is the value type of an algorithm parameter.
+type ParamType int
+
+// Parameter types and their canonical Go representation.
+const (
+	// ParamInt values are int.
+	ParamInt ParamType = iota + 1
+	// ParamUint values are uint.
+	ParamUint
+	// ParamFloat values are float64.
+	ParamFloat
+	// ParamDims values are strings of the form "WxH".
+	ParamDims
+	// ParamEnum values are strings naming one of Param.Values.
+	ParamEnum
+	// ParamFloats values are []float64.
+	ParamFloats
+	// ParamColor values are strings of the form "#RRGGBB".
+	ParamColor
+	// ParamString values are strings in a format documented by the parameter.
+	ParamString
+)
+
+// Param describes one parameter in an algorithm's option schema.
+type Param struct {
+	// Name is the parameter key, the snake_case name of the With* option.
+	Name string
+	// Type is the parameter value type.
+	Type ParamType
+	// Default is the canonical value used when the parameter is omitted,
+	// or nil if the default depends on other parameters.
+	Default any
+	// Values lists the accepted names of a ParamEnum parameter.
+	Values []string
+	// CompareOnly marks parameters that only affect Compare. They are
+	// accepted by New but not reported by Describe or recorded in envelopes.
+	CompareOnly bool
+	// Doc is a short description of the parameter.
+	Doc string
+}
+
+// Algorithm is a named hash algorithm that can be constructed from a
+// parameter map.
+type Algorithm struct {
+	// Name identifies the algorithm. Names are case-insensitive.
+	Name string
+	// Version is recorded in envelopes and must be bumped whenever a
+	// change makes the same parameters produce different hashes.
+	Version uint
+	// Kind is the kind of hash produced with the default parameters.
+	Kind hashtype.Kind
+	// Params is the option schema.
+	Params []Param
+	// New constructs a hasher. It receives only the parameters given by
+	// the caller, already converted to their canonical representation.
+	New func(params map[string]any) (HasherComparer, error)
+	// Describe reports whether h was produced by this algorithm and, if so,
+	// returns its canonical hash-affecting parameters.
+	Describe func(h Hasher) (map[string]any, bool)
+	// HashKind optionally returns the hash kind for the given canonical
+	// parameters, for algorithms whose kind depends on configuration.
+	// When nil, Kind is used.
+	HashKind func(params map[string]any) hashtype.Kind
+}
+
+// Spec describes a configured hasher in terms of its registered algorithm.
+type Spec struct {
+	Name    string
+	Version uint
+	Kind    hashtype.Kind
+	Params  map[string]any
+}
+
+var registry = struct {
+	sync.RWMutex
+	algorithms []Algorithm
+}{}
+
+// Register adds an algorithm to the registry so it can be constructed with
+// New and described with Describe. All algorithms in this package are
+// registered under their lowercase type name, e.g. "phash" or "pdq".
+func Register(a Algorithm) error {
+	if a.Name == "" || a.New == nil || a.Describe == nil {
+		return ErrInvalidAlgorithm
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, r := range registry.algorithms {
+		if strings.EqualFold(r.Name, a.Name) {
+			return fmt.Errorf("%w: %s", ErrAlgorithmExists, a.Name)
+		}
+	}
+	a.Name = strings.ToLower(a.Name)
+	a.Params = slices.Clone(a.Params)
+	registry.algorithms = append(registry.algorithms, a)
+	return nil
+}
+
+// Lookup returns the algorithm registered under name.
+func Lookup(name string) (Algorithm, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, a := range registry.algorithms {
+		if strings.EqualFold(a.Name, name) {
+			return a, true
+		}
+	}
+	return Algorithm{}, false
+}
+
+// Algorithms returns the names of all registered algorithms in sorted order.
+func Algorithms() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, len(registry.algorithms))
+	for i, a := range registry.algorithms {
+		names[i] = a.Name
+	}
+	slices.Sort(names)
+	return names
+}
+
+// New constructs the algorithm registered under name with the given
+// parameters. Omitted parameters keep their defaults.
+//
+// Keys are the snake_case names of the With* options (see
+// Algorithm.Params). Values may be given in their canonical Go form, as
+// strings in the form recorded by envelopes (e.g. "16x16", "Bicubic",
+// "1.5"), or as decoded JSON values:
+//
+//	imghash.New("phash", map[string]any{"size": "16x16", "interpolation": "Bicubic"})
+//
+// Option values are validated by the algorithm's constructor.
+func New(name string, params map[string]any) (HasherComparer, error) {
+	a, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, name)
+	}
+	canonical, err := a.convert(params)
+	if err != nil {
+		return nil, err
+	}
+	return a.New(canonical)
+}
+
+// Describe returns the registered algorithm and canonical hash-affecting
+// parameters of a configured hasher. Passing the parameters back to New
+// reproduces a hasher that computes identical hashes.
+func Describe(h Hasher) (Spec, error) {
+	registry.RLock()
+	algorithms := registry.algorithms
+	registry.RUnlock()
+	for _, a := range algorithms {
+		params, ok := a.Describe(h)
+		if !ok {
+			continue
+		}
+		kind := a.Kind
+		if a.HashKind != nil {
+			kind = a.HashKind(params)
+		}
+		return Spec{Name: a.Name, Version: a.Version, Kind: kind, Params: params}, nil
+	}
+	return Spec{}, fmt.Errorf("%w: %T", ErrUnknownHasher, h)
+}
+
+// FromEnvelope constructs the hasher recorded in an envelope, so new
+// images can be hashed the same way as the stored hash. It fails with
+// ErrAlgorithmVersion if the registered algorithm version differs from the
+// one that produced the envelope.
+func FromEnvelope(env Envelope) (HasherComparer, error) {
+	a, ok := Lookup(env.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, env.Algorithm)
+	}
+	if a.Version != env.Version {
+		return nil, fmt.Errorf("%w: %s is version %d, envelope has version %d", ErrAlgorithmVersion, a.Name, a.Version, env.Version)
+	}
+	params := make(map[string]any, len(env.Params))
+	for k, v := range env.Params {
+		params[k] = v
+	}
+	return New(a.Name, params)
+}
+
+// algorithmRef refers to a configured algorithm inside the parameters of
+// another one, such as the members of an ensemble: its registered name,
+// version and the hash-affecting parameters that differ from their
+// defaults. A zero version matches any registered version.
+type algorithmRef struct {
+	Algorithm string            `json:"algorithm"`
+	Version   uint              `json:"version,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+}
+
+// describeRef returns the reference to the registered algorithm of h.
+func describeRef(h Hasher) (algorithmRef, error) {
+	spec, err := Describe(h)
+	if err != nil {
+		return algorithmRef{}, err
+	}
+	a, _ := Lookup(spec.Name)
+	ref := algorithmRef{Algorithm: spec.Name, Version: spec.Version}
+	for _, name := range slices.Sorted(maps.Keys(spec.Params)) {
+		v := formatParam(spec.Params[name])
+		if p, ok := a.param(name); ok && p.Default != nil && formatParam(p.Default) == v {
+			continue
+		}
+		if ref.Params == nil {
+			ref.Params = make(map[string]string)
+		}
+		ref.Params[name] = v
+	}
+	return ref, nil
+}
+
+// build constructs the referenced algorithm with New. Parameters in shared
+// apply unless the reference sets them.
+func (r algorithmRef) build(shared map[string]any) (HasherComparer, error) {
+	a, ok := Lookup(r.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, r.Algorithm)
+	}
+	if r.Version != 0 && r.Version != a.Version {
+		return nil, fmt.Errorf("%w: %s is version %d, reference has version %d", ErrAlgorithmVersion, a.Name, a.Version, r.Version)
+	}
+	params := make(map[string]any, len(r.Params)+len(shared))
+	for k, v := range shared {
+		params[k] = v
+	}
+	for k, v := range r.Params {
+		params[k] = v
+	}
+	h, err := New(a.Name, params)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", a.Name, err)
+	}
+	return h, nil
+}
+
+func (a Algorithm) param(name string) (Param, bool) {
+	for _, p := range a.Params {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Param{}, false
+}
+
+// convert checks params against the schema and converts every value to its
+// canonical representation.
+func (a Algorithm) convert(params map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(params))
+	for name, v := range params {
+		p, ok := a.param(name)
+		if !ok {
+			return nil, fmt.Errorf("%w %q for %s", ErrUnknownParam, name, a.Name)
+		}
+		c, err := p.convert(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w for %q: %v", ErrInvalidParam, name, err)
+		}
+		out[name] = c
+	}
+	return out, nil
+}
+
+func (p Param) convert(v any) (any, error) {
+	if n, ok := v.(json.Number); ok {
+		v = n.String()
+	}
+	switch p.Type {
+	case ParamInt:
+		return toInt(v)
+	case ParamUint:
+		i, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			return nil, errors.New("must not be negative")
+		}
+		return uint(i), nil
+	case ParamFloat:
+		if s, ok := v.(string); ok {
+			return strconv.ParseFloat(s, 64)
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a number", v)
+		}
+		return f, nil
+	case ParamDims:
+		return toDims(v)
+	case ParamEnum:
+		var s string
+		switch x := v.(type) {
+		case string:
+			s = x
+		case fmt.Stringer:
+			s = x.String()
+		default:
+			return nil, fmt.Errorf("%T is not a name", v)
+		}
+		for _, name := range p.Values {
+			if strings.EqualFold(name, s) {
+				return name, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of %s", s, strings.Join(p.Values, ", "))
+	case ParamFloats:
+		return toFloats(v)
+	case ParamColor:
+		return toColor(v)
+	case ParamString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("%T is not a string", v)
+	}
+	return nil, fmt.Errorf("unsupported parameter type %d", p.Type)
+}
+
+func toFloat(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func toInt(v any) (int, error) {
+	if s, ok := v.(string); ok {
+		return strconv.Atoi(s)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt {
+			return 0, errors.New("out of range")
+		}
+		return int(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+			return 0, fmt.Errorf("%v is not an integer", f)
+		}
+		return int(f), nil
+	}
+	return 0, fmt.Errorf("%T is not an integer", v)
+}
+
+// toDims accepts "WxH" strings and two-element slices or arrays.
+func toDims(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		w, h, err := parseDims(s)
+		if err != nil {
+			return "", err
+		}
+		return formatDims(w, h), nil
+	}
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Len() == 2 {
+		var d [2]int
+		for i := range d {
+			n, err := toInt(rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			if n < 0 {
+				return "", errors.New("dimensions must not be negative")
+			}
+			d[i] = n
+		}
+		return formatDims(uint(d[0]), uint(d[1])), nil
+	}
+	return "", fmt.Errorf("%T is not WxH", v)
+}
+
+func parseDims(s string) (uint, uint, error) {
+	ws, hs, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not WxH", s)
+	}
+	w, err := strconv.ParseUint(ws, 10, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := strconv.ParseUint(hs, 10, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint(w), uint(h), nil
+}
+
+// toFloats accepts float slices, slices of numbers and comma-separated strings.
+func toFloats(v any) ([]float64, error) {
+	if s, ok := v.(string); ok {
+		var out []float64
+		for _, f := range strings.Split(s, ",") {
+			x, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, x)
+		}
+		return out, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%T is not a list of numbers", v)
+	}
+	out := make([]float64, rv.Len())
+	for i := range out {
+		f, ok := toFloat(rv.Index(i).Interface())
+		if !ok {
+			return nil, fmt.Errorf("element %d is not a number", i)
+		}
+		out[i] = f
+	}
+	return out, nil
+}
+
+// formatParam renders a canonical parameter value in its envelope form.
+func formatParam(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case uint:
+		return strconv.FormatUint(uint64(x), 10)
+	case float64:
+		return formatFloat(x)
+	case []float64:
+		parts := make([]string, len(x))
+		for i, f := range x {
+			parts[i] = formatFloat(f)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v)
+}
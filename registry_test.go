@@ -0,0 +1,252 @@
+package imghash_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+func TestRegistry_defaults(t *testing.T) {
+	names := imghash.Algorithms()
+	if len(names) < 18 {
+		t.Fatalf("got %d algorithms, want at least 18: %v", len(names), names)
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			a, ok := imghash.Lookup(name)
+			if !ok {
+				t.Fatalf("Lookup(%q) failed", name)
+			}
+			h, err := imghash.New(name, nil)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			spec, err := imghash.Describe(h)
+			if err != nil {
+				t.Fatalf("Describe: %v", err)
+			}
+			if spec.Name != a.Name || spec.Version != a.Version || spec.Kind != a.Kind {
+				t.Errorf("got spec %+v, want %s version %d kind %v", spec, a.Name, a.Version, a.Kind)
+			}
+			for key := range spec.Params {
+				if !slices.ContainsFunc(a.Params, func(p imghash.Param) bool { return p.Name == key }) {
+					t.Errorf("described parameter %q is not in the schema", key)
+				}
+			}
+			for _, p := range a.Params {
+				got, ok := spec.Params[p.Name]
+				if p.CompareOnly {
+					if ok {
+						t.Errorf("compare-only parameter %q is described", p.Name)
+					}
+					continue
+				}
+				if ok && got != p.Default {
+					t.Errorf("%s: got default %#v, schema says %#v", p.Name, got, p.Default)
+				}
+			}
+		})
+	}
+}
+
+func TestNew_roundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]any
+		want   map[string]any
+	}{
+		{"phash", map[string]any{"size": "16x16", "interpolation": "bicubic"}, map[string]any{"size": "16x16", "interpolation": "Bicubic"}},
+		{"blockmean", map[string]any{"block_size": [2]int{8, 8}, "block_mean_method": imghash.Overlap}, map[string]any{"block_size": "8x8", "block_mean_method": "Overlap"}},
+		{"marrhildreth", map[string]any{"scale": 2, "alpha": "1.5", "kernel_size": 5.0}, map[string]any{"scale": 2.0, "alpha": 1.5, "kernel_size": 5}},
+		{"hoghash", map[string]any{"cell_size": 16, "num_bins": uint8(6)}, map[string]any{"cell_size": uint(16), "num_bins": uint(6)}},
+		{"bovw", map[string]any{"bovw_storage": "SimHash", "sim_hash_bits": "64"}, map[string]any{"bovw_storage": "SimHash", "sim_hash_bits": uint(64)}},
+		{"GIST", map[string]any{"grid_size": "2x2"}, map[string]any{"grid_size": "2x2"}},
+		{"average", map[string]any{"alpha_mode": "composite", "background": "00ff80"}, map[string]any{"alpha_mode": "Composite", "background": "#00FF80"}},
+		{"pdq", map[string]any{"alpha_mode": imghash.AlphaIgnore}, map[string]any{"alpha_mode": "Ignore"}},
+		{"radialvariance", map[string]any{"crop_tolerance": "24"}, map[string]any{"crop_tolerance": uint(24)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := imghash.New(tt.name, tt.params)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			spec, err := imghash.Describe(h)
+			if err != nil {
+				t.Fatalf("Describe: %v", err)
+			}
+			for k, v := range tt.want {
+				if spec.Params[k] != v {
+					t.Errorf("%s: got %#v, want %#v", k, spec.Params[k], v)
+				}
+			}
+			again, err := imghash.New(spec.Name, spec.Params)
+			if err != nil {
+				t.Fatalf("New from described params: %v", err)
+			}
+			if !reflect.DeepEqual(again, h) {
+				t.Errorf("round trip produced a different hasher")
+			}
+		})
+	}
+}
+
+func TestNew_json(t *testing.T) {
+	var params map[string]any
+	if err := json.Unmarshal([]byte(`{"size": [16, 16], "weights": [1, 2, 0.5], "distance": "l1"}`), &params); err != nil {
+		t.Fatal(err)
+	}
+	h, err := imghash.New("phash", params)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	spec, err := imghash.Describe(h)
+	if err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+	if spec.Params["size"] != "16x16" {
+		t.Errorf("got size %v, want 16x16", spec.Params["size"])
+	}
+	if dist, err := h.Compare(hashtype.Binary{0}, hashtype.Binary{3}); err != nil || dist != 3 {
+		t.Errorf("got %v, %v, want L1 distance 3", dist, err)
+	}
+}
+
+func TestNew_errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		algo   string
+		params map[string]any
+		err    error
+	}{
+		{"unknown algorithm", "nope", nil, imghash.ErrUnknownAlgorithm},
+		{"unknown param", "average", map[string]any{"level": 2}, imghash.ErrUnknownParam},
+		{"bad dims", "average", map[string]any{"size": "8"}, imghash.ErrInvalidParam},
+		{"bad enum", "average", map[string]any{"interpolation": "Sharp"}, imghash.ErrInvalidParam},
+		{"bad int", "whash", map[string]any{"level": 1.5}, imghash.ErrInvalidParam},
+		{"negative uint", "hoghash", map[string]any{"cell_size": -1}, imghash.ErrInvalidParam},
+		{"constructor validation", "average", map[string]any{"size": "0x8"}, imghash.ErrInvalidSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := imghash.New(tt.algo, tt.params); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// constantHasher is a third-party hasher registered in TestRegister.
+type constantHasher struct{ value byte }
+
+func (c constantHasher) Calculate(image.Image) (hashtype.Hash, error) {
+	return hashtype.Binary{c.value}, nil
+}
+
+func (constantHasher) Compare(a, b hashtype.Hash) (imghash.Distance, error) {
+	return imghash.Compare(a, b)
+}
+
+func TestRegister(t *testing.T) {
+	a := imghash.Algorithm{
+		Name:    "Constant",
+		Version: 2,
+		Kind:    hashtype.KindBinary,
+		Params:  []imghash.Param{{Name: "value", Type: imghash.ParamUint, Default: uint(0)}},
+		New: func(p map[string]any) (imghash.HasherComparer, error) {
+			v, _ := p["value"].(uint)
+			if v > 255 {
+				return nil, errors.New("value out of range")
+			}
+			return constantHasher{byte(v)}, nil
+		},
+		Describe: func(h imghash.Hasher) (map[string]any, bool) {
+			c, ok := h.(constantHasher)
+			return map[string]any{"value": uint(c.value)}, ok
+		},
+	}
+	if err := imghash.Register(a); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := imghash.Register(a); !errors.Is(err, imghash.ErrAlgorithmExists) {
+		t.Errorf("duplicate Register: got %v, want %v", err, imghash.ErrAlgorithmExists)
+	}
+	if err := imghash.Register(imghash.Algorithm{Name: "broken"}); !errors.Is(err, imghash.ErrInvalidAlgorithm) {
+		t.Errorf("invalid Register: got %v, want %v", err, imghash.ErrInvalidAlgorithm)
+	}
+	if !slices.Contains(imghash.Algorithms(), "constant") {
+		t.Errorf("constant missing from %v", imghash.Algorithms())
+	}
+
+	h, err := imghash.New("constant", map[string]any{"value": "7"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	hash, err := h.Calculate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := imghash.NewEnvelope(h, hash)
+	if err != nil {
+		t.Fatalf("NewEnvelope: %v", err)
+	}
+	if env.Algorithm != "constant" || env.Version != 2 || env.Params["value"] != "7" {
+		t.Errorf("unexpected envelope %+v", env)
+	}
+	rebuilt, err := imghash.FromEnvelope(env)
+	if err != nil {
+		t.Fatalf("FromEnvelope: %v", err)
+	}
+	if rebuilt != h {
+		t.Errorf("got %v, want %v", rebuilt, h)
+	}
+}
+
+func TestFromEnvelope(t *testing.T) {
+	h, err := imghash.NewWHash(imghash.WithLevel(2), imghash.WithInterpolation(imghash.Bicubic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := imghash.NewEnvelope(h, hashtype.Binary{1, 2, 3, 4, 5, 6, 7, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := imghash.FromEnvelope(env)
+	if err != nil {
+		t.Fatalf("FromEnvelope: %v", err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("got %+v, want %+v", got, h)
+	}
+
+	env.Version++
+	if _, err := imghash.FromEnvelope(env); !errors.Is(err, imghash.ErrAlgorithmVersion) {
+		t.Errorf("got %v, want %v", err, imghash.ErrAlgorithmVersion)
+	}
+	env.Algorithm = "nope"
+	if _, err := imghash.FromEnvelope(env); !errors.Is(err, imghash.ErrUnknownAlgorithm) {
+		t.Errorf("got %v, want %v", err, imghash.ErrUnknownAlgorithm)
+	}
+}
+
+func ExampleNew() {
+	h, err := imghash.New("marrhildreth", map[string]any{"size": "256x256", "alpha": 1.5})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	spec, err := imghash.Describe(h)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(spec.Name, spec.Params["size"], spec.Params["alpha"], spec.Params["scale"])
+	// Output: marrhildreth 256x256 1.5 1
+}
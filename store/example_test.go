@@ -0,0 +1,64 @@
+package store_test
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/store"
+)
+
+func ExampleOpen() {
+	dir, err := os.MkdirTemp("", "hashes")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		panic(err)
+	}
+	cfg, err := store.ConfigOf(pdq)
+	if err != nil {
+		panic(err)
+	}
+	s, err := store.Open(dir, cfg)
+	if err != nil {
+		panic(err)
+	}
+	for id, path := range []string{"../assets/lena.jpg", "../assets/baboon.jpg", "../assets/peppers.jpg"} {
+		hash, err := imghash.HashFile(pdq, path)
+		if err != nil {
+			panic(err)
+		}
+		env, err := imghash.NewEnvelope(pdq, hash)
+		if err != nil {
+			panic(err)
+		}
+		if err := s.Add(uint64(id), env); err != nil {
+			panic(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		panic(err)
+	}
+
+	// Reopening the store needs no rehashing.
+	s, err = store.Open(dir, cfg)
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+	query, err := imghash.HashFile(pdq, "../assets/lena.jpg")
+	if err != nil {
+		panic(err)
+	}
+	matches, err := s.RadiusSearch(query, 31)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(s.Len(), "hashes, matches:", matches)
+	// Output:
+	// 3 hashes, matches: [{0 0}]
+}
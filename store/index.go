@@ -0,0 +1,373 @@
+package store
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+// Index file layout, all integers little-endian:
+//
+//	magic     8 bytes "IMGHIDX\x00"
+//	version   uint16, currently 1
+//	type      uint16, indexBinary or indexPivot
+//	records   uint32, record count of the segment
+//	n         uint32, number of indexed hashes
+//
+// A binary index continues with the substring width w and count m as
+// uint32, then for every substring 2^w+1 uint32 bucket offsets followed by
+// n uint32 record numbers sorted by substring value.
+//
+// A pivot index continues with the pivot count p as uint32 and p uint32
+// pivot record numbers, then n uint32 record numbers sorted by their
+// distance to the first pivot and, in the same order, n rows of p float64
+// distances to every pivot.
+const (
+	indexMagic   = "IMGHIDX\x00"
+	indexVersion = 1
+	indexPrefix  = 20
+
+	indexBinary = 1
+	indexPivot  = 2
+
+	maxSubstringWidth = 16
+	maxPivots         = 8
+)
+
+// errNoIndex is returned by openIndex when the index file is missing or
+// does not belong to the segment, so it has to be built.
+var errNoIndex = errors.New("store: no index")
+
+// openIndex maps the index of a sealed segment.
+func (g *segment) openIndex(dir string, cfg Config) error {
+	f, err := os.Open(filepath.Join(dir, indexName(g.num)))
+	if errors.Is(err, os.ErrNotExist) {
+		return errNoIndex
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	data, err := mapFile(f, int(fi.Size()))
+	if err != nil {
+		return err
+	}
+	if err := g.parseIndex(data, cfg); err != nil {
+		unmapFile(data)
+		return errNoIndex
+	}
+	g.index = data
+	return nil
+}
+
+func (g *segment) parseIndex(data []byte, cfg Config) error {
+	if len(data) < indexPrefix || string(data[:8]) != indexMagic || binary.LittleEndian.Uint16(data[8:]) != indexVersion {
+		return errNoIndex
+	}
+	typ := binary.LittleEndian.Uint16(data[10:])
+	if int(binary.LittleEndian.Uint32(data[12:])) != g.count {
+		return errNoIndex
+	}
+	n := int(binary.LittleEndian.Uint32(data[16:]))
+	switch {
+	case typ == indexBinary && cfg.Kind == hashtype.KindBinary:
+		x, err := parseBinaryIndex(data, n, 8*cfg.Length)
+		if err != nil {
+			return err
+		}
+		g.bin = x
+	case typ == indexPivot && cfg.Kind != hashtype.KindBinary:
+		x, err := parsePivotIndex(data, n, g.count)
+		if err != nil {
+			return err
+		}
+		g.vec = x
+	default:
+		return errNoIndex
+	}
+	return nil
+}
+
+// buildIndex indexes the hashes of a segment, writes the index file and
+// maps it.
+func (g *segment) buildIndex(dir string, cfg Config, size int) error {
+	var recs []int
+	for i := range g.count {
+		if g.record(i, size)[0] == recordHash {
+			recs = append(recs, i)
+		}
+	}
+	buf := make([]byte, indexPrefix)
+	copy(buf, indexMagic)
+	binary.LittleEndian.PutUint16(buf[8:], indexVersion)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(g.count))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(len(recs)))
+	if cfg.Kind == hashtype.KindBinary {
+		binary.LittleEndian.PutUint16(buf[10:], indexBinary)
+		buf = g.appendBinaryIndex(buf, recs, size, 8*cfg.Length)
+	} else {
+		binary.LittleEndian.PutUint16(buf[10:], indexPivot)
+		buf = g.appendPivotIndex(buf, recs, size, cfg.Kind)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, indexName(g.num)), buf); err != nil {
+		return err
+	}
+	if err := g.openIndex(dir, cfg); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorrupt, indexName(g.num), err)
+	}
+	return nil
+}
+
+// binaryIndex is a multi-index hashing table (Norouzi, Punjani and Fleet,
+// "Fast Search in Hamming Space with Multi-Index Hashing", CVPR 2012) over
+// the hashes of a segment. Each hash is split into m substrings of w bits,
+// and for every substring the records are bucketed by its value.
+type binaryIndex struct {
+	data   []byte
+	n      int
+	bits   int
+	width  int
+	chunks int
+}
+
+// substringWidth returns the substring width for n hashes of b bits, so
+// that buckets hold about one record each.
+func substringWidth(n, b int) int {
+	return max(1, min(maxSubstringWidth, bits.Len(uint(n)), b))
+}
+
+func (g *segment) appendBinaryIndex(buf []byte, recs []int, size, nbits int) []byte {
+	w := substringWidth(len(recs), nbits)
+	m := (nbits + w - 1) / w
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(w))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m))
+	values := make([]uint32, len(recs))
+	offsets := make([]uint32, 1<<w+1)
+	for c := range m {
+		start, width := c*w, min(w, nbits-c*w)
+		clear(offsets)
+		for j, r := range recs {
+			values[j] = substring(g.record(r, size)[recordPrefix:], start, width)
+			offsets[values[j]+1]++
+		}
+		for v := 1; v < len(offsets); v++ {
+			offsets[v] += offsets[v-1]
+		}
+		for _, o := range offsets {
+			buf = binary.LittleEndian.AppendUint32(buf, o)
+		}
+		entries := make([]uint32, len(recs))
+		next := slices.Clone(offsets[:len(offsets)-1])
+		for j, r := range recs {
+			entries[next[values[j]]] = uint32(r)
+			next[values[j]]++
+		}
+		for _, e := range entries {
+			buf = binary.LittleEndian.AppendUint32(buf, e)
+		}
+	}
+	return buf
+}
+
+func parseBinaryIndex(data []byte, n, nbits int) (*binaryIndex, error) {
+	if len(data) < indexPrefix+8 {
+		return nil, errNoIndex
+	}
+	x := &binaryIndex{
+		data:   data,
+		n:      n,
+		bits:   nbits,
+		width:  int(binary.LittleEndian.Uint32(data[indexPrefix:])),
+		chunks: int(binary.LittleEndian.Uint32(data[indexPrefix+4:])),
+	}
+	if x.width < 1 || x.width > maxSubstringWidth || x.chunks != (nbits+x.width-1)/x.width ||
+		len(data) != indexPrefix+8+x.chunks*x.tableSize() {
+		return nil, errNoIndex
+	}
+	return x, nil
+}
+
+func (x *binaryIndex) tableSize() int { return 4 * (1<<x.width + 1 + x.n) }
+
+// chunk returns the start and width of substring c.
+func (x *binaryIndex) chunk(c int) (start, width int) {
+	return c * x.width, min(x.width, x.bits-c*x.width)
+}
+
+// bucket calls fn with every record whose substring c has value v.
+func (x *binaryIndex) bucket(c int, v uint32, fn func(rec int)) {
+	table := indexPrefix + 8 + c*x.tableSize()
+	lo := binary.LittleEndian.Uint32(x.data[table+4*int(v):])
+	hi := binary.LittleEndian.Uint32(x.data[table+4*int(v)+4:])
+	entries := table + 4*(1<<x.width+1)
+	for j := lo; j < hi; j++ {
+		fn(int(binary.LittleEndian.Uint32(x.data[entries+4*int(j):])))
+	}
+}
+
+// probeCost returns the number of buckets probed for every substring at
+// exactly s differing bits.
+func (x *binaryIndex) probeCost(s int) float64 {
+	var cost float64
+	for c := range x.chunks {
+		_, w := x.chunk(c)
+		cost += binomial(w, s)
+	}
+	return cost
+}
+
+// probe calls fn with every record whose substrings differ from those of
+// q in exactly s bits for at least one substring.
+func (x *binaryIndex) probe(q []byte, s int, fn func(rec int)) {
+	for c := range x.chunks {
+		start, w := x.chunk(c)
+		if s > w {
+			continue
+		}
+		key := substring(q, start, w)
+		flips(w, s, 0, 0, func(mask uint32) { x.bucket(c, key^mask, fn) })
+	}
+}
+
+// substring returns width bits of p starting at bit start, counting from
+// the least significant bit of the first byte.
+func substring(p []byte, start, width int) uint32 {
+	var v uint32
+	for i := 0; i < width; {
+		b := start + i
+		n := min(8-b%8, width-i)
+		v |= uint32(p[b/8]>>(b%8)) & (1<<n - 1) << i
+		i += n
+	}
+	return v
+}
+
+// flips calls fn with every width-bit mask that has exactly n bits set at
+// positions from start upward, combined with mask.
+func flips(width, n, start int, mask uint32, fn func(uint32)) {
+	if n == 0 {
+		fn(mask)
+		return
+	}
+	for b := start; b <= width-n; b++ {
+		flips(width, n-1, b+1, mask|1<<b, fn)
+	}
+}
+
+func binomial(n, k int) float64 {
+	if k < 0 || k > n {
+		return 0
+	}
+	r := 1.0
+	for i := range k {
+		r = r * float64(n-i) / float64(i+1)
+	}
+	return r
+}
+
+// pivotIndex stores the L2 distance of every hash of a segment to a few
+// pivot hashes. By the triangle inequality, |d(q, p) - d(x, p)| is a lower
+// bound of d(q, x) for every pivot p, which rules out most records without
+// reading them (Micó, Oncina and Vidal, "A new version of the
+// nearest-neighbour approximating and eliminating search algorithm
+// (AESA) with linear preprocessing time and memory requirements", Pattern
+// Recognition Letters, 1994). Records are sorted by their distance to the
+// first pivot, so a search starts from the records closest to the query's.
+type pivotIndex struct {
+	data   []byte
+	n      int
+	pivots []int
+	order  int
+	dists  int
+}
+
+func (g *segment) appendPivotIndex(buf []byte, recs []int, size int, kind hashtype.Kind) []byte {
+	n := len(recs)
+	p := min(maxPivots, n)
+	// Pivots are chosen farthest first: each one is the hash farthest from
+	// the pivots chosen before it.
+	dist := make([][]float64, p)
+	nearest := make([]float64, n)
+	for i := range nearest {
+		nearest[i] = math.Inf(1)
+	}
+	pivots := make([]int, 0, p)
+	next := 0
+	for k := range p {
+		pivots = append(pivots, recs[next])
+		pv := vector(g.record(recs[next], size), kind)
+		dist[k] = make([]float64, n)
+		far := -1.0
+		for j, r := range recs {
+			d := l2(pv, g.record(r, size), kind)
+			dist[k][j] = d
+			nearest[j] = min(nearest[j], d)
+			if nearest[j] > far {
+				far, next = nearest[j], j
+			}
+		}
+	}
+	order := make([]int, n)
+	for j := range order {
+		order[j] = j
+	}
+	if p > 0 {
+		slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(dist[0][a], dist[0][b]) })
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(p))
+	for _, r := range pivots {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(r))
+	}
+	for _, j := range order {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(recs[j]))
+	}
+	for _, j := range order {
+		for k := range p {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(dist[k][j]))
+		}
+	}
+	return buf
+}
+
+func parsePivotIndex(data []byte, n, count int) (*pivotIndex, error) {
+	if len(data) < indexPrefix+4 {
+		return nil, errNoIndex
+	}
+	p := int(binary.LittleEndian.Uint32(data[indexPrefix:]))
+	if p > maxPivots || p > n || len(data) != indexPrefix+4+4*p+4*n+8*n*p {
+		return nil, errNoIndex
+	}
+	x := &pivotIndex{data: data, n: n, order: indexPrefix + 4 + 4*p}
+	x.dists = x.order + 4*n
+	for k := range p {
+		r := int(binary.LittleEndian.Uint32(data[indexPrefix+4+4*k:]))
+		if r >= count {
+			return nil, errNoIndex
+		}
+		x.pivots = append(x.pivots, r)
+	}
+	return x, nil
+}
+
+// record returns the record number at position j of the sorted order.
+func (x *pivotIndex) record(j int) int {
+	return int(binary.LittleEndian.Uint32(x.data[x.order+4*j:]))
+}
+
+// dist returns the distance of the record at position j to pivot k.
+func (x *pivotIndex) dist(j, k int) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(x.data[x.dists+8*(j*len(x.pivots)+k):]))
+}
@@ -0,0 +1,24 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package store
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the first size bytes of f on platforms without mmap
+// support in the syscall package.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(f, 0, int64(size)), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// unmapFile releases a buffer returned by mapFile.
+func unmapFile([]byte) error { return nil }
@@ -0,0 +1,416 @@
+package store
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// Result is a single search match.
+type Result struct {
+	ID       uint64
+	Distance similarity.Distance
+}
+
+// QueryOption configures RadiusSearch and KNN.
+type QueryOption interface{ applyQuery(*queryConfig) }
+
+type queryConfig struct {
+	linear bool
+}
+
+type linearScanOption bool
+
+func (o linearScanOption) applyQuery(c *queryConfig) { c.linear = bool(o) }
+
+// WithLinearScan compares the query with every record instead of using the
+// segment indexes. It returns the same results and suits small stores and
+// queries with a radius so large that most records match.
+func WithLinearScan() QueryOption { return linearScanOption(true) }
+
+// hit is a result with the position of its record, which breaks distance
+// ties in favour of older records.
+type hit struct {
+	Result
+	pos uint64
+}
+
+func (a hit) less(b hit) bool {
+	return a.Distance < b.Distance || a.Distance == b.Distance && a.pos < b.pos
+}
+
+func sortHits(hits []hit) []Result {
+	slices.SortFunc(hits, func(a, b hit) int {
+		if a.less(b) {
+			return -1
+		}
+		if b.less(a) {
+			return 1
+		}
+		return 0
+	})
+	out := make([]Result, len(hits))
+	for i, h := range hits {
+		out[i] = h.Result
+	}
+	return out
+}
+
+// query is a hash prepared for comparison with records: Binary hashes as
+// bytes compared by Hamming distance, other hashes as values compared by
+// L2 distance.
+type query struct {
+	kind hashtype.Kind
+	size int
+	bin  []byte
+	vec  []float64
+}
+
+func (q *query) dist(rec []byte) float64 {
+	if q.kind == hashtype.KindBinary {
+		return float64(hamming(q.bin, rec[recordPrefix:]))
+	}
+	return l2(q.vec, rec, q.kind)
+}
+
+// sync maps the records buffered since the last query.
+func (s *Store) sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.remap()
+}
+
+// prepare checks hash and prepares it for comparison. It returns a nil
+// query when the store holds no hashes yet.
+func (s *Store) prepare(hash hashtype.Hash) (*query, error) {
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if s.cfg.Length == 0 {
+		if k := hashtype.KindOf(hash); k != s.cfg.Kind {
+			return nil, ErrHashKindMismatch
+		}
+		return nil, nil
+	}
+	if err := s.checkHash(hash, false); err != nil {
+		return nil, err
+	}
+	q := &query{kind: s.cfg.Kind, size: s.recordSize()}
+	switch h := hash.(type) {
+	case hashtype.Binary:
+		q.bin = h
+	case hashtype.UInt8:
+		q.vec = make([]float64, len(h))
+		for i, v := range h {
+			q.vec[i] = float64(v)
+		}
+	case hashtype.Float64:
+		q.vec = h
+	}
+	return q, nil
+}
+
+// RadiusSearch returns every stored hash within maxDist of hash, nearest
+// first. Binary hashes are compared by Hamming distance, UInt8 and Float64
+// hashes by L2 distance.
+func (s *Store) RadiusSearch(hash hashtype.Hash, maxDist similarity.Distance, opts ...QueryOption) ([]Result, error) {
+	var c queryConfig
+	for _, o := range opts {
+		o.applyQuery(&c)
+	}
+	if err := s.sync(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	q, err := s.prepare(hash)
+	if q == nil || err != nil || !(maxDist >= 0) {
+		return nil, err
+	}
+	r := float64(maxDist)
+	var hits []hit
+	for _, g := range s.segments {
+		visit := func(i int) {
+			if h, ok := s.hit(q, g, i); ok && float64(h.Distance) <= r {
+				hits = append(hits, h)
+			}
+		}
+		switch {
+		case c.linear || (g.bin == nil && g.vec == nil):
+			scan(g, visit)
+		case g.bin != nil:
+			q.radiusBinary(g, r, visit)
+		default:
+			q.radiusPivot(g, r, visit)
+		}
+	}
+	return sortHits(hits), nil
+}
+
+// KNN returns the k stored hashes nearest to hash, nearest first. Hashes
+// are compared as in RadiusSearch.
+func (s *Store) KNN(hash hashtype.Hash, k int, opts ...QueryOption) ([]Result, error) {
+	if k <= 0 {
+		return nil, ErrInvalidK
+	}
+	var c queryConfig
+	for _, o := range opts {
+		o.applyQuery(&c)
+	}
+	if err := s.sync(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	q, err := s.prepare(hash)
+	if q == nil || err != nil {
+		return nil, err
+	}
+	best := &topK{k: k}
+	for _, g := range s.segments {
+		visit := func(i int) {
+			if h, ok := s.hit(q, g, i); ok {
+				best.push(h)
+			}
+		}
+		switch {
+		case c.linear || (g.bin == nil && g.vec == nil):
+			scan(g, visit)
+		case g.bin != nil:
+			q.knnBinary(g, best, visit)
+		default:
+			q.knnPivot(g, best, visit)
+		}
+	}
+	return sortHits(best.hits), nil
+}
+
+// hit compares q with record i of g unless it is a tombstone or deleted.
+func (s *Store) hit(q *query, g *segment, i int) (hit, bool) {
+	rec := g.record(i, q.size)
+	if rec[0] != recordHash {
+		return hit{}, false
+	}
+	id, pos := recordID(rec), position(g.num, i)
+	if !s.alive(id, pos) {
+		return hit{}, false
+	}
+	return hit{Result{id, similarity.Distance(q.dist(rec))}, pos}, true
+}
+
+func scan(g *segment, visit func(int)) {
+	for i := range g.count {
+		visit(i)
+	}
+}
+
+// radiusBinary visits the records of g that may be within r of q. By the
+// pigeonhole principle, a hash within r bits of q differs from it in at
+// most r/m bits in at least one of its m substrings.
+func (q *query) radiusBinary(g *segment, r float64, visit func(int)) {
+	x := g.bin
+	if r >= float64(x.bits) {
+		scan(g, visit)
+		return
+	}
+	s := int(r) / x.chunks
+	var cost float64
+	for t := 0; t <= s; t++ {
+		cost += x.probeCost(t)
+	}
+	if cost > float64(x.n) {
+		scan(g, visit)
+		return
+	}
+	seen := make([]bool, g.count)
+	for t := 0; t <= s; t++ {
+		x.probe(q.bin, t, func(rec int) {
+			if !seen[rec] {
+				seen[rec] = true
+				visit(rec)
+			}
+		})
+	}
+}
+
+// knnBinary probes the substrings of q at increasing radius s until the
+// k-th best match is closer than m*(s+1), after which no unprobed hash can
+// improve on it.
+func (q *query) knnBinary(g *segment, best *topK, visit func(int)) {
+	x := g.bin
+	seen := make([]bool, g.count)
+	mark := func(rec int) {
+		if !seen[rec] {
+			seen[rec] = true
+			visit(rec)
+		}
+	}
+	var cost float64
+	for s := 0; s <= x.width; s++ {
+		cost += x.probeCost(s)
+		if cost > float64(x.n) {
+			scan(g, mark)
+			return
+		}
+		x.probe(q.bin, s, mark)
+		if best.full() && float64(best.worst()) < float64(x.chunks*(s+1)) {
+			return
+		}
+	}
+}
+
+// pivotDistances returns the distances of q to the pivots of g and a
+// tolerance for rounding in distances computed in different orders.
+func (q *query) pivotDistances(g *segment) ([]float64, float64) {
+	x := g.vec
+	dq := make([]float64, len(x.pivots))
+	for k, r := range x.pivots {
+		dq[k] = l2(q.vec, g.record(r, q.size), q.kind)
+	}
+	return dq, 1e-9 * (1 + dq[0])
+}
+
+// radiusPivot visits the records of g whose pivot distances do not rule
+// out a distance of at most r to q.
+func (q *query) radiusPivot(g *segment, r float64, visit func(int)) {
+	x := g.vec
+	if len(x.pivots) == 0 {
+		return
+	}
+	dq, slack := q.pivotDistances(g)
+	r += slack + 1e-9*r
+	lo := sort.Search(x.n, func(j int) bool { return x.dist(j, 0) >= dq[0]-r })
+	for j := lo; j < x.n && x.dist(j, 0) <= dq[0]+r; j++ {
+		if x.bound(dq, j) <= r {
+			visit(x.record(j))
+		}
+	}
+}
+
+// knnPivot visits the records of g in order of their lower bound on the
+// first pivot, moving away from the query's distance to it in both
+// directions, until the bound exceeds the k-th best distance.
+func (q *query) knnPivot(g *segment, best *topK, visit func(int)) {
+	x := g.vec
+	if len(x.pivots) == 0 {
+		return
+	}
+	dq, slack := q.pivotDistances(g)
+	hi := sort.Search(x.n, func(j int) bool { return x.dist(j, 0) >= dq[0] })
+	lo := hi - 1
+	for lo >= 0 || hi < x.n {
+		var j int
+		if hi >= x.n || lo >= 0 && dq[0]-x.dist(lo, 0) <= x.dist(hi, 0)-dq[0] {
+			j, lo = lo, lo-1
+		} else {
+			j, hi = hi, hi+1
+		}
+		if best.full() && math.Abs(dq[0]-x.dist(j, 0)) > float64(best.worst())+slack {
+			return
+		}
+		if best.full() && x.bound(dq, j) > float64(best.worst())+slack {
+			continue
+		}
+		visit(x.record(j))
+	}
+}
+
+// bound returns the largest lower bound on the distance between the query
+// and the record at position j given by the pivots.
+func (x *pivotIndex) bound(dq []float64, j int) float64 {
+	var b float64
+	for k := range x.pivots {
+		b = max(b, math.Abs(dq[k]-x.dist(j, k)))
+	}
+	return b
+}
+
+// topK keeps the k best hits in a max-heap.
+type topK struct {
+	k    int
+	hits []hit
+}
+
+func (t *topK) Len() int           { return len(t.hits) }
+func (t *topK) Less(i, j int) bool { return t.hits[j].less(t.hits[i]) }
+func (t *topK) Swap(i, j int)      { t.hits[i], t.hits[j] = t.hits[j], t.hits[i] }
+func (t *topK) Push(x any)         { t.hits = append(t.hits, x.(hit)) }
+func (t *topK) Pop() any {
+	h := t.hits[len(t.hits)-1]
+	t.hits = t.hits[:len(t.hits)-1]
+	return h
+}
+
+func (t *topK) push(h hit) {
+	switch {
+	case len(t.hits) < t.k:
+		heap.Push(t, h)
+	case h.less(t.hits[0]):
+		t.hits[0] = h
+		heap.Fix(t, 0)
+	}
+}
+
+func (t *topK) full() bool { return len(t.hits) == t.k }
+
+func (t *topK) worst() similarity.Distance { return t.hits[0].Distance }
+
+// hamming returns the number of differing bits of two byte strings of the
+// same length.
+func hamming(a, b []byte) int {
+	d := 0
+	for len(a) >= 8 {
+		d += bits.OnesCount64(binary.LittleEndian.Uint64(a) ^ binary.LittleEndian.Uint64(b))
+		a, b = a[8:], b[8:]
+	}
+	for i := range a {
+		d += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return d
+}
+
+// vector returns the values of the hash held by a UInt8 or Float64
+// record.
+func vector(rec []byte, kind hashtype.Kind) []float64 {
+	p := rec[recordPrefix:]
+	if kind == hashtype.KindUInt8 {
+		v := make([]float64, len(p))
+		for i, b := range p {
+			v[i] = float64(b)
+		}
+		return v
+	}
+	v := make([]float64, len(p)/4)
+	for i := range v {
+		v[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(p[4*i:])))
+	}
+	return v
+}
+
+// l2 returns the L2 distance between q and the hash held by a UInt8 or
+// Float64 record, as computed by similarity.L2.
+func l2(q []float64, rec []byte, kind hashtype.Kind) float64 {
+	p := rec[recordPrefix:]
+	var s float64
+	if kind == hashtype.KindUInt8 {
+		for i, b := range p {
+			d := q[i] - float64(b)
+			s += d * d
+		}
+	} else {
+		for i := range q {
+			d := q[i] - float64(math.Float32frombits(binary.LittleEndian.Uint32(p[4*i:])))
+			s += d * d
+		}
+	}
+	return math.Sqrt(s)
+}
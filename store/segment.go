@@ -0,0 +1,248 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+// Segment file layout, all integers little-endian:
+//
+//	magic        8 bytes "IMGHSEG\x00"
+//	version      uint16, currently 1
+//	reserved     uint16
+//	header size  uint32, length of the JSON header that follows
+//	header       JSON object with the algorithm, version, params, kind
+//	             and length of the hashes
+//	records      fixed-width records up to the end of the file
+//
+// A record is a flag byte, recordHash or recordTombstone, the uint64 ID
+// and the packed hash, which a tombstone leaves zero.
+const (
+	segmentMagic   = "IMGHSEG\x00"
+	segmentVersion = 1
+	segmentPrefix  = 16
+
+	recordHash      = 1
+	recordTombstone = 2
+	recordPrefix    = 9
+)
+
+type segmentHeader struct {
+	Algorithm string            `json:"algorithm"`
+	Version   uint              `json:"version"`
+	Params    map[string]string `json:"params,omitempty"`
+	Kind      string            `json:"kind"`
+	Length    int               `json:"length"`
+}
+
+// segment is a mapped segment file and, once sealed, its index.
+type segment struct {
+	num uint32
+	// data maps the segment file; start is the offset of the first record
+	// and count the number of records in data. pending counts records
+	// written to file but not mapped yet.
+	data    []byte
+	start   int
+	count   int
+	pending int
+	// file is open for appending while the segment is active.
+	file  *os.File
+	index []byte
+	bin   *binaryIndex
+	vec   *pivotIndex
+}
+
+func segmentName(num uint32) string { return fmt.Sprintf("%06d.seg", num) }
+
+func indexName(num uint32) string { return fmt.Sprintf("%06d.idx", num) }
+
+// position orders records across segments.
+func position(num uint32, i int) uint64 { return uint64(num)<<32 | uint64(i) }
+
+// recordSize returns the size of a record holding a hash of kind and
+// length.
+func recordSize(kind hashtype.Kind, length int) int {
+	if kind == hashtype.KindFloat64 {
+		return recordPrefix + 4*length
+	}
+	return recordPrefix + length
+}
+
+func encodeRecord(dst []byte, flag byte, id uint64, hash hashtype.Hash) []byte {
+	dst[0] = flag
+	binary.LittleEndian.PutUint64(dst[1:], id)
+	switch h := hash.(type) {
+	case hashtype.Binary:
+		copy(dst[recordPrefix:], h)
+	case hashtype.UInt8:
+		copy(dst[recordPrefix:], h)
+	case hashtype.Float64:
+		for i, v := range h {
+			binary.LittleEndian.PutUint32(dst[recordPrefix+4*i:], math.Float32bits(float32(v)))
+		}
+	}
+	return dst
+}
+
+func recordID(rec []byte) uint64 { return binary.LittleEndian.Uint64(rec[1:]) }
+
+func (g *segment) record(i, size int) []byte {
+	off := g.start + i*size
+	return g.data[off : off+size]
+}
+
+// createSegment creates segment num with a header for cfg and opens it for
+// appending.
+func createSegment(dir string, num uint32, cfg Config) (*segment, error) {
+	hdr, err := json.Marshal(segmentHeader{
+		Algorithm: cfg.Algorithm,
+		Version:   cfg.Version,
+		Params:    cfg.Params,
+		Kind:      cfg.Kind.String(),
+		Length:    cfg.Length,
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, segmentPrefix, segmentPrefix+len(hdr))
+	copy(buf, segmentMagic)
+	binary.LittleEndian.PutUint16(buf[8:], segmentVersion)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(len(hdr)))
+	buf = append(buf, hdr...)
+
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(num)), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return nil, err
+	}
+	g := &segment{num: num, start: len(buf), file: f}
+	if err := g.remap(recordSize(cfg.Kind, cfg.Length)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// readSegment maps segment num and reads its configuration. A trailing
+// partial record, left by an interrupted write, is cut off the last
+// segment and reported as corruption in any other.
+func readSegment(dir string, num uint32, last bool) (*segment, Config, error) {
+	path := filepath.Join(dir, segmentName(num))
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, Config{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, Config{}, err
+	}
+	data, err := mapFile(f, int(fi.Size()))
+	if err != nil {
+		return nil, Config{}, err
+	}
+	g := &segment{num: num, data: data}
+	cfg, err := g.header()
+	if err != nil {
+		g.close()
+		return nil, Config{}, fmt.Errorf("%w: %s: %v", ErrCorrupt, segmentName(num), err)
+	}
+	size := recordSize(cfg.Kind, cfg.Length)
+	g.count = (len(data) - g.start) / size
+	if end := g.start + g.count*size; end != len(data) {
+		if !last {
+			g.close()
+			return nil, Config{}, fmt.Errorf("%w: %s: partial record", ErrCorrupt, segmentName(num))
+		}
+		g.close()
+		if err := os.Truncate(path, int64(end)); err != nil {
+			return nil, Config{}, err
+		}
+		if g.data, err = mapFile(f, end); err != nil {
+			return nil, Config{}, err
+		}
+	}
+	return g, cfg, nil
+}
+
+// header parses the segment header and sets start.
+func (g *segment) header() (Config, error) {
+	if len(g.data) < segmentPrefix || string(g.data[:8]) != segmentMagic {
+		return Config{}, fmt.Errorf("not a segment file")
+	}
+	if v := binary.LittleEndian.Uint16(g.data[8:]); v != segmentVersion {
+		return Config{}, fmt.Errorf("unsupported version %d", v)
+	}
+	n := int(binary.LittleEndian.Uint32(g.data[12:]))
+	if n > len(g.data)-segmentPrefix {
+		return Config{}, fmt.Errorf("truncated header")
+	}
+	var hdr segmentHeader
+	if err := json.Unmarshal(g.data[segmentPrefix:segmentPrefix+n], &hdr); err != nil {
+		return Config{}, err
+	}
+	kind, err := hashtype.ParseKind(hdr.Kind)
+	if err != nil {
+		return Config{}, err
+	}
+	if (kind != hashtype.KindBinary && kind != hashtype.KindUInt8 && kind != hashtype.KindFloat64) || hdr.Length <= 0 {
+		return Config{}, fmt.Errorf("invalid hash %s[%d]", hdr.Kind, hdr.Length)
+	}
+	g.start = segmentPrefix + n
+	return Config{Algorithm: hdr.Algorithm, Version: hdr.Version, Params: hdr.Params, Kind: kind, Length: hdr.Length}, nil
+}
+
+// remap maps the records written since the segment was last mapped.
+func (g *segment) remap(size int) error {
+	fi, err := g.file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := unmapFile(g.data); err != nil {
+		return err
+	}
+	g.data = nil
+	f, err := os.Open(g.file.Name())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if g.data, err = mapFile(f, int(fi.Size())); err != nil {
+		return err
+	}
+	g.count = (len(g.data) - g.start) / size
+	g.pending = 0
+	return nil
+}
+
+// closeFile stops appending to the segment.
+func (g *segment) closeFile() error {
+	if g.file == nil {
+		return nil
+	}
+	err := g.file.Close()
+	g.file = nil
+	return err
+}
+
+// close releases the mappings and the file of the segment.
+func (g *segment) close() error {
+	err := g.closeFile()
+	if e := unmapFile(g.data); err == nil {
+		err = e
+	}
+	if e := unmapFile(g.index); err == nil {
+		err = e
+	}
+	g.data, g.index, g.bin, g.vec = nil, nil, nil, nil
+	return err
+}
@@ -0,0 +1,694 @@
+// Package store keeps hashes on disk so that large collections can be
+// searched right after a process starts, without rehashing images or
+// rebuilding an in-memory index.
+//
+// A Store is a directory of append-only segment files. Each segment starts
+// with a header recording the Config of its hashes: the algorithm, its
+// version and hash-affecting parameters, and the hash kind and length. A
+// store refuses hashes and segments of any other configuration, so hashes
+// produced by different algorithm settings are never compared.
+//
+// Records have a fixed width: an ID followed by the hash, packed as bytes
+// for Binary and UInt8 hashes and as float32 values for Float64 hashes.
+// Segments are memory-mapped and queried in place. Once a segment reaches
+// its size limit it is sealed and indexed: Binary hashes by multi-index
+// hashing under the Hamming distance, UInt8 and Float64 hashes by distances
+// to pivot records under the L2 distance. Index files are mapped as well,
+// and both kinds of index return exact results.
+//
+//	pdq, _ := imghash.NewPDQ()
+//	cfg, err := store.ConfigOf(pdq)
+//	if err != nil {
+//		return err
+//	}
+//	s, err := store.Open("hashes", cfg)
+//	if err != nil {
+//		return err
+//	}
+//	defer s.Close()
+//	env, err := imghash.NewEnvelope(pdq, hash)
+//	if err != nil {
+//		return err
+//	}
+//	if err := s.Add(42, env); err != nil {
+//		return err
+//	}
+//	matches, err := s.RadiusSearch(query, 31)
+//
+// Delete appends a tombstone, and Compact rewrites the live records into
+// new segments to reclaim their space. A store is safe for concurrent use
+// by one process.
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+var (
+	// ErrNoConfig is returned when a store without segments is opened with
+	// a zero Config.
+	ErrNoConfig = errors.New("store: configuration is required for a new store")
+	// ErrConfigMismatch is returned when a segment or an envelope was
+	// produced with another configuration than the store's.
+	ErrConfigMismatch = errors.New("store: configuration does not match")
+	// ErrUnsupportedKind is returned for hash kinds other than Binary,
+	// UInt8 and Float64.
+	ErrUnsupportedKind = errors.New("store: unsupported hash kind")
+	// ErrHashKindMismatch is returned when a hash does not have the kind of
+	// the store.
+	ErrHashKindMismatch = errors.New("store: hash kind does not match")
+	// ErrHashLengthMismatch is returned when a hash does not have the
+	// length of the store.
+	ErrHashLengthMismatch = errors.New("store: hash length does not match")
+	// ErrInvalidSegmentSize is returned when the segment size is not
+	// positive.
+	ErrInvalidSegmentSize = errors.New("store: segment size must be greater than zero")
+	// ErrInvalidK is returned when KNN is called with k <= 0.
+	ErrInvalidK = errors.New("store: k must be greater than zero")
+	// ErrCorrupt is returned when a store file cannot be read.
+	ErrCorrupt = errors.New("store: corrupt file")
+	// ErrClosed is returned when a closed store is used.
+	ErrClosed = errors.New("store: store is closed")
+)
+
+// Config identifies the hashes held by a store.
+type Config struct {
+	// Algorithm, Version and Params describe the hasher as in an Envelope.
+	Algorithm string
+	Version   uint
+	Params    map[string]string
+	// Kind is the hash kind: Binary, UInt8 or Float64.
+	Kind hashtype.Kind
+	// Length is the number of bytes of Binary and UInt8 hashes and the
+	// number of values of Float64 hashes. Zero lets the first hash added
+	// set it.
+	Length int
+}
+
+// ConfigOf returns the configuration of the hashes computed by h, as
+// described by imghash.Describe. The length is left zero.
+func ConfigOf(h imghash.Hasher) (Config, error) {
+	spec, err := imghash.Describe(h)
+	if err != nil {
+		return Config{}, err
+	}
+	var empty hashtype.Hash
+	switch spec.Kind {
+	case hashtype.KindBinary:
+		empty = hashtype.Binary{}
+	case hashtype.KindUInt8:
+		empty = hashtype.UInt8{}
+	case hashtype.KindFloat64:
+		empty = hashtype.Float64{}
+	default:
+		return Config{}, fmt.Errorf("%w: %v", ErrUnsupportedKind, spec.Kind)
+	}
+	env, err := imghash.NewEnvelope(h, empty)
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{Algorithm: env.Algorithm, Version: env.Version, Params: env.Params, Kind: spec.Kind}, nil
+}
+
+// check returns an error unless a store of c may hold hashes of o.
+func (c Config) check(o Config) error {
+	switch {
+	case c.Algorithm != o.Algorithm || c.Version != o.Version:
+		return fmt.Errorf("%w: %s version %d, got %s version %d", ErrConfigMismatch, c.Algorithm, c.Version, o.Algorithm, o.Version)
+	case !maps.Equal(c.Params, o.Params):
+		return fmt.Errorf("%w: params %v, got %v", ErrConfigMismatch, c.Params, o.Params)
+	case c.Kind != o.Kind:
+		return fmt.Errorf("%w: kind %v, got %v", ErrConfigMismatch, c.Kind, o.Kind)
+	case c.Length != 0 && o.Length != 0 && c.Length != o.Length:
+		return fmt.Errorf("%w: length %d, got %d", ErrConfigMismatch, c.Length, o.Length)
+	}
+	return nil
+}
+
+// Option configures Open.
+type Option interface{ apply(*config) }
+
+type config struct {
+	segmentSize int64
+}
+
+type segmentSizeOption int64
+
+func (o segmentSizeOption) apply(c *config) { c.segmentSize = int64(o) }
+
+// WithSegmentSize sets the size in bytes at which a segment is sealed and
+// indexed, and new records go to a new segment. It defaults to 256 MiB.
+func WithSegmentSize(n int64) Option { return segmentSizeOption(n) }
+
+// Store is a persistent collection of hashes keyed by uint64 IDs. An ID
+// may hold several hashes, such as the frames of a video.
+type Store struct {
+	mu          sync.RWMutex
+	dir         string
+	cfg         Config
+	segmentSize int64
+	segments    []*segment
+	// active is the last segment while it takes new records, and w
+	// buffers its writes; dirty is set while w holds unmapped records.
+	active *segment
+	w      *bufio.Writer
+	dirty  bool
+	// deleted maps an ID to the position of its latest tombstone, which
+	// removes every earlier record of the ID.
+	deleted map[uint64]uint64
+	live    int
+	next    uint32
+	closed  bool
+}
+
+const manifestName = "MANIFEST"
+
+type manifest struct {
+	Segments []uint32 `json:"segments"`
+}
+
+// Open opens the store in dir, creating the directory and the store if
+// needed. The configuration of existing segments must match cfg; a zero
+// cfg opens an existing store with the configuration recorded in it.
+func Open(dir string, cfg Config, opts ...Option) (*Store, error) {
+	c := config{segmentSize: 256 << 20}
+	for _, o := range opts {
+		o.apply(&c)
+	}
+	if c.segmentSize <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidSegmentSize, c.segmentSize)
+	}
+	adopt := cfg.Algorithm == "" && cfg.Kind == 0
+	if !adopt && cfg.Kind != hashtype.KindBinary && cfg.Kind != hashtype.KindUInt8 && cfg.Kind != hashtype.KindFloat64 {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedKind, cfg.Kind)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, cfg: cfg, segmentSize: c.segmentSize, deleted: make(map[uint64]uint64), next: 1}
+
+	var m manifest
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if adopt {
+			return nil, ErrNoConfig
+		}
+		if err := s.writeManifest(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, manifestName, err)
+		}
+	}
+	if adopt && len(m.Segments) == 0 {
+		return nil, ErrNoConfig
+	}
+	if err := s.removeStray(m.Segments); err != nil {
+		return nil, err
+	}
+	for i, num := range m.Segments {
+		if err := s.openSegment(num, i == len(m.Segments)-1, adopt && i == 0); err != nil {
+			s.unmapAll()
+			return nil, err
+		}
+		s.next = max(s.next, num+1)
+	}
+	s.loadTombstones()
+	return s, nil
+}
+
+// openSegment maps segment num and its index, building a missing index
+// unless the segment is the last one, which then takes new records.
+func (s *Store) openSegment(num uint32, last, adopt bool) error {
+	g, cfg, err := readSegment(s.dir, num, last)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, g)
+	if adopt {
+		s.cfg = cfg
+	}
+	if err := s.cfg.check(cfg); err != nil {
+		return fmt.Errorf("segment %s: %w", segmentName(num), err)
+	}
+	s.cfg.Length = cfg.Length
+	err = g.openIndex(s.dir, s.cfg)
+	switch {
+	case err == nil:
+		return nil
+	case !errors.Is(err, errNoIndex):
+		return err
+	case last:
+		if g.file, err = os.OpenFile(filepath.Join(s.dir, segmentName(num)), os.O_WRONLY|os.O_APPEND, 0); err != nil {
+			return err
+		}
+		s.active, s.w = g, bufio.NewWriter(g.file)
+		return nil
+	default:
+		return g.buildIndex(s.dir, s.cfg, s.recordSize())
+	}
+}
+
+// removeStray deletes segment and index files that are not listed in the
+// manifest, left behind by an interrupted compaction.
+func (s *Store) removeStray(keep []uint32) error {
+	names := make(map[string]bool)
+	for _, num := range keep {
+		names[segmentName(num)] = true
+		names[indexName(num)] = true
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		if (ext == ".seg" || ext == ".idx" || ext == ".tmp") && !names[name] {
+			if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) loadTombstones() {
+	size := s.recordSize()
+	for _, g := range s.segments {
+		for i := range g.count {
+			rec := g.record(i, size)
+			if rec[0] == recordTombstone {
+				s.deleted[recordID(rec)] = position(g.num, i)
+			}
+		}
+	}
+	for _, g := range s.segments {
+		for i := range g.count {
+			rec := g.record(i, size)
+			if rec[0] == recordHash && s.alive(recordID(rec), position(g.num, i)) {
+				s.live++
+			}
+		}
+	}
+}
+
+// Config returns the configuration of the store.
+func (s *Store) Config() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c := s.cfg
+	c.Params = maps.Clone(c.Params)
+	return c
+}
+
+// Len returns the number of stored hashes.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.live
+}
+
+// Add stores the hash of env under id. The envelope must record the
+// algorithm, version and parameters of the store, and its hash must have
+// the kind and length of the store. imghash.NewEnvelope builds the
+// envelope from the hasher that computed the hash.
+func (s *Store) Add(id uint64, env hashtype.Envelope) error {
+	s.mu.RLock()
+	err := s.cfg.check(Config{
+		Algorithm: env.Algorithm,
+		Version:   env.Version,
+		Params:    env.Params,
+		Kind:      s.cfg.Kind,
+	})
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return s.AddUnchecked(id, env.Hash)
+}
+
+// AddUnchecked stores hash under id. Only the kind and length of the hash
+// are checked: the caller must make sure that it was computed with the
+// configuration of the store, as when copying hashes out of another store
+// of the same Config. Prefer Add, which checks the configuration.
+func (s *Store) AddUnchecked(id uint64, hash hashtype.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.checkHash(hash, true); err != nil {
+		return err
+	}
+	if err := s.append(recordHash, id, hash); err != nil {
+		return err
+	}
+	s.live++
+	return nil
+}
+
+// Delete removes every hash stored under id and reports whether there was
+// any. It reads the ID of every record.
+func (s *Store) Delete(id uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false, ErrClosed
+	}
+	if err := s.remap(); err != nil {
+		return false, err
+	}
+	n := 0
+	size := s.recordSize()
+	for _, g := range s.segments {
+		for i := range g.count {
+			rec := g.record(i, size)
+			if rec[0] == recordHash && recordID(rec) == id && s.alive(id, position(g.num, i)) {
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return false, nil
+	}
+	if err := s.append(recordTombstone, id, nil); err != nil {
+		return false, err
+	}
+	g := s.segments[len(s.segments)-1]
+	s.deleted[id] = position(g.num, g.count+g.pending-1)
+	s.live -= n
+	return true, nil
+}
+
+// checkHash validates the kind and length of hash, fixing the length of
+// the store on the first hash when set is true.
+func (s *Store) checkHash(hash hashtype.Hash, set bool) error {
+	if hash == nil {
+		return fmt.Errorf("%w: nil hash", ErrHashKindMismatch)
+	}
+	if k := hashtype.KindOf(hash); k != s.cfg.Kind {
+		return fmt.Errorf("%w: store holds %v hashes, got %v", ErrHashKindMismatch, s.cfg.Kind, k)
+	}
+	switch {
+	case hash.Len() == 0:
+		return fmt.Errorf("%w: empty hash", ErrHashLengthMismatch)
+	case s.cfg.Length == 0 && set:
+		s.cfg.Length = hash.Len()
+	case hash.Len() != s.cfg.Length:
+		return fmt.Errorf("%w: store holds hashes of length %d, got %d", ErrHashLengthMismatch, s.cfg.Length, hash.Len())
+	}
+	return nil
+}
+
+// append writes a record to the active segment, creating a new segment
+// when there is none and sealing it once it reaches the segment size.
+func (s *Store) append(flag byte, id uint64, hash hashtype.Hash) error {
+	if s.active == nil {
+		if err := s.createSegment(); err != nil {
+			return err
+		}
+	}
+	size := s.recordSize()
+	if _, err := s.w.Write(encodeRecord(make([]byte, size), flag, id, hash)); err != nil {
+		return err
+	}
+	s.active.pending++
+	s.dirty = true
+	if int64(s.active.start+(s.active.count+s.active.pending)*size) >= s.segmentSize {
+		return s.seal()
+	}
+	return nil
+}
+
+// createSegment starts a new active segment and lists it in the manifest.
+func (s *Store) createSegment() error {
+	num := s.next
+	g, err := createSegment(s.dir, num, s.cfg)
+	if err != nil {
+		return err
+	}
+	s.next++
+	s.segments = append(s.segments, g)
+	if err := s.writeManifest(); err != nil {
+		s.segments = s.segments[:len(s.segments)-1]
+		g.close()
+		return err
+	}
+	s.active, s.w = g, bufio.NewWriter(g.file)
+	return nil
+}
+
+// seal flushes the active segment, indexes it and stops appending to it.
+func (s *Store) seal() error {
+	if err := s.remap(); err != nil {
+		return err
+	}
+	g := s.active
+	if err := g.file.Sync(); err != nil {
+		return err
+	}
+	if err := g.buildIndex(s.dir, s.cfg, s.recordSize()); err != nil {
+		return err
+	}
+	s.active, s.w = nil, nil
+	return g.closeFile()
+}
+
+// remap writes buffered records and maps them into the active segment.
+func (s *Store) remap() error {
+	if !s.dirty {
+		return nil
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if err := s.active.remap(s.recordSize()); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Flush writes buffered records to disk and syncs the active segment.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.remap(); err != nil {
+		return err
+	}
+	if s.active != nil {
+		return s.active.file.Sync()
+	}
+	return nil
+}
+
+// Close flushes the store and releases its files.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	var err error
+	if s.active != nil {
+		if err = s.w.Flush(); err == nil {
+			err = s.active.file.Sync()
+		}
+	}
+	s.closed = true
+	return errors.Join(err, s.unmapAll())
+}
+
+func (s *Store) unmapAll() error {
+	var errs []error
+	for _, g := range s.segments {
+		errs = append(errs, g.close())
+	}
+	s.segments, s.active, s.w = nil, nil, nil
+	return errors.Join(errs...)
+}
+
+// Compact rewrites the live records into new sealed segments, dropping
+// deleted records and tombstones, and removes the old segments. A store
+// left without live records keeps one empty segment that records its
+// configuration.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.remap(); err != nil {
+		return err
+	}
+	size := s.recordSize()
+	var fresh []*segment
+	fail := func(err error) error {
+		for _, g := range fresh {
+			g.close()
+			os.Remove(filepath.Join(s.dir, segmentName(g.num)))
+			os.Remove(filepath.Join(s.dir, indexName(g.num)))
+		}
+		return err
+	}
+	var out *segment
+	var w *bufio.Writer
+	finish := func() error {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if err := out.file.Sync(); err != nil {
+			return err
+		}
+		if err := out.remap(size); err != nil {
+			return err
+		}
+		if err := out.buildIndex(s.dir, s.cfg, size); err != nil {
+			return err
+		}
+		return out.closeFile()
+	}
+	create := func() error {
+		var err error
+		if out, err = createSegment(s.dir, s.next+uint32(len(fresh)), s.cfg); err != nil {
+			return err
+		}
+		fresh = append(fresh, out)
+		w = bufio.NewWriter(out.file)
+		return nil
+	}
+	for _, g := range s.segments {
+		for i := range g.count {
+			rec := g.record(i, size)
+			if rec[0] != recordHash || !s.alive(recordID(rec), position(g.num, i)) {
+				continue
+			}
+			if out == nil {
+				if err := create(); err != nil {
+					return fail(err)
+				}
+			}
+			if _, err := w.Write(rec); err != nil {
+				return fail(err)
+			}
+			out.pending++
+			if int64(out.start+out.pending*size) >= s.segmentSize {
+				if err := finish(); err != nil {
+					return fail(err)
+				}
+				out = nil
+			}
+		}
+	}
+	// With no live records left, an empty sealed segment keeps the
+	// configuration on disk, so the store still opens with a zero Config.
+	if len(fresh) == 0 && len(s.segments) > 0 {
+		if err := create(); err != nil {
+			return fail(err)
+		}
+	}
+	if out != nil {
+		if err := finish(); err != nil {
+			return fail(err)
+		}
+	}
+
+	old := s.segments
+	s.segments = fresh
+	if err := s.writeManifest(); err != nil {
+		s.segments = old
+		return fail(err)
+	}
+	s.next += uint32(len(fresh))
+	s.active, s.w = nil, nil
+	s.deleted = make(map[uint64]uint64)
+	var errs []error
+	for _, g := range old {
+		errs = append(errs,
+			g.close(),
+			os.Remove(filepath.Join(s.dir, segmentName(g.num))),
+			ignoreNotExist(os.Remove(filepath.Join(s.dir, indexName(g.num)))))
+	}
+	return errors.Join(errs...)
+}
+
+// writeManifest atomically replaces the manifest with the current list of
+// segments.
+func (s *Store) writeManifest() error {
+	m := manifest{Segments: make([]uint32, len(s.segments))}
+	for i, g := range s.segments {
+		m.Segments[i] = g.num
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, manifestName), data)
+}
+
+// writeFileAtomic writes data to a temporary file, syncs it and renames it
+// to path, so readers see either the old or the new contents.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+func ignoreNotExist(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// alive reports whether the record of id at pos has not been deleted.
+func (s *Store) alive(id, pos uint64) bool {
+	if len(s.deleted) == 0 {
+		return true
+	}
+	d, ok := s.deleted[id]
+	return !ok || d < pos
+}
+
+func (s *Store) recordSize() int {
+	return recordSize(s.cfg.Kind, s.cfg.Length)
+}
@@ -0,0 +1,568 @@
+package store_test
+
+import (
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+	"github.com/ajdnik/imghash/v2/store"
+)
+
+func testConfig(kind hashtype.Kind) store.Config {
+	return store.Config{Algorithm: "test", Version: 1, Params: map[string]string{"size": "8x8"}, Kind: kind}
+}
+
+// randomHashes returns n hashes of kind in clusters of up to four similar
+// hashes. Float64 values are multiples of 1/8, which float32 holds
+// exactly.
+func randomHashes(r *rand.Rand, kind hashtype.Kind, n, length int) []hashtype.Hash {
+	var out []hashtype.Hash
+	for len(out) < n {
+		base := make([]int, length)
+		for i := range base {
+			base[i] = r.IntN(256)
+		}
+		for range 1 + r.IntN(4) {
+			v := slices.Clone(base)
+			switch kind {
+			case hashtype.KindBinary:
+				for range r.IntN(10) {
+					bit := r.IntN(8 * length)
+					v[bit/8] ^= 1 << (bit % 8)
+				}
+				h := make(hashtype.Binary, length)
+				for i := range h {
+					h[i] = byte(v[i])
+				}
+				out = append(out, h)
+			case hashtype.KindUInt8:
+				h := make(hashtype.UInt8, length)
+				for i := range h {
+					h[i] = byte(min(255, max(0, v[i]+r.IntN(9)-4)))
+				}
+				out = append(out, h)
+			default:
+				h := make(hashtype.Float64, length)
+				for i := range h {
+					h[i] = float64(v[i]+r.IntN(9)-4) / 8
+				}
+				out = append(out, h)
+			}
+		}
+	}
+	return out[:n]
+}
+
+// bruteForce returns the results of a radius search computed with the
+// similarity package.
+func bruteForce(hashes []hashtype.Hash, skip map[uint64]bool, q hashtype.Hash, r similarity.Distance) []store.Result {
+	dist := similarity.L2
+	if _, ok := q.(hashtype.Binary); ok {
+		dist = similarity.Hamming
+	}
+	var out []store.Result
+	for i, h := range hashes {
+		d, _ := dist(q, h)
+		if d <= r && !skip[uint64(i)] {
+			out = append(out, store.Result{ID: uint64(i), Distance: d})
+		}
+	}
+	slices.SortStableFunc(out, func(a, b store.Result) int {
+		if a.Distance < b.Distance {
+			return -1
+		}
+		if a.Distance > b.Distance {
+			return 1
+		}
+		return 0
+	})
+	return out
+}
+
+func TestStore_search(t *testing.T) {
+	tests := []struct {
+		kind   hashtype.Kind
+		length int
+		radii  []similarity.Distance
+	}{
+		{hashtype.KindBinary, 8, []similarity.Distance{0, 3, 8, 20, 64}},
+		{hashtype.KindBinary, 5, []similarity.Distance{2, 9}},
+		{hashtype.KindUInt8, 12, []similarity.Distance{0, 10, 40, 400}},
+		{hashtype.KindFloat64, 6, []similarity.Distance{0, 1, 5, 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind.String(), func(t *testing.T) {
+			r := rand.New(rand.NewPCG(1, uint64(tt.length)))
+			hashes := randomHashes(r, tt.kind, 700, tt.length)
+			dir := t.TempDir()
+			s, err := store.Open(dir, testConfig(tt.kind), store.WithSegmentSize(2048))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, h := range hashes {
+				if err := s.AddUnchecked(uint64(i), h); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			check := func(t *testing.T, s *store.Store) {
+				t.Helper()
+				if s.Len() != len(hashes) {
+					t.Errorf("Len() = %d, want %d", s.Len(), len(hashes))
+				}
+				for qi := range 20 {
+					q := hashes[qi*31]
+					for _, radius := range tt.radii {
+						want := bruteForce(hashes, nil, q, radius)
+						for _, opts := range [][]store.QueryOption{nil, {store.WithLinearScan()}} {
+							got, err := s.RadiusSearch(q, radius, opts...)
+							if err != nil {
+								t.Fatal(err)
+							}
+							if !reflect.DeepEqual(got, want) {
+								t.Fatalf("RadiusSearch(%d, %v, linear %v) = %d results, want %d", qi*31, radius, opts != nil, len(got), len(want))
+							}
+						}
+					}
+					for _, k := range []int{1, 5, 50} {
+						want := bruteForce(hashes, nil, q, 1e9)[:k]
+						for _, opts := range [][]store.QueryOption{nil, {store.WithLinearScan()}} {
+							got, err := s.KNN(q, k, opts...)
+							if err != nil {
+								t.Fatal(err)
+							}
+							if !reflect.DeepEqual(got, want) {
+								t.Fatalf("KNN(%d, %d, linear %v) = %v, want %v", qi*31, k, opts != nil, got, want)
+							}
+						}
+					}
+				}
+			}
+			check(t, s)
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err = store.Open(dir, testConfig(tt.kind), store.WithSegmentSize(2048))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if c := s.Config(); c.Length != tt.length {
+				t.Errorf("Config().Length = %d, want %d", c.Length, tt.length)
+			}
+			check(t, s)
+		})
+	}
+}
+
+func TestStore_deleteAndCompact(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	hashes := randomHashes(r, hashtype.KindBinary, 300, 8)
+	dir := t.TempDir()
+	s, err := store.Open(dir, testConfig(hashtype.KindBinary), store.WithSegmentSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, h := range hashes {
+		if err := s.AddUnchecked(uint64(i), h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := make(map[uint64]bool)
+	for id := uint64(0); id < 300; id += 7 {
+		ok, err := s.Delete(id)
+		if err != nil || !ok {
+			t.Fatalf("Delete(%d) = %v, %v, want true", id, ok, err)
+		}
+		deleted[id] = true
+	}
+	if ok, err := s.Delete(7); ok || err != nil {
+		t.Errorf("second Delete(7) = %v, %v, want false", ok, err)
+	}
+	if ok, err := s.Delete(1000); ok || err != nil {
+		t.Errorf("Delete(1000) = %v, %v, want false", ok, err)
+	}
+	// Re-adding a deleted ID stores the new hash only.
+	if err := s.AddUnchecked(14, hashes[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(t *testing.T, s *store.Store) {
+		t.Helper()
+		if want := 300 - len(deleted) + 1; s.Len() != want {
+			t.Errorf("Len() = %d, want %d", s.Len(), want)
+		}
+		for _, q := range hashes[:30] {
+			want := bruteForce(append(slices.Clone(hashes), hashes[0]), deleted, q, 12)
+			for i := range want {
+				if want[i].ID == 300 {
+					want[i].ID = 14
+				}
+			}
+			got, err := s.RadiusSearch(q, 12)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("RadiusSearch = %v, want %v", got, want)
+			}
+		}
+	}
+	check(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = store.Open(dir, testConfig(hashtype.KindBinary), store.WithSegmentSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	check(t, s)
+	before := segmentFiles(t, dir)
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, s)
+	if after := segmentFiles(t, dir); after >= before {
+		t.Errorf("%d segment files after compaction, want fewer than %d", after, before)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = store.Open(dir, testConfig(hashtype.KindBinary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	check(t, s)
+}
+
+func TestStore_compactEmpty(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	hashes := randomHashes(r, hashtype.KindUInt8, 50, 8)
+	dir := t.TempDir()
+	cfg := testConfig(hashtype.KindUInt8)
+	s, err := store.Open(dir, cfg, store.WithSegmentSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, h := range hashes {
+		if err := s.AddUnchecked(uint64(i), h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range hashes {
+		if _, err := s.Delete(uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if n := segmentFiles(t, dir); n != 1 {
+		t.Errorf("%d segment files after compaction, want 1", n)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = store.Open(dir, store.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", s.Len())
+	}
+	cfg.Length = 8
+	if got := s.Config(); !reflect.DeepEqual(got, cfg) {
+		t.Errorf("Config() = %+v, want %+v", got, cfg)
+	}
+	if err := s.AddUnchecked(1, hashes[1]); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.RadiusSearch(hashes[1], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("RadiusSearch = %v, want ID 1", got)
+	}
+}
+
+func segmentFiles(t *testing.T, dir string) int {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestStore_config(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(hashtype.KindBinary)
+	s, err := store.Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddUnchecked(1, hashtype.Binary{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		add  func() error
+		want error
+	}{
+		{"kind", func() error { return s.AddUnchecked(2, hashtype.UInt8{1, 2}) }, store.ErrHashKindMismatch},
+		{"length", func() error { return s.AddUnchecked(2, hashtype.Binary{1, 2, 3}) }, store.ErrHashLengthMismatch},
+		{"nil", func() error { return s.AddUnchecked(2, nil) }, store.ErrHashKindMismatch},
+		{"envelope params", func() error {
+			return s.Add(2, hashtype.Envelope{Algorithm: "test", Version: 1, Params: map[string]string{"size": "16x16"}, Hash: hashtype.Binary{1, 2}})
+		}, store.ErrConfigMismatch},
+		{"envelope version", func() error {
+			return s.Add(2, hashtype.Envelope{Algorithm: "test", Version: 2, Params: cfg.Params, Hash: hashtype.Binary{1, 2}})
+		}, store.ErrConfigMismatch},
+		{"envelope kind", func() error {
+			return s.Add(2, hashtype.Envelope{Algorithm: "test", Version: 1, Params: cfg.Params, Hash: hashtype.UInt8{1, 3}})
+		}, store.ErrHashKindMismatch},
+		{"envelope", func() error {
+			return s.Add(2, hashtype.Envelope{Algorithm: "test", Version: 1, Params: cfg.Params, Hash: hashtype.Binary{1, 3}})
+		}, nil},
+	} {
+		if err := tt.add(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if _, err := s.RadiusSearch(hashtype.Float64{1, 2}, 1); !errors.Is(err, store.ErrHashKindMismatch) {
+		t.Errorf("RadiusSearch with Float64: got %v, want ErrHashKindMismatch", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		cfg  store.Config
+	}{
+		{"algorithm", store.Config{Algorithm: "other", Version: 1, Params: cfg.Params, Kind: hashtype.KindBinary}},
+		{"version", store.Config{Algorithm: "test", Version: 2, Params: cfg.Params, Kind: hashtype.KindBinary}},
+		{"params", store.Config{Algorithm: "test", Version: 1, Kind: hashtype.KindBinary}},
+		{"kind", store.Config{Algorithm: "test", Version: 1, Params: cfg.Params, Kind: hashtype.KindUInt8}},
+		{"length", store.Config{Algorithm: "test", Version: 1, Params: cfg.Params, Kind: hashtype.KindBinary, Length: 4}},
+	} {
+		if _, err := store.Open(dir, tt.cfg); !errors.Is(err, store.ErrConfigMismatch) {
+			t.Errorf("Open with other %s: got %v, want ErrConfigMismatch", tt.name, err)
+		}
+	}
+
+	s, err = store.Open(dir, store.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	want := cfg
+	want.Length = 2
+	if got := s.Config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Config() = %+v, want %+v", got, want)
+	}
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", s.Len())
+	}
+}
+
+func TestConfigOf(t *testing.T) {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := store.ConfigOf(pdq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := imghash.HashFile(pdq, "../assets/lena.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := imghash.NewEnvelope(pdq, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Algorithm != env.Algorithm || cfg.Version != env.Version || !reflect.DeepEqual(cfg.Params, env.Params) || cfg.Kind != hashtype.KindBinary {
+		t.Errorf("ConfigOf(pdq) = %+v, want the configuration of %+v", cfg, env)
+	}
+
+	s, err := store.Open(t.TempDir(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Add(1, env); err != nil {
+		t.Fatal(err)
+	}
+	interp, err := imghash.NewPDQ(imghash.WithInterpolation(imghash.Bicubic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err = imghash.NewEnvelope(interp, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(2, env); !errors.Is(err, store.ErrConfigMismatch) {
+		t.Errorf("Add with other interpolation: got %v, want ErrConfigMismatch", err)
+	}
+	other, err := imghash.NewPDQ(imghash.WithBorderCrop(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err = imghash.NewEnvelope(other, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(3, env); !errors.Is(err, store.ErrConfigMismatch) {
+		t.Errorf("Add with other border crop: got %v, want ErrConfigMismatch", err)
+	}
+
+	ensemble, err := imghash.NewEnsemble([]imghash.Member{{Name: "pdq", Hasher: pdq, Threshold: 31}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ConfigOf(ensemble); !errors.Is(err, store.ErrUnsupportedKind) {
+		t.Errorf("ConfigOf(ensemble): got %v, want ErrUnsupportedKind", err)
+	}
+}
+
+func TestStore_recovery(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(hashtype.KindBinary)
+	s, err := store.Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 10 {
+		if err := s.AddUnchecked(uint64(i), hashtype.Binary{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A torn write leaves a partial record at the end of the last segment.
+	seg := filepath.Join(dir, "000001.seg")
+	f, err := os.OpenFile(seg, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3})
+	f.Close()
+	// Files of an interrupted compaction are not listed in the manifest.
+	if err := os.WriteFile(filepath.Join(dir, "000009.seg"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = store.Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 10 {
+		t.Errorf("Len() = %d, want 10", s.Len())
+	}
+	if err := s.AddUnchecked(10, hashtype.Binary{10}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.KNN(hashtype.Binary{10}, 1)
+	if err != nil || len(got) != 1 || got[0].ID != 10 || got[0].Distance != 0 {
+		t.Errorf("KNN = %v, %v, want ID 10 at distance 0", got, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "000009.seg")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stray segment not removed: %v", err)
+	}
+
+	// A missing index of a sealed segment is rebuilt.
+	s, err = store.Open(dir, cfg, store.WithSegmentSize(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if err := s.AddUnchecked(uint64(100+i), hashtype.Binary{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "000002.idx")); err != nil {
+		t.Fatal(err)
+	}
+	s, err = store.Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.RadiusSearch(hashtype.Binary{3}, 0)
+	if err != nil || len(got) != 2 || got[0].ID != 3 || got[1].ID != 103 {
+		t.Errorf("RadiusSearch = %v, %v, want IDs 3 and 103", got, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "000002.idx")); err != nil {
+		t.Errorf("index not rebuilt: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "MANIFEST"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(dir, cfg); !errors.Is(err, store.ErrCorrupt) {
+		t.Errorf("Open with corrupt manifest: got %v, want ErrCorrupt", err)
+	}
+}
+
+func TestStore_errors(t *testing.T) {
+	cfg := testConfig(hashtype.KindBinary)
+	if _, err := store.Open(t.TempDir(), cfg, store.WithSegmentSize(0)); !errors.Is(err, store.ErrInvalidSegmentSize) {
+		t.Errorf("Open with segment size 0: got %v, want ErrInvalidSegmentSize", err)
+	}
+	if _, err := store.Open(t.TempDir(), testConfig(hashtype.KindComposite)); !errors.Is(err, store.ErrUnsupportedKind) {
+		t.Errorf("Open with composite kind: got %v, want ErrUnsupportedKind", err)
+	}
+	if _, err := store.Open(t.TempDir(), store.Config{}); !errors.Is(err, store.ErrNoConfig) {
+		t.Errorf("Open new store with zero config: got %v, want ErrNoConfig", err)
+	}
+
+	s, err := store.Open(t.TempDir(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.RadiusSearch(hashtype.Binary{1}, 8); got != nil || err != nil {
+		t.Errorf("RadiusSearch on empty store = %v, %v", got, err)
+	}
+	if _, err := s.KNN(hashtype.Binary{1}, 0); !errors.Is(err, store.ErrInvalidK) {
+		t.Errorf("KNN(0): got %v, want ErrInvalidK", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddUnchecked(1, hashtype.Binary{1}); !errors.Is(err, store.ErrClosed) {
+		t.Errorf("AddUnchecked after Close: got %v, want ErrClosed", err)
+	}
+	if _, err := s.KNN(hashtype.Binary{1}, 1); !errors.Is(err, store.ErrClosed) {
+		t.Errorf("KNN after Close: got %v, want ErrClosed", err)
+	}
+}
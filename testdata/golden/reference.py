@@ -0,0 +1,82 @@
+#!/usr/bin/env python3
+"""Record reference hashes for the golden vector test.
+
+Hashes every image in assets/ and testdata/golden/synthetic/ with
+OpenCV's img_hash module and Meta's PDQ, and writes them to
+testdata/golden/golden.json in the format read by golden_test.go.
+Run it from the repository root:
+
+    pip install opencv-contrib-python-headless pdqhash
+    python3 testdata/golden/reference.py
+
+Images are decoded with OpenCV. JPEG decoders differ slightly between
+libraries, so only lossless inputs are required to match exactly.
+"""
+
+import glob
+import json
+import os
+
+import cv2
+import numpy as np
+import pdqhash
+
+GOLDEN = "testdata/golden/golden.json"
+
+
+def images():
+    paths = sorted(glob.glob("assets/*.jpg") + glob.glob("assets/*.png"))
+    paths += sorted(glob.glob("testdata/golden/synthetic/*.png"))
+    return paths
+
+
+def pdq_hex(bits):
+    # Pack bit k into 16-bit word k/16 and print the words from the last
+    # to the first, like Hash256::format in the reference implementation.
+    words = [0] * 16
+    for k, b in enumerate(bits):
+        if b:
+            words[k >> 4] |= 1 << (k & 15)
+    return "".join("%04x" % w for w in reversed(words))
+
+
+def binary(h):
+    return bytes(np.asarray(h, dtype=np.uint8).ravel()).hex()
+
+
+def main():
+    algorithms = {
+        "pdq": lambda bgr: pdq_hex(pdqhash.compute(cv2.cvtColor(bgr, cv2.COLOR_BGR2RGB))[0]),
+        "phash": lambda bgr: binary(cv2.img_hash.pHash(bgr)),
+        "blockmean": lambda bgr: binary(
+            cv2.img_hash.blockMeanHash(bgr, mode=cv2.img_hash.BLOCK_MEAN_HASH_MODE_0)),
+        "blockmean_overlap": lambda bgr: binary(
+            cv2.img_hash.blockMeanHash(bgr, mode=cv2.img_hash.BLOCK_MEAN_HASH_MODE_1)),
+        "marrhildreth": lambda bgr: binary(cv2.img_hash.marrHildrethHash(bgr, alpha=2, scale=1)),
+        "radialvariance": lambda bgr: binary(
+            cv2.img_hash.radialVarianceHash(bgr, sigma=1, numOfAngleLine=180)),
+        "colormoment": lambda bgr: [float(v) for v in cv2.img_hash.colorMomentHash(bgr).ravel()],
+    }
+    sources = {
+        "pdq": "pdqhash " + getattr(pdqhash, "__version__", "unknown"),
+    }
+    golden = {}
+    paths = images()
+    for name, fn in algorithms.items():
+        hashes = {}
+        for path in paths:
+            bgr = cv2.imread(path, cv2.IMREAD_COLOR | cv2.IMREAD_IGNORE_ORIENTATION)
+            hashes[path] = fn(bgr)
+        golden[name] = {
+            "source": sources.get(name, "opencv-contrib " + cv2.__version__),
+            "hashes": hashes,
+        }
+    with open(GOLDEN, "w") as f:
+        json.dump(golden, f, indent="\t", sort_keys=True)
+        f.write("\n")
+    print("wrote %d algorithms for %d images to %s" % (len(golden), len(paths), GOLDEN))
+
+
+if __name__ == "__main__":
+    os.chdir(os.path.join(os.path.dirname(os.path.abspath(__file__)), "..", ".."))
+    main()
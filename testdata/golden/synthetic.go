@@ -0,0 +1,180 @@
+//go:build ignore
+
+// Command synthetic writes the synthetic golden vector images to
+// testdata/golden/synthetic. The images are deterministic, so running
+// it again reproduces the committed files:
+//
+//	go run testdata/golden/synthetic.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const dir = "testdata/golden/synthetic"
+
+// rng is a small linear congruential generator, so the images do not
+// depend on the math/rand implementation.
+type rng uint32
+
+func (r *rng) next() uint8 {
+	*r = *r*1664525 + 1013904223
+	return uint8(*r >> 24)
+}
+
+func rgb(w, h int, f func(x, y int) color.RGBA) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, f(x, y))
+		}
+	}
+	return img
+}
+
+func gray(w, h int, f func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, color.Gray{Y: f(x, y)})
+		}
+	}
+	return img
+}
+
+func clamp(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
+
+func noise(w, h int, seed rng, colored bool) image.Image {
+	r := seed
+	return rgb(w, h, func(x, y int) color.RGBA {
+		v := r.next()
+		if !colored {
+			return color.RGBA{v, v, v, 255}
+		}
+		return color.RGBA{v, r.next(), r.next(), 255}
+	})
+}
+
+func blobs(w, h, n int, seed rng) image.Image {
+	r := seed
+	type blob struct{ x, y, s, cr, cg, cb float64 }
+	bs := make([]blob, n)
+	for i := range bs {
+		bs[i] = blob{
+			float64(r.next()) / 255 * float64(w), float64(r.next()) / 255 * float64(h),
+			8 + float64(r.next())/255*float64(min(w, h))/3,
+			float64(r.next()), float64(r.next()), float64(r.next()),
+		}
+	}
+	return rgb(w, h, func(x, y int) color.RGBA {
+		cr, cg, cb := 40.0, 40.0, 40.0
+		for _, b := range bs {
+			d := (math.Pow(float64(x)-b.x, 2) + math.Pow(float64(y)-b.y, 2)) / (2 * b.s * b.s)
+			a := math.Exp(-d)
+			cr += a * (b.cr - cr)
+			cg += a * (b.cg - cg)
+			cb += a * (b.cb - cb)
+		}
+		return color.RGBA{clamp(cr), clamp(cg), clamp(cb), 255}
+	})
+}
+
+func rectangles(w, h, n int, seed rng) image.Image {
+	r := seed
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for range n {
+		x0, y0 := int(r.next())*w/256, int(r.next())*h/256
+		x1, y1 := x0+4+int(r.next())*w/1024, y0+4+int(r.next())*h/1024
+		c := color.RGBA{r.next(), r.next(), r.next(), 255}
+		for y := y0; y < min(y1, h); y++ {
+			for x := x0; x < min(x1, w); x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	return img
+}
+
+var images = map[string]image.Image{
+	"gradient-h-97x64": rgb(97, 64, func(x, y int) color.RGBA {
+		return color.RGBA{uint8(x * 255 / 96), 80, uint8(255 - x*255/96), 255}
+	}),
+	"gradient-v-64x130": gray(64, 130, func(x, y int) uint8 { return uint8(y * 255 / 129) }),
+	"gradient-diag-256x256": rgb(256, 256, func(x, y int) color.RGBA {
+		return color.RGBA{uint8(x), uint8(y), uint8((x + y) / 2), 255}
+	}),
+	"checker-8-128x128": gray(128, 128, func(x, y int) uint8 { return uint8(255 * ((x/8 + y/8) % 2)) }),
+	"checker-3-99x77": rgb(99, 77, func(x, y int) color.RGBA {
+		if (x/3+y/3)%2 == 0 {
+			return color.RGBA{200, 30, 30, 255}
+		}
+		return color.RGBA{20, 60, 220, 255}
+	}),
+	"stripes-h-200x50": gray(200, 50, func(x, y int) uint8 { return uint8(255 * (y / 5 % 2)) }),
+	"stripes-v-50x200": gray(50, 200, func(x, y int) uint8 { return uint8(255 * (x / 5 % 2)) }),
+	"disc-160x160": gray(160, 160, func(x, y int) uint8 {
+		if math.Hypot(float64(x)-70, float64(y)-90) < 45 {
+			return 230
+		}
+		return 25
+	}),
+	"rings-300x200": rgb(300, 200, func(x, y int) color.RGBA {
+		v := clamp(127.5 + 127.5*math.Sin(math.Hypot(float64(x)-110, float64(y)-80)/6))
+		return color.RGBA{v, 255 - v, 128, 255}
+	}),
+	"waves-800x600": gray(800, 600, func(x, y int) uint8 {
+		fx, fy := float64(x), float64(y)
+		return clamp(128 + 60*math.Sin(fx/37) + 50*math.Cos(fy/23) + 15*math.Sin((fx+fy)/9))
+	}),
+	"quadrants-120x120": rgb(120, 120, func(x, y int) color.RGBA {
+		switch {
+		case x < 60 && y < 60:
+			return color.RGBA{230, 40, 40, 255}
+		case y < 60:
+			return color.RGBA{40, 200, 60, 255}
+		case x < 60:
+			return color.RGBA{30, 60, 210, 255}
+		}
+		return color.RGBA{240, 220, 40, 255}
+	}),
+	"flat-gray-64x64":    gray(64, 64, func(x, y int) uint8 { return 128 }),
+	"flat-color-50x50":   rgb(50, 50, func(x, y int) color.RGBA { return color.RGBA{90, 140, 200, 255} }),
+	"noise-gray-64x64":   noise(64, 64, 1, false),
+	"noise-rgb-128x96":   noise(128, 96, 2, true),
+	"noise-rgb-7x5":      noise(7, 5, 3, true),
+	"blobs-320x240":      blobs(320, 240, 12, 4),
+	"blobs-640x427":      blobs(640, 427, 20, 5),
+	"rectangles-240x180": rectangles(240, 180, 30, 6),
+	"rectangles-513x257": rectangles(513, 257, 60, 7),
+}
+
+func main() {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	for name, img := range images {
+		f, err := os.Create(filepath.Join(dir, name+".png"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Printf("wrote %d images to %s\n", len(images), dir)
+}
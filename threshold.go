@@ -8,10 +8,10 @@ import (
 
 // thresholdHash builds a binary hash by setting a bit for every pixel
 // whose intensity exceeds the given threshold. Used by Average and Median.
-func thresholdHash(img *image.Gray, threshold uint) (hashtype.Binary, error) {
+func thresholdHash(dst hashtype.Hash, img *image.Gray, threshold uint) (hashtype.Binary, error) {
 	bnds := img.Bounds()
 	bits := uint(bnds.Dx() * bnds.Dy())
-	hash := hashtype.NewBinary(bits)
+	hash := binaryInto(dst, bits)
 	var c uint
 	for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
 		for x := bnds.Min.X; x < bnds.Max.X; x++ {
@@ -0,0 +1,142 @@
+package video
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+// Alignment describes how two frame hash sequences line up.
+type Alignment struct {
+	// Offset is the time to add to a timestamp in the first video to get
+	// the matching timestamp in the second.
+	Offset time.Duration
+	// Start is the timestamp in the first video at which the shared
+	// segment starts.
+	Start time.Duration
+	// Overlap is the length of the shared segment, from the first to the
+	// last matching frame of the first video.
+	Overlap time.Duration
+	// Matches is the number of frames of the first video that match a frame
+	// of the second at Offset.
+	Matches int
+}
+
+// AlignOption configures Align.
+type AlignOption interface{ applyAlign(*alignConfig) }
+
+type alignConfig struct {
+	tolerance time.Duration
+}
+
+type toleranceOption time.Duration
+
+func (o toleranceOption) applyAlign(c *alignConfig) { c.tolerance = time.Duration(o) }
+
+// WithTolerance sets how far apart the offsets of two frame matches may be
+// while still supporting the same alignment. It defaults to one second and
+// should be at least the sampling interval.
+func WithTolerance(d time.Duration) AlignOption { return toleranceOption(d) }
+
+// Align finds the time offset at which the most frames of a match frames
+// of b. Frames match when c reports a distance of at most maxDist. Every
+// pair of frames is compared, so the cost grows with the product of the
+// sequence lengths.
+//
+// Each matching pair votes for the offset between its timestamps. The
+// offsets supported by the most distinct frames of a within the tolerance
+// win, and the median of those offsets is returned. ErrNoAlignment is
+// returned when no frames match.
+func Align(a, b []FrameHash, c imghash.Comparer, maxDist similarity.Distance, opts ...AlignOption) (Alignment, error) {
+	cfg := alignConfig{tolerance: time.Second}
+	for _, o := range opts {
+		o.applyAlign(&cfg)
+	}
+	switch {
+	case c == nil:
+		return Alignment{}, ErrNilHasher
+	case maxDist < 0:
+		return Alignment{}, ErrInvalidThreshold
+	case cfg.tolerance < 0:
+		return Alignment{}, ErrInvalidTolerance
+	}
+
+	var votes []vote
+	for i, fa := range a {
+		for _, fb := range b {
+			d, err := c.Compare(fa.Hash, fb.Hash)
+			if err != nil {
+				return Alignment{}, err
+			}
+			if d <= maxDist {
+				votes = append(votes, vote{fb.Time - fa.Time, i})
+			}
+		}
+	}
+	if len(votes) == 0 {
+		return Alignment{}, ErrNoAlignment
+	}
+	slices.SortFunc(votes, func(x, y vote) int {
+		return cmp.Or(cmp.Compare(x.offset, y.offset), cmp.Compare(x.frame, y.frame))
+	})
+
+	// Slide a window of the tolerance's width over the sorted offsets and
+	// keep the one supported by the most distinct frames of a.
+	counts := make(map[int]int)
+	bestLo, bestHi, best := 0, 0, 0
+	lo := 0
+	for hi, v := range votes {
+		counts[v.frame]++
+		for votes[hi].offset-votes[lo].offset > cfg.tolerance {
+			f := votes[lo].frame
+			if counts[f]--; counts[f] == 0 {
+				delete(counts, f)
+			}
+			lo++
+		}
+		n := len(counts)
+		if n > best || (n == best && absDuration(medianOffset(votes[lo:hi+1])) < absDuration(medianOffset(votes[bestLo:bestHi+1]))) {
+			bestLo, bestHi, best = lo, hi, n
+		}
+	}
+
+	window := votes[bestLo : bestHi+1]
+	al := Alignment{
+		Offset:  medianOffset(window),
+		Matches: best,
+	}
+	first, last := time.Duration(math.MaxInt64), time.Duration(math.MinInt64)
+	for _, v := range window {
+		t := a[v.frame].Time
+		first, last = min(first, t), max(last, t)
+	}
+	al.Start, al.Overlap = first, last-first
+	return al, nil
+}
+
+// vote is a pair of matching frames: the offset between their timestamps
+// and the index of the frame in the first sequence.
+type vote struct {
+	offset time.Duration
+	frame  int
+}
+
+// medianOffset returns the median offset of votes sorted by offset.
+func medianOffset(votes []vote) time.Duration {
+	m := len(votes) / 2
+	if len(votes)%2 == 1 {
+		return votes[m].offset
+	}
+	return votes[m-1].offset + (votes[m].offset-votes[m-1].offset)/2
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,125 @@
+package video_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/video"
+)
+
+func TestAlign(t *testing.T) {
+	h, err := video.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := h.Hash(clip(t, 1, 2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b shows two other shots, then the whole of a, then another shot.
+	b, err := h.Hash(clip(t, 7, 8, 1, 2, 3, 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// c shares only the last shot of a.
+	c, err := h.Hash(clip(t, 3, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := h.Hash(clip(t, 4, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		a, b *video.Signature
+		want video.Alignment
+	}{
+		{"identical", a, a, video.Alignment{Offset: 0, Start: 0, Overlap: 8 * time.Second, Matches: 9}},
+		{"contained", a, b, video.Alignment{Offset: 6 * time.Second, Start: 0, Overlap: 8 * time.Second, Matches: 9}},
+		{"containing", b, a, video.Alignment{Offset: -6 * time.Second, Start: 6 * time.Second, Overlap: 8 * time.Second, Matches: 9}},
+		{"partial", a, c, video.Alignment{Offset: -6 * time.Second, Start: 6 * time.Second, Overlap: 2 * time.Second, Matches: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.Align(tt.a, tt.b, 32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := h.Align(a, d, 32); !errors.Is(err, video.ErrNoAlignment) {
+		t.Errorf("unrelated: got %v, want %v", err, video.ErrNoAlignment)
+	}
+}
+
+func TestAlign_tolerance(t *testing.T) {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := video.New(video.WithHasher(pdq))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := h.Hash(clip(t, 1, 2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Resample b at times between the samples of a.
+	b := &video.Signature{}
+	for i, f := range a.Frames {
+		f.Time += 400 * time.Millisecond
+		if i%2 == 1 {
+			f.Time += 200 * time.Millisecond
+		}
+		b.Frames = append(b.Frames, f)
+	}
+
+	got, err := video.Align(a.Frames, b.Frames, pdq, 32, video.WithTolerance(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Matches != 5 {
+		t.Errorf("tolerance 100ms: got %d matches, want 5", got.Matches)
+	}
+	got, err = video.Align(a.Frames, b.Frames, pdq, 32, video.WithTolerance(300*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Matches != 9 || got.Offset < 400*time.Millisecond || got.Offset > 600*time.Millisecond {
+		t.Errorf("tolerance 300ms: got %+v, want 9 matches between 400ms and 600ms", got)
+	}
+}
+
+func TestAlign_validation(t *testing.T) {
+	pdq, err := imghash.NewPDQ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		c       imghash.Comparer
+		maxDist imghash.Distance
+		opts    []video.AlignOption
+		err     error
+	}{
+		{"nil comparer", nil, 0, nil, video.ErrNilHasher},
+		{"negative distance", pdq, -1, nil, video.ErrInvalidThreshold},
+		{"negative tolerance", pdq, 0, []video.AlignOption{video.WithTolerance(-time.Second)}, video.ErrInvalidTolerance},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := video.Align(nil, nil, tt.c, tt.maxDist, tt.opts...); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package video_test
+
+import (
+	"fmt"
+	"image"
+	"slices"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/video"
+)
+
+// shots returns the frames of a video showing each image for two seconds
+// at 10 frames per second.
+func shots(paths ...string) []image.Image {
+	var frames []image.Image
+	for _, p := range paths {
+		img, err := imghash.OpenImage(p)
+		if err != nil {
+			panic(err)
+		}
+		for range 20 {
+			frames = append(frames, img)
+		}
+	}
+	return frames
+}
+
+func Example() {
+	h, err := video.New()
+	if err != nil {
+		panic(err)
+	}
+	hash := func(images []image.Image) *video.Signature {
+		frames, err := video.Images(slices.Values(images), 10)
+		if err != nil {
+			panic(err)
+		}
+		sig, err := h.Hash(frames)
+		if err != nil {
+			panic(err)
+		}
+		return sig
+	}
+
+	clip := hash(shots("../assets/lena.jpg", "../assets/cat.jpg"))
+	full := hash(shots("../assets/baboon.jpg", "../assets/lena.jpg", "../assets/cat.jpg", "../assets/tulips.jpg"))
+
+	al, err := h.Align(clip, full, 32)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%d frames, clip starts at %v in the full video, %v shared\n", len(clip.Frames), al.Offset, al.Overlap)
+	// Output: 4 frames, clip starts at 2s in the full video, 3s shared
+}
@@ -0,0 +1,223 @@
+package video
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+)
+
+// Temporal is a temporal signature of a video in the spirit of TMK+PDQF
+// (Poullot et al., "Temporal Matching Kernel with Explicit Feature Maps",
+// ACM MM 2015, as used by Meta's TMK+PDQF).
+//
+// Every sampled frame hash is turned into a unit feature vector: the bits
+// of a Binary hash map to -1 and +1, other hashes are centred on their mean.
+// The signature holds the mean feature, a first-level descriptor that can
+// be indexed on its own, and the features summed against the cosine and
+// sine of every harmonic of every period, which CompareTemporal uses to
+// score the videos at any time offset without comparing frames pairwise.
+type Temporal struct {
+	// Periods are the periods of the Fourier harmonics.
+	Periods []time.Duration
+	// Start and End are the timestamps of the first and last sampled frames.
+	Start, End time.Duration
+	// Mean is the average frame feature.
+	Mean hashtype.Float64
+	// Cos[p][k] and Sin[p][k] are the average frame features weighted by
+	// the cosine and sine of harmonic k+1 of Periods[p] at the frame times.
+	Cos, Sin [][]hashtype.Float64
+}
+
+// TemporalMatch is the result of comparing two temporal signatures.
+type TemporalMatch struct {
+	// Level1 is the cosine similarity of the mean frame features, from -1
+	// to 1. It ignores frame order and is cheap to compute.
+	Level1 float64
+	// Level2 is the normalised temporal match score at Offset, from -1 to
+	// 1. It is high only when the frames also match in order and timing.
+	Level2 float64
+	// Offset is the time to add to a timestamp in the first video to get
+	// the matching timestamp in the second.
+	Offset time.Duration
+}
+
+func newTemporal(frames []FrameHash, periods []time.Duration, harmonics int) (Temporal, error) {
+	feats := make([][]float64, len(frames))
+	for i, f := range frames {
+		feats[i] = feature(f.Hash)
+	}
+	dim := len(feats[0])
+	n := float64(len(frames))
+	t := Temporal{
+		Periods: slices.Clone(periods),
+		Start:   frames[0].Time,
+		End:     frames[len(frames)-1].Time,
+		Mean:    make(hashtype.Float64, dim),
+		Cos:     make([][]hashtype.Float64, len(periods)),
+		Sin:     make([][]hashtype.Float64, len(periods)),
+	}
+	for _, f := range feats {
+		if len(f) != dim {
+			return Temporal{}, imghash.ErrHashLengthMismatch
+		}
+		for d, v := range f {
+			t.Mean[d] += v / n
+		}
+	}
+	for p, period := range periods {
+		t.Cos[p] = make([]hashtype.Float64, harmonics)
+		t.Sin[p] = make([]hashtype.Float64, harmonics)
+		for k := range harmonics {
+			c := make(hashtype.Float64, dim)
+			s := make(hashtype.Float64, dim)
+			w := angularFrequency(period, k)
+			for i, f := range feats {
+				sin, cos := math.Sincos(w * frames[i].Time.Seconds())
+				for d, v := range f {
+					c[d] += v * cos / n
+					s[d] += v * sin / n
+				}
+			}
+			t.Cos[p][k], t.Sin[p][k] = c, s
+		}
+	}
+	return t, nil
+}
+
+// angularFrequency returns the angular frequency, in radians per second,
+// of harmonic k+1 of period.
+func angularFrequency(period time.Duration, k int) float64 {
+	return 2 * math.Pi * float64(k+1) / period.Seconds()
+}
+
+// feature converts a frame hash into a unit feature vector.
+func feature(h hashtype.Hash) []float64 {
+	var f []float64
+	if b, ok := h.(hashtype.Binary); ok {
+		f = make([]float64, 8*len(b))
+		for i := range f {
+			f[i] = float64(int(b[i/8]>>(i%8)&1)*2 - 1)
+		}
+	} else {
+		f = make([]float64, h.Len())
+		var mean float64
+		for i := range f {
+			f[i] = h.ValueAt(i)
+			mean += f[i]
+		}
+		mean /= float64(len(f))
+		for i := range f {
+			f[i] -= mean
+		}
+	}
+	if n := norm(f); n > 0 {
+		for i := range f {
+			f[i] /= n
+		}
+	}
+	return f
+}
+
+func dot(a, b []float64) float64 {
+	var s float64
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func norm(a []float64) float64 {
+	return math.Sqrt(dot(a, a))
+}
+
+// CompareTemporal scores two temporal signatures. The second level score
+// is maximised over every offset at which the videos overlap, so it also
+// finds where a clip occurs in a longer video. Signatures must be computed
+// with the same periods, harmonics and frame hasher.
+func CompareTemporal(a, b Temporal) (TemporalMatch, error) {
+	if !a.compatible(b) {
+		return TemporalMatch{}, ErrIncompatibleSignature
+	}
+	var m TemporalMatch
+	if na, nb := norm(a.Mean), norm(b.Mean); na > 0 && nb > 0 {
+		m.Level1 = dot(a.Mean, b.Mean) / (na * nb)
+	}
+
+	// The match kernel sums cos(w*(tb-ta-offset)) over all frame pairs,
+	// which expands into per-harmonic dot products of the signatures.
+	type harmonic struct{ w, cc, cs float64 }
+	var hs []harmonic
+	var selfA, selfB, minPeriod float64
+	for p, period := range a.Periods {
+		if s := period.Seconds(); minPeriod == 0 || s < minPeriod {
+			minPeriod = s
+		}
+		for k := range a.Cos[p] {
+			ca, sa := a.Cos[p][k], a.Sin[p][k]
+			cb, sb := b.Cos[p][k], b.Sin[p][k]
+			hs = append(hs, harmonic{
+				w:  angularFrequency(period, k),
+				cc: dot(ca, cb) + dot(sa, sb),
+				cs: dot(ca, sb) - dot(sa, cb),
+			})
+			selfA += dot(ca, ca) + dot(sa, sa)
+			selfB += dot(cb, cb) + dot(sb, sb)
+		}
+	}
+	if selfA == 0 || selfB == 0 {
+		return m, nil
+	}
+	scale := 1 / math.Sqrt(selfA*selfB)
+	score := func(off float64) float64 {
+		var s float64
+		for _, h := range hs {
+			sin, cos := math.Sincos(h.w * off)
+			s += h.cc*cos + h.cs*sin
+		}
+		return s * scale
+	}
+
+	// Scan the offsets at which the videos overlap on a grid of an eighth
+	// of the shortest harmonic wavelength, then refine around the best.
+	lo := (b.Start - a.End).Seconds()
+	hi := (b.End - a.Start).Seconds()
+	step := minPeriod / float64(len(a.Cos[0])) / 8
+	offsets := []float64{lo, hi}
+	for i := math.Ceil(lo / step); i*step < hi; i++ {
+		offsets = append(offsets, i*step)
+	}
+	best, bestScore := lo, math.Inf(-1)
+	for _, o := range offsets {
+		if s := score(o); s > bestScore || (s == bestScore && math.Abs(o) < math.Abs(best)) {
+			best, bestScore = o, s
+		}
+	}
+	for range 3 {
+		step /= 8
+		center := best
+		for i := -8; i <= 8; i++ {
+			o := min(max(center+float64(i)*step, lo), hi)
+			if s := score(o); s > bestScore {
+				best, bestScore = o, s
+			}
+		}
+	}
+	m.Level2 = bestScore
+	m.Offset = time.Duration(math.Round(best * float64(time.Second)))
+	return m, nil
+}
+
+func (t Temporal) compatible(o Temporal) bool {
+	if !slices.Equal(t.Periods, o.Periods) || len(t.Mean) != len(o.Mean) || len(t.Cos) != len(o.Cos) {
+		return false
+	}
+	for p := range t.Cos {
+		if len(t.Cos[p]) != len(o.Cos[p]) {
+			return false
+		}
+	}
+	return len(t.Periods) > 0 && len(t.Cos[0]) > 0
+}
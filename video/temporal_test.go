@@ -0,0 +1,102 @@
+package video_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/video"
+)
+
+func TestCompareTemporal(t *testing.T) {
+	h, err := video.New(video.WithInterval(500 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := func(scenes ...uint32) video.Temporal {
+		sig, err := h.Hash(clip(t, scenes...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig.Temporal
+	}
+	a := hash(1, 2, 3)
+	b := hash(7, 8, 1, 2, 3, 9)
+	reordered := hash(3, 1, 2)
+	unrelated := hash(4, 5, 6)
+
+	self, err := video.CompareTemporal(a, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(self.Level1-1) > 1e-9 || math.Abs(self.Level2-1) > 1e-9 || self.Offset != 0 {
+		t.Errorf("self: got %+v, want scores 1 at offset 0", self)
+	}
+
+	contained, err := video.CompareTemporal(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := contained.Offset - 6*time.Second; d < -500*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("contained: got offset %v, want 6s", contained.Offset)
+	}
+
+	shuffled, err := video.CompareTemporal(a, reordered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(shuffled.Level1-1) > 1e-9 {
+		t.Errorf("reordered: got level 1 %v, want 1", shuffled.Level1)
+	}
+	if shuffled.Level2 >= self.Level2-0.1 {
+		t.Errorf("reordered: got level 2 %v, want well below %v", shuffled.Level2, self.Level2)
+	}
+
+	other, err := video.CompareTemporal(a, unrelated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Level1 >= contained.Level1 || other.Level2 >= contained.Level2 {
+		t.Errorf("unrelated: got %+v, want scores below %+v", other, contained)
+	}
+}
+
+func TestCompareTemporal_incompatible(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts []video.Option
+	}{
+		{"periods", []video.Option{video.WithPeriods(time.Minute)}},
+		{"harmonics", []video.Option{video.WithHarmonics(4)}},
+		{"hasher", []video.Option{video.WithHasher(avg)}},
+	}
+	base, err := video.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := base.Hash(clip(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := video.New(tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := h.Hash(clip(t, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := video.CompareTemporal(want.Temporal, sig.Temporal); !errors.Is(err, video.ErrIncompatibleSignature) {
+				t.Errorf("got %v, want %v", err, video.ErrIncompatibleSignature)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+// Package video computes perceptual hashes of videos.
+//
+// A video is given as a sequence of decoded frames, so any decoder can be
+// plugged in. Hasher samples keyframes at a fixed interval, on scene
+// changes, or both, hashes them with an image Hasher (PDQ by default) and
+// returns a Signature holding:
+//
+//   - the per-frame hash sequence, which Align lines up against another
+//     video to find the offset and length of a shared segment, and
+//   - a compact temporal signature in the spirit of TMK+PDQF (Temporal
+//     Match Kernel over PDQ frame features), which CompareTemporal scores
+//     without comparing frames pairwise.
+package video
+
+import (
+	"errors"
+	"image"
+	"iter"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/hashtype"
+	"github.com/ajdnik/imghash/v2/similarity"
+)
+
+var (
+	// ErrNilHasher is returned when a nil frame or scene hasher is given.
+	ErrNilHasher = errors.New("video: hasher must not be nil")
+	// ErrInvalidInterval is returned when the sampling interval is negative.
+	ErrInvalidInterval = errors.New("video: interval must not be negative")
+	// ErrInvalidThreshold is returned when a distance threshold is negative.
+	ErrInvalidThreshold = errors.New("video: threshold must not be negative")
+	// ErrInvalidPeriods is returned when no temporal periods are given or
+	// one of them is not positive.
+	ErrInvalidPeriods = errors.New("video: periods must be greater than zero")
+	// ErrInvalidHarmonics is returned when the harmonic count is not positive.
+	ErrInvalidHarmonics = errors.New("video: harmonics must be greater than zero")
+	// ErrInvalidFrameRate is returned when a frame rate is not positive.
+	ErrInvalidFrameRate = errors.New("video: frame rate must be greater than zero")
+	// ErrInvalidTolerance is returned when the alignment tolerance is negative.
+	ErrInvalidTolerance = errors.New("video: tolerance must not be negative")
+	// ErrFrameOrder is returned when frame timestamps decrease.
+	ErrFrameOrder = errors.New("video: frame timestamps must not decrease")
+	// ErrNoFrames is returned when hashing a video without frames.
+	ErrNoFrames = errors.New("video: no frames")
+	// ErrIncompatibleSignature is returned when comparing temporal
+	// signatures computed with different periods, harmonics or hashers.
+	ErrIncompatibleSignature = errors.New("video: signatures are not comparable")
+	// ErrNoAlignment is returned when no frames of two videos match.
+	ErrNoAlignment = errors.New("video: no matching frames")
+)
+
+// Frame is one decoded video frame.
+type Frame struct {
+	Image image.Image
+	// Time is the presentation timestamp of the frame.
+	Time time.Duration
+}
+
+// Images returns the frames of a video decoded at a constant frame rate,
+// timestamped from zero.
+func Images(images iter.Seq[image.Image], fps float64) (iter.Seq[Frame], error) {
+	if !(fps > 0) {
+		return nil, ErrInvalidFrameRate
+	}
+	return func(yield func(Frame) bool) {
+		i := 0
+		for img := range images {
+			t := time.Duration(float64(i) * float64(time.Second) / fps)
+			if !yield(Frame{Image: img, Time: t}) {
+				return
+			}
+			i++
+		}
+	}, nil
+}
+
+// FrameHash is the hash of one sampled frame.
+type FrameHash struct {
+	// Index is the position of the frame in the input sequence.
+	Index int
+	// Time is the presentation timestamp of the frame.
+	Time time.Duration
+	Hash hashtype.Hash
+}
+
+// Signature is the perceptual signature of a video.
+type Signature struct {
+	// Frames holds the hashes of the sampled frames in presentation order.
+	Frames []FrameHash
+	// Temporal summarises the frame hashes over time.
+	Temporal Temporal
+}
+
+// Option configures a Hasher.
+type Option interface{ apply(*config) }
+
+type config struct {
+	hasher    imghash.HasherComparer
+	hasherSet bool
+	interval  time.Duration
+	scene     imghash.HasherComparer
+	sceneSet  bool
+	threshold similarity.Distance
+	periods   []time.Duration
+	harmonics int
+}
+
+type hasherOption struct{ h imghash.HasherComparer }
+
+func (o hasherOption) apply(c *config) { c.hasher, c.hasherSet = o.h, true }
+
+// WithHasher sets the hasher used for sampled frames. It defaults to PDQ.
+func WithHasher(h imghash.HasherComparer) Option { return hasherOption{h} }
+
+type intervalOption time.Duration
+
+func (o intervalOption) apply(c *config) { c.interval = time.Duration(o) }
+
+// WithInterval samples a frame whenever d has passed since the last
+// sampled frame. It defaults to one second. An interval of zero samples
+// every frame, or only scene changes when WithSceneChange is set.
+func WithInterval(d time.Duration) Option { return intervalOption(d) }
+
+type sceneOption struct {
+	h         imghash.HasherComparer
+	threshold similarity.Distance
+}
+
+func (o sceneOption) apply(c *config) {
+	c.scene, c.threshold, c.sceneSet = o.h, o.threshold, true
+}
+
+// WithSceneChange also samples a frame when its distance under h from the
+// last sampled frame exceeds threshold. A nil h uses the frame hasher.
+// Frames are then hashed with h as well, so a cheap hasher such as Average
+// keeps detection fast.
+func WithSceneChange(h imghash.HasherComparer, threshold similarity.Distance) Option {
+	return sceneOption{h, threshold}
+}
+
+type periodsOption []time.Duration
+
+func (o periodsOption) apply(c *config) { c.periods = o }
+
+// WithPeriods sets the periods of the temporal signature. They default to
+// those of TMK+PDQF, 2731 and 4391 frames at 15 frames per second.
+func WithPeriods(periods ...time.Duration) Option {
+	return periodsOption(append([]time.Duration(nil), periods...))
+}
+
+type harmonicsOption int
+
+func (o harmonicsOption) apply(c *config) { c.harmonics = int(o) }
+
+// WithHarmonics sets the number of Fourier harmonics per period in the
+// temporal signature. It defaults to 32.
+func WithHarmonics(k int) Option { return harmonicsOption(k) }
+
+// Default temporal signature parameters, from TMK+PDQF.
+var defaultPeriods = []time.Duration{2731 * time.Second / 15, 4391 * time.Second / 15}
+
+const defaultHarmonics = 32
+
+// Hasher computes video signatures.
+type Hasher struct {
+	hasher    imghash.HasherComparer
+	interval  time.Duration
+	scene     imghash.HasherComparer
+	threshold similarity.Distance
+	// sceneIsFrame is set when scene changes are detected with the frame
+	// hasher, so the scene hash of a sampled frame is its frame hash.
+	sceneIsFrame bool
+	periods      []time.Duration
+	harmonics    int
+}
+
+// New creates a video Hasher with the given options.
+func New(opts ...Option) (Hasher, error) {
+	cfg := config{
+		interval:  time.Second,
+		periods:   defaultPeriods,
+		harmonics: defaultHarmonics,
+	}
+	for _, o := range opts {
+		o.apply(&cfg)
+	}
+	if cfg.hasherSet && cfg.hasher == nil {
+		return Hasher{}, ErrNilHasher
+	}
+	if cfg.hasher == nil {
+		pdq, err := imghash.NewPDQ()
+		if err != nil {
+			return Hasher{}, err
+		}
+		cfg.hasher = pdq
+	}
+	sceneIsFrame := cfg.sceneSet && cfg.scene == nil
+	if sceneIsFrame {
+		cfg.scene = cfg.hasher
+	}
+	switch {
+	case cfg.interval < 0:
+		return Hasher{}, ErrInvalidInterval
+	case cfg.threshold < 0:
+		return Hasher{}, ErrInvalidThreshold
+	case cfg.harmonics <= 0:
+		return Hasher{}, ErrInvalidHarmonics
+	case len(cfg.periods) == 0:
+		return Hasher{}, ErrInvalidPeriods
+	}
+	for _, p := range cfg.periods {
+		if p <= 0 {
+			return Hasher{}, ErrInvalidPeriods
+		}
+	}
+	return Hasher{
+		hasher:       cfg.hasher,
+		interval:     cfg.interval,
+		scene:        cfg.scene,
+		threshold:    cfg.threshold,
+		sceneIsFrame: sceneIsFrame,
+		periods:      cfg.periods,
+		harmonics:    cfg.harmonics,
+	}, nil
+}
+
+// Hash samples and hashes the frames of a video, which must be in
+// presentation order. The first frame is always sampled.
+func (h Hasher) Hash(frames iter.Seq[Frame]) (*Signature, error) {
+	sig := &Signature{}
+	var last Frame
+	var lastScene hashtype.Hash
+	i := -1
+	for f := range frames {
+		i++
+		if i > 0 && f.Time < last.Time {
+			return nil, ErrFrameOrder
+		}
+		prep := imghash.Prepare(f.Image)
+		take := i == 0 || h.due(f.Time, sig.Frames[len(sig.Frames)-1].Time)
+		var sceneHash hashtype.Hash
+		if h.scene != nil {
+			var err error
+			if sceneHash, err = imghash.CalculatePrepared(h.scene, prep); err != nil {
+				return nil, err
+			}
+			if !take {
+				d, err := h.scene.Compare(lastScene, sceneHash)
+				if err != nil {
+					return nil, err
+				}
+				take = d > h.threshold
+			}
+		}
+		last = f
+		if !take {
+			continue
+		}
+		hash := sceneHash
+		if !h.sceneIsFrame {
+			var err error
+			if hash, err = imghash.CalculatePrepared(h.hasher, prep); err != nil {
+				return nil, err
+			}
+		}
+		lastScene = sceneHash
+		sig.Frames = append(sig.Frames, FrameHash{Index: i, Time: f.Time, Hash: hash})
+	}
+	if len(sig.Frames) == 0 {
+		return nil, ErrNoFrames
+	}
+	var err error
+	if sig.Temporal, err = newTemporal(sig.Frames, h.periods, h.harmonics); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// due reports whether a frame at t is sampled by the interval, given the
+// time of the last sampled frame.
+func (h Hasher) due(t, last time.Duration) bool {
+	if h.interval == 0 {
+		return h.scene == nil
+	}
+	return t-last >= h.interval
+}
+
+// Align aligns the frame hashes of two signatures computed by h, comparing
+// frames with the frame hasher; see Align.
+func (h Hasher) Align(a, b *Signature, maxDist similarity.Distance, opts ...AlignOption) (Alignment, error) {
+	return Align(a.Frames, b.Frames, h.hasher, maxDist, opts...)
+}
@@ -0,0 +1,179 @@
+package video_test
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"iter"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ajdnik/imghash/v2"
+	"github.com/ajdnik/imghash/v2/video"
+)
+
+const testFPS = 10
+
+// scene draws frame i of a synthetic shot: a pattern of rectangles seeded
+// by the scene number that drifts slowly from frame to frame.
+func scene(seed uint32, i int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 96, 64))
+	r := seed*2654435761 + 1
+	next := func() int {
+		r = r*1664525 + 1013904223
+		return int(r >> 24)
+	}
+	bg := color.RGBA{uint8(next()), uint8(next()), uint8(next()), 255}
+	for p := 0; p < len(img.Pix); p += 4 {
+		img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = bg.R, bg.G, bg.B, 255
+	}
+	for range 12 {
+		x0, y0 := next()*96/256+i/10, next()*64/256
+		w, h := 6+next()/8, 6+next()/12
+		c := color.RGBA{uint8(next()), uint8(next()), uint8(next()), 255}
+		for y := y0; y < min(y0+h, 64); y++ {
+			for x := x0; x < min(x0+w, 96); x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	return img
+}
+
+// clip returns the frames of a video made of three-second shots of the
+// given scenes at testFPS, timestamped from zero.
+func clip(t *testing.T, scenes ...uint32) iter.Seq[video.Frame] {
+	t.Helper()
+	var imgs []image.Image
+	for _, s := range scenes {
+		for i := range 3 * testFPS {
+			imgs = append(imgs, scene(s, i))
+		}
+	}
+	frames, err := video.Images(slices.Values(imgs), testFPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frames
+}
+
+func TestNew_validation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []video.Option
+		err  error
+	}{
+		{"defaults", nil, nil},
+		{"nil hasher", []video.Option{video.WithHasher(nil)}, video.ErrNilHasher},
+		{"negative interval", []video.Option{video.WithInterval(-time.Second)}, video.ErrInvalidInterval},
+		{"zero interval", []video.Option{video.WithInterval(0)}, nil},
+		{"negative threshold", []video.Option{video.WithSceneChange(nil, -1)}, video.ErrInvalidThreshold},
+		{"no periods", []video.Option{video.WithPeriods()}, video.ErrInvalidPeriods},
+		{"zero period", []video.Option{video.WithPeriods(time.Minute, 0)}, video.ErrInvalidPeriods},
+		{"zero harmonics", []video.Option{video.WithHarmonics(0)}, video.ErrInvalidHarmonics},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := video.New(tt.opts...); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestImages(t *testing.T) {
+	imgs := slices.Values([]image.Image{scene(1, 0), scene(1, 1), scene(1, 2), scene(1, 3)})
+	frames, err := video.Images(imgs, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []time.Duration
+	for f := range frames {
+		got = append(got, f.Time)
+	}
+	want := []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, fps := range []float64{0, -1} {
+		if _, err := video.Images(imgs, fps); !errors.Is(err, video.ErrInvalidFrameRate) {
+			t.Errorf("fps %v: got %v, want %v", fps, err, video.ErrInvalidFrameRate)
+		}
+	}
+}
+
+func TestHasher_Hash_sampling(t *testing.T) {
+	avg, err := imghash.NewAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts []video.Option
+		want []int
+	}{
+		{"default interval", nil, []int{0, 10, 20, 30, 40, 50, 60, 70, 80}},
+		{"interval", []video.Option{video.WithInterval(1500 * time.Millisecond)}, []int{0, 15, 30, 45, 60, 75}},
+		{"scene changes", []video.Option{video.WithInterval(0), video.WithSceneChange(avg, 16)}, []int{0, 30, 60}},
+		{"scene changes with frame hasher", []video.Option{video.WithInterval(0), video.WithSceneChange(nil, 64)}, []int{0, 30, 60}},
+		{"interval and scene changes", []video.Option{video.WithInterval(2 * time.Second), video.WithSceneChange(avg, 16)}, []int{0, 20, 30, 50, 60, 80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := video.New(tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := h.Hash(clip(t, 1, 2, 3))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, f := range sig.Frames {
+				got = append(got, f.Index)
+				if want := time.Duration(f.Index) * time.Second / testFPS; f.Time != want {
+					t.Errorf("frame %d: got time %v, want %v", f.Index, f.Time, want)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got frames %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasher_Hash_everyFrame(t *testing.T) {
+	h, err := video.New(video.WithInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := h.Hash(clip(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig.Frames) != 3*testFPS {
+		t.Errorf("got %d frames, want %d", len(sig.Frames), 3*testFPS)
+	}
+}
+
+func TestHasher_Hash_errors(t *testing.T) {
+	h, err := video.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Hash(slices.Values([]video.Frame(nil))); !errors.Is(err, video.ErrNoFrames) {
+		t.Errorf("no frames: got %v, want %v", err, video.ErrNoFrames)
+	}
+	backwards := slices.Values([]video.Frame{
+		{Image: scene(1, 0), Time: time.Second},
+		{Image: scene(1, 1), Time: 0},
+	})
+	if _, err := h.Hash(backwards); !errors.Is(err, video.ErrFrameOrder) {
+		t.Errorf("decreasing timestamps: got %v, want %v", err, video.ErrFrameOrder)
+	}
+	empty := slices.Values([]video.Frame{{Image: image.NewRGBA(image.Rect(0, 0, 0, 0))}})
+	if _, err := h.Hash(empty); !errors.Is(err, imghash.ErrEmptyImage) {
+		t.Errorf("empty frame: got %v, want %v", err, imghash.ErrEmptyImage)
+	}
+}
@@ -24,7 +24,7 @@ type WHash struct {
 // Without options, sensible defaults are used (8×8 hash, 3 levels, Bilinear).
 func NewWHash(opts ...WHashOption) (WHash, error) {
 	w := WHash{
-		baseConfig: baseConfig{width: 8, height: 8, interp: Bilinear},
+		baseConfig: baseConfig{width: 8, height: 8, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 		level:      3,
 	}
 	for _, o := range opts {
@@ -41,14 +41,32 @@ func NewWHash(opts ...WHashOption) (WHash, error) {
 
 // Calculate returns a perceptual image hash.
 func (wh WHash) Calculate(img image.Image) (hashtype.Hash, error) {
+	return wh.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Binary hash with enough capacity. See IntoHasher.
+func (wh WHash) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return wh.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (wh WHash) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return wh.calculate(nil, prep)
+}
+
+func (wh WHash) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(wh.alphaPolicy).cropBorders(wh.border)
 	// Resize to (width * 2^level) x (height * 2^level) so that after
 	// `level` DWT passes the LL subband is exactly width×height.
 	scale := uint(1) << uint(wh.level)
 	rw := wh.width * scale
 	rh := wh.height * scale
 
-	r := imgproc.Resize(rw, rh, img, wh.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	g, err := prep.ResizedGray(rw, rh, wh.interp)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +75,7 @@ func (wh WHash) Calculate(img image.Image) (hashtype.Hash, error) {
 
 	ll := wh.extractLL(mat)
 	med := wh.median(ll)
-	return wh.computeHash(ll, med)
+	return wh.computeHash(dst, ll, med)
 }
 
 func (wh WHash) extractLL(mat [][]float32) [][]float32 {
@@ -73,8 +91,8 @@ func (wh WHash) median(mat [][]float32) float32 {
 	return imgproc.MedianF32(mat)
 }
 
-func (wh WHash) computeHash(ll [][]float32, median float32) (hashtype.Binary, error) {
-	hash := hashtype.NewBinary(wh.width * wh.height)
+func (wh WHash) computeHash(dst hashtype.Hash, ll [][]float32, median float32) (hashtype.Binary, error) {
+	hash := binaryInto(dst, wh.width*wh.height)
 	var c uint
 	for _, row := range ll {
 		for _, v := range row {
@@ -99,3 +117,9 @@ func (wh WHash) Compare(h1, h2 hashtype.Hash) (similarity.Distance, error) {
 	}
 	return similarity.Hamming(h1, h2)
 }
+
+// ComparesHamming reports whether Compare returns the Hamming distance,
+// which it does unless WithDistance was given. See HammingComparer.
+func (wh WHash) ComparesHamming() bool {
+	return wh.distFunc == nil
+}
@@ -5,7 +5,6 @@ import (
 	"math"
 
 	"github.com/ajdnik/imghash/v2/hashtype"
-	"github.com/ajdnik/imghash/v2/internal/imgproc"
 	"github.com/ajdnik/imghash/v2/similarity"
 )
 
@@ -34,7 +33,7 @@ type Zernike struct {
 // Without options, sensible defaults are used.
 func NewZernike(opts ...ZernikeOption) (Zernike, error) {
 	z := Zernike{
-		baseConfig: baseConfig{width: 64, height: 64, interp: Bilinear},
+		baseConfig: baseConfig{width: 64, height: 64, interp: Bilinear, alphaPolicy: defaultAlphaPolicy},
 		degree:     8,
 	}
 	for _, o := range opts {
@@ -51,12 +50,30 @@ func NewZernike(opts ...ZernikeOption) (Zernike, error) {
 
 // Calculate returns a perceptual image hash.
 func (z Zernike) Calculate(img image.Image) (hashtype.Hash, error) {
-	r := imgproc.Resize(z.width, z.height, img, z.interp.resizeType())
-	g, err := imgproc.Grayscale(r)
+	return z.CalculateInto(nil, img)
+}
+
+// CalculateInto is like Calculate but writes the hash into dst when it is
+// a Float64 hash with enough capacity. See IntoHasher.
+func (z Zernike) CalculateInto(dst hashtype.Hash, img image.Image) (hashtype.Hash, error) {
+	prep := prepareScratch(img)
+	defer prep.release()
+	return z.calculate(dst, prep)
+}
+
+// CalculatePrepared is like Calculate but reuses the preprocessing
+// cached in a Prepared image.
+func (z Zernike) CalculatePrepared(prep *Prepared) (hashtype.Hash, error) {
+	return z.calculate(nil, prep)
+}
+
+func (z Zernike) calculate(dst hashtype.Hash, prep *Prepared) (hashtype.Hash, error) {
+	prep = prep.flatten(z.alphaPolicy).cropBorders(z.border)
+	g, err := prep.ResizedGray(z.width, z.height, z.interp)
 	if err != nil {
 		return nil, err
 	}
-	return z.computeHash(g), nil
+	return z.computeHash(dst, g), nil
 }
 
 func zernikeOrders(maxDegree int) []zernikeOrder {
@@ -98,7 +115,7 @@ func zernikeRadial(n, m int, rho float64, logFact []float64) float64 {
 	return sum
 }
 
-func (z Zernike) computeHash(img *image.Gray) hashtype.Float64 {
+func (z Zernike) computeHash(dst hashtype.Hash, img *image.Gray) hashtype.Float64 {
 	orders := zernikeOrders(z.degree)
 	if len(orders) <= 1 {
 		return hashtype.Float64{}
@@ -110,14 +127,14 @@ func (z Zernike) computeHash(img *image.Gray) hashtype.Float64 {
 	bounds := img.Bounds()
 	w, h := bounds.Dx(), bounds.Dy()
 	if w == 0 || h == 0 {
-		return make(hashtype.Float64, len(orders)-1)
+		return hashInto[hashtype.Float64](dst, len(orders)-1)
 	}
 	scale := w
 	if h < scale {
 		scale = h
 	}
 	if scale == 0 {
-		return make(hashtype.Float64, len(orders)-1)
+		return hashInto[hashtype.Float64](dst, len(orders)-1)
 	}
 	radius := float64(scale) / 2
 	cx := float64(w-1) / 2
@@ -153,7 +170,7 @@ func (z Zernike) computeHash(img *image.Gray) hashtype.Float64 {
 		}
 	}
 
-	descriptor := make(hashtype.Float64, len(orders)-1)
+	descriptor := hashInto[hashtype.Float64](dst, len(orders)-1)
 	dc := math.Hypot(sumRe[0], sumIm[0]) / math.Pi
 	if dc <= zernikeEpsilon {
 		return descriptor